@@ -0,0 +1,84 @@
+package adb
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"net"
+	"strings"
+
+	"DomaphoneS-Next/backend/goadb/wire"
+)
+
+// abbRequest builds the request of the abb services: the arguments are separated by NUL,
+// so they need no quoting and may contain spaces.
+func abbRequest(prefix, service string, args []string) (string, error) {
+	if isBlank(service) {
+		return "", fmt.Errorf("%w: abb service cannot be empty", wire.ErrAssertion)
+	}
+	for i, arg := range args {
+		if strings.ContainsRune(arg, 0) {
+			return "", fmt.Errorf("%w: arg at index %d contains a NUL byte", wire.ErrParse, i)
+		}
+	}
+	return prefix + strings.Join(append([]string{service}, args...), "\x00"), nil
+}
+
+// Abb runs a binder shell command of service through the Android Binder Bridge, like
+// `cmd service args...` but without spawning a shell on the device. It needs FeatureAbb,
+// check DeviceFeatures. The output is framed like shell v2, so stdout, stderr and the exit
+// code are kept apart. A non-zero exitCode isn't an error, err reports transport errors.
+func (c *Device) Abb(ctx context.Context, service string, args ...string) (stdout, stderr []byte, exitCode int, err error) {
+	req, err := abbRequest("abb:", service, args)
+	if err != nil {
+		return nil, nil, 0, wrapClientError(err, c, "Abb")
+	}
+	conn, err := c.openService(ctx, req)
+	if err != nil {
+		return nil, nil, 0, wrapClientError(err, c, "Abb")
+	}
+	defer conn.Close()
+
+	tp := newShellTransport(conn, 0)
+	if err = tp.Send(shellCloseStdin, nil); err != nil {
+		return nil, nil, 0, wrapClientError(contextError(ctx, err), c, "Abb")
+	}
+	var outBuf, errBuf bytes.Buffer
+	for {
+		typ, data, err := tp.Read()
+		if err == io.EOF {
+			return outBuf.Bytes(), errBuf.Bytes(), 0, wrapClientError(&ExitMissingError{}, c, "Abb")
+		}
+		if err != nil {
+			return outBuf.Bytes(), errBuf.Bytes(), 0, wrapClientError(contextError(ctx, err), c, "Abb")
+		}
+		switch typ {
+		case shellStdout:
+			outBuf.Write(data)
+		case shellStderr:
+			errBuf.Write(data)
+		case shellExit:
+			if len(data) > 0 {
+				exitCode = int(data[0])
+			}
+			return outBuf.Bytes(), errBuf.Bytes(), exitCode, nil
+		}
+	}
+}
+
+// AbbExec runs a binder shell command of service like Abb, with a raw stream: what's written
+// to the connection is the stdin of the command, what's read its output, until the command
+// exits. It needs FeatureAbbExec. adb install streams APKs with it.
+// The connection stays bound to ctx: cancelling it closes the connection.
+func (c *Device) AbbExec(ctx context.Context, service string, args ...string) (net.Conn, error) {
+	req, err := abbRequest("abb_exec:", service, args)
+	if err != nil {
+		return nil, wrapClientError(err, c, "AbbExec")
+	}
+	conn, err := c.openService(ctx, req)
+	if err != nil {
+		return nil, wrapClientError(err, c, "AbbExec")
+	}
+	return conn, nil
+}
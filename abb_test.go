@@ -0,0 +1,94 @@
+package adb_test
+
+import (
+	"context"
+	"io"
+	"testing"
+
+	adb "DomaphoneS-Next/backend/goadb"
+	"DomaphoneS-Next/backend/goadb/adbtest"
+	"DomaphoneS-Next/backend/goadb/wire"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func newAbbDevice() *adbtest.Device {
+	dev := adbtest.NewDevice("emulator-5554")
+	dev.Features = append(dev.Features, adb.FeatureAbb, adb.FeatureAbbExec)
+	return dev
+}
+
+func TestAbb(t *testing.T) {
+	ctx := context.Background()
+	dev := newAbbDevice()
+	dev.HandleShell("cmd activity get-config a b", adbtest.Reply("config\n", "warning\n", 0))
+	dev.HandleShell("cmd package path missing", adbtest.Reply("", "not found\n", 1))
+	_, client := newTestClient(t, dev)
+	d := client.Device(adb.AnyDevice())
+
+	// The space is part of the argument, no quoting is involved.
+	stdout, stderr, code, err := d.Abb(ctx, "activity", "get-config", "a b")
+	require.NoError(t, err)
+	assert.Equal(t, "config\n", string(stdout))
+	assert.Equal(t, "warning\n", string(stderr))
+	assert.Zero(t, code)
+
+	_, stderr, code, err = d.Abb(ctx, "package", "path", "missing")
+	require.NoError(t, err)
+	assert.Equal(t, "not found\n", string(stderr))
+	assert.Equal(t, 1, code)
+
+	_, _, _, err = d.Abb(ctx, "")
+	assert.ErrorIs(t, err, wire.ErrAssertion)
+}
+
+func TestAbbExec(t *testing.T) {
+	ctx := context.Background()
+	dev := newAbbDevice()
+	dev.HandleShell("cmd package install -S 4", func(cmd string, stdin io.Reader, stdout, stderr io.Writer) int {
+		data, _ := io.ReadAll(io.LimitReader(stdin, 4))
+		io.WriteString(stdout, "Success: "+string(data)+"\n")
+		return 0
+	})
+	_, client := newTestClient(t, dev)
+
+	conn, err := client.Device(adb.AnyDevice()).AbbExec(ctx, "package", "install", "-S", "4")
+	require.NoError(t, err)
+	defer conn.Close()
+	_, err = conn.Write([]byte("data"))
+	require.NoError(t, err)
+	out, err := io.ReadAll(conn)
+	require.NoError(t, err)
+	assert.Equal(t, "Success: data\n", string(out))
+
+	// Without the feature adbd doesn't know the service.
+	_, client = newTestClient(t, adbtest.NewDevice("emulator-5556"))
+	_, err = client.Device(adb.AnyDevice()).AbbExec(ctx, "package", "list", "packages")
+	assert.ErrorIs(t, err, wire.ErrAdb)
+}
+
+func TestPm_Abb(t *testing.T) {
+	ctx := context.Background()
+	for _, withAbb := range []bool{true, false} {
+		dev := adbtest.NewDevice("emulator-5554")
+		prefix := "pm "
+		if withAbb {
+			dev = newAbbDevice()
+			prefix = "cmd package "
+		}
+		dev.HandleShell(prefix+"list packages -3", adbtest.Reply("package:com.example.a\npackage:com.example.b\n", "", 0))
+		dev.HandleShell(prefix+"clear com.example.a", adbtest.Reply("Success\n", "", 0))
+		dev.HandleShell(prefix+"uninstall com.example.c", adbtest.Reply("Failure [DELETE_FAILED_INTERNAL_ERROR]\n", "", 1))
+		dev.HandleShell(prefix+"install -r /data/local/tmp/app.apk", adbtest.Reply("Success\n", "", 0))
+		_, client := newTestClient(t, dev)
+		d := client.Device(adb.AnyDevice())
+
+		names, err := d.PmListPackages(ctx, true)
+		require.NoError(t, err, "abb %v", withAbb)
+		assert.Equal(t, []string{"com.example.a", "com.example.b"}, names)
+		assert.NoError(t, d.PmClear(ctx, "com.example.a"))
+		assert.EqualError(t, d.PmUninstall(ctx, "com.example.c"), "Failure [DELETE_FAILED_INTERNAL_ERROR]")
+		assert.NoError(t, d.PmInstall(ctx, "/data/local/tmp/app.apk", true, false, false))
+	}
+}
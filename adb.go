@@ -2,6 +2,7 @@ package adb
 
 import (
 	"bytes"
+	"context"
 	"fmt"
 	"strconv"
 	"strings"
@@ -41,13 +42,14 @@ func NewWithConfig(config ServerConfig) (*Adb, error) {
 }
 
 // Dial establishes a connection with the adb server.
-func (c *Adb) Dial() (wire.IConn, error) {
-	return c.server.Dial()
+// Cancelling ctx closes the connection.
+func (c *Adb) Dial(ctx context.Context) (wire.IConn, error) {
+	return dialServer(ctx, c.server)
 }
 
 // Starts the adb server if it’s not running.
-func (c *Adb) StartServer() error {
-	return c.server.Start()
+func (c *Adb) StartServer(ctx context.Context) error {
+	return c.server.Start(ctx)
 }
 
 func (c *Adb) Device(descriptor DeviceDescriptor) *Device {
@@ -60,13 +62,14 @@ func (c *Adb) Device(descriptor DeviceDescriptor) *Device {
 	}
 }
 
-func (c *Adb) NewDeviceWatcher() *DeviceWatcher {
-	return newDeviceWatcher(c.server)
+// NewDeviceWatcher starts watching devices, until ctx is done or Shutdown is called.
+func (c *Adb) NewDeviceWatcher(ctx context.Context) *DeviceWatcher {
+	return newDeviceWatcher(ctx, c.server)
 }
 
 // ServerVersion asks the ADB server for its internal version number.
-func (c *Adb) ServerVersion() (int, error) {
-	resp, err := roundTripSingleResponse(c.server, "host:version")
+func (c *Adb) ServerVersion(ctx context.Context) (int, error) {
+	resp, err := roundTripSingleResponse(ctx, c.server, "host:version")
 	if err != nil {
 		return 0, fmt.Errorf("GetServerVersion: %w", err)
 	}
@@ -78,8 +81,8 @@ func (c *Adb) ServerVersion() (int, error) {
 	return version, nil
 }
 
-func (c *Adb) HostFeatures() (map[string]bool, error) {
-	resp, err := roundTripSingleResponse(c.server, "host:host-features")
+func (c *Adb) HostFeatures(ctx context.Context) (map[string]bool, error) {
+	resp, err := roundTripSingleResponse(ctx, c.server, "host:host-features")
 	if err != nil {
 		return nil, err
 	}
@@ -90,8 +93,8 @@ func (c *Adb) HostFeatures() (map[string]bool, error) {
 // Corresponds to the command:
 //
 //	adb kill-server
-func (c *Adb) KillServer() error {
-	conn, err := c.server.Dial()
+func (c *Adb) KillServer(ctx context.Context) error {
+	conn, err := dialServer(ctx, c.server)
 	if err != nil {
 		return fmt.Errorf("KillServer: %w", err)
 	}
@@ -107,8 +110,8 @@ func (c *Adb) KillServer() error {
 // Corresponds to the command:
 //
 //	adb devices
-func (c *Adb) ListDeviceSerials() ([]string, error) {
-	resp, err := roundTripSingleResponse(c.server, "host:devices")
+func (c *Adb) ListDeviceSerials(ctx context.Context) ([]string, error) {
+	resp, err := roundTripSingleResponse(ctx, c.server, "host:devices")
 	if err != nil {
 		return nil, fmt.Errorf("ListDeviceSerials: %w", err)
 	}
@@ -129,8 +132,8 @@ func (c *Adb) ListDeviceSerials() ([]string, error) {
 // Corresponds to the command:
 //
 //	adb devices -l
-func (c *Adb) ListDevices() ([]*DeviceInfo, error) {
-	resp, err := roundTripSingleResponse(c.server, "host:devices-l")
+func (c *Adb) ListDevices(ctx context.Context) ([]*DeviceInfo, error) {
+	resp, err := roundTripSingleResponse(ctx, c.server, "host:devices-l")
 	if err != nil {
 		return nil, fmt.Errorf("ListDevices: %w", err)
 	}
@@ -146,33 +149,77 @@ func (c *Adb) ListDevices() ([]*DeviceInfo, error) {
 // Corresponds to the command:
 //
 //	adb connect ip:port
-func (c *Adb) Connect(addr string) error {
-	// connect may slow in internet, set 5 second timeout
-	_, err := roundTripSingleResponseTimeout(c.server, "host:connect:"+addr, time.Second*5)
+func (c *Adb) Connect(ctx context.Context, addr string) error {
+	// connect may slow in internet, default to a 5 second timeout
+	_, err := roundTripSingleResponseTimeout(ctx, c.server, "host:connect:"+addr, time.Second*5)
 	if err != nil {
 		return fmt.Errorf("Connect: %w", err)
 	}
 	return nil
 }
 
-func (c *Adb) DisconnectAll() error {
-	_, err := roundTripSingleResponse(c.server, "host:disconnect:")
+// Pair pairs with a device that has wireless debugging enabled, using the six digit
+// code shown in "Pair device with pairing code" (Android 11+).
+// addr is the ip:port of the pairing service, not the one used to connect.
+// Corresponds to the command:
+//
+//	adb pair ip:port code
+func (c *Adb) Pair(ctx context.Context, addr, code string) error {
+	// pairing runs SPAKE2 and TLS over the network, it takes a few seconds
+	resp, err := roundTripSingleResponseTimeout(ctx, c.server, "host:pair:"+code+":"+addr, time.Second*15)
+	if err != nil {
+		return fmt.Errorf("Pair: %w", err)
+	}
+	// The server reports failures with OKAY too, eg. "Failed: Wrong password or connection was dropped."
+	if !bytes.HasPrefix(resp, []byte("Successfully paired")) {
+		return fmt.Errorf("Pair: %w: %s", wire.ErrAdb, resp)
+	}
+	return nil
+}
+
+// MdnsCheck checks whether the mdns discovery of the adb server is available,
+// and returns its description, eg. "mdns daemon version [Openscreen discovery 0.0.0]".
+// Corresponds to the command:
+//
+//	adb mdns check
+func (c *Adb) MdnsCheck(ctx context.Context) (string, error) {
+	resp, err := roundTripSingleResponse(ctx, c.server, "host:mdns:check")
+	if err != nil {
+		return "", fmt.Errorf("MdnsCheck: %w", err)
+	}
+	return strings.TrimSpace(string(resp)), nil
+}
+
+// MdnsServices lists the adb services discovered via mdns.
+// Corresponds to the command:
+//
+//	adb mdns services
+func (c *Adb) MdnsServices(ctx context.Context) ([]MdnsService, error) {
+	resp, err := roundTripSingleResponse(ctx, c.server, "host:mdns:services")
+	if err != nil {
+		return nil, fmt.Errorf("MdnsServices: %w", err)
+	}
+	return parseMdnsServices(resp), nil
+}
+
+func (c *Adb) DisconnectAll(ctx context.Context) error {
+	_, err := roundTripSingleResponse(ctx, c.server, "host:disconnect:")
 	if err != nil {
 		return fmt.Errorf("disconnect: %w", err)
 	}
 	return nil
 }
 
-func (c *Adb) Disconnect(addr string) error {
-	_, err := roundTripSingleResponse(c.server, "host:disconnect:"+addr)
+func (c *Adb) Disconnect(ctx context.Context, addr string) error {
+	_, err := roundTripSingleResponse(ctx, c.server, "host:disconnect:"+addr)
 	if err != nil {
 		return fmt.Errorf("disconnect: %w", err)
 	}
 	return nil
 }
 
-func (c *Adb) ListForward() ([]ForwardEntry, error) {
-	resp, err := roundTripSingleResponse(c.server, "host:list-forward")
+func (c *Adb) ListForward(ctx context.Context) ([]ForwardEntry, error) {
+	resp, err := roundTripSingleResponse(ctx, c.server, "host:list-forward")
 	if err != nil {
 		return nil, err
 	}
@@ -185,8 +232,8 @@ func (c *Adb) ListForward() ([]ForwardEntry, error) {
 // 00000010  77 61 72 64 2d 61 6c 6c                           |ward-all|
 // <---
 // 00000000  4f 4b 41 59 4f 4b 41 59                           |OKAYOKAY|
-func (c *Adb) RemoveAllForward() (err error) {
-	conn, err := c.server.Dial()
+func (c *Adb) RemoveAllForward(ctx context.Context) (err error) {
+	conn, err := dialServer(ctx, c.server)
 	if err != nil {
 		return
 	}
@@ -198,7 +245,7 @@ func (c *Adb) RemoveAllForward() (err error) {
 		return err
 	}
 
-	if _, err = readStatusWithTimeout(conn, req, CommandTimeoutShortDefault); err != nil {
+	if _, err = readStatusWithTimeout(ctx, conn, req, CommandTimeoutShortDefault); err != nil {
 		return fmt.Errorf("'%s' failed: %w", req, err)
 	}
 	return nil
@@ -225,6 +272,58 @@ func featuresStrToMap(attr string) (features map[string]bool) {
 	return
 }
 
+const (
+	// MdnsServiceTLSPairing is advertised while "Pair device with pairing code" is shown.
+	MdnsServiceTLSPairing = "_adb-tls-pairing._tcp"
+	// MdnsServiceTLSConnect is advertised by devices with wireless debugging enabled.
+	MdnsServiceTLSConnect = "_adb-tls-connect._tcp"
+	// MdnsServiceLegacy is advertised by devices with adb over TCP enabled.
+	MdnsServiceLegacy = "_adb._tcp"
+)
+
+// MdnsService is an adb service discovered via mdns.
+type MdnsService struct {
+	// Instance name, eg. adb-PQY0220A15002880-cMOQjn
+	Instance string
+	// Service type, one of the MdnsService* constants.
+	Type string
+	// Address as ip:port
+	Addr string
+}
+
+// IsPairing returns true if the service accepts Adb.Pair.
+func (s MdnsService) IsPairing() bool {
+	return s.Type == MdnsServiceTLSPairing
+}
+
+// IsConnect returns true if the service accepts Adb.Connect.
+func (s MdnsService) IsConnect() bool {
+	return s.Type == MdnsServiceTLSConnect || s.Type == MdnsServiceLegacy
+}
+
+// parseMdnsServices parses the response of host:mdns:services, one service per line:
+//
+//	adb-PQY0220A15002880-cMOQjn	_adb-tls-connect._tcp	192.168.1.100:39555
+//
+// Older servers add a trailing dot to the service type.
+func parseMdnsServices(resp []byte) []MdnsService {
+	lines := bytes.Split(resp, []byte("\n"))
+	services := make([]MdnsService, 0, len(lines))
+
+	for i := range lines {
+		fields := bytes.Fields(lines[i])
+		if len(fields) < 3 {
+			continue
+		}
+		services = append(services, MdnsService{
+			Instance: string(fields[0]),
+			Type:     strings.TrimSuffix(string(fields[1]), "."),
+			Addr:     string(fields[2]),
+		})
+	}
+	return services
+}
+
 type ForwardEntry struct {
 	Serial string
 	Local  string
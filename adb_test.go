@@ -1,6 +1,7 @@
 package adb
 
 import (
+	"context"
 	"testing"
 
 	"DomaphoneS-Next/backend/goadb/wire"
@@ -15,14 +16,14 @@ func TestGetServerVersion(t *testing.T) {
 	}
 	client := &Adb{s}
 
-	v, err := client.ServerVersion()
+	v, err := client.ServerVersion(context.TODO())
 	assert.Equal(t, "host:version", s.Requests[0])
 	assert.NoError(t, err)
 	assert.Equal(t, 10, v)
 }
 
 func TestAdb_ListForward(t *testing.T) {
-	_, err := adbclient.ListForward()
+	_, err := adbclient.ListForward(context.TODO())
 	if err != nil {
 		t.Fatal(err)
 	}
@@ -42,7 +43,7 @@ func TestAdb_parseForwardList(t *testing.T) {
 
 func TestAdb_RemoveAllForward(t *testing.T) {
 	// clear all forwards
-	err := adbclient.RemoveAllForward()
+	err := adbclient.RemoveAllForward(context.TODO())
 	if err != nil {
 		t.Fatal(err)
 	}
@@ -52,26 +53,26 @@ func TestDevice_DoForward(t *testing.T) {
 	d := adbclient.Device(AnyDevice())
 
 	// clear all forwards
-	err := adbclient.RemoveAllForward()
+	err := adbclient.RemoveAllForward(context.TODO())
 	if err != nil {
 		t.Fatal(err)
 	}
 
 	// forward
-	err = d.DoForward("tcp:700001", "tcp:7001", false)
+	_, err = d.DoForward(context.TODO(), "tcp:700001", "tcp:7001", false)
 	assert.Contains(t, err.Error(), "server error: cannot bind listener: bad port number '700001'")
 
-	err = d.DoForward("tcp:5000", "tcp:6000", false)
+	_, err = d.DoForward(context.TODO(), "tcp:5000", "tcp:6000", false)
 	if err != nil {
 		t.Fatal(err)
 	}
 
-	err = d.DoForward("tcp:5001", "tcp:6000", false)
+	_, err = d.DoForward(context.TODO(), "tcp:5001", "tcp:6000", false)
 	if err != nil {
 		t.Fatal(err)
 	}
 
-	list, err := d.DoListForward()
+	list, err := d.DoListForward(context.TODO())
 	if err != nil {
 		t.Fatal(err)
 	}
@@ -80,8 +81,8 @@ func TestDevice_DoForward(t *testing.T) {
 	assert.Equal(t, list[0].Remote, "tcp:6000")
 
 	// remove
-	d.DoRemoveForward(list[0].Local)
-	list, err = d.DoListForward()
+	d.DoRemoveForward(context.TODO(), list[0].Local)
+	list, err = d.DoListForward(context.TODO())
 	if err != nil {
 		t.Fatal(err)
 	}
@@ -91,11 +92,43 @@ func TestDevice_DoForward(t *testing.T) {
 }
 
 func TestAdb_Disconnect(t *testing.T) {
-	err := adbclient.Disconnect("192.168.1.100:5000")
+	err := adbclient.Disconnect(context.TODO(), "192.168.1.100:5000")
 	assert.Contains(t, err.Error(), "no such device '192.168.1.100:5000'")
 }
 
 func TestAdb_DisconnectAll(t *testing.T) {
-	err := adbclient.DisconnectAll()
+	err := adbclient.DisconnectAll(context.TODO())
 	assert.Nil(t, err)
 }
+
+func TestAdb_Pair(t *testing.T) {
+	s := &MockServer{
+		Status:   wire.StatusSuccess,
+		Messages: []string{"Successfully paired to 192.168.1.100:37099 [guid=adb-PQY0220A15002880-cMOQjn]"},
+	}
+	err := (&Adb{s}).Pair(context.TODO(), "192.168.1.100:37099", "123456")
+	assert.NoError(t, err)
+	assert.Equal(t, "host:pair:123456:192.168.1.100:37099", s.Requests[0])
+
+	s = &MockServer{
+		Status:   wire.StatusSuccess,
+		Messages: []string{"Failed: Wrong password or connection was dropped."},
+	}
+	err = (&Adb{s}).Pair(context.TODO(), "192.168.1.100:37099", "000000")
+	assert.ErrorIs(t, err, wire.ErrAdb)
+	assert.ErrorContains(t, err, "Wrong password")
+}
+
+func TestAdb_parseMdnsServices(t *testing.T) {
+	resp := "adb-PQY0220A15002880-cMOQjn\t_adb-tls-connect._tcp\t192.168.1.100:39555\n" +
+		"adb-PQY0220A15002880-cMOQjn\t_adb-tls-pairing._tcp.\t192.168.1.100:37099\n" +
+		"\n"
+	list := parseMdnsServices([]byte(resp))
+	assert.Len(t, list, 2)
+	assert.Equal(t, "adb-PQY0220A15002880-cMOQjn", list[0].Instance)
+	assert.Equal(t, MdnsServiceTLSConnect, list[0].Type)
+	assert.Equal(t, "192.168.1.100:39555", list[0].Addr)
+	assert.True(t, list[0].IsConnect())
+	assert.Equal(t, MdnsServiceTLSPairing, list[1].Type)
+	assert.True(t, list[1].IsPairing())
+}
@@ -0,0 +1,235 @@
+package adbtest
+
+import (
+	"fmt"
+	"io"
+	"sort"
+	"strings"
+	"sync"
+
+	"DomaphoneS-Next/backend/goadb/wire"
+)
+
+// States a Device can be in, as reported by host:devices.
+const (
+	StateDevice       = "device"
+	StateOffline      = "offline"
+	StateUnauthorized = "unauthorized"
+	StateAuthorizing  = "authorizing"
+	StateRecovery     = "recovery"
+	StateSideload     = "sideload"
+)
+
+// DefaultFeatures are the features of a Device created by NewDevice.
+var DefaultFeatures = []string{
+	"shell_v2",
+	"cmd",
+	"stat_v2",
+	"ls_v2",
+	"fixed_push_mkdir",
+	"sendrecv_v2",
+}
+
+// ShellFunc runs cmd on a fake device like a process would: it reads stdin,
+// writes to stdout and stderr, and returns the exit code.
+// With shell v1 stdout and stderr are merged and the exit code is dropped, like adbd does.
+type ShellFunc func(cmd string, stdin io.Reader, stdout, stderr io.Writer) int
+
+// Reply returns a ShellFunc that prints stdout and stderr and exits with exitCode.
+func Reply(stdout, stderr string, exitCode int) ShellFunc {
+	return func(cmd string, stdin io.Reader, out, errOut io.Writer) int {
+		io.WriteString(out, stdout)
+		io.WriteString(errOut, stderr)
+		return exitCode
+	}
+}
+
+// ServiceFunc serves a device service that is neither shell nor sync, eg. tcp:8080 opened by Device.Forward.
+// rw is closed when the function returns.
+type ServiceFunc func(service string, rw io.ReadWriter)
+
+// Device is a fake device attached to a Server.
+// Exported fields must not be changed after the device has been added to a server,
+// use Server.SetState to change the state.
+type Device struct {
+	Serial  string
+	State   string
+	Product string
+	Model   string
+	Device  string
+	// Usb is the usb attribute of devices-l, leave it empty for network devices.
+	Usb      string
+	Features []string
+	// Properties are printed by the getprop shell command.
+	Properties map[string]string
+	// FS backs the sync service.
+	FS *FS
+
+	transportID int
+
+	mu        sync.Mutex
+	shell     map[string]ShellFunc
+	shellFunc ShellFunc
+	services  map[string]ServiceFunc
+	reverses  []Forward
+	nextPort  int
+}
+
+// NewDevice returns an online device with DefaultFeatures and an empty FS.
+func NewDevice(serial string) *Device {
+	return &Device{
+		Serial:     serial,
+		State:      StateDevice,
+		Product:    "sdk_gphone64_x86_64",
+		Model:      "sdk_gphone64_x86_64",
+		Device:     "emu64xa",
+		Features:   append([]string(nil), DefaultFeatures...),
+		Properties: map[string]string{},
+		FS:         NewFS(),
+		nextPort:   40000,
+	}
+}
+
+// HandleShell scripts the response to the exact command line cmd,
+// as sent by the client after quoting, eg. `echo "a b"`.
+// abb and abb_exec requests run the handler of `cmd SERVICE ARGS...`, the arguments joined
+// with spaces and unquoted, eg. `cmd package list packages -3`.
+func (d *Device) HandleShell(cmd string, fn ShellFunc) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	if d.shell == nil {
+		d.shell = map[string]ShellFunc{}
+	}
+	d.shell[cmd] = fn
+}
+
+// HandleShellFunc sets the handler of commands that have no HandleShell entry.
+// Without one, unknown commands fail like a missing binary with exit code 127.
+func (d *Device) HandleShellFunc(fn ShellFunc) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	d.shellFunc = fn
+}
+
+// HandleService serves services whose name starts with prefix, eg. "tcp:" or "localabstract:".
+func (d *Device) HandleService(prefix string, fn ServiceFunc) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	if d.services == nil {
+		d.services = map[string]ServiceFunc{}
+	}
+	d.services[prefix] = fn
+}
+
+func (d *Device) hasFeature(name string) bool {
+	for _, f := range d.Features {
+		if f == name {
+			return true
+		}
+	}
+	return false
+}
+
+func (d *Device) shellHandler(cmd string) ShellFunc {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	if fn, ok := d.shell[cmd]; ok {
+		return fn
+	}
+	if d.shellFunc != nil {
+		return d.shellFunc
+	}
+	if cmd == "getprop" || strings.HasPrefix(cmd, "getprop ") {
+		return d.getprop
+	}
+	return notFound
+}
+
+func (d *Device) serviceHandler(service string) ServiceFunc {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	// The longest matching prefix wins.
+	var match string
+	for prefix := range d.services {
+		if strings.HasPrefix(service, prefix) && len(prefix) > len(match) {
+			match = prefix
+		}
+	}
+	if match == "" {
+		return nil
+	}
+	return d.services[match]
+}
+
+// Reverses returns the reverse forwards set up on the device, Local is the device side.
+func (d *Device) Reverses() []Forward {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	return append([]Forward(nil), d.reverses...)
+}
+
+// reverseSerial is the name adbd gives to the host connection in reverse:list-forward.
+const reverseSerial = "UsbFfs"
+
+// serveReverse serves the reverse: services of adbd's handle_forward_request,
+// which answer with a single status, unlike the host: ones, and list-forward
+// with its message alone.
+func (d *Device) serveReverse(c *wire.Conn, cmd string) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	switch {
+	case cmd == "list-forward":
+		c.SendMessage([]byte(formatForwards(d.reverses)))
+	case cmd == "killforward-all":
+		d.reverses = nil
+		writeOkay(c)
+	case strings.HasPrefix(cmd, "killforward:"):
+		if err := removeForward(&d.reverses, strings.TrimPrefix(cmd, "killforward:")); err != nil {
+			writeFail(c, err.Error())
+			return
+		}
+		writeOkay(c)
+	case strings.HasPrefix(cmd, "forward:"):
+		port, err := addForward(&d.reverses, reverseSerial, strings.TrimPrefix(cmd, "forward:"), &d.nextPort)
+		if err != nil {
+			writeFail(c, err.Error())
+			return
+		}
+		if port != "" {
+			respond(c, port)
+		} else {
+			writeOkay(c)
+		}
+	default:
+		writeFail(c, "unknown reverse service")
+	}
+}
+
+// getprop prints Properties like the real command: all of them in the
+// `[name]: [value]` format, or the value of a single one.
+func (d *Device) getprop(cmd string, stdin io.Reader, stdout, stderr io.Writer) int {
+	args := strings.Fields(cmd)[1:]
+	if len(args) > 0 {
+		fmt.Fprintln(stdout, d.Properties[strings.Trim(args[0], `"`)])
+		return 0
+	}
+
+	names := make([]string, 0, len(d.Properties))
+	for name := range d.Properties {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		fmt.Fprintf(stdout, "[%s]: [%s]\n", name, d.Properties[name])
+	}
+	return 0
+}
+
+func notFound(cmd string, stdin io.Reader, stdout, stderr io.Writer) int {
+	name := cmd
+	if fields := strings.Fields(cmd); len(fields) > 0 {
+		name = fields[0]
+	}
+	fmt.Fprintf(stderr, "/system/bin/sh: %s: inaccessible or not found\n", name)
+	return 127
+}
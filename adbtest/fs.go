@@ -0,0 +1,156 @@
+package adbtest
+
+import (
+	"io/fs"
+	"os"
+	"path"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"DomaphoneS-Next/backend/goadb/wire"
+)
+
+// File is an entry of an FS.
+type File struct {
+	Name    string
+	Mode    os.FileMode
+	Data    []byte
+	ModTime time.Time
+}
+
+// FS is the in-memory filesystem that backs the sync protocol of a fake device.
+// Paths are absolute and use forward slashes, like on the device.
+type FS struct {
+	mu      sync.Mutex
+	entries map[string]*File
+}
+
+// NewFS returns a filesystem with the directories goadb commonly pushes to.
+func NewFS() *FS {
+	f := &FS{entries: map[string]*File{}}
+	f.entries["/"] = &File{Name: "/", Mode: fs.ModeDir | 0755, ModTime: time.Now()}
+	f.MkdirAll("/sdcard", 0770)
+	f.MkdirAll("/data/local/tmp", 0771)
+	return f
+}
+
+func cleanPath(name string) string {
+	return path.Clean("/" + name)
+}
+
+// MkdirAll creates name and all missing parents.
+func (f *FS) MkdirAll(name string, perm os.FileMode) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return f.mkdirAll(cleanPath(name), perm)
+}
+
+func (f *FS) mkdirAll(name string, perm os.FileMode) error {
+	if e, ok := f.entries[name]; ok {
+		if !e.Mode.IsDir() {
+			return &fs.PathError{Op: "mkdir", Path: name, Err: fs.ErrExist}
+		}
+		return nil
+	}
+	if err := f.mkdirAll(path.Dir(name), perm); err != nil {
+		return err
+	}
+	f.entries[name] = &File{Name: name, Mode: fs.ModeDir | perm.Perm(), ModTime: time.Now()}
+	return nil
+}
+
+// WriteFile creates or replaces the regular file name, creating missing parents
+// the way adbd does for pushes.
+func (f *FS) WriteFile(name string, data []byte, perm os.FileMode) error {
+	return f.writeFile(name, data, perm, time.Now())
+}
+
+func (f *FS) writeFile(name string, data []byte, perm os.FileMode, mtime time.Time) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	name = cleanPath(name)
+	if e, ok := f.entries[name]; ok && e.Mode.IsDir() {
+		return &fs.PathError{Op: "open", Path: name, Err: wire.EISDIR}
+	}
+	if err := f.mkdirAll(path.Dir(name), 0770); err != nil {
+		return err
+	}
+	f.entries[name] = &File{
+		Name:    name,
+		Mode:    perm.Perm(),
+		Data:    append([]byte(nil), data...),
+		ModTime: mtime,
+	}
+	return nil
+}
+
+// ReadFile returns the content of the regular file name.
+func (f *FS) ReadFile(name string) ([]byte, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	name = cleanPath(name)
+	e, ok := f.entries[name]
+	if !ok {
+		return nil, &fs.PathError{Op: "open", Path: name, Err: fs.ErrNotExist}
+	}
+	if e.Mode.IsDir() {
+		return nil, &fs.PathError{Op: "read", Path: name, Err: wire.EISDIR}
+	}
+	return append([]byte(nil), e.Data...), nil
+}
+
+// Stat returns a copy of the entry at name.
+func (f *FS) Stat(name string) (File, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	name = cleanPath(name)
+	e, ok := f.entries[name]
+	if !ok {
+		return File{}, &fs.PathError{Op: "stat", Path: name, Err: fs.ErrNotExist}
+	}
+	return *e, nil
+}
+
+// ReadDir returns the entries of the directory name, sorted by name.
+// The Name of the returned entries is the base name.
+func (f *FS) ReadDir(name string) ([]File, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	name = cleanPath(name)
+	e, ok := f.entries[name]
+	if !ok {
+		return nil, &fs.PathError{Op: "readdir", Path: name, Err: fs.ErrNotExist}
+	}
+	if !e.Mode.IsDir() {
+		return nil, &fs.PathError{Op: "readdir", Path: name, Err: wire.ENOTDIR}
+	}
+
+	var list []File
+	for p, child := range f.entries {
+		if p != "/" && path.Dir(p) == name {
+			c := *child
+			c.Name = path.Base(p)
+			list = append(list, c)
+		}
+	}
+	sort.Slice(list, func(i, j int) bool { return list[i].Name < list[j].Name })
+	return list, nil
+}
+
+// Remove removes name and, for directories, everything below it.
+func (f *FS) Remove(name string) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	name = cleanPath(name)
+	if _, ok := f.entries[name]; !ok || name == "/" {
+		return &fs.PathError{Op: "remove", Path: name, Err: fs.ErrNotExist}
+	}
+	for p := range f.entries {
+		if p == name || strings.HasPrefix(p, name+"/") {
+			delete(f.entries, p)
+		}
+	}
+	return nil
+}
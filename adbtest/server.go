@@ -0,0 +1,687 @@
+// Package adbtest provides a fake adb server for tests.
+//
+// The server listens on a local TCP port and speaks the adb server protocol,
+// so clients are created with the regular adb package:
+//
+//	srv, err := adbtest.NewServer()
+//	...
+//	defer srv.Close()
+//	dev := adbtest.NewDevice("emulator-5554")
+//	dev.HandleShell("echo hello", adbtest.Reply("hello\n", "", 0))
+//	srv.AddDevice(dev)
+//
+//	client, err := adb.NewWithConfig(srv.Config())
+//
+// It emulates host:devices(-l), host:track-devices, host:transport*, the forward
+// and reverse requests, shell (v1 and v2), exec, abb and sync backed by an in-memory FS.
+package adbtest
+
+import (
+	"fmt"
+	"io"
+	"net"
+	"os"
+	"path/filepath"
+	"runtime"
+	"strconv"
+	"strings"
+	"sync"
+
+	adb "DomaphoneS-Next/backend/goadb"
+	"DomaphoneS-Next/backend/goadb/wire"
+)
+
+// Version is the adb server version reported by host:version.
+const Version = 41
+
+// Forward is a port forwarding rule set up by host:forward.
+type Forward struct {
+	Serial string
+	Local  string
+	Remote string
+}
+
+// Server is a fake adb server.
+type Server struct {
+	ln      net.Listener
+	tempDir string
+	adbPath string
+
+	mu              sync.Mutex
+	devices         []*Device
+	nextTransportID int
+	forwards        []Forward
+	nextPort        int
+	watchers        map[chan struct{}]struct{}
+	conns           map[net.Conn]struct{}
+	closed          bool
+	wg              sync.WaitGroup
+}
+
+// NewServer starts a fake adb server on a random port of 127.0.0.1.
+func NewServer() (*Server, error) {
+	tempDir, err := os.MkdirTemp("", "adbtest")
+	if err != nil {
+		return nil, err
+	}
+	adbPath, err := writeAdbStub(tempDir)
+	if err != nil {
+		os.RemoveAll(tempDir)
+		return nil, err
+	}
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		os.RemoveAll(tempDir)
+		return nil, err
+	}
+
+	s := &Server{
+		ln:              ln,
+		tempDir:         tempDir,
+		adbPath:         adbPath,
+		nextTransportID: 1,
+		nextPort:        40000,
+		watchers:        map[chan struct{}]struct{}{},
+		conns:           map[net.Conn]struct{}{},
+	}
+	s.wg.Add(1)
+	go s.serve()
+	return s, nil
+}
+
+// writeAdbStub writes an adb executable that does nothing, so adb.NewWithConfig
+// works on hosts without the SDK and StartServer succeeds against the fake server.
+func writeAdbStub(dir string) (string, error) {
+	name, content := "adb", "#!/bin/sh\nexit 0\n"
+	if runtime.GOOS == "windows" {
+		name, content = "adb.bat", "@exit /b 0\r\n"
+	}
+	path := filepath.Join(dir, name)
+	if err := os.WriteFile(path, []byte(content), 0755); err != nil {
+		return "", err
+	}
+	return path, nil
+}
+
+// Addr returns the address the server listens on.
+func (s *Server) Addr() *net.TCPAddr {
+	return s.ln.Addr().(*net.TCPAddr)
+}
+
+// Config returns the configuration that connects an adb client to this server.
+func (s *Server) Config() adb.ServerConfig {
+	return adb.ServerConfig{
+		PathToAdb: s.adbPath,
+		Host:      s.Addr().IP.String(),
+		Port:      s.Addr().Port,
+	}
+}
+
+// Close stops the server and closes all its connections.
+func (s *Server) Close() error {
+	s.mu.Lock()
+	if s.closed {
+		s.mu.Unlock()
+		return nil
+	}
+	s.closed = true
+	err := s.ln.Close()
+	for conn := range s.conns {
+		conn.Close()
+	}
+	for ch := range s.watchers {
+		close(ch)
+		delete(s.watchers, ch)
+	}
+	s.mu.Unlock()
+
+	s.wg.Wait()
+	os.RemoveAll(s.tempDir)
+	return err
+}
+
+// AddDevice attaches d to the server and notifies track-devices clients.
+func (s *Server) AddDevice(d *Device) {
+	if d.State == "" {
+		d.State = StateDevice
+	}
+	if d.FS == nil {
+		d.FS = NewFS()
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	d.transportID = s.nextTransportID
+	s.nextTransportID++
+	s.devices = append(s.devices, d)
+	s.notifyLocked()
+}
+
+// RemoveDevice detaches the device with serial, and its forwards, like unplugging it.
+func (s *Server) RemoveDevice(serial string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for i, d := range s.devices {
+		if d.Serial == serial {
+			s.devices = append(s.devices[:i], s.devices[i+1:]...)
+			break
+		}
+	}
+	forwards := s.forwards[:0]
+	for _, f := range s.forwards {
+		if f.Serial != serial {
+			forwards = append(forwards, f)
+		}
+	}
+	s.forwards = forwards
+	s.notifyLocked()
+}
+
+// SetState changes the state of the device with serial, eg. to StateOffline.
+func (s *Server) SetState(serial, state string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for _, d := range s.devices {
+		if d.Serial == serial {
+			d.State = state
+		}
+	}
+	s.notifyLocked()
+}
+
+// Forwards returns the forwards that are currently set up.
+func (s *Server) Forwards() []Forward {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return append([]Forward(nil), s.forwards...)
+}
+
+func (s *Server) notifyLocked() {
+	for ch := range s.watchers {
+		select {
+		case ch <- struct{}{}:
+		default:
+		}
+	}
+}
+
+func (s *Server) serve() {
+	defer s.wg.Done()
+	for {
+		conn, err := s.ln.Accept()
+		if err != nil {
+			return
+		}
+
+		s.mu.Lock()
+		if s.closed {
+			s.mu.Unlock()
+			conn.Close()
+			return
+		}
+		s.conns[conn] = struct{}{}
+		s.wg.Add(1)
+		s.mu.Unlock()
+
+		go func() {
+			defer s.wg.Done()
+			s.handle(conn)
+			conn.Close()
+			s.mu.Lock()
+			delete(s.conns, conn)
+			s.mu.Unlock()
+		}()
+	}
+}
+
+// handle serves one client connection: host requests, and after a transport
+// request, either more host requests for the selected device or one device service.
+func (s *Server) handle(conn net.Conn) {
+	c := wire.NewConn(conn)
+	var dev *Device
+	for {
+		msg, err := c.ReadMessage()
+		if err != nil {
+			return
+		}
+		req := string(msg)
+
+		if dev != nil && !strings.HasPrefix(req, "host") {
+			s.handleService(c, dev, req)
+			return
+		}
+		if strings.HasPrefix(req, "host:transport") || strings.HasPrefix(req, "host:tport") {
+			if dev, err = s.transport(req); err != nil {
+				writeFail(c, err.Error())
+				return
+			}
+			if writeOkay(c) != nil {
+				return
+			}
+			continue
+		}
+		if !s.handleHost(c, dev, req) {
+			return
+		}
+	}
+}
+
+func (s *Server) transport(req string) (*Device, error) {
+	switch {
+	case strings.HasPrefix(req, "host:transport:"):
+		return s.acquire(strings.TrimPrefix(req, "host:transport:"), 0)
+	case strings.HasPrefix(req, "host:transport-id:"):
+		id, err := strconv.Atoi(strings.TrimPrefix(req, "host:transport-id:"))
+		if err != nil {
+			return nil, fmt.Errorf("invalid transport id")
+		}
+		return s.acquire("", id)
+	case req == "host:transport-any", req == "host:transport-usb", req == "host:transport-local":
+		return s.acquire("", 0)
+	default:
+		return nil, fmt.Errorf("unknown host service")
+	}
+}
+
+// acquire finds an online device by serial, transport id, or the only one
+// when both are empty, with the error messages of the real server.
+func (s *Server) acquire(serial string, transportID int) (*Device, error) {
+	d, err := s.find(serial, transportID)
+	if err != nil {
+		return nil, err
+	}
+	switch state := s.stateOf(d); state {
+	case StateDevice, StateRecovery, StateSideload:
+		return d, nil
+	case StateUnauthorized:
+		return nil, fmt.Errorf("device unauthorized.\n" +
+			"This adb server's $ADB_VENDOR_KEYS is not set\n" +
+			"Try 'adb kill-server' if that seems wrong.\n" +
+			"Otherwise check for a confirmation dialog on your device.")
+	case StateAuthorizing:
+		return nil, fmt.Errorf("device still authorizing")
+	default:
+		return nil, fmt.Errorf("device %s", state)
+	}
+}
+
+func (s *Server) stateOf(d *Device) string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return d.State
+}
+
+func (s *Server) find(serial string, transportID int) (*Device, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	switch {
+	case serial != "":
+		for _, d := range s.devices {
+			if d.Serial == serial {
+				return d, nil
+			}
+		}
+		return nil, fmt.Errorf("device '%s' not found", serial)
+	case transportID != 0:
+		for _, d := range s.devices {
+			if d.transportID == transportID {
+				return d, nil
+			}
+		}
+		return nil, fmt.Errorf("no device with transport id '%d'", transportID)
+	case len(s.devices) == 0:
+		return nil, fmt.Errorf("no devices/emulators found")
+	case len(s.devices) > 1:
+		return nil, fmt.Errorf("more than one device/emulator")
+	default:
+		return s.devices[0], nil
+	}
+}
+
+// splitSerial splits "serial:cmd" where serial may be host:port, like the real server does.
+func splitSerial(rest string) (serial, cmd string) {
+	i := strings.Index(rest, ":")
+	if i < 0 {
+		return "", rest
+	}
+	if j := strings.Index(rest[i+1:], ":"); j > 0 {
+		if _, err := strconv.Atoi(rest[i+1 : i+1+j]); err == nil {
+			i += 1 + j
+		}
+	}
+	return rest[:i], rest[i+1:]
+}
+
+// handleHost serves a host request and reports whether the connection stays open.
+// dev is the device selected by a previous transport request, if any.
+func (s *Server) handleHost(c *wire.Conn, dev *Device, req string) bool {
+	var cmd, serial string
+	var transportID int
+	switch {
+	case strings.HasPrefix(req, "host:"):
+		cmd = strings.TrimPrefix(req, "host:")
+	case strings.HasPrefix(req, "host-usb:"):
+		cmd = strings.TrimPrefix(req, "host-usb:")
+	case strings.HasPrefix(req, "host-local:"):
+		cmd = strings.TrimPrefix(req, "host-local:")
+	case strings.HasPrefix(req, "host-serial:"):
+		serial, cmd = splitSerial(strings.TrimPrefix(req, "host-serial:"))
+	case strings.HasPrefix(req, "host-transport-id:"):
+		var id string
+		id, cmd, _ = strings.Cut(strings.TrimPrefix(req, "host-transport-id:"), ":")
+		transportID, _ = strconv.Atoi(id)
+	default:
+		writeFail(c, "unknown host service")
+		return false
+	}
+
+	// target returns the device a device-specific request applies to.
+	target := func() (*Device, error) {
+		if dev != nil && serial == "" && transportID == 0 {
+			return dev, nil
+		}
+		return s.acquire(serial, transportID)
+	}
+
+	switch {
+	case cmd == "version":
+		respond(c, fmt.Sprintf("%04x", Version))
+	case cmd == "host-features":
+		respond(c, strings.Join(DefaultFeatures, ","))
+	case cmd == "devices":
+		respond(c, s.deviceList(false))
+	case cmd == "devices-l":
+		respond(c, s.deviceList(true))
+	case cmd == "track-devices":
+		s.trackDevices(c)
+	case cmd == "kill":
+		writeOkay(c)
+	case cmd == "get-state", cmd == "get-serialno", cmd == "get-devpath", cmd == "features":
+		d, err := target()
+		if err != nil {
+			writeFail(c, err.Error())
+			break
+		}
+		switch cmd {
+		case "get-state":
+			respond(c, s.stateOf(d))
+		case "get-serialno":
+			respond(c, d.Serial)
+		case "get-devpath":
+			respond(c, "unknown")
+		default:
+			respond(c, strings.Join(d.Features, ","))
+		}
+	case cmd == "list-forward":
+		respond(c, s.forwardList())
+	case cmd == "killforward-all":
+		s.mu.Lock()
+		s.forwards = nil
+		s.mu.Unlock()
+		// One OKAY for the request, one for the result.
+		writeOkay(c)
+		writeOkay(c)
+	case strings.HasPrefix(cmd, "killforward:"):
+		if err := s.killForward(strings.TrimPrefix(cmd, "killforward:")); err != nil {
+			writeFail(c, err.Error())
+			break
+		}
+		writeOkay(c)
+		writeOkay(c)
+	case strings.HasPrefix(cmd, "forward:"):
+		d, err := target()
+		if err != nil {
+			writeFail(c, err.Error())
+			break
+		}
+		port, err := s.forward(d, strings.TrimPrefix(cmd, "forward:"))
+		if err != nil {
+			writeFail(c, err.Error())
+			break
+		}
+		writeOkay(c)
+		writeOkay(c)
+		if port != "" {
+			c.SendMessage([]byte(port))
+		}
+	default:
+		writeFail(c, "unknown host service")
+	}
+	return false
+}
+
+func (s *Server) deviceList(long bool) string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	var b strings.Builder
+	for _, d := range s.devices {
+		if !long {
+			fmt.Fprintf(&b, "%s\t%s\n", d.Serial, d.State)
+			continue
+		}
+		fmt.Fprintf(&b, "%-22s %s", d.Serial, d.State)
+		if d.Usb != "" {
+			fmt.Fprintf(&b, " usb:%s", d.Usb)
+		}
+		fmt.Fprintf(&b, " product:%s model:%s device:%s transport_id:%d\n", d.Product, d.Model, d.Device, d.transportID)
+	}
+	return b.String()
+}
+
+func (s *Server) trackDevices(c *wire.Conn) {
+	ch := make(chan struct{}, 1)
+	s.mu.Lock()
+	if s.closed {
+		s.mu.Unlock()
+		return
+	}
+	s.watchers[ch] = struct{}{}
+	s.mu.Unlock()
+	defer func() {
+		s.mu.Lock()
+		if _, ok := s.watchers[ch]; ok {
+			delete(s.watchers, ch)
+		}
+		s.mu.Unlock()
+	}()
+
+	if writeOkay(c) != nil {
+		return
+	}
+	// The client never writes on this connection, a read returns when it goes away.
+	closed := make(chan struct{})
+	go func() {
+		io.Copy(io.Discard, c)
+		close(closed)
+	}()
+
+	last := ""
+	for {
+		if list := s.deviceList(false); list != last {
+			if c.SendMessage([]byte(list)) != nil {
+				return
+			}
+			last = list
+		}
+		select {
+		case _, ok := <-ch:
+			if !ok {
+				return
+			}
+		case <-closed:
+			return
+		}
+	}
+}
+
+func (s *Server) forwardList() string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return formatForwards(s.forwards)
+}
+
+// forward handles "[norebind:]<local>;<remote>" and returns the allocated port for tcp:0.
+func (s *Server) forward(d *Device, spec string) (string, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return addForward(&s.forwards, d.Serial, spec, &s.nextPort)
+}
+
+func (s *Server) killForward(local string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return removeForward(&s.forwards, local)
+}
+
+// addForward adds "[norebind:]<local>;<remote>" to rules, like adb's install_listener,
+// and returns the port taken from nextPort for tcp:0.
+func addForward(rules *[]Forward, serial, spec string, nextPort *int) (string, error) {
+	noRebind := strings.HasPrefix(spec, "norebind:")
+	spec = strings.TrimPrefix(spec, "norebind:")
+	local, remote, ok := strings.Cut(spec, ";")
+	if !ok || local == "" || remote == "" {
+		return "", fmt.Errorf("bad forward: %s", spec)
+	}
+
+	var allocated string
+	if strings.HasPrefix(local, "tcp:") {
+		port := strings.TrimPrefix(local, "tcp:")
+		n, err := strconv.Atoi(port)
+		if err != nil || n < 0 || n > 65535 {
+			return "", fmt.Errorf("cannot bind listener: bad port number '%s'", port)
+		}
+		if n == 0 {
+			allocated = strconv.Itoa(*nextPort)
+			*nextPort++
+			local = "tcp:" + allocated
+		}
+	}
+
+	for i, f := range *rules {
+		if f.Local == local {
+			if noRebind {
+				return "", fmt.Errorf("cannot rebind existing socket")
+			}
+			(*rules)[i] = Forward{Serial: serial, Local: local, Remote: remote}
+			return allocated, nil
+		}
+	}
+	*rules = append(*rules, Forward{Serial: serial, Local: local, Remote: remote})
+	return allocated, nil
+}
+
+func removeForward(rules *[]Forward, local string) error {
+	for i, f := range *rules {
+		if f.Local == local {
+			*rules = append((*rules)[:i], (*rules)[i+1:]...)
+			return nil
+		}
+	}
+	return fmt.Errorf("listener '%s' not found", local)
+}
+
+func formatForwards(rules []Forward) string {
+	var b strings.Builder
+	for _, f := range rules {
+		fmt.Fprintf(&b, "%s %s %s\n", f.Serial, f.Local, f.Remote)
+	}
+	return b.String()
+}
+
+// handleService serves a device service opened after a transport request.
+func (s *Server) handleService(c *wire.Conn, d *Device, req string) {
+	switch {
+	case strings.HasPrefix(req, "shell"):
+		opts, cmd, ok := strings.Cut(req, ":")
+		if !ok {
+			writeFail(c, "closed")
+			return
+		}
+		v2 := false
+		for _, opt := range strings.Split(opts, ",")[1:] {
+			if opt == "v2" {
+				v2 = true
+			}
+		}
+		if v2 && !d.hasFeature("shell_v2") {
+			writeFail(c, "closed")
+			return
+		}
+		if writeOkay(c) != nil {
+			return
+		}
+		if v2 {
+			runShellV2(c, d.shellHandler(cmd), cmd)
+		} else {
+			runShellV1(c, d.shellHandler(cmd), cmd)
+		}
+
+	case strings.HasPrefix(req, "abb:"), strings.HasPrefix(req, "abb_exec:"):
+		// abb runs the binder shell command of a service, like cmd does.
+		name, args, _ := strings.Cut(req, ":")
+		if !d.hasFeature(name) {
+			writeFail(c, "closed")
+			return
+		}
+		cmd := "cmd " + strings.ReplaceAll(args, "\x00", " ")
+		if writeOkay(c) != nil {
+			return
+		}
+		if name == "abb" {
+			runShellV2(c, d.shellHandler(cmd), cmd)
+		} else {
+			runShellV1(c, d.shellHandler(cmd), cmd)
+		}
+
+	case strings.HasPrefix(req, "exec:"):
+		// exec runs the command without the shell protocol nor a pty, output is merged.
+		cmd := strings.TrimPrefix(req, "exec:")
+		if writeOkay(c) != nil {
+			return
+		}
+		runShellV1(c, d.shellHandler(cmd), cmd)
+
+	case req == "sync:":
+		if writeOkay(c) != nil {
+			return
+		}
+		newSyncSession(c, d).serve()
+
+	case strings.HasPrefix(req, "reverse:"):
+		if writeOkay(c) != nil {
+			return
+		}
+		d.serveReverse(c, strings.TrimPrefix(req, "reverse:"))
+
+	default:
+		fn := d.serviceHandler(req)
+		if fn == nil {
+			writeFail(c, "closed")
+			return
+		}
+		if writeOkay(c) != nil {
+			return
+		}
+		fn(req, c)
+	}
+}
+
+func writeOkay(c *wire.Conn) error {
+	_, err := c.Write([]byte(wire.StatusSuccess))
+	return err
+}
+
+func writeFail(c *wire.Conn, msg string) {
+	if _, err := c.Write([]byte(wire.StatusFailure)); err != nil {
+		return
+	}
+	c.SendMessage([]byte(msg))
+}
+
+// respond sends OKAY followed by msg with a hex length prefix.
+func respond(c *wire.Conn, msg string) {
+	if writeOkay(c) != nil {
+		return
+	}
+	c.SendMessage([]byte(msg))
+}
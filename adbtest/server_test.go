@@ -0,0 +1,289 @@
+package adbtest_test
+
+import (
+	"bytes"
+	"context"
+	"io"
+	"os"
+	"strings"
+	"testing"
+	"time"
+
+	adb "DomaphoneS-Next/backend/goadb"
+	"DomaphoneS-Next/backend/goadb/adbtest"
+	"DomaphoneS-Next/backend/goadb/wire"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func newTestServer(t *testing.T, devices ...*adbtest.Device) (*adbtest.Server, *adb.Adb) {
+	srv, err := adbtest.NewServer()
+	require.NoError(t, err)
+	t.Cleanup(func() { srv.Close() })
+	for _, d := range devices {
+		srv.AddDevice(d)
+	}
+
+	client, err := adb.NewWithConfig(srv.Config())
+	require.NoError(t, err)
+	return srv, client
+}
+
+func TestServer_ListDevices(t *testing.T) {
+	ctx := context.Background()
+	usb := adbtest.NewDevice("0123456789ABCDEF")
+	usb.Usb = "1-1"
+	_, client := newTestServer(t, usb, adbtest.NewDevice("192.168.1.2:5555"))
+
+	version, err := client.ServerVersion(ctx)
+	assert.NoError(t, err)
+	assert.Equal(t, adbtest.Version, version)
+
+	devices, err := client.ListDevices(ctx)
+	require.NoError(t, err)
+	require.Len(t, devices, 2)
+	assert.Equal(t, "0123456789ABCDEF", devices[0].Serial)
+	assert.True(t, devices[0].IsUsb())
+	assert.Equal(t, 1, devices[0].TransportID)
+	assert.Equal(t, "192.168.1.2:5555", devices[1].Serial)
+	assert.Equal(t, "sdk_gphone64_x86_64", devices[1].Model)
+	assert.Equal(t, 2, devices[1].TransportID)
+}
+
+func TestServer_Transport(t *testing.T) {
+	ctx := context.Background()
+	srv, client := newTestServer(t, adbtest.NewDevice("a"), adbtest.NewDevice("192.168.1.2:5555"))
+
+	_, err := client.Device(adb.AnyDevice()).Serial(ctx)
+	assert.ErrorIs(t, err, wire.ErrMoreThanOneDevice)
+
+	serial, err := client.Device(adb.DeviceWithSerial("192.168.1.2:5555")).Serial(ctx)
+	assert.NoError(t, err)
+	assert.Equal(t, "192.168.1.2:5555", serial)
+
+	_, err = client.Device(adb.DeviceWithSerial("b")).Serial(ctx)
+	assert.ErrorIs(t, err, wire.ErrDeviceNotFound)
+
+	srv.SetState("a", adbtest.StateUnauthorized)
+	state, err := client.Device(adb.DeviceWithSerial("a")).State(ctx)
+	assert.NoError(t, err)
+	assert.Equal(t, adb.StateUnauthorized, state)
+
+	srv.SetState("a", adbtest.StateOffline)
+	state, err = client.Device(adb.DeviceWithSerial("a")).State(ctx)
+	assert.NoError(t, err)
+	assert.Equal(t, adb.StateOffline, state)
+	_, err = client.Device(adb.DeviceWithSerial("a")).RunCommand(ctx, "true")
+	assert.ErrorIs(t, err, wire.ErrDeviceOffline)
+}
+
+func TestServer_Shell(t *testing.T) {
+	ctx := context.Background()
+	dev := adbtest.NewDevice("emulator-5554")
+	dev.HandleShell("echo hello", adbtest.Reply("hello\n", "", 0))
+	dev.HandleShell("ls /data", adbtest.Reply("", "ls: /data: Permission denied\n", 1))
+	dev.HandleShell("cat", func(cmd string, stdin io.Reader, stdout, stderr io.Writer) int {
+		io.Copy(stdout, stdin)
+		return 0
+	})
+	dev.Properties["ro.build.version.sdk"] = "34"
+	_, client := newTestServer(t, dev)
+	d := client.Device(adb.AnyDevice())
+
+	out, err := d.RunCommand(ctx, "echo", "hello")
+	assert.NoError(t, err)
+	assert.Equal(t, "hello\n", string(out))
+
+	out, err = d.RunCommand(ctx, "getprop", "ro.build.version.sdk")
+	assert.NoError(t, err)
+	assert.Equal(t, "34\n", string(out))
+
+	// v2 keeps stdout, stderr and the exit code apart.
+	session, err := d.NewSession(ctx)
+	require.NoError(t, err)
+	var stdout, stderr bytes.Buffer
+	session.Stdout, session.Stderr = &stdout, &stderr
+	err = session.Run("ls /data")
+	session.Close()
+	var exitErr *adb.ExitError
+	require.ErrorAs(t, err, &exitErr)
+	assert.Equal(t, 1, exitErr.ExitStatus())
+	assert.Empty(t, stdout.String())
+	assert.Equal(t, "ls: /data: Permission denied\n", stderr.String())
+
+	session, err = d.NewSession(ctx)
+	require.NoError(t, err)
+	session.Stdin = strings.NewReader("from stdin")
+	out, err = session.Output("cat")
+	session.Close()
+	assert.NoError(t, err)
+	assert.Equal(t, "from stdin", string(out))
+
+	session, err = d.NewSession(ctx)
+	require.NoError(t, err)
+	out, err = session.CombinedOutput("unknown-tool --help")
+	session.Close()
+	assert.Error(t, err)
+	assert.Equal(t, "/system/bin/sh: unknown-tool: inaccessible or not found\n", string(out))
+}
+
+func testSync(t *testing.T, features []string) {
+	ctx := context.Background()
+	dev := adbtest.NewDevice("emulator-5554")
+	dev.Features = features
+	require.NoError(t, dev.FS.WriteFile("/sdcard/hello.txt", []byte("hello"), 0644))
+	_, client := newTestServer(t, dev)
+	d := client.Device(adb.AnyDevice())
+
+	mtime := time.Unix(1700000000, 0)
+	conn, w, err := d.OpenFileWriter(ctx, "/sdcard/dir/pushed.bin", 0600, mtime)
+	require.NoError(t, err)
+	data := bytes.Repeat([]byte("0123456789"), 10000)
+	_, err = w.Write(data)
+	assert.NoError(t, err)
+	assert.NoError(t, w.CopyDone())
+	conn.Close()
+
+	pushed, err := dev.FS.ReadFile("/sdcard/dir/pushed.bin")
+	assert.NoError(t, err)
+	assert.Equal(t, data, pushed)
+
+	entry, err := d.Stat(ctx, "/sdcard/dir/pushed.bin")
+	require.NoError(t, err)
+	assert.Equal(t, os.FileMode(0600), entry.Mode)
+	assert.Equal(t, int64(len(data)), entry.Size)
+	assert.Equal(t, mtime.UTC(), entry.ModifiedAt)
+
+	_, err = d.Stat(ctx, "/sdcard/missing")
+	assert.ErrorIs(t, err, wire.ErrFileNoExist)
+
+	conn, r, err := d.OpenFileReader(ctx, "/sdcard/hello.txt")
+	require.NoError(t, err)
+	pulled, err := io.ReadAll(r)
+	conn.Close()
+	assert.NoError(t, err)
+	assert.Equal(t, "hello", string(pulled))
+
+	conn, dr, err := d.OpenDirReader(ctx, "/sdcard")
+	require.NoError(t, err)
+	entries, err := dr.ReadDir(-1)
+	conn.Close()
+	require.ErrorIs(t, err, io.EOF)
+	var names []string
+	for _, e := range entries {
+		names = append(names, e.Name)
+	}
+	assert.Equal(t, []string{"dir", "hello.txt"}, names)
+	assert.True(t, entries[0].Mode.IsDir())
+}
+
+func TestServer_SyncV1(t *testing.T) {
+	testSync(t, []string{"shell_v2"})
+}
+
+func TestServer_SyncV2(t *testing.T) {
+	testSync(t, adbtest.DefaultFeatures)
+}
+
+func TestServer_Forward(t *testing.T) {
+	ctx := context.Background()
+	dev := adbtest.NewDevice("emulator-5554")
+	dev.HandleService("tcp:8080", func(service string, rw io.ReadWriter) {
+		io.Copy(rw, rw)
+	})
+	srv, client := newTestServer(t, dev)
+	d := client.Device(adb.AnyDevice())
+
+	port, err := d.DoForward(ctx, "tcp:6100", "tcp:8080", false)
+	require.NoError(t, err)
+	assert.Zero(t, port)
+	_, err = d.DoForward(ctx, "tcp:6100", "tcp:8081", true)
+	assert.Error(t, err)
+	port, err = d.DoForward(ctx, "tcp:0", "tcp:8080", false)
+	require.NoError(t, err)
+	assert.Equal(t, 40000, port)
+	list, err := d.DoListForward(ctx)
+	require.NoError(t, err)
+	assert.Equal(t, []adb.ForwardEntry{
+		{Serial: "emulator-5554", Local: "tcp:6100", Remote: "tcp:8080"},
+		{Serial: "emulator-5554", Local: "tcp:40000", Remote: "tcp:8080"},
+	}, list)
+
+	conn, err := d.ForwardPort(ctx, 8080)
+	require.NoError(t, err)
+	conn.Write([]byte("ping"))
+	buf := make([]byte, 4)
+	_, err = io.ReadFull(conn, buf)
+	conn.Close()
+	assert.NoError(t, err)
+	assert.Equal(t, "ping", string(buf))
+
+	_, err = d.ForwardPort(ctx, 9090)
+	assert.Error(t, err)
+
+	assert.NoError(t, client.RemoveAllForward(ctx))
+	assert.Empty(t, srv.Forwards())
+}
+
+func TestServer_Reverse(t *testing.T) {
+	ctx := context.Background()
+	dev := adbtest.NewDevice("emulator-5554")
+	_, client := newTestServer(t, dev)
+	d := client.Device(adb.AnyDevice())
+
+	port, err := d.DoReverse(ctx, "tcp:8080", "tcp:9090", false)
+	require.NoError(t, err)
+	assert.Zero(t, port)
+	port, err = d.DoReverse(ctx, "tcp:0", "tcp:9091", false)
+	require.NoError(t, err)
+	assert.Equal(t, 40000, port)
+
+	_, err = d.DoReverse(ctx, "tcp:8080", "tcp:9092", true)
+	assert.ErrorIs(t, err, wire.ErrCannotBind)
+
+	list, err := d.DoListReverse(ctx)
+	require.NoError(t, err)
+	assert.Equal(t, []adb.ForwardEntry{
+		{Serial: "UsbFfs", Local: "tcp:8080", Remote: "tcp:9090"},
+		{Serial: "UsbFfs", Local: "tcp:40000", Remote: "tcp:9091"},
+	}, list)
+
+	require.NoError(t, d.DoRemoveReverse(ctx, "tcp:8080"))
+	assert.ErrorIs(t, d.DoRemoveReverse(ctx, "tcp:8080"), wire.ErrAdb)
+	assert.Len(t, dev.Reverses(), 1)
+
+	require.NoError(t, d.DoRemoveAllReverse(ctx))
+	list, err = d.DoListReverse(ctx)
+	require.NoError(t, err)
+	assert.Empty(t, list)
+}
+
+func TestServer_TrackDevices(t *testing.T) {
+	srv, client := newTestServer(t)
+	watcher := client.NewDeviceWatcher(context.Background())
+	defer watcher.Shutdown()
+
+	next := func() adb.DeviceStateChangedEvent {
+		select {
+		case event := <-watcher.C():
+			return event
+		case <-time.After(5 * time.Second):
+			t.Fatal("timeout waiting for device event")
+			return adb.DeviceStateChangedEvent{}
+		}
+	}
+
+	srv.AddDevice(adbtest.NewDevice("emulator-5554"))
+	event := next()
+	assert.Equal(t, "emulator-5554", event.Serial)
+	assert.True(t, event.CameOnline())
+
+	srv.SetState("emulator-5554", adbtest.StateOffline)
+	event = next()
+	assert.True(t, event.WentOffline())
+
+	srv.RemoveDevice("emulator-5554")
+	event = next()
+	assert.Equal(t, adb.StateDisconnected, event.NewState)
+}
@@ -0,0 +1,100 @@
+package adbtest
+
+import (
+	"encoding/binary"
+	"io"
+	"sync"
+)
+
+// Shell protocol message types, see shell_protocol.h.
+const (
+	shellStdin      byte = 0
+	shellStdout     byte = 1
+	shellStderr     byte = 2
+	shellExit       byte = 3
+	shellCloseStdin byte = 4
+)
+
+// lockedWriter serializes writes of stdout and stderr on the connection.
+type lockedWriter struct {
+	mu *sync.Mutex
+	w  io.Writer
+}
+
+func (l lockedWriter) Write(p []byte) (int, error) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	return l.w.Write(p)
+}
+
+// runShellV1 runs fn with the raw connection: stdin and the merged output are
+// unframed, and the exit code is lost when the connection is closed.
+func runShellV1(rw io.ReadWriter, fn ShellFunc, cmd string) {
+	out := lockedWriter{mu: &sync.Mutex{}, w: rw}
+	fn(cmd, rw, out, out)
+}
+
+// shellPacketWriter writes everything as packets of one shell protocol type.
+type shellPacketWriter struct {
+	mu  *sync.Mutex
+	w   io.Writer
+	typ byte
+}
+
+func (s shellPacketWriter) Write(p []byte) (int, error) {
+	if len(p) == 0 {
+		return 0, nil
+	}
+	if err := writeShellPacket(s.mu, s.w, s.typ, p); err != nil {
+		return 0, err
+	}
+	return len(p), nil
+}
+
+func writeShellPacket(mu *sync.Mutex, w io.Writer, typ byte, data []byte) error {
+	buf := make([]byte, 5+len(data))
+	buf[0] = typ
+	binary.LittleEndian.PutUint32(buf[1:5], uint32(len(data)))
+	copy(buf[5:], data)
+
+	mu.Lock()
+	defer mu.Unlock()
+	_, err := w.Write(buf)
+	return err
+}
+
+// runShellV2 runs fn with the shell protocol: stdin packets are decoded until
+// CLOSE_STDIN, output is framed as stdout/stderr packets, followed by the exit code.
+func runShellV2(rw io.ReadWriter, fn ShellFunc, cmd string) {
+	stdin, stdinWriter := io.Pipe()
+	defer stdin.Close()
+	go func() {
+		var header [5]byte
+		for {
+			if _, err := io.ReadFull(rw, header[:]); err != nil {
+				stdinWriter.CloseWithError(err)
+				return
+			}
+			data := make([]byte, binary.LittleEndian.Uint32(header[1:]))
+			if _, err := io.ReadFull(rw, data); err != nil {
+				stdinWriter.CloseWithError(err)
+				return
+			}
+			switch header[0] {
+			case shellStdin:
+				if _, err := stdinWriter.Write(data); err != nil {
+					return
+				}
+			case shellCloseStdin:
+				stdinWriter.Close()
+				return
+			}
+		}
+	}()
+
+	mu := &sync.Mutex{}
+	code := fn(cmd, stdin,
+		shellPacketWriter{mu: mu, w: rw, typ: shellStdout},
+		shellPacketWriter{mu: mu, w: rw, typ: shellStderr})
+	writeShellPacket(mu, rw, shellExit, []byte{byte(code)})
+}
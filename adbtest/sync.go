@@ -0,0 +1,300 @@
+package adbtest
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"DomaphoneS-Next/backend/goadb/wire"
+)
+
+// syncSession serves the sync protocol of adbd's file_sync_service.cpp on one connection.
+type syncSession struct {
+	rw  io.ReadWriter
+	dev *Device
+}
+
+func newSyncSession(rw io.ReadWriter, dev *Device) *syncSession {
+	return &syncSession{rw: rw, dev: dev}
+}
+
+func (s *syncSession) serve() {
+	for {
+		id, path, err := s.readRequest()
+		if err != nil {
+			return
+		}
+
+		switch id {
+		case wire.ID_LSTAT_V1:
+			err = s.statV1(path)
+		case wire.ID_LSTAT_V2, wire.ID_STAT_V2:
+			err = s.statV2(id, path)
+		case wire.ID_LIST_V1:
+			err = s.list(path, false)
+		case wire.ID_LIST_V2:
+			err = s.list(path, true)
+		case wire.ID_SEND:
+			err = s.send(path)
+		case wire.ID_SEND_V2:
+			err = s.sendV2(path)
+		case wire.ID_RECV:
+			err = s.recv(path)
+		case wire.ID_RECV_V2:
+			err = s.recvV2(path)
+		case wire.ID_QUIT:
+			return
+		default:
+			s.fail(fmt.Sprintf("unknown command %q", id))
+			return
+		}
+		if err != nil {
+			return
+		}
+	}
+}
+
+// readRequest reads a request header, an id and a length, followed by the path.
+func (s *syncSession) readRequest() (id, path string, err error) {
+	var header [8]byte
+	if _, err = io.ReadFull(s.rw, header[:]); err != nil {
+		return
+	}
+	buf := make([]byte, binary.LittleEndian.Uint32(header[4:]))
+	if _, err = io.ReadFull(s.rw, buf); err != nil {
+		return
+	}
+	return string(header[:4]), string(buf), nil
+}
+
+func (s *syncSession) write(id string, fields ...interface{}) error {
+	var buf bytes.Buffer
+	buf.WriteString(id)
+	for _, f := range fields {
+		binary.Write(&buf, binary.LittleEndian, f)
+	}
+	_, err := s.rw.Write(buf.Bytes())
+	return err
+}
+
+// fail sends a FAIL status with msg, which ends the current request.
+func (s *syncSession) fail(msg string) error {
+	if err := s.write(wire.ID_FAIL, uint32(len(msg))); err != nil {
+		return err
+	}
+	_, err := io.WriteString(s.rw, msg)
+	return err
+}
+
+// failErr sends err with the capitalized strerror text of adbd, eg. "No such file or directory".
+func (s *syncSession) failErr(err error) error {
+	msg := toErrno(err).Error()
+	return s.fail(strings.ToUpper(msg[:1]) + msg[1:])
+}
+
+func toErrno(err error) wire.Errno {
+	var errno wire.Errno
+	switch {
+	case errors.As(err, &errno):
+		return errno
+	case errors.Is(err, fs.ErrNotExist):
+		return wire.ENOENT
+	case errors.Is(err, fs.ErrExist):
+		return wire.EEXIST
+	case errors.Is(err, fs.ErrPermission):
+		return wire.EACCES
+	default:
+		return wire.EIO
+	}
+}
+
+// posixMode converts mode to st_mode.
+func posixMode(mode os.FileMode) uint32 {
+	m := uint32(mode.Perm())
+	switch {
+	case mode&os.ModeSymlink != 0:
+		m |= wire.ModeSymlink
+	case mode.IsDir():
+		m |= wire.ModeDir
+	default:
+		m |= 0100000
+	}
+	return m
+}
+
+func (s *syncSession) statV1(path string) error {
+	f, err := s.dev.FS.Stat(path)
+	if err != nil {
+		// stat v1 reports errors as all zeros.
+		return s.write(wire.ID_LSTAT_V1, uint32(0), uint32(0), uint32(0))
+	}
+	return s.write(wire.ID_LSTAT_V1, posixMode(f.Mode), uint32(len(f.Data)), uint32(f.ModTime.Unix()))
+}
+
+// statV2Fields returns the fields of stat_v2 after the id.
+func statV2Fields(f File, err error) []interface{} {
+	if err != nil {
+		return []interface{}{uint32(toErrno(err)), [64]byte{}}
+	}
+	mtime := f.ModTime.Unix()
+	nlink := uint32(1)
+	if f.Mode.IsDir() {
+		nlink = 2
+	}
+	return []interface{}{
+		uint32(0),           // error
+		uint64(0),           // dev
+		uint64(0),           // ino
+		posixMode(f.Mode),   // mode
+		nlink,               // nlink
+		uint32(2000),        // uid, shell
+		uint32(2000),        // gid, shell
+		uint64(len(f.Data)), // size
+		mtime, mtime, mtime, // atime, mtime, ctime
+	}
+}
+
+func (s *syncSession) statV2(id, path string) error {
+	f, err := s.dev.FS.Stat(path)
+	return s.write(id, statV2Fields(f, err)...)
+}
+
+func (s *syncSession) list(path string, v2 bool) error {
+	// adbd lists nothing for a missing directory.
+	entries, _ := s.dev.FS.ReadDir(path)
+	for _, f := range entries {
+		var err error
+		if v2 {
+			fields := append(statV2Fields(f, nil), uint32(len(f.Name)))
+			err = s.write(wire.ID_DENT_V2, fields...)
+		} else {
+			err = s.write(wire.ID_DENT_V1, posixMode(f.Mode), uint32(len(f.Data)), uint32(f.ModTime.Unix()), uint32(len(f.Name)))
+		}
+		if err != nil {
+			return err
+		}
+		if _, err = io.WriteString(s.rw, f.Name); err != nil {
+			return err
+		}
+	}
+
+	if v2 {
+		return s.write(wire.ID_DONE, [statV2DentSize - 4]byte{})
+	}
+	return s.write(wire.ID_DONE, [16]byte{})
+}
+
+// Size of dent_v2 without the name.
+const statV2DentSize = 76
+
+func (s *syncSession) send(pathAndMode string) error {
+	// The mode follows the last comma.
+	pos := strings.LastIndex(pathAndMode, ",")
+	if pos < 0 {
+		return s.fail("missing file mode")
+	}
+	mode, err := strconv.ParseUint(pathAndMode[pos+1:], 10, 32)
+	if err != nil {
+		return s.fail("invalid file mode")
+	}
+	return s.receiveFile(pathAndMode[:pos], os.FileMode(mode), false)
+}
+
+//	struct __attribute__((packed)) {
+//		uint32_t id;
+//		uint32_t mode;
+//		uint32_t flags;
+//	} send_v2_setup;
+func (s *syncSession) sendV2(path string) error {
+	var setup [12]byte
+	if _, err := io.ReadFull(s.rw, setup[:]); err != nil {
+		return err
+	}
+	if string(setup[:4]) != wire.ID_SEND_V2 {
+		return s.fail("SND2 setup expected")
+	}
+	mode := binary.LittleEndian.Uint32(setup[4:8])
+	flags := wire.SyncFlag(binary.LittleEndian.Uint32(setup[8:12]))
+	if flags&^wire.SyncFlagDryRun != 0 {
+		return s.fail(fmt.Sprintf("unsupported flags %#x", uint32(flags)))
+	}
+	return s.receiveFile(path, os.FileMode(mode), flags&wire.SyncFlagDryRun != 0)
+}
+
+// receiveFile reads DATA chunks until DONE, writes the file unless dryRun and acknowledges it.
+func (s *syncSession) receiveFile(path string, mode os.FileMode, dryRun bool) error {
+	var data bytes.Buffer
+	var header [8]byte
+	for {
+		if _, err := io.ReadFull(s.rw, header[:]); err != nil {
+			return err
+		}
+		id, n := string(header[:4]), binary.LittleEndian.Uint32(header[4:])
+		if id == wire.ID_DONE {
+			if dryRun {
+				break
+			}
+			mtime := time.Unix(int64(n), 0)
+			if err := s.dev.FS.writeFile(path, data.Bytes(), mode, mtime); err != nil {
+				return s.failErr(err)
+			}
+			break
+		}
+		if id != wire.ID_DATA {
+			return s.fail(fmt.Sprintf("invalid data message %q", id))
+		}
+		if n > wire.SyncMaxChunkSize {
+			return s.fail("oversize data message")
+		}
+		if _, err := io.CopyN(&data, s.rw, int64(n)); err != nil {
+			return err
+		}
+	}
+	return s.write(wire.ID_OKAY, uint32(0))
+}
+
+func (s *syncSession) recv(path string) error {
+	data, err := s.dev.FS.ReadFile(path)
+	if err != nil {
+		return s.failErr(err)
+	}
+	for len(data) > 0 {
+		n := len(data)
+		if n > wire.SyncMaxChunkSize {
+			n = wire.SyncMaxChunkSize
+		}
+		if err = s.write(wire.ID_DATA, uint32(n)); err != nil {
+			return err
+		}
+		if _, err = s.rw.Write(data[:n]); err != nil {
+			return err
+		}
+		data = data[n:]
+	}
+	return s.write(wire.ID_DONE, uint32(0))
+}
+
+//	struct __attribute__((packed)) {
+//		uint32_t id;
+//		uint32_t flags;
+//	} recv_v2_setup;
+func (s *syncSession) recvV2(path string) error {
+	var setup [8]byte
+	if _, err := io.ReadFull(s.rw, setup[:]); err != nil {
+		return err
+	}
+	if string(setup[:4]) != wire.ID_RECV_V2 {
+		return s.fail("RCV2 setup expected")
+	}
+	if flags := binary.LittleEndian.Uint32(setup[4:]); flags != 0 {
+		return s.fail(fmt.Sprintf("unsupported flags %#x", flags))
+	}
+	return s.recv(path)
+}
@@ -0,0 +1,509 @@
+package adb
+
+import (
+	"archive/zip"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+
+	"DomaphoneS-Next/backend/goadb/wire"
+)
+
+// DeviceSpec describes a device to pick the APKs of an .apks archive for it, like the
+// device spec of bundletool.
+type DeviceSpec struct {
+	// SupportedAbis are the ABIs of the device, preferred first, eg. arm64-v8a.
+	SupportedAbis []string
+	SdkVersion    int
+	// ScreenDensity is the density in dpi, 0 if unknown.
+	ScreenDensity int
+	// SupportedLocales are BCP 47 tags, eg. en-US, only their language is matched.
+	SupportedLocales []string
+}
+
+// DeviceSpec returns the spec of the device from its properties. The density comes from
+// `wm density`, with its override if set, and from the properties when wm has none.
+func (c *Device) DeviceSpec(ctx context.Context) (spec DeviceSpec, err error) {
+	props, err := c.GetProperties(ctx, nil)
+	if err != nil {
+		return spec, err
+	}
+	return deviceSpecOf(ctx, c, props)
+}
+
+var wmDensityRegex = regexp.MustCompile(`(?m)^(Physical|Override) density: (\d+)`)
+
+func deviceSpecOf(ctx context.Context, c *Device, props AndroidProperties) (spec DeviceSpec, err error) {
+	if spec.SupportedAbis, err = props.CpuAbiList(); err != nil {
+		return spec, err
+	}
+	if spec.SdkVersion, err = props.SdkLevel(); err != nil {
+		return spec, err
+	}
+	if locale, err := props.Locale(); err == nil {
+		spec.SupportedLocales = []string{locale}
+	}
+	// The override of `wm density` wins, the properties only have the physical density.
+	resp, wmErr := c.RunCommand(ctx, "wm", "density")
+	if wmErr == nil {
+		spec.ScreenDensity = parseWmDensity(resp)
+	}
+	if spec.ScreenDensity == 0 {
+		if spec.ScreenDensity, err = props.Density(); err != nil {
+			if wmErr != nil {
+				return spec, wmErr
+			}
+			return spec, err
+		}
+	}
+	return spec, nil
+}
+
+// parseWmDensity returns the override density of the `wm density` output, else the
+// physical one, 0 if there's neither.
+func parseWmDensity(resp []byte) (density int) {
+	for _, m := range wmDensityRegex.FindAllSubmatch(resp, -1) {
+		d, _ := strconv.Atoi(string(m[2]))
+		if string(m[1]) == "Override" || density == 0 {
+			density = d
+		}
+	}
+	return density
+}
+
+// InstallAPKs installs the app of the bundletool .apks archive apksPath: the APKs matching
+// the device spec are picked, see SelectAPKs, and installed in one session.
+func (c *Device) InstallAPKs(ctx context.Context, apksPath string, opts InstallOptions) error {
+	spec, err := c.DeviceSpec(ctx)
+	if err != nil {
+		return wrapClientError(err, c, "InstallAPKs")
+	}
+	archive, err := zip.OpenReader(apksPath)
+	if err != nil {
+		return err
+	}
+	defer archive.Close()
+	paths, err := selectAPKs(&archive.Reader, spec)
+	if err != nil {
+		return err
+	}
+
+	dir, err := os.MkdirTemp("", "apks")
+	if err != nil {
+		return err
+	}
+	defer os.RemoveAll(dir)
+	apks := make([]string, len(paths))
+	for i, path := range paths {
+		if apks[i], err = extractZipFile(&archive.Reader, path, dir); err != nil {
+			return err
+		}
+	}
+
+	if len(apks) == 1 {
+		return c.Install(ctx, apks[0], opts)
+	}
+	return c.InstallMultiple(ctx, apks, opts)
+}
+
+// SelectAPKs returns the paths in the .apks archive apksPath of the APKs to install on a
+// device matching spec, read from its toc.pb: the variant for the SDK version and the
+// install-time modules, each with its master split and the splits of the best ABI, screen
+// density and the languages of the device.
+// Splits targeting other dimensions, like texture compression formats, aren't matched and
+// only their fallback is picked.
+func SelectAPKs(apksPath string, spec DeviceSpec) ([]string, error) {
+	archive, err := zip.OpenReader(apksPath)
+	if err != nil {
+		return nil, err
+	}
+	defer archive.Close()
+	return selectAPKs(&archive.Reader, spec)
+}
+
+func selectAPKs(archive *zip.Reader, spec DeviceSpec) ([]string, error) {
+	toc, err := readZipFile(archive, "toc.pb")
+	if err != nil {
+		return nil, err
+	}
+	variants, err := parseApksToc(toc)
+	if err != nil {
+		return nil, err
+	}
+
+	for _, v := range variants {
+		if !v.targeting.matches(spec) {
+			continue
+		}
+		var paths []string
+		for _, apk := range v.apks {
+			if apk.targeting.matches(spec) {
+				paths = append(paths, apk.path)
+			}
+		}
+		if len(paths) == 0 {
+			break
+		}
+		return paths, nil
+	}
+	return nil, fmt.Errorf("%w: no APK of the archive matches the device %+v", wire.ErrNotSupported, spec)
+}
+
+func readZipFile(archive *zip.Reader, name string) ([]byte, error) {
+	f, err := archive.Open(name)
+	if err != nil {
+		return nil, fmt.Errorf("not an .apks archive: %w", err)
+	}
+	defer f.Close()
+	return io.ReadAll(f)
+}
+
+// extractZipFile writes the file name of archive to dir and returns its path.
+func extractZipFile(archive *zip.Reader, name, dir string) (string, error) {
+	src, err := archive.Open(name)
+	if err != nil {
+		return "", err
+	}
+	defer src.Close()
+	// The splits of different modules may have the same name.
+	path := filepath.Join(dir, strings.ReplaceAll(name, "/", "_"))
+	dst, err := os.Create(path)
+	if err != nil {
+		return "", err
+	}
+	_, err = io.Copy(dst, src)
+	return path, errors.Join(err, dst.Close())
+}
+
+// apksVariant is a variant of the toc.pb of an .apks archive: the APKs for a range of
+// devices, of the install-time modules.
+type apksVariant struct {
+	targeting apksTargeting
+	apks      []apksAPK
+}
+
+type apksAPK struct {
+	path      string
+	targeting apksTargeting
+}
+
+// apksTargeting is the targeting of a variant or an APK. The alternatives are the values
+// of the other variants or splits, the device gets the best one among all.
+type apksTargeting struct {
+	sdk, sdkAlternatives            []int
+	abis, abiAlternatives           []string
+	densities, densityAlternatives  []int
+	languages, languageAlternatives []string
+	// other is set for values of dimensions that aren't matched.
+	other bool
+}
+
+// Fields of bundletool's commands.proto and targeting.proto.
+const (
+	tocVariant           = 1 // BuildApksResult.variant
+	variantTargeting     = 1 // Variant.targeting
+	variantApkSet        = 2 // Variant.apk_set
+	apkSetModuleMetadata = 1 // ApkSet.module_metadata
+	apkSetDescription    = 2 // ApkSet.apk_description
+	moduleOnDemand       = 2 // ModuleMetadata.on_demand_deprecated
+	moduleDeliveryType   = 6 // ModuleMetadata.delivery_type
+	apkTargeting         = 1 // ApkDescription.targeting
+	apkPath              = 2 // ApkDescription.path
+	apkSplitMetadata     = 3 // ApkDescription.split_apk_metadata
+	apkStandaloneMeta    = 4 // ApkDescription.standalone_apk_metadata
+
+	deliveryInstallTime = 1
+)
+
+// Targeting dimensions.
+const (
+	dimSdk = iota
+	dimAbi
+	dimDensity
+	dimLanguage
+	dimOther
+)
+
+// VariantTargeting and ApkTargeting number their dimensions differently.
+var (
+	variantDimensions = map[int]int{1: dimSdk, 2: dimAbi, 3: dimDensity, 4: dimOther, 5: dimOther, 6: dimOther}
+	apkDimensions     = map[int]int{1: dimAbi, 2: dimOther, 3: dimLanguage, 4: dimDensity, 5: dimSdk,
+		6: dimOther, 7: dimOther, 8: dimOther, 9: dimOther, 10: dimOther}
+)
+
+// abiAliases are the values of the AbiAlias enum.
+var abiAliases = map[uint64]string{
+	1: "armeabi", 2: "armeabi-v7a", 3: "arm64-v8a", 4: "x86", 5: "x86_64", 6: "mips", 7: "mips64", 8: "riscv64",
+}
+
+// densityAliases are the dpi of the DensityAlias enum, NODPI is left out.
+var densityAliases = map[uint64]int{2: 120, 3: 160, 4: 213, 5: 240, 6: 320, 7: 480, 8: 640}
+
+// parseApksToc decodes the variants of the BuildApksResult message of toc.pb.
+func parseApksToc(toc []byte) ([]apksVariant, error) {
+	var variants []apksVariant
+	err := walkProto(toc, func(num int, _ uint64, data []byte) error {
+		if num != tocVariant || data == nil {
+			return nil
+		}
+		v, err := parseApksVariant(data)
+		variants = append(variants, v)
+		return err
+	})
+	if err != nil {
+		return nil, fmt.Errorf("%w: invalid toc.pb: %w", wire.ErrParse, err)
+	}
+	return variants, nil
+}
+
+func parseApksVariant(msg []byte) (v apksVariant, err error) {
+	err = walkProto(msg, func(num int, _ uint64, data []byte) error {
+		switch num {
+		case variantTargeting:
+			return parseTargeting(data, variantDimensions, &v.targeting)
+		case variantApkSet:
+			apks, err := parseApkSet(data)
+			v.apks = append(v.apks, apks...)
+			return err
+		}
+		return nil
+	})
+	return
+}
+
+// parseApkSet returns the APKs of a module, none if it isn't installed at install time.
+func parseApkSet(msg []byte) ([]apksAPK, error) {
+	var apks []apksAPK
+	installTime := true
+	err := walkProto(msg, func(num int, _ uint64, data []byte) error {
+		switch num {
+		case apkSetModuleMetadata:
+			return walkProto(data, func(num int, v uint64, _ []byte) error {
+				if (num == moduleOnDemand && v != 0) || (num == moduleDeliveryType && v != deliveryInstallTime) {
+					installTime = false
+				}
+				return nil
+			})
+		case apkSetDescription:
+			var apk apksAPK
+			installable := false
+			err := walkProto(data, func(num int, _ uint64, data []byte) error {
+				switch num {
+				case apkTargeting:
+					return parseTargeting(data, apkDimensions, &apk.targeting)
+				case apkPath:
+					apk.path = string(data)
+				case apkSplitMetadata, apkStandaloneMeta:
+					// Instant and system APKs aren't for adb.
+					installable = true
+				}
+				return nil
+			})
+			if installable {
+				apks = append(apks, apk)
+			}
+			return err
+		}
+		return nil
+	})
+	if !installTime {
+		return nil, err
+	}
+	return apks, err
+}
+
+// parseTargeting decodes a VariantTargeting or an ApkTargeting message into t.
+func parseTargeting(msg []byte, dimensions map[int]int, t *apksTargeting) error {
+	return walkProto(msg, func(num int, _ uint64, data []byte) error {
+		dim, ok := dimensions[num]
+		if !ok || data == nil {
+			return nil
+		}
+		// Every dimension has repeated value = 1 and alternatives = 2.
+		return walkProto(data, func(num int, v uint64, data []byte) error {
+			if data == nil || (num != 1 && num != 2) {
+				if dim == dimOther && num == 1 && v != 0 {
+					// SdkRuntimeTargeting.requires_sdk_runtime
+					t.other = true
+				}
+				return nil
+			}
+			value := num == 1
+			switch dim {
+			case dimSdk:
+				min := parseSdkVersion(data)
+				if value {
+					t.sdk = append(t.sdk, min)
+				} else {
+					t.sdkAlternatives = append(t.sdkAlternatives, min)
+				}
+			case dimAbi:
+				abi := parseEnumField(data, abiAliases)
+				if value {
+					t.abis = append(t.abis, abi)
+				} else {
+					t.abiAlternatives = append(t.abiAlternatives, abi)
+				}
+			case dimDensity:
+				dpi := parseDensity(data)
+				if value {
+					t.densities = append(t.densities, dpi)
+				} else {
+					t.densityAlternatives = append(t.densityAlternatives, dpi)
+				}
+			case dimLanguage:
+				if value {
+					t.languages = append(t.languages, string(data))
+				} else {
+					t.languageAlternatives = append(t.languageAlternatives, string(data))
+				}
+			case dimOther:
+				if value {
+					t.other = true
+				}
+			}
+			return nil
+		})
+	})
+}
+
+// parseSdkVersion decodes SdkVersion { Int32Value min = 1; }.
+func parseSdkVersion(msg []byte) (min int) {
+	walkProto(msg, func(num int, _ uint64, data []byte) error {
+		if num == 1 && data != nil {
+			walkProto(data, func(num int, v uint64, _ []byte) error {
+				if num == 1 {
+					min = int(v)
+				}
+				return nil
+			})
+		}
+		return nil
+	})
+	return
+}
+
+// parseEnumField returns the name of the enum in field 1 of msg, like Abi { AbiAlias alias = 1; }.
+func parseEnumField(msg []byte, names map[uint64]string) (name string) {
+	walkProto(msg, func(num int, v uint64, data []byte) error {
+		if num == 1 && data == nil {
+			name = names[v]
+		}
+		return nil
+	})
+	return
+}
+
+// parseDensity decodes ScreenDensity { oneof { DensityAlias density_alias = 1; int32 density_dpi = 2; } }.
+func parseDensity(msg []byte) (dpi int) {
+	walkProto(msg, func(num int, v uint64, data []byte) error {
+		switch num {
+		case 1:
+			dpi = densityAliases[v]
+		case 2:
+			dpi = int(v)
+		}
+		return nil
+	})
+	return
+}
+
+// matches tells whether the values of t are the best ones for spec among the alternatives.
+func (t apksTargeting) matches(spec DeviceSpec) bool {
+	if t.other {
+		return false
+	}
+	if len(t.sdk) > 0 {
+		best, ok := bestSdk(spec.SdkVersion, append(append([]int(nil), t.sdk...), t.sdkAlternatives...))
+		if !ok || !containsInt(t.sdk, best) {
+			return false
+		}
+	}
+	if len(t.abis) > 0 {
+		best, ok := bestAbi(spec.SupportedAbis, append(append([]string(nil), t.abis...), t.abiAlternatives...))
+		if !ok || !containsString(t.abis, best) {
+			return false
+		}
+	}
+	if len(t.densities) > 0 {
+		best := bestDensity(spec.ScreenDensity, append(append([]int(nil), t.densities...), t.densityAlternatives...))
+		if !containsInt(t.densities, best) {
+			return false
+		}
+	}
+	if len(t.languages) > 0 && !matchLanguages(spec.SupportedLocales, t.languages) {
+		return false
+	}
+	return true
+}
+
+// bestSdk returns the highest minimum SDK version the device satisfies.
+func bestSdk(sdk int, mins []int) (best int, ok bool) {
+	for _, min := range mins {
+		if min <= sdk && (!ok || min > best) {
+			best, ok = min, true
+		}
+	}
+	return
+}
+
+// bestAbi returns the preferred ABI of the device among abis.
+func bestAbi(supported, abis []string) (string, bool) {
+	for _, abi := range supported {
+		if containsString(abis, abi) {
+			return abi, true
+		}
+	}
+	return "", false
+}
+
+// bestDensity returns the density the resources of the device are taken from, like
+// Android does: the lowest one above the density of the device, or the highest.
+func bestDensity(density int, densities []int) int {
+	sorted := append([]int(nil), densities...)
+	sort.Ints(sorted)
+	for _, d := range sorted {
+		if d >= density {
+			return d
+		}
+	}
+	return sorted[len(sorted)-1]
+}
+
+// matchLanguages tells whether the language of one of the locales is in languages.
+func matchLanguages(locales, languages []string) bool {
+	for _, locale := range locales {
+		lang, _, _ := strings.Cut(strings.ReplaceAll(locale, "_", "-"), "-")
+		for _, l := range languages {
+			if strings.EqualFold(lang, l) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+func containsInt(list []int, v int) bool {
+	for _, e := range list {
+		if e == v {
+			return true
+		}
+	}
+	return false
+}
+
+func containsString(list []string, v string) bool {
+	for _, e := range list {
+		if e == v {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,209 @@
+package adb_test
+
+import (
+	"archive/zip"
+	"context"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"testing"
+
+	adb "DomaphoneS-Next/backend/goadb"
+	"DomaphoneS-Next/backend/goadb/adbtest"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// Targeting messages of bundletool's targeting.proto, each dimension with value = 1 and
+// alternatives = 2.
+func tocDimension(values, alternatives [][]byte) []byte {
+	var msg []byte
+	for _, v := range values {
+		msg = protoBytes(msg, 1, v)
+	}
+	for _, v := range alternatives {
+		msg = protoBytes(msg, 2, v)
+	}
+	return msg
+}
+
+func tocSdk(min uint64) []byte {
+	return protoBytes(nil, 1, protoVarint(nil, 1, min))
+}
+
+func tocAbi(alias uint64) []byte     { return protoVarint(nil, 1, alias) }
+func tocDensity(alias uint64) []byte { return protoVarint(nil, 1, alias) }
+func tocDpi(dpi uint64) []byte       { return protoVarint(nil, 2, dpi) }
+
+// tocAPK is an ApkDescription of a split with the ApkTargeting field num set to dimension.
+func tocAPK(path string, num int, dimension []byte) []byte {
+	var targeting []byte
+	if dimension != nil {
+		targeting = protoBytes(targeting, num, dimension)
+	}
+	apk := protoBytes(nil, 1, targeting)
+	apk = protoBytes(apk, 2, []byte(path))
+	return protoBytes(apk, 3, nil)
+}
+
+// writeAPKS writes an .apks archive with the toc.pb of a split variant for Android 5 and
+// later, with a base and an on-demand module, and a standalone variant for older devices.
+func writeAPKS(t *testing.T) string {
+	abis := [][]byte{tocAbi(3), tocAbi(4)}
+	densities := [][]byte{tocDensity(6), tocDensity(7)}
+	base := []byte(nil)
+	base = protoBytes(base, 1, protoBytes(nil, 1, []byte("base")))
+	base = protoBytes(base, 2, tocAPK("splits/base-master.apk", 0, nil))
+	base = protoBytes(base, 2, tocAPK("splits/base-arm64_v8a.apk", 1, tocDimension(abis[:1], abis[1:])))
+	base = protoBytes(base, 2, tocAPK("splits/base-x86.apk", 1, tocDimension(abis[1:], abis[:1])))
+	base = protoBytes(base, 2, tocAPK("splits/base-xhdpi.apk", 4, tocDimension(densities[:1], densities[1:])))
+	base = protoBytes(base, 2, tocAPK("splits/base-xxhdpi.apk", 4, tocDimension(densities[1:], densities[:1])))
+	base = protoBytes(base, 2, tocAPK("splits/base-fr.apk", 3, tocDimension([][]byte{[]byte("fr")}, nil)))
+	base = protoBytes(base, 2, tocAPK("splits/base-de.apk", 3, tocDimension([][]byte{[]byte("de")}, nil)))
+	// A split for a texture compression format is never picked.
+	base = protoBytes(base, 2, tocAPK("splits/base-astc.apk", 6, tocDimension([][]byte{protoVarint(nil, 1, 8)}, nil)))
+
+	feature := protoBytes(nil, 1, protoVarint(protoBytes(nil, 1, []byte("feature")), 6, 2))
+	feature = protoBytes(feature, 2, tocAPK("splits/feature-master.apk", 0, nil))
+
+	splitVariant := protoBytes(nil, 1, protoBytes(nil, 1, tocDimension([][]byte{tocSdk(21)}, [][]byte{tocSdk(15)})))
+	splitVariant = protoBytes(splitVariant, 2, base)
+	splitVariant = protoBytes(splitVariant, 2, feature)
+
+	standalone := protoBytes(nil, 2, []byte("standalones/standalone.apk"))
+	standalone = protoBytes(standalone, 4, nil)
+	standaloneVariant := protoBytes(nil, 1, protoBytes(nil, 1, tocDimension([][]byte{tocSdk(15)}, [][]byte{tocSdk(21)})))
+	standaloneVariant = protoBytes(standaloneVariant, 2, protoBytes(nil, 2, standalone))
+
+	toc := protoBytes(nil, 1, standaloneVariant)
+	toc = protoBytes(toc, 1, splitVariant)
+	toc = protoBytes(toc, 4, []byte("com.example"))
+
+	path := filepath.Join(t.TempDir(), "app.apks")
+	f, err := os.Create(path)
+	require.NoError(t, err)
+	defer f.Close()
+	w := zip.NewWriter(f)
+	files := map[string][]byte{"toc.pb": toc}
+	for _, name := range []string{
+		"splits/base-master.apk", "splits/base-arm64_v8a.apk", "splits/base-x86.apk",
+		"splits/base-xhdpi.apk", "splits/base-xxhdpi.apk", "splits/base-fr.apk", "splits/base-de.apk",
+		"splits/base-astc.apk", "splits/feature-master.apk", "standalones/standalone.apk",
+	} {
+		files[name] = []byte(name)
+	}
+	for name, data := range files {
+		fw, err := w.Create(name)
+		require.NoError(t, err)
+		_, err = fw.Write(data)
+		require.NoError(t, err)
+	}
+	require.NoError(t, w.Close())
+	return path
+}
+
+func TestSelectAPKs(t *testing.T) {
+	apks := writeAPKS(t)
+
+	spec := adb.DeviceSpec{
+		SupportedAbis:    []string{"arm64-v8a", "armeabi-v7a"},
+		SdkVersion:       33,
+		ScreenDensity:    420,
+		SupportedLocales: []string{"fr-FR"},
+	}
+	paths, err := adb.SelectAPKs(apks, spec)
+	require.NoError(t, err)
+	assert.Equal(t, []string{
+		"splits/base-master.apk", "splits/base-arm64_v8a.apk", "splits/base-xxhdpi.apk", "splits/base-fr.apk",
+	}, paths)
+
+	// Above the highest density, the highest is picked.
+	spec = adb.DeviceSpec{SupportedAbis: []string{"x86"}, SdkVersion: 21, ScreenDensity: 640}
+	paths, err = adb.SelectAPKs(apks, spec)
+	require.NoError(t, err)
+	assert.Equal(t, []string{"splits/base-master.apk", "splits/base-x86.apk", "splits/base-xxhdpi.apk"}, paths)
+
+	spec = adb.DeviceSpec{SupportedAbis: []string{"x86"}, SdkVersion: 19, ScreenDensity: 320}
+	paths, err = adb.SelectAPKs(apks, spec)
+	require.NoError(t, err)
+	assert.Equal(t, []string{"standalones/standalone.apk"}, paths)
+
+	spec = adb.DeviceSpec{SdkVersion: 10}
+	_, err = adb.SelectAPKs(apks, spec)
+	assert.Error(t, err)
+}
+
+func TestInstallAPKs(t *testing.T) {
+	f := &fakeSessions{splits: map[int]map[string][]byte{}}
+	dev := adbtest.NewDevice("emulator-5554")
+	dev.Features = append(dev.Features, adb.FeatureAbb, adb.FeatureAbbExec)
+	dev.HandleShellFunc(f.handle)
+	props := map[string]string{
+		adb.PropProductCpuAbiList: "x86_64,x86",
+		adb.PropBuildVersionSdk:   "30",
+		adb.PropSysLocale:         "de-DE",
+	}
+	dev.HandleShell("getprop", func(cmd string, stdin io.Reader, stdout, stderr io.Writer) int {
+		for name, value := range props {
+			fmt.Fprintf(stdout, "[%s]: [%s]\n", name, value)
+		}
+		return 0
+	})
+	// Without ro.sf.lcd_density, the density comes from the window manager.
+	dev.HandleShell("wm density", func(cmd string, stdin io.Reader, stdout, stderr io.Writer) int {
+		fmt.Fprintln(stdout, "Physical density: 320")
+		return 0
+	})
+	_, client := newTestClient(t, dev)
+	d := client.Device(adb.AnyDevice())
+
+	spec, err := d.DeviceSpec(context.Background())
+	require.NoError(t, err)
+	assert.Equal(t, adb.DeviceSpec{
+		SupportedAbis:    []string{"x86_64", "x86"},
+		SdkVersion:       30,
+		ScreenDensity:    320,
+		SupportedLocales: []string{"de-DE"},
+	}, spec)
+
+	require.NoError(t, d.InstallAPKs(context.Background(), writeAPKS(t), adb.InstallOptions{}))
+	assert.Equal(t, map[string][]byte{
+		"0_splits_base-master.apk": []byte("splits/base-master.apk"),
+		"1_splits_base-x86.apk":    []byte("splits/base-x86.apk"),
+		"2_splits_base-xhdpi.apk":  []byte("splits/base-xhdpi.apk"),
+		"3_splits_base-de.apk":     []byte("splits/base-de.apk"),
+	}, f.splits[1])
+	assert.Equal(t, []int{1}, f.committed)
+}
+
+func TestDeviceSpec_DensityOverride(t *testing.T) {
+	dev := adbtest.NewDevice("emulator-5554")
+	dev.Properties = map[string]string{
+		adb.PropProductCpuAbiList: "arm64-v8a",
+		adb.PropBuildVersionSdk:   "33",
+		adb.PropLcdDensity:        "420",
+	}
+	dev.HandleShell("wm density", func(cmd string, stdin io.Reader, stdout, stderr io.Writer) int {
+		io.WriteString(stdout, "Physical density: 420\nOverride density: 320\n")
+		return 0
+	})
+	_, client := newTestClient(t, dev)
+
+	spec, err := client.Device(adb.AnyDevice()).DeviceSpec(context.Background())
+	require.NoError(t, err)
+	assert.Equal(t, 320, spec.ScreenDensity)
+
+	// Without wm, the density comes from the property.
+	dev = adbtest.NewDevice("emulator-5556")
+	dev.Properties = map[string]string{
+		adb.PropProductCpuAbiList: "arm64-v8a",
+		adb.PropBuildVersionSdk:   "33",
+		adb.PropLcdDensity:        "420",
+	}
+	_, client = newTestClient(t, dev)
+	spec, err = client.Device(adb.AnyDevice()).DeviceSpec(context.Background())
+	require.NoError(t, err)
+	assert.Equal(t, 420, spec.ScreenDensity)
+}
@@ -0,0 +1,340 @@
+package adb
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"DomaphoneS-Next/backend/goadb/wire"
+)
+
+// Directions of a CaptureFrame.
+const (
+	CaptureDial  = "dial"
+	CaptureSend  = "send" // client to server
+	CaptureRecv  = "recv" // server to client
+	CaptureClose = "close"
+)
+
+// CaptureFrame is one line of a capture file. A capture file is a sequence of
+// JSON encoded frames, one per line, for every Read and Write on every connection
+// opened by a RecordingDialer.
+type CaptureFrame struct {
+	// Conn numbers the connections in the order they were dialed, starting at 1.
+	Conn int       `json:"conn"`
+	Time time.Time `json:"time"`
+	Dir  string    `json:"dir"`
+	// Request is the last service requested on the connection, eg. host:version or sync:.
+	Request string `json:"req,omitempty"`
+	// Address is the dialed address, set in CaptureDial frames.
+	Address string `json:"addr,omitempty"`
+	Data    []byte `json:"data,omitempty"`
+	// Err is the error of a failed dial or read, eg. "EOF".
+	Err string `json:"err,omitempty"`
+}
+
+// RecordingDialer is a Dialer that records the traffic of all its connections to
+// a capture file, which a ReplayDialer can serve back.
+// Everything that goes through the connection is recorded, including sync and shell streams.
+type RecordingDialer struct {
+	dialer Dialer
+
+	mu     sync.Mutex
+	w      io.Writer
+	enc    *json.Encoder
+	nextID int
+}
+
+// NewRecordingDialer returns a RecordingDialer that writes the capture to w.
+// dialer connects to the server, the default TCP dialer is used if it's nil.
+func NewRecordingDialer(dialer Dialer, w io.Writer) *RecordingDialer {
+	if dialer == nil {
+		dialer = netDialer{}
+	}
+	return &RecordingDialer{dialer: dialer, w: w, enc: json.NewEncoder(w)}
+}
+
+func (d *RecordingDialer) Dial(ctx context.Context, address string) (*wire.Conn, error) {
+	d.mu.Lock()
+	d.nextID++
+	id := d.nextID
+	d.mu.Unlock()
+
+	conn, err := d.dialer.Dial(ctx, address)
+	frame := CaptureFrame{Conn: id, Dir: CaptureDial, Address: address}
+	if err != nil {
+		frame.Err = err.Error()
+	}
+	d.record(frame)
+	if err != nil {
+		return nil, err
+	}
+
+	// Wrapping the underlying net.Conn also captures SyncConn, which bypasses wire.Conn.
+	return wire.NewConn(&recordingConn{Conn: conn.Conn, id: id, dialer: d, expectRequest: true}), nil
+}
+
+func (d *RecordingDialer) record(frame CaptureFrame) {
+	frame.Time = time.Now()
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	if err := d.enc.Encode(frame); err != nil {
+		debugLog(fmt.Sprintf("capture write failed: %v", err))
+	}
+}
+
+// recordingConn records every Read and Write as a frame.
+type recordingConn struct {
+	net.Conn
+	id     int
+	dialer *RecordingDialer
+
+	mu sync.Mutex
+	// request is the last request sent, expectRequest is false once the
+	// connection has been switched to a service and carries a raw stream.
+	request       string
+	expectRequest bool
+}
+
+func (c *recordingConn) Write(b []byte) (int, error) {
+	req := c.trackRequest(b)
+	n, err := c.Conn.Write(b)
+	frame := CaptureFrame{Conn: c.id, Dir: CaptureSend, Request: req, Data: append([]byte(nil), b[:n]...)}
+	if err != nil {
+		frame.Err = err.Error()
+	}
+	c.dialer.record(frame)
+	return n, err
+}
+
+func (c *recordingConn) Read(b []byte) (int, error) {
+	n, err := c.Conn.Read(b)
+	frame := CaptureFrame{Conn: c.id, Dir: CaptureRecv, Request: c.currentRequest(), Data: append([]byte(nil), b[:n]...)}
+	if err != nil {
+		frame.Err = err.Error()
+	}
+	c.dialer.record(frame)
+	return n, err
+}
+
+func (c *recordingConn) Close() error {
+	c.dialer.record(CaptureFrame{Conn: c.id, Dir: CaptureClose, Request: c.currentRequest()})
+	return c.Conn.Close()
+}
+
+func (c *recordingConn) currentRequest() string {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.request
+}
+
+// trackRequest updates the current request if b is a request message, and returns it.
+// Only host:transport requests keep the connection in request mode.
+func (c *recordingConn) trackRequest(b []byte) string {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if !c.expectRequest || len(b) < 4 {
+		return c.request
+	}
+	length, err := strconv.ParseUint(string(b[:4]), 16, 16)
+	if err != nil || int(length) != len(b)-4 {
+		return c.request
+	}
+	c.request = string(b[4:])
+	c.expectRequest = strings.HasPrefix(c.request, "host:transport") || strings.HasPrefix(c.request, "host:tport")
+	return c.request
+}
+
+// ReplayDialer is a Dialer that serves a capture written by a RecordingDialer.
+// The n-th Dial returns the n-th recorded connection, so replays are deterministic
+// for code that dials sequentially. Reads return the recorded server data, and
+// writes fail with wire.ErrAssertion if they differ from what was recorded.
+// Timestamps are ignored, a replay runs as fast as the client reads.
+type ReplayDialer struct {
+	mu    sync.Mutex
+	dials []CaptureFrame
+	conns map[int][]CaptureFrame
+	next  int
+}
+
+// NewReplayDialer reads a capture file.
+func NewReplayDialer(r io.Reader) (*ReplayDialer, error) {
+	d := &ReplayDialer{conns: map[int][]CaptureFrame{}}
+	scanner := bufio.NewScanner(r)
+	// Frames hold up to a sync chunk, base64 encoded.
+	scanner.Buffer(make([]byte, 64*1024), 4*wire.MaxPayload)
+	for line := 1; scanner.Scan(); line++ {
+		if len(bytes.TrimSpace(scanner.Bytes())) == 0 {
+			continue
+		}
+		var frame CaptureFrame
+		if err := json.Unmarshal(scanner.Bytes(), &frame); err != nil {
+			return nil, fmt.Errorf("%w: capture line %d: %w", wire.ErrParse, line, err)
+		}
+		if frame.Dir == CaptureDial {
+			d.dials = append(d.dials, frame)
+		} else {
+			d.conns[frame.Conn] = append(d.conns[frame.Conn], frame)
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+	return d, nil
+}
+
+// LoadReplayDialer reads the capture file at path.
+func LoadReplayDialer(path string) (*ReplayDialer, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	return NewReplayDialer(f)
+}
+
+func (d *ReplayDialer) Dial(ctx context.Context, address string) (*wire.Conn, error) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	if d.next >= len(d.dials) {
+		return nil, fmt.Errorf("%w: replay has no more recorded connections, dialed %d", wire.ErrServerNotAvailable, d.next)
+	}
+	dial := d.dials[d.next]
+	d.next++
+	if dial.Err != "" {
+		return nil, fmt.Errorf("%w: recorded dial error: %s", wire.ErrServerNotAvailable, dial.Err)
+	}
+	return wire.NewConn(newReplayConn(dial, d.conns[dial.Conn])), nil
+}
+
+// Remaining returns the number of recorded connections that haven't been dialed yet.
+func (d *ReplayDialer) Remaining() int {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	return len(d.dials) - d.next
+}
+
+// replayConn serves the recv frames of a connection and checks writes against its send frames.
+// Reads and writes use separate cursors, so a shell session may read and write concurrently.
+type replayConn struct {
+	id     int
+	remote string
+	closed chan struct{}
+	once   sync.Once
+
+	rmu  sync.Mutex
+	recv []CaptureFrame
+	rbuf []byte
+
+	wmu  sync.Mutex
+	sent []CaptureFrame
+	wbuf []byte
+}
+
+func newReplayConn(dial CaptureFrame, frames []CaptureFrame) *replayConn {
+	c := &replayConn{id: dial.Conn, remote: dial.Address, closed: make(chan struct{})}
+	for _, f := range frames {
+		switch f.Dir {
+		case CaptureRecv:
+			c.recv = append(c.recv, f)
+		case CaptureSend:
+			c.sent = append(c.sent, f)
+		}
+	}
+	return c
+}
+
+func (c *replayConn) isClosed() bool {
+	select {
+	case <-c.closed:
+		return true
+	default:
+		return false
+	}
+}
+
+func (c *replayConn) Read(b []byte) (int, error) {
+	c.rmu.Lock()
+	defer c.rmu.Unlock()
+	for len(c.rbuf) == 0 {
+		if c.isClosed() {
+			return 0, net.ErrClosed
+		}
+		if len(c.recv) == 0 {
+			return 0, io.EOF
+		}
+		frame := c.recv[0]
+		c.recv = c.recv[1:]
+		c.rbuf = frame.Data
+		if len(c.rbuf) == 0 && frame.Err != "" {
+			return 0, replayError(frame.Err)
+		}
+	}
+	n := copy(b, c.rbuf)
+	c.rbuf = c.rbuf[n:]
+	return n, nil
+}
+
+func replayError(msg string) error {
+	if msg == io.EOF.Error() {
+		return io.EOF
+	}
+	return errors.New(msg)
+}
+
+func (c *replayConn) Write(b []byte) (int, error) {
+	c.wmu.Lock()
+	defer c.wmu.Unlock()
+	if c.isClosed() {
+		return 0, net.ErrClosed
+	}
+	written := 0
+	for written < len(b) {
+		if len(c.wbuf) == 0 {
+			if len(c.sent) == 0 {
+				return written, fmt.Errorf("%w: replay conn %d: unexpected write %q after the recorded traffic",
+					wire.ErrAssertion, c.id, b[written:])
+			}
+			c.wbuf = c.sent[0].Data
+			c.sent = c.sent[1:]
+			continue
+		}
+		n := len(b) - written
+		if n > len(c.wbuf) {
+			n = len(c.wbuf)
+		}
+		if !bytes.Equal(b[written:written+n], c.wbuf[:n]) {
+			return written, fmt.Errorf("%w: replay conn %d: wrote %q, recorded %q",
+				wire.ErrAssertion, c.id, b[written:written+n], c.wbuf[:n])
+		}
+		c.wbuf = c.wbuf[n:]
+		written += n
+	}
+	return written, nil
+}
+
+func (c *replayConn) Close() error {
+	c.once.Do(func() { close(c.closed) })
+	return nil
+}
+
+func (c *replayConn) LocalAddr() net.Addr                { return replayAddr("replay") }
+func (c *replayConn) RemoteAddr() net.Addr               { return replayAddr(c.remote) }
+func (c *replayConn) SetDeadline(t time.Time) error      { return nil }
+func (c *replayConn) SetReadDeadline(t time.Time) error  { return nil }
+func (c *replayConn) SetWriteDeadline(t time.Time) error { return nil }
+
+type replayAddr string
+
+func (a replayAddr) Network() string { return "replay" }
+func (a replayAddr) String() string  { return string(a) }
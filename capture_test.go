@@ -0,0 +1,106 @@
+package adb_test
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"io"
+	"strings"
+	"testing"
+
+	adb "DomaphoneS-Next/backend/goadb"
+	"DomaphoneS-Next/backend/goadb/adbtest"
+	"DomaphoneS-Next/backend/goadb/wire"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+type captureResult struct {
+	version int
+	serials []string
+	output  string
+	content string
+}
+
+func runCaptureScenario(t *testing.T, client *adb.Adb) captureResult {
+	ctx := context.Background()
+	var r captureResult
+	var err error
+	r.version, err = client.ServerVersion(ctx)
+	require.NoError(t, err)
+	r.serials, err = client.ListDeviceSerials(ctx)
+	require.NoError(t, err)
+
+	d := client.Device(adb.AnyDevice())
+	out, err := d.RunCommand(ctx, "echo", "hello")
+	require.NoError(t, err)
+	r.output = string(out)
+
+	conn, reader, err := d.OpenFileReader(ctx, "/sdcard/file.txt")
+	require.NoError(t, err)
+	content, err := io.ReadAll(reader)
+	conn.Close()
+	require.NoError(t, err)
+	r.content = string(content)
+	return r
+}
+
+func TestRecordAndReplay(t *testing.T) {
+	srv, err := adbtest.NewServer()
+	require.NoError(t, err)
+	defer srv.Close()
+	dev := adbtest.NewDevice("emulator-5554")
+	dev.HandleShell("echo hello", adbtest.Reply("hello\n", "", 0))
+	require.NoError(t, dev.FS.WriteFile("/sdcard/file.txt", []byte("content"), 0644))
+	srv.AddDevice(dev)
+
+	var capture bytes.Buffer
+	config := srv.Config()
+	config.Dialer = adb.NewRecordingDialer(nil, &capture)
+	client, err := adb.NewWithConfig(config)
+	require.NoError(t, err)
+	recorded := runCaptureScenario(t, client)
+	assert.Equal(t, captureResult{adbtest.Version, []string{"emulator-5554"}, "hello\n", "content"}, recorded)
+
+	// Every frame carries the request of its connection.
+	var requests []string
+	for _, line := range strings.Split(strings.TrimSpace(capture.String()), "\n") {
+		var frame adb.CaptureFrame
+		require.NoError(t, json.Unmarshal([]byte(line), &frame))
+		if frame.Dir == adb.CaptureSend && (len(requests) == 0 || requests[len(requests)-1] != frame.Request) {
+			requests = append(requests, frame.Request)
+		}
+	}
+	assert.Contains(t, requests, "host:version")
+	assert.Contains(t, requests, "shell:echo hello")
+	assert.Contains(t, requests, "sync:")
+
+	// The replay doesn't need the server.
+	replay, err := adb.NewReplayDialer(bytes.NewReader(capture.Bytes()))
+	require.NoError(t, err)
+	config.Dialer = replay
+	config.Port = 1
+	client, err = adb.NewWithConfig(config)
+	require.NoError(t, err)
+	assert.Equal(t, recorded, runCaptureScenario(t, client))
+	assert.Zero(t, replay.Remaining())
+}
+
+func TestReplay_UnexpectedRequest(t *testing.T) {
+	capture := `{"conn":1,"time":"2024-01-01T00:00:00Z","dir":"dial","addr":"127.0.0.1:5037"}
+{"conn":1,"time":"2024-01-01T00:00:00Z","dir":"send","req":"host:version","data":"MDAwY2hvc3Q6dmVyc2lvbg=="}
+{"conn":1,"time":"2024-01-01T00:00:00Z","dir":"recv","req":"host:version","data":"T0tBWTAwMDQwMDI5"}
+{"conn":1,"time":"2024-01-01T00:00:00Z","dir":"recv","req":"host:version","err":"EOF"}
+`
+	replay, err := adb.NewReplayDialer(strings.NewReader(capture))
+	require.NoError(t, err)
+
+	conn, err := replay.Dial(context.Background(), "127.0.0.1:5037")
+	require.NoError(t, err)
+	_, err = conn.RoundTripSingleResponse([]byte("host:devices"))
+	assert.ErrorIs(t, err, wire.ErrAssertion)
+
+	_, err = replay.Dial(context.Background(), "127.0.0.1:5037")
+	assert.ErrorIs(t, err, wire.ErrServerNotAvailable)
+}
@@ -1,6 +1,7 @@
 package main
 
 import (
+	"context"
 	"encoding/hex"
 	"errors"
 	"fmt"
@@ -118,7 +119,7 @@ func parseDevice() adb.DeviceDescriptor {
 
 func listDevices(long bool) int {
 	//client := adb.New(server)
-	devices, err := client.ListDevices()
+	devices, err := client.ListDevices(context.Background())
 	if err != nil {
 		fmt.Fprintln(os.Stderr, "error:", err)
 	}
@@ -165,7 +166,7 @@ func runShellCommand(commandAndArgs []string, device adb.DeviceDescriptor) int {
 	}
 
 	client := client.Device(device)
-	reader, err := client.RunCommand(command, args...)
+	reader, err := client.RunCommand(context.Background(), command, args...)
 	if err != nil {
 		fmt.Fprintln(os.Stderr, "error:", err)
 		return 1
@@ -181,7 +182,7 @@ func runShellCommand(commandAndArgs []string, device adb.DeviceDescriptor) int {
 
 func ps(device adb.DeviceDescriptor) int {
 	client := client.Device(device)
-	list, err := client.ListProcesses(nil)
+	list, err := client.ListProcesses(context.Background(), nil)
 	if err != nil {
 		panic(err)
 		return 1
@@ -205,7 +206,7 @@ func pull(showProgress bool, remotePath, localPath string, device adb.DeviceDesc
 
 	client := client.Device(device)
 
-	info, err := client.Stat(remotePath)
+	info, err := client.Stat(context.Background(), remotePath)
 	if errors.Is(err, wire.ErrFileNoExist) {
 		fmt.Fprintln(os.Stderr, "remote file does not exist:", remotePath)
 		return 1
@@ -214,7 +215,7 @@ func pull(showProgress bool, remotePath, localPath string, device adb.DeviceDesc
 		return 1
 	}
 
-	sc, remoteFile, err := client.OpenFileReader(remotePath)
+	sc, remoteFile, err := client.OpenFileReader(context.Background(), remotePath)
 	if err != nil {
 		fmt.Fprintf(os.Stderr, "error opening remote file %s: %v\n", remotePath, err)
 		return 1
@@ -277,7 +278,7 @@ func push(showProgress bool, localPath, remotePath string, device adb.DeviceDesc
 	defer localFile.Close()
 
 	client := client.Device(device)
-	sc, writer, err := client.OpenFileWriter(remotePath, perms, mtime)
+	sc, writer, err := client.OpenFileWriter(context.Background(), remotePath, perms, mtime)
 	if err != nil {
 		fmt.Fprintf(os.Stderr, "error opening remote file %s: %s\n", remotePath, err)
 		return 1
@@ -336,7 +337,7 @@ func copyWithProgressAndStats(dst io.Writer, src io.Reader, size int, showProgre
 
 func push2(descriptor adb.DeviceDescriptor, localPath, remotePath string) int {
 	device := client.Device(descriptor)
-	err := device.PushDir(localPath, remotePath, true, func(totalFiles, sentFiles uint64, current string, percent, speed float64, err error) {
+	err := device.PushDir(context.Background(), localPath, remotePath, true, func(totalFiles, sentFiles uint64, current string, percent, speed float64, err error) {
 		if err != nil {
 			fmt.Printf("[%d/%d] pushing %s, %.2f%%, err:%s\n", sentFiles, totalFiles, current, percent, err.Error())
 		} else {
@@ -2,6 +2,7 @@
 package main
 
 import (
+	"context"
 	"flag"
 	"fmt"
 	"io"
@@ -28,15 +29,15 @@ func main() {
 		log.Fatal(err)
 	}
 	fmt.Println("Starting server…")
-	client.StartServer()
+	client.StartServer(context.Background())
 
-	serverVersion, err := client.ServerVersion()
+	serverVersion, err := client.ServerVersion(context.Background())
 	if err != nil {
 		log.Fatal(err)
 	}
 	fmt.Println("Server version:", serverVersion)
 
-	devices, err := client.ListDevices()
+	devices, err := client.ListDevices(context.Background())
 	if err != nil {
 		log.Fatal(err)
 	}
@@ -49,7 +50,7 @@ func main() {
 	PrintDeviceInfoAndError(adb.AnyLocalDevice())
 	PrintDeviceInfoAndError(adb.AnyUsbDevice())
 
-	serials, err := client.ListDeviceSerials()
+	serials, err := client.ListDeviceSerials(context.Background())
 	if err != nil {
 		log.Fatal(err)
 	}
@@ -59,7 +60,7 @@ func main() {
 
 	fmt.Println()
 	fmt.Println("Watching for device state changes.")
-	watcher := client.NewDeviceWatcher()
+	watcher := client.NewDeviceWatcher(context.Background())
 	for event := range watcher.C() {
 		fmt.Printf("\t[%s]%+v\n", time.Now(), event)
 	}
@@ -79,15 +80,15 @@ func PrintDeviceInfoAndError(descriptor adb.DeviceDescriptor) {
 }
 
 func PrintDeviceInfo(device *adb.Device) error {
-	serialNo, err := device.Serial()
+	serialNo, err := device.Serial(context.Background())
 	if err != nil {
 		return err
 	}
-	devPath, err := device.DevicePath()
+	devPath, err := device.DevicePath(context.Background())
 	if err != nil {
 		return err
 	}
-	state, err := device.State()
+	state, err := device.State(context.Background())
 	if err != nil {
 		return err
 	}
@@ -97,20 +98,20 @@ func PrintDeviceInfo(device *adb.Device) error {
 	fmt.Printf("\tdevPath: %s\n", devPath)
 	fmt.Printf("\tstate: %s\n", state)
 
-	cmdOutput, err := device.RunCommand("pwd")
+	cmdOutput, err := device.RunCommand(context.Background(), "pwd")
 	if err != nil {
 		fmt.Println("\terror running command:", err)
 	}
 	fmt.Printf("\tcmd output: %s\n", cmdOutput)
 
-	stat, err := device.Stat("/sdcard")
+	stat, err := device.Stat(context.Background(), "/sdcard")
 	if err != nil {
 		fmt.Println("\terror stating /sdcard:", err)
 	}
 	fmt.Printf("\tstat \"/sdcard\": %+v\n", stat)
 
 	fmt.Println("\tfiles in \"/\":")
-	sc, dr, err := device.OpenDirReader("/")
+	sc, dr, err := device.OpenDirReader(context.Background(), "/")
 	if err != nil {
 		fmt.Println("\terror listing files:", err)
 	} else {
@@ -126,7 +127,7 @@ func PrintDeviceInfo(device *adb.Device) error {
 	}
 
 	fmt.Println("\tnon-existent file:")
-	stat, err = device.Stat("/supercalifragilisticexpialidocious")
+	stat, err = device.Stat(context.Background(), "/supercalifragilisticexpialidocious")
 	if err != nil {
 		fmt.Println("\terror:", err)
 	} else {
@@ -134,7 +135,7 @@ func PrintDeviceInfo(device *adb.Device) error {
 	}
 
 	fmt.Print("\tload avg: ")
-	sc, loadavgReader, err := device.OpenFileReader("/proc/loadavg")
+	sc, loadavgReader, err := device.OpenFileReader(context.Background(), "/proc/loadavg")
 	if err != nil {
 		fmt.Println("\terror opening file:", err)
 	} else {
@@ -2,6 +2,7 @@
 package main
 
 import (
+	"context"
 	"bufio"
 	"flag"
 	"fmt"
@@ -55,7 +56,7 @@ func doCommand(cmd string) error {
 		log.Fatal(err)
 	}
 
-	conn, err := server.Dial()
+	conn, err := server.Dial(context.Background())
 	if err != nil {
 		log.Fatal(err)
 	}
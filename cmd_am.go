@@ -2,6 +2,7 @@ package adb
 
 import (
 	"bytes"
+	"context"
 	"errors"
 	"fmt"
 	"regexp"
@@ -52,8 +53,8 @@ func UnpackActivity(resp []byte) (l []Activity) {
 // TODO: may not support multi display.
 // references:
 // https://stackoverflow.com/questions/13193592/getting-the-name-of-the-current-activity-via-adb
-func (d *Device) GetCurrentActivity() (app []Activity, err error) {
-	resp, err := d.RunCommandTimeout(d.CmdTimeoutLong, "dumpsys activity activities | grep ResumedActivity")
+func (d *Device) GetCurrentActivity(ctx context.Context) (app []Activity, err error) {
+	resp, err := d.runCommandTimeout(ctx, d.CmdTimeoutLong, "dumpsys activity activities | grep ResumedActivity")
 	if err != nil {
 		return // tcp error
 	}
@@ -90,10 +91,10 @@ func (d *Device) GetCurrentActivity() (app []Activity, err error) {
 // $ adb shell monkey -p com.android.settings1111 1
 // ...
 // ** No activities found to run, monkey aborted.
-func (d *Device) LaunchAppByMonkey(packageName string) (resp []byte, err error) {
+func (d *Device) LaunchAppByMonkey(ctx context.Context, packageName string) (resp []byte, err error) {
 	// https://stackoverflow.com/questions/4567904/how-to-start-an-application-using-android-adb-tools
 	cmd := "monkey -p " + packageName + " 1"
-	resp, err = d.RunCommandTimeout(d.CmdTimeoutLong, cmd)
+	resp, err = d.runCommandTimeout(ctx, d.CmdTimeoutLong, cmd)
 	if err != nil {
 		return // tcp error
 	}
@@ -116,8 +117,8 @@ func (d *Device) LaunchAppByMonkey(packageName string) (resp []byte, err error)
 // Starting: Intent { cmp=com.EpicLRT.ActionRPGSample/com.epicgames.ue4.SplashActivity1 }
 // Error type 3
 // Error: Activity class {com.EpicLRT.ActionRPGSample/com.epicgames.ue4.SplashActivity1} does not exist.
-func (d *Device) AmStart(pkgActivityName string) error {
-	resp, err := d.RunCommandTimeout(d.CmdTimeoutLong, "am start -n "+pkgActivityName)
+func (d *Device) AmStart(ctx context.Context, pkgActivityName string) error {
+	resp, err := d.runCommandTimeout(ctx, d.CmdTimeoutLong, "am start -n "+pkgActivityName)
 	if err != nil {
 		return err // tcp error
 	}
@@ -131,8 +132,8 @@ func (d *Device) AmStart(pkgActivityName string) error {
 
 // ForceStopPackage force-stop app
 // Android 14: don't need permission
-func (d *Device) AmForceStop(packageName string) (err error) {
-	resp, err := d.RunCommandTimeout(d.CmdTimeoutLong, "am force-stop "+packageName)
+func (d *Device) AmForceStop(ctx context.Context, packageName string) (err error) {
+	resp, err := d.runCommandTimeout(ctx, d.CmdTimeoutLong, "am force-stop "+packageName)
 	if err != nil {
 		return err // tcp error
 	}
@@ -1,6 +1,7 @@
 package adb_test
 
 import (
+	"context"
 	"fmt"
 	"testing"
 
@@ -12,7 +13,7 @@ import (
 func TestDevice_GetCurrentActivity(t *testing.T) {
 	assert.NotNil(t, adbclient)
 	d := adbclient.Device(adb.AnyDevice())
-	list, err := d.GetCurrentActivity()
+	list, err := d.GetCurrentActivity(context.TODO())
 	assert.Nil(t, err)
 	for _, l := range list {
 		fmt.Println(l)
@@ -22,23 +23,23 @@ func TestDevice_GetCurrentActivity(t *testing.T) {
 func TestDevice_ForceStopApp(t *testing.T) {
 	assert.NotNil(t, adbclient)
 	d := adbclient.Device(adb.AnyDevice())
-	list, err := d.GetCurrentActivity()
+	list, err := d.GetCurrentActivity(context.TODO())
 	assert.Nil(t, err)
-	err = d.AmForceStop(list[0].Package)
+	err = d.AmForceStop(context.TODO(), list[0].Package)
 	assert.Nil(t, err)
 }
 
 func TestDevice_StartApp(t *testing.T) {
 	assert.NotNil(t, adbclient)
 	d := adbclient.Device(adb.AnyDevice())
-	_, err := d.LaunchAppByMonkey("com.android.settings")
+	_, err := d.LaunchAppByMonkey(context.TODO(), "com.android.settings")
 	assert.Nil(t, err)
 }
 
 func TestDevice_StartApp2(t *testing.T) {
 	assert.NotNil(t, adbclient)
 	d := adbclient.Device(adb.AnyDevice())
-	_, err := d.LaunchAppByMonkey("com.EpicLRT.ActionRPGSample")
+	_, err := d.LaunchAppByMonkey(context.TODO(), "com.EpicLRT.ActionRPGSample")
 	assert.Nil(t, err)
 }
 
@@ -1,6 +1,7 @@
 package adb
 
 import (
+	"context"
 	"errors"
 	"fmt"
 	"regexp"
@@ -198,9 +199,9 @@ func unpackDfV2(resp []byte) (names []DfEntry) {
 // Android 5.x, they may be not same
 // please see comments in cmd_df_test.go
 // in general, check '/data' in MountedOn, which is supported on Android 5.x ~ Android14
-func (d *Device) DF() (list []DfEntry, err error) {
+func (d *Device) DF(ctx context.Context) (list []DfEntry, err error) {
 	// detect wether support df -h or not
-	resp, err := d.RunCommand("df", "-h")
+	resp, err := d.RunCommand(ctx, "df", "-h")
 	if err != nil {
 		return
 	}
@@ -208,7 +209,7 @@ func (d *Device) DF() (list []DfEntry, err error) {
 	// if received too few bytes, means 'df -h' is not supported
 	if len(resp) < 128 {
 		// <= Android 6.x
-		resp, err = d.RunCommand("df")
+		resp, err = d.RunCommand(ctx, "df")
 		if err != nil {
 			return
 		}
@@ -224,8 +225,8 @@ func (d *Device) DF() (list []DfEntry, err error) {
 }
 
 // 使用最大分区作为磁盘大小的近似
-func (d *Device) GetDiskSize() (sizeInBytes uint64, err error) {
-	list, err := d.DF()
+func (d *Device) GetDiskSize(ctx context.Context) (sizeInBytes uint64, err error) {
+	list, err := d.DF(ctx)
 	if err != nil {
 		return
 	}
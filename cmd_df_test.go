@@ -1,6 +1,7 @@
 package adb
 
 import (
+	"context"
 	"fmt"
 	"testing"
 
@@ -294,7 +295,7 @@ tmpfs             7.4G  16K  7.4G   1% /apex
 
 func TestDevice_DF(t *testing.T) {
 	d := adbclient.Device(AnyDevice())
-	entries, err := d.DF()
+	entries, err := d.DF(context.TODO())
 	assert.Nil(t, err)
 	for _, entry := range entries {
 		fmt.Printf("%s:%s size=%s used=%s avail=%s\n", entry.FileSystem, entry.MountedOn,
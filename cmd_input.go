@@ -0,0 +1,359 @@
+package adb
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"DomaphoneS-Next/backend/goadb/wire"
+)
+
+// DefaultDisplay sends input events to the default display. Other display IDs need
+// Android 10, they are the logical IDs listed by `dumpsys display`.
+const DefaultDisplay = -1
+
+const (
+	// inputTextChunk is the number of characters typed by one input text command: long
+	// command lines are truncated by some devices and input drops characters.
+	inputTextChunk = 200
+	// defaultLongPress is the duration of LongPress by default, above the long press timeout
+	// of ViewConfiguration.
+	defaultLongPress = time.Second
+)
+
+// inputCommand returns the input command line for display.
+func inputCommand(display int, args ...string) string {
+	cmd := "input"
+	if display != DefaultDisplay {
+		cmd += " -d " + strconv.Itoa(display)
+	}
+	return cmd + " " + strings.Join(args, " ")
+}
+
+func itoa(values ...int) []string {
+	s := make([]string, len(values))
+	for i, v := range values {
+		s[i] = strconv.Itoa(v)
+	}
+	return s
+}
+
+func tapCommand(display, x, y int) string {
+	return inputCommand(display, append([]string{"tap"}, itoa(x, y)...)...)
+}
+
+func swipeCommand(display int, command string, x1, y1, x2, y2 int, duration time.Duration) string {
+	return inputCommand(display, append([]string{command}, itoa(x1, y1, x2, y2, int(duration.Milliseconds()))...)...)
+}
+
+func keyEventCommand(display int, keycodes []Keycode) (string, error) {
+	if len(keycodes) == 0 {
+		return "", fmt.Errorf("%w: no key code", wire.ErrAssertion)
+	}
+	args := []string{"keyevent"}
+	for _, k := range keycodes {
+		args = append(args, strconv.Itoa(int(k)))
+	}
+	return inputCommand(display, args...), nil
+}
+
+// textCommands returns the commands typing text. input text types printable ASCII only,
+// so newlines and tabs are sent as key events. Spaces are typed as %s, the text is single
+// quoted for the shell and split so that no command has a literal %s.
+func textCommands(display int, text string) ([]string, error) {
+	var cmds []string
+	var chunk []byte
+	flush := func() {
+		if len(chunk) > 0 {
+			s := strings.ReplaceAll(string(chunk), " ", "%s")
+			s = strings.ReplaceAll(s, "'", `'\''`)
+			cmds = append(cmds, inputCommand(display, "text", "'"+s+"'"))
+			chunk = chunk[:0]
+		}
+	}
+	for i, r := range text {
+		switch {
+		case r == '\n':
+			flush()
+			cmds = append(cmds, inputCommand(display, "keyevent", strconv.Itoa(int(KeycodeEnter))))
+			continue
+		case r == '\t':
+			flush()
+			cmds = append(cmds, inputCommand(display, "keyevent", strconv.Itoa(int(KeycodeTab))))
+			continue
+		case r < ' ' || r > '~':
+			return nil, fmt.Errorf("%w: input text can't type %q at offset %d", wire.ErrNotSupported, r, i)
+		case r == 's' && len(chunk) > 0 && chunk[len(chunk)-1] == '%':
+			flush()
+		}
+		chunk = append(chunk, byte(r))
+		if len(chunk) == inputTextChunk {
+			flush()
+		}
+	}
+	flush()
+	return cmds, nil
+}
+
+// runInput runs the input commands cmds in order, each its own command line so that none is
+// longer than a text chunk. Each takes as long as input needs to start, up to CmdTimeoutLong,
+// plus extra for gestures. input prints nothing unless it fails, which stops the commands.
+func (d *Device) runInput(ctx context.Context, extra time.Duration, cmds ...string) error {
+	for _, cmd := range cmds {
+		out, err := d.runCommandTimeout(ctx, d.CmdTimeoutLong+extra, cmd)
+		if err != nil {
+			return err
+		}
+		if out = bytes.TrimSpace(out); len(out) > 0 {
+			return fmt.Errorf("input: %s", out)
+		}
+	}
+	return nil
+}
+
+// Tap taps the screen of display at x, y, in pixels. Every call runs input, which takes
+// hundreds of milliseconds: see NewInputShell to send many events.
+func (d *Device) Tap(ctx context.Context, display, x, y int) error {
+	return d.runInput(ctx, 0, tapCommand(display, x, y))
+}
+
+// Swipe swipes from x1, y1 to x2, y2 in duration, 0 is the default of input, 300ms.
+func (d *Device) Swipe(ctx context.Context, display, x1, y1, x2, y2 int, duration time.Duration) error {
+	return d.runInput(ctx, duration, swipeCommand(display, "swipe", x1, y1, x2, y2, duration))
+}
+
+// LongPress presses at x, y for duration, 0 is a second.
+func (d *Device) LongPress(ctx context.Context, display, x, y int, duration time.Duration) error {
+	if duration == 0 {
+		duration = defaultLongPress
+	}
+	return d.runInput(ctx, duration, swipeCommand(display, "swipe", x, y, x, y, duration))
+}
+
+// Drag drags and drops from x1, y1 to x2, y2 in duration: unlike Swipe, it long presses
+// first. It needs Android 12.
+func (d *Device) Drag(ctx context.Context, display, x1, y1, x2, y2 int, duration time.Duration) error {
+	return d.runInput(ctx, duration, swipeCommand(display, "draganddrop", x1, y1, x2, y2, duration))
+}
+
+// KeyEvent presses and releases the keys, in order.
+func (d *Device) KeyEvent(ctx context.Context, display int, keycodes ...Keycode) error {
+	cmd, err := keyEventCommand(display, keycodes)
+	if err != nil {
+		return err
+	}
+	return d.runInput(ctx, 0, cmd)
+}
+
+// Text types text into the focused view. input text only types printable ASCII, newlines
+// and tabs are sent as the Enter and Tab keys, other characters are an error. Long texts
+// are typed in chunks.
+func (d *Device) Text(ctx context.Context, display int, text string) error {
+	cmds, err := textCommands(display, text)
+	if err != nil {
+		return err
+	}
+	return d.runInput(ctx, 0, cmds...)
+}
+
+// InputShell sends input events through a shell kept open on the device, see
+// Device.NewInputShell. Events are written without waiting for them, so there is no round
+// trip per event: Sync waits for them and reports their errors.
+// An InputShell must not be used concurrently.
+type InputShell struct {
+	session *Session
+	stdin   *io.PipeWriter
+	markers chan string
+	seq     int
+
+	stderr lockedBuffer
+	exited chan struct{}
+	err    error
+}
+
+// lockedBuffer is a bytes.Buffer safe for concurrent use.
+type lockedBuffer struct {
+	mu  sync.Mutex
+	buf bytes.Buffer
+}
+
+func (b *lockedBuffer) Write(p []byte) (int, error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.buf.Write(p)
+}
+
+// take returns the content of the buffer and empties it.
+func (b *lockedBuffer) take() string {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	s := b.buf.String()
+	b.buf.Reset()
+	return s
+}
+
+// inputSyncPrefix is echoed by Sync once the previous events are sent.
+const inputSyncPrefix = "input-shell-sync-"
+
+// NewInputShell starts a shell to send input events in batches. It needs FeatureShell2,
+// check DeviceFeatures; without it use the methods of Device.
+// The shell stops when ctx is done or Close is called.
+func (d *Device) NewInputShell(ctx context.Context) (*InputShell, error) {
+	features, err := d.cachedFeatures(ctx)
+	if err != nil {
+		return nil, wrapClientError(err, d, "NewInputShell")
+	}
+	if !features[FeatureShell2] {
+		return nil, wrapClientError(fmt.Errorf("%w: %s", wire.ErrNotSupported, FeatureShell2), d, "NewInputShell")
+	}
+	session, err := d.NewSession(ctx)
+	if err != nil {
+		return nil, wrapClientError(err, d, "NewInputShell")
+	}
+
+	stdin, stdinWriter := io.Pipe()
+	stdoutReader, stdout := io.Pipe()
+	s := &InputShell{
+		session: session,
+		stdin:   stdinWriter,
+		markers: make(chan string, 16),
+		exited:  make(chan struct{}),
+	}
+	session.Stdin = stdin
+	session.Stdout = stdout
+	session.Stderr = &s.stderr
+	if err = session.Start("sh"); err != nil {
+		session.Close()
+		return nil, wrapClientError(err, d, "NewInputShell")
+	}
+
+	go s.readMarkers(stdoutReader)
+	go func() {
+		s.err = session.Wait()
+		stdout.Close()
+		stdin.Close()
+		close(s.exited)
+	}()
+	return s, nil
+}
+
+func (s *InputShell) readMarkers(stdout io.Reader) {
+	scanner := bufio.NewScanner(stdout)
+	for scanner.Scan() {
+		if line := scanner.Text(); strings.HasPrefix(line, inputSyncPrefix) {
+			select {
+			case s.markers <- line:
+			default:
+				// Nobody waits for this one anymore.
+			}
+		}
+	}
+	io.Copy(io.Discard, stdout)
+}
+
+func (s *InputShell) send(cmds ...string) error {
+	for _, cmd := range cmds {
+		if _, err := io.WriteString(s.stdin, cmd+"\n"); err != nil {
+			return fmt.Errorf("input shell: %w", err)
+		}
+	}
+	return nil
+}
+
+// Tap is Device.Tap, sent through the shell.
+func (s *InputShell) Tap(display, x, y int) error {
+	return s.send(tapCommand(display, x, y))
+}
+
+// Swipe is Device.Swipe, sent through the shell.
+func (s *InputShell) Swipe(display, x1, y1, x2, y2 int, duration time.Duration) error {
+	return s.send(swipeCommand(display, "swipe", x1, y1, x2, y2, duration))
+}
+
+// LongPress is Device.LongPress, sent through the shell.
+func (s *InputShell) LongPress(display, x, y int, duration time.Duration) error {
+	if duration == 0 {
+		duration = defaultLongPress
+	}
+	return s.send(swipeCommand(display, "swipe", x, y, x, y, duration))
+}
+
+// Drag is Device.Drag, sent through the shell.
+func (s *InputShell) Drag(display, x1, y1, x2, y2 int, duration time.Duration) error {
+	return s.send(swipeCommand(display, "draganddrop", x1, y1, x2, y2, duration))
+}
+
+// KeyEvent is Device.KeyEvent, sent through the shell.
+func (s *InputShell) KeyEvent(display int, keycodes ...Keycode) error {
+	cmd, err := keyEventCommand(display, keycodes)
+	if err != nil {
+		return err
+	}
+	return s.send(cmd)
+}
+
+// Text is Device.Text, sent through the shell.
+func (s *InputShell) Text(display int, text string) error {
+	cmds, err := textCommands(display, text)
+	if err != nil {
+		return err
+	}
+	return s.send(cmds...)
+}
+
+// Sync waits until the events sent so far are injected and returns what input reported
+// for them, if anything.
+func (s *InputShell) Sync(ctx context.Context) error {
+	s.seq++
+	marker := inputSyncPrefix + strconv.Itoa(s.seq)
+	if err := s.send("echo " + marker); err != nil {
+		return err
+	}
+	for {
+		select {
+		case m := <-s.markers:
+			if m != marker {
+				continue
+			}
+			if out := strings.TrimSpace(s.stderr.take()); out != "" {
+				return fmt.Errorf("input: %s", out)
+			}
+			return nil
+		case <-s.exited:
+			return fmt.Errorf("input shell exited: %w", s.exitErr())
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+	}
+}
+
+func (s *InputShell) exitErr() error {
+	if s.err == nil {
+		return io.EOF
+	}
+	return s.err
+}
+
+// Close ends the shell once the events sent are injected and returns what input reported
+// since the last Sync, if anything.
+func (s *InputShell) Close() error {
+	s.stdin.Close()
+	<-s.exited
+	var exitErr *ExitError
+	err := s.err
+	if errors.As(err, &exitErr) {
+		// The exit code is the one of the last command, the output tells more.
+		err = nil
+	}
+	if out := strings.TrimSpace(s.stderr.take()); out != "" {
+		err = errors.Join(err, fmt.Errorf("input: %s", out))
+	}
+	return err
+}
@@ -0,0 +1,160 @@
+package adb_test
+
+import (
+	"bufio"
+	"context"
+	"fmt"
+	"io"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	adb "DomaphoneS-Next/backend/goadb"
+	"DomaphoneS-Next/backend/goadb/adbtest"
+	"DomaphoneS-Next/backend/goadb/wire"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// inputRecorder records the command lines run on the device.
+type inputRecorder struct {
+	mu   sync.Mutex
+	cmds []string
+}
+
+func (r *inputRecorder) record(cmd string) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.cmds = append(r.cmds, cmd)
+}
+
+func (r *inputRecorder) take() []string {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	cmds := r.cmds
+	r.cmds = nil
+	return cmds
+}
+
+// handle runs a command line, and sh reading command lines from stdin. input fails for
+// display 9, which doesn't exist.
+func (r *inputRecorder) handle(cmd string, stdin io.Reader, stdout, stderr io.Writer) int {
+	if cmd != "sh" {
+		r.record(cmd)
+		if strings.Contains(cmd, "input -d 9 ") {
+			fmt.Fprintln(stderr, "Error: display 9 not found")
+		}
+		return 0
+	}
+	scanner := bufio.NewScanner(stdin)
+	for scanner.Scan() {
+		line := scanner.Text()
+		if strings.HasPrefix(line, "echo ") {
+			fmt.Fprintln(stdout, strings.TrimPrefix(line, "echo "))
+			continue
+		}
+		r.record(line)
+		if strings.Contains(line, "input -d 9 ") {
+			fmt.Fprintln(stderr, "Error: display 9 not found")
+		}
+	}
+	return 0
+}
+
+func newInputDevice(t *testing.T) (*inputRecorder, *adb.Device) {
+	r := &inputRecorder{}
+	dev := adbtest.NewDevice("emulator-5554")
+	dev.HandleShellFunc(r.handle)
+	_, client := newTestClient(t, dev)
+	return r, client.Device(adb.AnyDevice())
+}
+
+func TestInput(t *testing.T) {
+	ctx := context.Background()
+	r, d := newInputDevice(t)
+
+	require.NoError(t, d.Tap(ctx, adb.DefaultDisplay, 100, 200))
+	require.NoError(t, d.Swipe(ctx, 2, 10, 20, 30, 40, 300*time.Millisecond))
+	require.NoError(t, d.LongPress(ctx, adb.DefaultDisplay, 5, 6, 0))
+	require.NoError(t, d.Drag(ctx, adb.DefaultDisplay, 1, 2, 3, 4, time.Second))
+	require.NoError(t, d.KeyEvent(ctx, adb.DefaultDisplay, adb.KeycodeHome, adb.KeycodeBack))
+	assert.Equal(t, []string{
+		"input tap 100 200",
+		"input -d 2 swipe 10 20 30 40 300",
+		"input swipe 5 6 5 6 1000",
+		"input draganddrop 1 2 3 4 1000",
+		"input keyevent 3 4",
+	}, r.take())
+
+	err := d.Tap(ctx, 9, 1, 1)
+	assert.EqualError(t, err, "input: Error: display 9 not found")
+	r.take()
+
+	assert.ErrorIs(t, d.KeyEvent(ctx, adb.DefaultDisplay), wire.ErrAssertion)
+}
+
+func TestInput_Text(t *testing.T) {
+	ctx := context.Background()
+	r, d := newInputDevice(t)
+
+	require.NoError(t, d.Text(ctx, adb.DefaultDisplay, "it's 100%s done\n$HOME (ok)"))
+	assert.Equal(t, []string{
+		`input text 'it'\''s%s100%'`,
+		`input text 's%sdone'`,
+		"input keyevent 66",
+		`input text '$HOME%s(ok)'`,
+	}, r.take())
+
+	// Long texts are typed in chunks.
+	require.NoError(t, d.Text(ctx, 3, strings.Repeat("a", 250)))
+	assert.Equal(t, []string{
+		"input -d 3 text '" + strings.Repeat("a", 200) + "'",
+		"input -d 3 text '" + strings.Repeat("a", 50) + "'",
+	}, r.take())
+
+	// A failure stops the commands.
+	assert.EqualError(t, d.Text(ctx, 9, "a\nb"), "input: Error: display 9 not found")
+	assert.Equal(t, []string{"input -d 9 text 'a'"}, r.take())
+
+	assert.ErrorIs(t, d.Text(ctx, adb.DefaultDisplay, "héllo"), wire.ErrNotSupported)
+	assert.Empty(t, r.take())
+}
+
+func TestInputShell(t *testing.T) {
+	ctx := context.Background()
+	r, d := newInputDevice(t)
+
+	s, err := d.NewInputShell(ctx)
+	require.NoError(t, err)
+	require.NoError(t, s.Tap(adb.DefaultDisplay, 1, 2))
+	require.NoError(t, s.KeyEvent(adb.DefaultDisplay, adb.KeycodeEnter))
+	require.NoError(t, s.Text(adb.DefaultDisplay, "a b"))
+	require.NoError(t, s.Sync(ctx))
+	assert.Equal(t, []string{"input tap 1 2", "input keyevent 66", "input text 'a%sb'"}, r.take())
+
+	require.NoError(t, s.Tap(9, 1, 2))
+	assert.EqualError(t, s.Sync(ctx), "input: Error: display 9 not found")
+	require.NoError(t, s.Swipe(adb.DefaultDisplay, 1, 2, 3, 4, 0))
+	require.NoError(t, s.Sync(ctx))
+
+	require.NoError(t, s.LongPress(adb.DefaultDisplay, 1, 2, 0))
+	require.NoError(t, s.Close())
+	assert.Equal(t, []string{"input -d 9 tap 1 2", "input swipe 1 2 3 4 0", "input swipe 1 2 1 2 1000"}, r.take())
+}
+
+func TestInputShell_NotSupported(t *testing.T) {
+	dev := adbtest.NewDevice("emulator-5554")
+	dev.Features = nil
+	_, client := newTestClient(t, dev)
+
+	_, err := client.Device(adb.AnyDevice()).NewInputShell(context.Background())
+	assert.ErrorIs(t, err, wire.ErrNotSupported)
+}
+
+func TestKeycode_String(t *testing.T) {
+	assert.Equal(t, "KEYCODE_HOME", adb.KeycodeHome.String())
+	assert.Equal(t, "KEYCODE_7", adb.Keycode7.String())
+	assert.Equal(t, "1000", adb.Keycode(1000).String())
+}
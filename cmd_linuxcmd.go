@@ -28,9 +28,9 @@ func parseUptime(resp []byte) (uptime float64, err error) {
 	return strconv.ParseFloat(string(list[0]), 64)
 }
 
-func (d *Device) Uptime() (uptime float64, err error) {
+func (d *Device) Uptime(ctx context.Context) (uptime float64, err error) {
 	// detect wether support df -h or not
-	resp, err := d.RunCommand("cat", "/proc/uptime")
+	resp, err := d.RunCommand(ctx, "cat", "/proc/uptime")
 	if err != nil {
 		return
 	}
@@ -72,9 +72,9 @@ func parseUname(resp []byte) (info LinuxVersion, err error) {
 	return
 }
 
-func (d *Device) Uname() (version LinuxVersion, err error) {
+func (d *Device) Uname(ctx context.Context) (version LinuxVersion, err error) {
 	// detect wether support df -h or not
-	resp, err := d.RunCommand("cat", "/proc/version")
+	resp, err := d.RunCommand(ctx, "cat", "/proc/version")
 	if err != nil {
 		return
 	}
@@ -106,8 +106,8 @@ func parseGpu(resp []byte) (info GpuInfo, err error) {
 	return
 }
 
-func (d *Device) GetGpuAndOpenGL() (des GpuInfo, err error) {
-	glstr, err := d.RunCommand("dumpsys SurfaceFlinger | grep GLES")
+func (d *Device) GetGpuAndOpenGL(ctx context.Context) (des GpuInfo, err error) {
+	glstr, err := d.RunCommand(ctx, "dumpsys SurfaceFlinger | grep GLES")
 	if err != nil {
 		return
 	}
@@ -163,8 +163,8 @@ func parseIpAddressWlan0(resp []byte) (info EtherInfo, err error) {
 }
 
 // GetWlanInfo adb shell ip address show wlan0
-func (d *Device) GetWlanInfo() (info EtherInfo, err error) {
-	resp, err := d.RunCommand("ip address show wlan0")
+func (d *Device) GetWlanInfo(ctx context.Context) (info EtherInfo, err error) {
+	resp, err := d.RunCommand(ctx, "ip address show wlan0")
 	if err != nil {
 		return
 	}
@@ -197,8 +197,8 @@ func parseMemoryInfo(resp []byte) (info map[string]uint64, err error) {
 }
 
 // GetMemoryTotal
-func (d *Device) GetMemoryTotal() (totalInKb uint64, err error) {
-	resp, err := d.RunCommand("cat /proc/meminfo")
+func (d *Device) GetMemoryTotal(ctx context.Context) (totalInKb uint64, err error) {
+	resp, err := d.RunCommand(ctx, "cat /proc/meminfo")
 	if err != nil {
 		return
 	}
@@ -261,8 +261,8 @@ func parseDisplaySize(resp []byte) (display DisplaySizeInfo, err error) {
 }
 
 // GetDisplayDefault wm size
-func (d *Device) GetDefaultDisplaySize() (display DisplaySizeInfo, err error) {
-	resp, err := d.RunCommand("wm size")
+func (d *Device) GetDefaultDisplaySize(ctx context.Context) (display DisplaySizeInfo, err error) {
+	resp, err := d.RunCommand(ctx, "wm size")
 	if err != nil {
 		return
 	}
@@ -305,8 +305,8 @@ func parseCpuInfo(resp []byte) (cpuInfo []CpuInfoProp, err error) {
 }
 
 // GetCpuInfo get cpu information
-func (d *Device) GetCpuInfo() (cpuInfo CpuInfo, err error) {
-	resp, err := d.RunCommand("cat /proc/cpuinfo")
+func (d *Device) GetCpuInfo(ctx context.Context) (cpuInfo CpuInfo, err error) {
+	resp, err := d.RunCommand(ctx, "cat /proc/cpuinfo")
 	if err != nil {
 		return
 	}
@@ -333,7 +333,7 @@ func (d *Device) GetCpuInfo() (cpuInfo CpuInfo, err error) {
 	// coreInfo, err := device.RunCommand("ls", "/sys/devices/system/cpu/")
 
 	// get frequency
-	freqInfo, err := d.RunCommand("cat /sys/devices/system/cpu/cpu0/cpufreq/cpuinfo_max_freq")
+	freqInfo, err := d.RunCommand(ctx, "cat /sys/devices/system/cpu/cpu0/cpufreq/cpuinfo_max_freq")
 	if err != nil {
 		return
 	}
@@ -345,7 +345,7 @@ func (d *Device) GetCpuInfo() (cpuInfo CpuInfo, err error) {
 
 // Reboot the device
 func (d *Device) Reboot(ctx context.Context, waitToBootCompleted bool) error {
-	_, err := d.RunCommand("reboot")
+	_, err := d.RunCommand(ctx, "reboot")
 	if errors.Is(err, os.ErrDeadlineExceeded) {
 		// pass
 		// err is "read tcp 127.0.0.1:65357->127.0.0.1:5037: i/o timeout"
@@ -359,7 +359,7 @@ func (d *Device) Reboot(ctx context.Context, waitToBootCompleted bool) error {
 	ctx1, cancel := context.WithTimeout(ctx, time.Second*30)
 	defer cancel()
 	for {
-		if state, _ := d.State(); state == StateInvalid || state == StateOffline {
+		if state, _ := d.State(ctx1); state == StateInvalid || state == StateOffline {
 			break
 		}
 
@@ -378,8 +378,8 @@ func (d *Device) Reboot(ctx context.Context, waitToBootCompleted bool) error {
 	ctx2, cancel := context.WithTimeout(ctx, time.Second*90)
 	defer cancel()
 	for {
-		if state, _ := d.State(); state == StateOnline {
-			if booted, _ := d.BootCompleted(); booted {
+		if state, _ := d.State(ctx2); state == StateOnline {
+			if booted, _ := d.BootCompleted(ctx2); booted {
 				return nil
 			}
 		}
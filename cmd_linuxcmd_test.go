@@ -30,7 +30,7 @@ func Test_parseUptime(t *testing.T) {
 func TestDevice_Uptime(t *testing.T) {
 	assert.NotNil(t, adbclient)
 	d := adbclient.Device(AnyDevice())
-	uptime, err := d.Uptime()
+	uptime, err := d.Uptime(context.TODO())
 	assert.Nil(t, err)
 	fmt.Println(uptime / 3600)
 }
@@ -64,7 +64,7 @@ func Test_parseUname(t *testing.T) {
 func TestDevice_Uname(t *testing.T) {
 	assert.NotNil(t, adbclient)
 	d := adbclient.Device(AnyDevice())
-	info, err := d.Uname()
+	info, err := d.Uname(context.TODO())
 	assert.Nil(t, err)
 	fmt.Println(info)
 }
@@ -128,7 +128,7 @@ link/ether 2c:5b:b8:e5:d6:12 brd ff:ff:ff:ff:ff:ff
 func TestDevice_GetWlanInfo(t *testing.T) {
 	assert.NotNil(t, adbclient)
 	d := adbclient.Device(AnyDevice())
-	info, err := d.GetWlanInfo()
+	info, err := d.GetWlanInfo(context.TODO())
 	assert.Nil(t, err)
 	fmt.Println(info)
 }
@@ -300,7 +300,7 @@ func TestDevice_Reboot(t *testing.T) {
 }
 
 func TestDevice_Reboot2(t *testing.T) {
-	lists, err := adbclient.ListDeviceSerials()
+	lists, err := adbclient.ListDeviceSerials(context.TODO())
 	assert.Nil(t, err)
 	assert.Greater(t, len(lists), 0)
 
@@ -0,0 +1,516 @@
+package adb
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/binary"
+	"fmt"
+	"io"
+	"math"
+	"regexp"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"DomaphoneS-Next/backend/goadb/wire"
+)
+
+// LogBuffer is a log buffer of logcat.
+type LogBuffer string
+
+const (
+	LogBufferMain     LogBuffer = "main"
+	LogBufferRadio    LogBuffer = "radio"
+	LogBufferEvents   LogBuffer = "events"
+	LogBufferSystem   LogBuffer = "system"
+	LogBufferCrash    LogBuffer = "crash"
+	LogBufferStats    LogBuffer = "stats"
+	LogBufferSecurity LogBuffer = "security"
+	LogBufferKernel   LogBuffer = "kernel"
+	// LogBufferAll selects all the buffers, for LogcatOptions.Buffers and LogcatClear.
+	LogBufferAll LogBuffer = "all"
+)
+
+// logBufferIDs are the buffers by log id, see log_id_t.
+var logBufferIDs = []LogBuffer{
+	LogBufferMain, LogBufferRadio, LogBufferEvents, LogBufferSystem,
+	LogBufferCrash, LogBufferStats, LogBufferSecurity, LogBufferKernel,
+}
+
+// LogLevel is the priority of a log entry.
+type LogLevel int
+
+const (
+	LogLevelUnknown LogLevel = iota
+	LogLevelDefault
+	LogLevelVerbose
+	LogLevelDebug
+	LogLevelInfo
+	LogLevelWarn
+	LogLevelError
+	LogLevelFatal
+	// LogLevelSilent is only a filter, it hides everything.
+	LogLevelSilent
+)
+
+const logLevelLetters = "??VDIWEFS"
+
+// String returns the letter of the level used by logcat, eg. I.
+func (l LogLevel) String() string {
+	if l < 0 || int(l) >= len(logLevelLetters) {
+		return strconv.Itoa(int(l))
+	}
+	return logLevelLetters[l : l+1]
+}
+
+// LogEntry is an entry of the log of the device.
+type LogEntry struct {
+	Time  time.Time
+	Pid   int
+	Tid   int
+	Level LogLevel
+	Tag   string
+	// Message is the text of the entry. Binary events, of the events, stats and security
+	// buffers, are formatted like logcat does, their tag is the number of the event.
+	Message string
+	// Buffer is empty when the device doesn't tell, before Android 5.
+	Buffer LogBuffer
+}
+
+// LogcatOptions are the options of Logcat.
+type LogcatOptions struct {
+	// Buffers are the buffers to read, nil is the default of logcat: main, system and crash.
+	Buffers []LogBuffer
+	// Pid only shows the entries of a process, it needs Android 7.
+	Pid int
+	// Uids only shows the entries of the uids, it needs Android 9.
+	Uids []int
+	// Package only shows the entries of the running process of the package, it needs Android 7.
+	Package string
+	// Level is the lowest level shown, 0 shows all.
+	Level LogLevel
+	// Tags are logcat filter specs TAG:LEVEL, eg. ActivityManager:I. Other tags are silenced
+	// unless Level is set.
+	Tags []string
+	// Since only shows the entries since then, it needs Android 7.
+	Since time.Time
+	// Tail only shows the last entries, it's ignored with Since.
+	Tail int
+	// Dump stops the stream once the buffers are read, instead of waiting for new entries.
+	Dump bool
+	// Text reads the text output of `logcat -v threadtime` instead of the binary one. It's
+	// the fallback of devices without the exec service, before Android 5, and it loses the
+	// year and the time zone of the entries.
+	Text bool
+}
+
+// args returns the logcat options, the output format aside.
+func (o LogcatOptions) args(pid int) []string {
+	var args []string
+	for _, b := range o.Buffers {
+		args = append(args, "-b", string(b))
+	}
+	if o.Dump {
+		args = append(args, "-d")
+	}
+	// -t implies -d, -T doesn't.
+	start := "-T"
+	if o.Dump {
+		start = "-t"
+	}
+	if !o.Since.IsZero() {
+		args = append(args, start, fmt.Sprintf("%d.%03d", o.Since.Unix(), o.Since.Nanosecond()/1e6))
+	} else if o.Tail > 0 {
+		args = append(args, start, strconv.Itoa(o.Tail))
+	}
+	if pid > 0 {
+		args = append(args, "--pid="+strconv.Itoa(pid))
+	}
+	if len(o.Uids) > 0 {
+		args = append(args, "--uid="+strings.Join(itoa(o.Uids...), ","))
+	}
+	args = append(args, o.Tags...)
+	if o.Level > LogLevelDefault {
+		args = append(args, "*:"+o.Level.String())
+	} else if len(o.Tags) > 0 {
+		args = append(args, "*:S")
+	}
+	return args
+}
+
+// LogcatStream publishes the entries read by Device.Logcat.
+type LogcatStream struct {
+	conn    io.Closer
+	cancel  context.CancelFunc
+	entries chan LogEntry
+
+	mu  sync.Mutex
+	err error
+}
+
+// Logcat streams the log of the device. The binary output of `logcat -B` is read with the
+// exec service, so messages with newlines or odd bytes arrive as they are; devices without
+// it fall back to the text output, see LogcatOptions.Text.
+// The stream stops when ctx is done or Close is called, or once the buffers are read with
+// LogcatOptions.Dump.
+func (d *Device) Logcat(ctx context.Context, opts LogcatOptions) (*LogcatStream, error) {
+	pid := opts.Pid
+	if opts.Package != "" {
+		processes, err := d.ListProcesses(ctx, nil)
+		if err != nil {
+			return nil, wrapClientError(err, d, "Logcat")
+		}
+		for _, p := range processes {
+			if p.Name == opts.Package {
+				pid = p.Pid
+				break
+			}
+		}
+		if pid == 0 {
+			return nil, wrapClientError(fmt.Errorf("%w: no process of package %s", ErrNotFound, opts.Package), d, "Logcat")
+		}
+	}
+
+	ctx, cancel := context.WithCancel(ctx)
+	s := &LogcatStream{cancel: cancel, entries: make(chan LogEntry)}
+	if !opts.Text {
+		conn, err := d.ExecOut(ctx, "logcat", append([]string{"-B"}, opts.args(pid)...)...)
+		if err == nil {
+			s.conn = conn
+			go s.run(ctx, func(emit func(LogEntry) bool) error {
+				return readBinaryLogs(bufio.NewReaderSize(conn, 64*1024), emit)
+			})
+			return s, nil
+		}
+		if ctx.Err() != nil {
+			cancel()
+			return nil, err
+		}
+		debugLog(fmt.Sprintf("logcat -B: %v, falling back to the text output", err))
+	}
+
+	conn, err := d.RunShellCommand(ctx, false, "logcat", append([]string{"-v", "threadtime"}, opts.args(pid)...)...)
+	if err != nil {
+		cancel()
+		return nil, wrapClientError(err, d, "Logcat")
+	}
+	s.conn = conn
+	go s.run(ctx, func(emit func(LogEntry) bool) error {
+		return readTextLogs(conn, time.Now(), emit)
+	})
+	return s, nil
+}
+
+// C returns the channel of entries. It's closed when the stream stops, see Err.
+func (s *LogcatStream) C() <-chan LogEntry {
+	return s.entries
+}
+
+// Err returns the error that stopped the stream once C is closed, nil after Close or a dump.
+func (s *LogcatStream) Err() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.err
+}
+
+// Close stops the stream.
+func (s *LogcatStream) Close() error {
+	s.cancel()
+	return nil
+}
+
+func (s *LogcatStream) run(ctx context.Context, read func(emit func(LogEntry) bool) error) {
+	defer close(s.entries)
+	defer s.conn.Close()
+	defer s.cancel()
+
+	err := read(func(e LogEntry) bool {
+		select {
+		case s.entries <- e:
+			return true
+		case <-ctx.Done():
+			return false
+		}
+	})
+	if err != nil && ctx.Err() == nil {
+		s.mu.Lock()
+		s.err = fmt.Errorf("logcat: %w", err)
+		s.mu.Unlock()
+	}
+}
+
+// readBinaryLogs reads the entries written by logcat -B, see liblog's log/log_read.h:
+//
+//	struct logger_entry {      // v1: hdr_size is __pad, 0
+//	    uint16_t len;          // length of the payload
+//	    uint16_t hdr_size;     // v2: 24, v3: 24, v4: 28
+//	    int32_t  pid;
+//	    uint32_t tid;
+//	    uint32_t sec;
+//	    uint32_t nsec;
+//	    uint32_t lid;          // v3 and v4, it's euid in v2
+//	    uint32_t uid;          // v4
+//	    char     msg[];
+//	};
+func readBinaryLogs(r *bufio.Reader, emit func(LogEntry) bool) error {
+	var hdr [28]byte
+	for {
+		if _, err := io.ReadFull(r, hdr[:4]); err != nil {
+			if err == io.EOF {
+				return nil
+			}
+			return err
+		}
+		length := binary.LittleEndian.Uint16(hdr[0:])
+		hdrSize := int(binary.LittleEndian.Uint16(hdr[2:]))
+		if hdrSize == 0 {
+			hdrSize = 20
+		}
+		if hdrSize != 20 && hdrSize != 24 && hdrSize != 28 {
+			// Not binary, logcat printed an error, eg. for an unknown option.
+			rest, _ := io.ReadAll(io.LimitReader(r, 4096))
+			return fmt.Errorf("%w: %s", wire.ErrParse, bytes.TrimSpace(append(hdr[:4], rest...)))
+		}
+		if _, err := io.ReadFull(r, hdr[4:hdrSize]); err != nil {
+			return err
+		}
+		payload := make([]byte, length)
+		if _, err := io.ReadFull(r, payload); err != nil {
+			return err
+		}
+
+		e := LogEntry{
+			Pid: int(int32(binary.LittleEndian.Uint32(hdr[4:]))),
+			Tid: int(binary.LittleEndian.Uint32(hdr[8:])),
+			Time: time.Unix(int64(binary.LittleEndian.Uint32(hdr[12:])),
+				int64(binary.LittleEndian.Uint32(hdr[16:]))),
+		}
+		// The euid of v2 is beyond the log ids, but for root.
+		if hdrSize >= 24 {
+			if lid := binary.LittleEndian.Uint32(hdr[20:]); lid < uint32(len(logBufferIDs)) {
+				e.Buffer = logBufferIDs[lid]
+			}
+		}
+		switch e.Buffer {
+		case LogBufferEvents, LogBufferStats, LogBufferSecurity:
+			parseEventPayload(&e, payload)
+		default:
+			parseTextPayload(&e, payload)
+		}
+		if !emit(e) {
+			return nil
+		}
+	}
+}
+
+// parseTextPayload parses the payload of text entries: the priority, the tag and the
+// message, each string ending with NUL.
+func parseTextPayload(e *LogEntry, payload []byte) {
+	if len(payload) == 0 {
+		return
+	}
+	e.Level = LogLevel(payload[0])
+	tag, msg, _ := bytes.Cut(payload[1:], []byte{0})
+	e.Tag = string(tag)
+	msg = bytes.TrimRight(msg, "\x00")
+	e.Message = string(bytes.TrimRight(msg, "\n"))
+}
+
+// Types of the values of binary events, see log/log_event_list.h.
+const (
+	eventInt    = 0
+	eventLong   = 1
+	eventString = 2
+	eventList   = 3
+	eventFloat  = 4
+)
+
+// parseEventPayload parses the payload of binary events: the int32 tag and a value.
+func parseEventPayload(e *LogEntry, payload []byte) {
+	e.Level = LogLevelInfo
+	if len(payload) < 4 {
+		return
+	}
+	e.Tag = strconv.FormatUint(uint64(binary.LittleEndian.Uint32(payload)), 10)
+	var msg strings.Builder
+	if _, ok := formatEvent(&msg, payload[4:]); !ok {
+		msg.WriteString("[truncated event]")
+	}
+	e.Message = msg.String()
+}
+
+// formatEvent writes the value at the start of data like logcat and returns the rest.
+func formatEvent(w *strings.Builder, data []byte) ([]byte, bool) {
+	if len(data) == 0 {
+		return nil, false
+	}
+	typ, data := data[0], data[1:]
+	switch typ {
+	case eventInt:
+		if len(data) < 4 {
+			return nil, false
+		}
+		w.WriteString(strconv.Itoa(int(int32(binary.LittleEndian.Uint32(data)))))
+		return data[4:], true
+	case eventLong:
+		if len(data) < 8 {
+			return nil, false
+		}
+		w.WriteString(strconv.FormatInt(int64(binary.LittleEndian.Uint64(data)), 10))
+		return data[8:], true
+	case eventFloat:
+		if len(data) < 4 {
+			return nil, false
+		}
+		f := math.Float32frombits(binary.LittleEndian.Uint32(data))
+		w.WriteString(strconv.FormatFloat(float64(f), 'f', -1, 32))
+		return data[4:], true
+	case eventString:
+		if len(data) < 4 {
+			return nil, false
+		}
+		n := int(binary.LittleEndian.Uint32(data))
+		if n > len(data)-4 {
+			return nil, false
+		}
+		w.Write(data[4 : 4+n])
+		return data[4+n:], true
+	case eventList:
+		if len(data) < 1 {
+			return nil, false
+		}
+		count := int(data[0])
+		data = data[1:]
+		w.WriteByte('[')
+		for i := 0; i < count; i++ {
+			if i > 0 {
+				w.WriteByte(',')
+			}
+			var ok bool
+			if data, ok = formatEvent(w, data); !ok {
+				return nil, false
+			}
+		}
+		w.WriteByte(']')
+		return data, true
+	}
+	return nil, false
+}
+
+var (
+	// logThreadtimeRegex matches `10-17 12:34:56.789  1234  5678 I Tag     : message`.
+	logThreadtimeRegex = regexp.MustCompile(`^(\d\d-\d\d \d\d:\d\d:\d\d\.\d{3})\s+(\d+)\s+(\d+) ([VDIWEFS]) (.*?)\s*: ?(.*)$`)
+	// logBeginningRegex matches the line logcat prints before the entries of each buffer.
+	logBeginningRegex = regexp.MustCompile(`^-+ beginning of (\w+)`)
+)
+
+// readTextLogs reads the output of logcat -v threadtime. It has no year, the entries are
+// taken to be of the year of now, or the one before if they'd be in the future, and in the
+// local time zone.
+// Lines that aren't entries are an error until an entry is read, logcat prints its errors
+// first, and skipped afterwards.
+func readTextLogs(r io.Reader, now time.Time, emit func(LogEntry) bool) error {
+	scanner := bufio.NewScanner(r)
+	scanner.Buffer(make([]byte, 64*1024), 1024*1024)
+	var buffer LogBuffer
+	entries := 0
+	for scanner.Scan() {
+		// Old devices turn \n into \r\n.
+		line := strings.TrimRight(scanner.Text(), "\r")
+		if m := logBeginningRegex.FindStringSubmatch(line); m != nil {
+			buffer = LogBuffer(m[1])
+			continue
+		}
+		m := logThreadtimeRegex.FindStringSubmatch(line)
+		if m == nil {
+			if entries == 0 && strings.TrimSpace(line) != "" {
+				return fmt.Errorf("%w: %s", wire.ErrParse, line)
+			}
+			continue
+		}
+		entries++
+
+		t, _ := time.ParseInLocation("01-02 15:04:05.000", m[1], now.Location())
+		t = t.AddDate(now.Year(), 0, 0)
+		if t.After(now.Add(24 * time.Hour)) {
+			// Logged last year.
+			t = t.AddDate(-1, 0, 0)
+		}
+		pid, _ := strconv.Atoi(m[2])
+		tid, _ := strconv.Atoi(m[3])
+		e := LogEntry{
+			Time:    t,
+			Pid:     pid,
+			Tid:     tid,
+			Level:   LogLevel(strings.IndexByte(logLevelLetters, m[4][0])),
+			Tag:     m[5],
+			Message: m[6],
+			Buffer:  buffer,
+		}
+		if !emit(e) {
+			return nil
+		}
+	}
+	return scanner.Err()
+}
+
+// LogcatClear clears the buffers of the log, the default ones of logcat if none is given.
+func (d *Device) LogcatClear(ctx context.Context, buffers ...LogBuffer) error {
+	args := []string{"-c"}
+	for _, b := range buffers {
+		args = append(args, "-b", string(b))
+	}
+	out, err := d.runCommandTimeout(ctx, d.CmdTimeoutLong, "logcat", args...)
+	if err != nil {
+		return err
+	}
+	if out = bytes.TrimSpace(out); len(out) > 0 {
+		return fmt.Errorf("logcat -c: %s", out)
+	}
+	return nil
+}
+
+// logBufferSizeRegex matches `main: ring buffer is 256 KiB (253 KiB consumed)`, or
+// `main: ring buffer is 256Kb (11Kb consumed)` before Android 9.
+var logBufferSizeRegex = regexp.MustCompile(`ring buffer is (\d+)\s*([KMG]?)(?:iB|b|B)`)
+
+// LogcatBufferSize returns the size of buffer in bytes.
+func (d *Device) LogcatBufferSize(ctx context.Context, buffer LogBuffer) (int64, error) {
+	out, err := d.RunCommand(ctx, "logcat", "-g", "-b", string(buffer))
+	if err != nil {
+		return 0, err
+	}
+	m := logBufferSizeRegex.FindSubmatch(out)
+	if m == nil {
+		return 0, fmt.Errorf("%w: logcat -g: %s", wire.ErrParse, bytes.TrimSpace(out))
+	}
+	size, _ := strconv.ParseInt(string(m[1]), 10, 64)
+	switch string(m[2]) {
+	case "K":
+		size <<= 10
+	case "M":
+		size <<= 20
+	case "G":
+		size <<= 30
+	}
+	return size, nil
+}
+
+// SetLogcatBufferSize sets the size of the buffers in bytes, rounded up to KiB, the default
+// ones of logcat if none is given. logcat accepts from 64 KiB to 256 MiB.
+func (d *Device) SetLogcatBufferSize(ctx context.Context, size int64, buffers ...LogBuffer) error {
+	args := []string{"-G", strconv.FormatInt((size+1023)>>10, 10) + "K"}
+	for _, b := range buffers {
+		args = append(args, "-b", string(b))
+	}
+	out, err := d.RunCommand(ctx, "logcat", args...)
+	if err != nil {
+		return err
+	}
+	if out = bytes.TrimSpace(out); len(out) > 0 {
+		return fmt.Errorf("logcat -G: %s", out)
+	}
+	return nil
+}
@@ -0,0 +1,253 @@
+package adb_test
+
+import (
+	"bytes"
+	"context"
+	"encoding/binary"
+	"io"
+	"math"
+	"testing"
+	"time"
+
+	adb "DomaphoneS-Next/backend/goadb"
+	"DomaphoneS-Next/backend/goadb/adbtest"
+	"DomaphoneS-Next/backend/goadb/wire"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// logEntry encodes a logger_entry of hdrSize, 20 for v1, with lid for v3 and v4.
+func logEntry(hdrSize int, pid, tid int, t time.Time, lid uint32, payload []byte) []byte {
+	var buf bytes.Buffer
+	pad := uint16(hdrSize)
+	if hdrSize == 20 {
+		pad = 0
+	}
+	binary.Write(&buf, binary.LittleEndian, []uint16{uint16(len(payload)), pad})
+	binary.Write(&buf, binary.LittleEndian, []uint32{uint32(pid), uint32(tid), uint32(t.Unix()), uint32(t.Nanosecond())})
+	if hdrSize >= 24 {
+		binary.Write(&buf, binary.LittleEndian, lid)
+	}
+	if hdrSize >= 28 {
+		binary.Write(&buf, binary.LittleEndian, uint32(10123))
+	}
+	buf.Write(payload)
+	return buf.Bytes()
+}
+
+func logText(level adb.LogLevel, tag, msg string) []byte {
+	return []byte(string(rune(level)) + tag + "\x00" + msg + "\x00")
+}
+
+func readLogs(t *testing.T, s *adb.LogcatStream) []adb.LogEntry {
+	var entries []adb.LogEntry
+	timeout := time.After(5 * time.Second)
+	for {
+		select {
+		case e, ok := <-s.C():
+			if !ok {
+				return entries
+			}
+			entries = append(entries, e)
+		case <-timeout:
+			t.Fatal("logcat stream not closed")
+		}
+	}
+}
+
+func TestLogcat_Binary(t *testing.T) {
+	t0 := time.Unix(1760700000, 123000000)
+	var event bytes.Buffer
+	binary.Write(&event, binary.LittleEndian, uint32(30001))
+	event.Write([]byte{3, 4})
+	event.WriteByte(0)
+	binary.Write(&event, binary.LittleEndian, int32(-7))
+	event.WriteByte(1)
+	binary.Write(&event, binary.LittleEndian, int64(1)<<40)
+	event.WriteByte(2)
+	binary.Write(&event, binary.LittleEndian, uint32(3))
+	event.WriteString("abc")
+	event.WriteByte(4)
+	binary.Write(&event, binary.LittleEndian, math.Float32bits(1.5))
+
+	var output bytes.Buffer
+	output.Write(logEntry(20, 100, 101, t0, 0, logText(adb.LogLevelInfo, "Old", "v1 entry\n")))
+	output.Write(logEntry(24, 200, 201, t0, 3, logText(adb.LogLevelWarn, "ActivityManager", "line 1\nline 2")))
+	output.Write(logEntry(28, 300, 302, t0, 4, logText(adb.LogLevelFatal, "AndroidRuntime", "FATAL EXCEPTION: main")))
+	output.Write(logEntry(28, 400, 400, t0, 2, event.Bytes()))
+
+	dev := adbtest.NewDevice("emulator-5554")
+	dev.HandleShell("logcat -B -b all -d --pid=300 *:W", func(cmd string, stdin io.Reader, stdout, stderr io.Writer) int {
+		stdout.Write(output.Bytes())
+		return 0
+	})
+	_, client := newTestClient(t, dev)
+
+	s, err := client.Device(adb.AnyDevice()).Logcat(context.Background(), adb.LogcatOptions{
+		Buffers: []adb.LogBuffer{adb.LogBufferAll},
+		Pid:     300,
+		Level:   adb.LogLevelWarn,
+		Dump:    true,
+	})
+	require.NoError(t, err)
+	entries := readLogs(t, s)
+	require.NoError(t, s.Err())
+
+	assert.Equal(t, []adb.LogEntry{
+		{Time: t0, Pid: 100, Tid: 101, Level: adb.LogLevelInfo, Tag: "Old", Message: "v1 entry"},
+		{Time: t0, Pid: 200, Tid: 201, Level: adb.LogLevelWarn, Tag: "ActivityManager", Message: "line 1\nline 2", Buffer: adb.LogBufferSystem},
+		{Time: t0, Pid: 300, Tid: 302, Level: adb.LogLevelFatal, Tag: "AndroidRuntime", Message: "FATAL EXCEPTION: main", Buffer: adb.LogBufferCrash},
+		{Time: t0, Pid: 400, Tid: 400, Level: adb.LogLevelInfo, Tag: "30001", Message: "[-7,1099511627776,abc,1.5]", Buffer: adb.LogBufferEvents},
+	}, entries)
+	assert.Equal(t, "W", entries[1].Level.String())
+}
+
+func TestLogcat_BinaryError(t *testing.T) {
+	dev := adbtest.NewDevice("emulator-5554")
+	dev.HandleShell("logcat -B --uid=1000,10123", func(cmd string, stdin io.Reader, stdout, stderr io.Writer) int {
+		io.WriteString(stdout, "logcat: unrecognized option '--uid=1000,10123'\n")
+		return 1
+	})
+	_, client := newTestClient(t, dev)
+
+	s, err := client.Device(adb.AnyDevice()).Logcat(context.Background(), adb.LogcatOptions{Uids: []int{1000, 10123}})
+	require.NoError(t, err)
+	assert.Empty(t, readLogs(t, s))
+	assert.ErrorIs(t, s.Err(), wire.ErrParse)
+	assert.ErrorContains(t, s.Err(), "unrecognized option")
+}
+
+func TestLogcat_Close(t *testing.T) {
+	t0 := time.Unix(1760700000, 0)
+	dev := adbtest.NewDevice("emulator-5554")
+	dev.HandleShell("logcat -B -T 1760699990.500 ActivityManager:I *:S", func(cmd string, stdin io.Reader, stdout, stderr io.Writer) int {
+		stdout.Write(logEntry(28, 1, 1, t0, 0, logText(adb.LogLevelInfo, "ActivityManager", "Start proc")))
+		// Follows the log until the client is gone.
+		io.Copy(io.Discard, stdin)
+		return 0
+	})
+	_, client := newTestClient(t, dev)
+
+	s, err := client.Device(adb.AnyDevice()).Logcat(context.Background(), adb.LogcatOptions{
+		Tags:  []string{"ActivityManager:I"},
+		Since: time.Unix(1760699990, 500000000),
+	})
+	require.NoError(t, err)
+	e := <-s.C()
+	assert.Equal(t, "Start proc", e.Message)
+	require.NoError(t, s.Close())
+	assert.Empty(t, readLogs(t, s))
+	assert.NoError(t, s.Err())
+}
+
+func TestLogcat_Package(t *testing.T) {
+	dev := adbtest.NewDevice("emulator-5554")
+	ps := func(cmd string, stdin io.Reader, stdout, stderr io.Writer) int {
+		io.WriteString(stdout, "USER           PID  PPID     VSZ    RSS WCHAN            ADDR S NAME\n"+
+			"root             1     0 10782796 11960 do_epoll_wait       0 S init\n"+
+			"u0_a123       4321   612 14502876 98412 do_epoll_wait       0 S com.example.app\n")
+		return 0
+	}
+	// The output is short enough to look like a device without ps -A.
+	dev.HandleShell("ps -A", ps)
+	dev.HandleShell("ps", ps)
+	dev.HandleShell("logcat -B -d -t 10 --pid=4321", func(cmd string, stdin io.Reader, stdout, stderr io.Writer) int {
+		stdout.Write(logEntry(28, 4321, 4321, time.Unix(1760700000, 0), 0, logText(adb.LogLevelDebug, "App", "hello")))
+		return 0
+	})
+	_, client := newTestClient(t, dev)
+	device := client.Device(adb.AnyDevice())
+
+	s, err := device.Logcat(context.Background(), adb.LogcatOptions{Package: "com.example.app", Tail: 10, Dump: true})
+	require.NoError(t, err)
+	entries := readLogs(t, s)
+	require.NoError(t, s.Err())
+	require.Len(t, entries, 1)
+	assert.Equal(t, "hello", entries[0].Message)
+
+	_, err = device.Logcat(context.Background(), adb.LogcatOptions{Package: "com.example.other"})
+	assert.ErrorIs(t, err, adb.ErrNotFound)
+}
+
+func TestLogcat_Text(t *testing.T) {
+	dev := adbtest.NewDevice("emulator-5554")
+	dev.HandleShell("logcat -v threadtime -d", func(cmd string, stdin io.Reader, stdout, stderr io.Writer) int {
+		io.WriteString(stdout, "--------- beginning of main\r\n"+
+			"01-02 03:04:05.678  1234  5678 I ActivityManager: Start proc 4321:com.example.app\r\n"+
+			"01-02 03:04:05.679  1234  1234 D Tag with spaces :  indented: message\r\n"+
+			"--------- beginning of crash\r\n"+
+			"01-02 03:04:06.000  4321  4321 E AndroidRuntime: FATAL EXCEPTION: main\r\n")
+		return 0
+	})
+	_, client := newTestClient(t, dev)
+
+	s, err := client.Device(adb.AnyDevice()).Logcat(context.Background(), adb.LogcatOptions{Dump: true, Text: true})
+	require.NoError(t, err)
+	entries := readLogs(t, s)
+	require.NoError(t, s.Err())
+	require.Len(t, entries, 3)
+
+	year := time.Now().Year()
+	assert.Equal(t, adb.LogEntry{
+		Time:    time.Date(year, 1, 2, 3, 4, 5, 678000000, time.Local),
+		Pid:     1234,
+		Tid:     5678,
+		Level:   adb.LogLevelInfo,
+		Tag:     "ActivityManager",
+		Message: "Start proc 4321:com.example.app",
+		Buffer:  adb.LogBufferMain,
+	}, entries[0])
+	assert.Equal(t, "Tag with spaces", entries[1].Tag)
+	assert.Equal(t, " indented: message", entries[1].Message)
+	assert.Equal(t, adb.LogLevelError, entries[2].Level)
+	assert.Equal(t, adb.LogBufferCrash, entries[2].Buffer)
+}
+
+func TestLogcatClear(t *testing.T) {
+	dev := adbtest.NewDevice("emulator-5554")
+	cleared := make(chan struct{}, 1)
+	dev.HandleShell("logcat -c -b main -b crash", func(cmd string, stdin io.Reader, stdout, stderr io.Writer) int {
+		cleared <- struct{}{}
+		return 0
+	})
+	dev.HandleShell("logcat -c -b kernel", func(cmd string, stdin io.Reader, stdout, stderr io.Writer) int {
+		io.WriteString(stdout, "failed to clear the 'kernel' log\n")
+		return 1
+	})
+	_, client := newTestClient(t, dev)
+	device := client.Device(adb.AnyDevice())
+
+	require.NoError(t, device.LogcatClear(context.Background(), adb.LogBufferMain, adb.LogBufferCrash))
+	assert.Len(t, cleared, 1)
+	assert.ErrorContains(t, device.LogcatClear(context.Background(), adb.LogBufferKernel), "failed to clear")
+}
+
+func TestLogcatBufferSize(t *testing.T) {
+	dev := adbtest.NewDevice("emulator-5554")
+	dev.HandleShell("logcat -g -b main", func(cmd string, stdin io.Reader, stdout, stderr io.Writer) int {
+		io.WriteString(stdout, "main: ring buffer is 256 KiB (253 KiB consumed), max entry is 5120 B, max payload is 4068 B\n")
+		return 0
+	})
+	dev.HandleShell("logcat -g -b radio", func(cmd string, stdin io.Reader, stdout, stderr io.Writer) int {
+		io.WriteString(stdout, "radio: ring buffer is 2Mb (11Kb consumed), max entry is 5120b, max payload is 4076b\n")
+		return 0
+	})
+	resized := make(chan string, 1)
+	dev.HandleShellFunc(func(cmd string, stdin io.Reader, stdout, stderr io.Writer) int {
+		resized <- cmd
+		return 0
+	})
+	_, client := newTestClient(t, dev)
+	device := client.Device(adb.AnyDevice())
+
+	size, err := device.LogcatBufferSize(context.Background(), adb.LogBufferMain)
+	require.NoError(t, err)
+	assert.EqualValues(t, 256<<10, size)
+	size, err = device.LogcatBufferSize(context.Background(), adb.LogBufferRadio)
+	require.NoError(t, err)
+	assert.EqualValues(t, 2<<20, size)
+
+	require.NoError(t, device.SetLogcatBufferSize(context.Background(), 1<<20+1, adb.LogBufferMain, adb.LogBufferSystem))
+	assert.Equal(t, "logcat -G 1025K -b main -b system", <-resized)
+}
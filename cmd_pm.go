@@ -12,6 +12,20 @@ var (
 	ErrSecurityException = errors.New("JavaSecurityException")
 )
 
+// pm runs pm with args and returns its output, stderr included. The package service is
+// called through abb when the device supports it, which saves spawning a shell and pm.
+// Only ctx limits it.
+func (d *Device) pm(ctx context.Context, args ...string) ([]byte, error) {
+	if features, err := d.cachedFeatures(ctx); err == nil && features[FeatureAbb] {
+		stdout, stderr, _, err := d.Abb(ctx, "package", args...)
+		return append(stdout, stderr...), err
+	}
+
+	var out bytes.Buffer
+	err := d.RunCommandTo(ctx, &out, "pm", args...)
+	return out.Bytes(), err
+}
+
 // PmListPackages adb shell pm
 // list packages [-f] [-d] [-e] [-s] [-3] [-i] [-l] [-u] [-U]
 //
@@ -35,13 +49,15 @@ var (
 //		--uid UID: filter to only show packages with the given UID
 //		--user USER_ID: only list packages belonging to the given user
 //		--match-libraries: include packages that declare static shared and SDK libraries
-func (d *Device) PmListPackages(thirdParty bool) (names []string, err error) {
+func (d *Device) PmListPackages(ctx context.Context, thirdParty bool) (names []string, err error) {
 	args := []string{"list", "packages"}
 	if thirdParty {
 		args = append(args, "-3")
 	}
 
-	list, err := d.RunCommandTimeout(d.CmdTimeoutLong, "pm", args...)
+	ctx, cancel := withDefaultTimeout(ctx, d.CmdTimeoutLong)
+	defer cancel()
+	list, err := d.pm(ctx, args...)
 	if err != nil {
 		return nil, fmt.Errorf("pm "+strings.Join(args, " ")+": %w", err)
 	}
@@ -61,8 +77,10 @@ func (d *Device) PmListPackages(thirdParty bool) (names []string, err error) {
 // Android 5.1
 // shell:pm clear <package>
 // 00000000  53 75 63 63 65 73 73 0d  0a                       |Success..|
-func (d *Device) PmClear(packageName string) (err error) {
-	resp, err := d.RunCommandTimeout(d.CmdTimeoutLong, "pm clear "+packageName)
+func (d *Device) PmClear(ctx context.Context, packageName string) (err error) {
+	ctx, cancel := withDefaultTimeout(ctx, d.CmdTimeoutLong)
+	defer cancel()
+	resp, err := d.pm(ctx, "clear", packageName)
 	if err != nil {
 		return err // always tcp error
 	}
@@ -87,8 +105,10 @@ func (d *Device) PmClear(packageName string) (err error) {
 // Success
 // HWALP:/ $ pm uninstall non-existed-app
 // Failure [DELETE_FAILED_INTERNAL_ERROR]
-func (d *Device) PmUninstall(packageName string) (err error) {
-	resp, err := d.RunCommandTimeout(d.CmdTimeoutLong, "pm uninstall "+packageName)
+func (d *Device) PmUninstall(ctx context.Context, packageName string) (err error) {
+	ctx, cancel := withDefaultTimeout(ctx, d.CmdTimeoutLong)
+	defer cancel()
+	resp, err := d.pm(ctx, "uninstall", packageName)
 	if err != nil {
 		return err // always tcp error
 	}
@@ -134,26 +154,23 @@ func (d *Device) PmUninstall(packageName string) (err error) {
 
 func (d *Device) PmInstall(ctx context.Context, apkPath string, reinstall bool, grantPermission bool,
 	allowDowngrade bool) error {
-	var args string
+	args := []string{"install"}
 	if reinstall {
-		args += "-r "
+		args = append(args, "-r")
 	}
 	if grantPermission {
-		args += "-g "
+		args = append(args, "-g")
 	}
 	if allowDowngrade {
-		args += "-d "
+		args = append(args, "-d")
 	}
+	args = append(args, apkPath)
 
-	resp, err := d.RunCommandOutputCtx(ctx, "pm install "+args+apkPath)
+	// Installing takes as long as it takes, only ctx limits it.
+	out, err := d.pm(ctx, args...)
 	if err != nil {
-		return fmt.Errorf("'pm install %s' failed: %w", args+apkPath, err)
+		return fmt.Errorf("'pm %s' failed: %w", strings.Join(args, " "), err)
 	}
 
-	resp = bytes.TrimSpace(resp)
-	// err maybe nil, check response to determine error
-	if bytes.Equal(resp, []byte("Success")) {
-		return nil
-	}
-	return errors.New(string(resp))
+	return installResult(out)
 }
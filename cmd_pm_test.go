@@ -18,7 +18,7 @@ var (
 func TestDevice_PmListPackages(t *testing.T) {
 	assert.NotNil(t, adbclient)
 	d := adbclient.Device(adb.AnyDevice())
-	list, err := d.PmListPackages(true)
+	list, err := d.PmListPackages(context.TODO(), true)
 	if err != nil {
 		t.Fatal(err)
 	}
@@ -48,7 +48,7 @@ java.lang.SecurityException: PID 6593 does not have permission android.permissio
 func TestDevice_PmClear(t *testing.T) {
 	assert.NotNil(t, adbclient)
 	d := adbclient.Device(adb.AnyDevice())
-	list, err := d.PmListPackages(true)
+	list, err := d.PmListPackages(context.TODO(), true)
 	if err != nil {
 		t.Fatal(err)
 	}
@@ -57,7 +57,7 @@ func TestDevice_PmClear(t *testing.T) {
 	packageName := list[0]
 	fmt.Println("pm clear", packageName)
 
-	err = d.PmClear(list[0])
+	err = d.PmClear(context.TODO(), list[0])
 	if err != nil {
 		assert.ErrorIs(t, err, adb.ErrSecurityException)
 		fmt.Println(err)
@@ -67,10 +67,10 @@ func TestDevice_PmClear(t *testing.T) {
 func TestDevice_PmUninstall(t *testing.T) {
 	assert.NotNil(t, adbclient)
 	d := adbclient.Device(adb.AnyDevice())
-	err := d.PmUninstall("non-existed-app")
+	err := d.PmUninstall(context.TODO(), "non-existed-app")
 	assert.True(t, strings.Contains(err.Error(), "DELETE_FAILED_INTERNAL_ERROR"))
 
-	err = d.PmUninstall("com.tencent.wetestdemo")
+	err = d.PmUninstall(context.TODO(), "com.tencent.wetestdemo")
 	assert.Nil(t, err)
 }
 
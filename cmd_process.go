@@ -2,6 +2,7 @@ package adb
 
 import (
 	"bytes"
+	"context"
 	"errors"
 	"fmt"
 	"regexp"
@@ -105,9 +106,9 @@ func unpackProcess(resp []byte, filter ProcessFilter) (names []Process) {
 }
 
 // ListProcesses run adb shell ps
-func (d *Device) ListProcesses(filter ProcessFilter) (names []Process, err error) {
+func (d *Device) ListProcesses(ctx context.Context, filter ProcessFilter) (names []Process, err error) {
 	// detect wether support ps -A or not
-	resp, err := d.RunCommand("ps", "-A")
+	resp, err := d.RunCommand(ctx, "ps", "-A")
 	if err != nil {
 		return
 	}
@@ -117,7 +118,7 @@ func (d *Device) ListProcesses(filter ProcessFilter) (names []Process, err error
 	// if received too few bytes, means 'ps -A' is not supported
 	if len(resp) < 256 {
 		// <= Android 7.x
-		resp, err = d.RunCommand("ps")
+		resp, err = d.RunCommand(ctx, "ps")
 		if err != nil {
 			return
 		}
@@ -130,8 +131,8 @@ func (d *Device) ListProcesses(filter ProcessFilter) (names []Process, err error
 	return
 }
 
-func (d *Device) ListProcessGroup(filter ProcessFilter) (list map[Process][]Process, err error) {
-	l, err := d.ListProcesses(nil)
+func (d *Device) ListProcessGroup(ctx context.Context, filter ProcessFilter) (list map[Process][]Process, err error) {
+	l, err := d.ListProcesses(ctx, nil)
 	if err != nil {
 		return
 	}
@@ -168,14 +169,14 @@ func (d *Device) ListProcessGroup(filter ProcessFilter) (list map[Process][]Proc
 // system/bin/sh: pidof: not found
 
 // FindPids find pid
-func (d *Device) PidOf(name string, match bool) (list []Process, err error) {
-	return d.ListProcesses(func(p Process) bool {
+func (d *Device) PidOf(ctx context.Context, name string, match bool) (list []Process, err error) {
+	return d.ListProcesses(ctx, func(p Process) bool {
 		return (match && p.Name == name) || (!match && strings.Contains(p.Name, name))
 	})
 }
 
-func (d *Device) PidGroupOf(name string, match bool) (list map[Process][]Process, err error) {
-	return d.ListProcessGroup(func(p Process) bool {
+func (d *Device) PidGroupOf(ctx context.Context, name string, match bool) (list map[Process][]Process, err error) {
+	return d.ListProcessGroup(ctx, func(p Process) bool {
 		return (match && p.Name == name) || (!match && strings.Contains(p.Name, name))
 	})
 }
@@ -188,7 +189,7 @@ func (d *Device) PidGroupOf(name string, match bool) (list map[Process][]Process
 // /system/bin/sh: kill: 12006: No such process
 
 // KillPidGroup kill process and it's children processes
-func (d *Device) KillPids(list []int, signal int) (err error) {
+func (d *Device) KillPids(ctx context.Context, list []int, signal int) (err error) {
 	args := make([]string, len(list))
 	if signal > 0 {
 		args = append(args, "-"+strconv.Itoa(signal))
@@ -197,7 +198,7 @@ func (d *Device) KillPids(list []int, signal int) (err error) {
 		args = append(args, strconv.Itoa(pid))
 	}
 
-	resp, err := d.RunCommand("kill", args...)
+	resp, err := d.RunCommand(ctx, "kill", args...)
 	if len(resp) > 0 {
 		err = errors.New(string(resp))
 		if bytes.Contains(resp, []byte("Operation not permitted")) {
@@ -210,8 +211,8 @@ func (d *Device) KillPids(list []int, signal int) (err error) {
 }
 
 // KillPidGroup kill process and it's children processes
-func (d *Device) KillPidGroupOf(name string, match bool) (killed map[Process][]Process, err error) {
-	killed, err = d.ListProcessGroup(func(p Process) bool {
+func (d *Device) KillPidGroupOf(ctx context.Context, name string, match bool) (killed map[Process][]Process, err error) {
+	killed, err = d.ListProcessGroup(ctx, func(p Process) bool {
 		return (match && p.Name == name) || (!match && strings.Contains(p.Name, name))
 	})
 	if err != nil {
@@ -225,6 +226,6 @@ func (d *Device) KillPidGroupOf(name string, match bool) (killed map[Process][]P
 			pids = append(pids, child.Pid)
 		}
 	}
-	err = d.KillPids(pids, 9)
+	err = d.KillPids(ctx, pids, 9)
 	return
 }
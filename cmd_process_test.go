@@ -1,6 +1,7 @@
 package adb
 
 import (
+	"context"
 	"fmt"
 	"testing"
 
@@ -65,7 +66,7 @@ root           845     2          0      0 0                   0 S [irq/227-q6v5
 func TestDevice_ListProcesses(t *testing.T) {
 	assert.NotNil(t, adbclient)
 	d := adbclient.Device(AnyDevice())
-	list, err := d.ListProcesses(nil)
+	list, err := d.ListProcesses(context.TODO(), nil)
 	if err != nil {
 		t.Fatal(err)
 	}
@@ -78,7 +79,7 @@ func TestDevice_ListProcesses(t *testing.T) {
 func TestDevice_PidGroupOf(t *testing.T) {
 	assert.NotNil(t, adbclient)
 	d := adbclient.Device(DeviceWithSerial("4d639ca1"))
-	list, err := d.PidGroupOf("zygote", true)
+	list, err := d.PidGroupOf(context.TODO(), "zygote", true)
 	if err != nil {
 		t.Fatal(err)
 	}
@@ -96,7 +97,7 @@ func TestDevice_PidGroupOf(t *testing.T) {
 func TestDevice_PidGroupOfAndroid14(t *testing.T) {
 	assert.NotNil(t, adbclient)
 	d := adbclient.Device(DeviceWithSerial("79f63fb7"))
-	list, err := d.PidGroupOf("zygote", false) // zygote64, zygote, webview_zygote
+	list, err := d.PidGroupOf(context.TODO(), "zygote", false) // zygote64, zygote, webview_zygote
 	if err != nil {
 		t.Fatal(err)
 	}
@@ -113,20 +114,20 @@ func TestDevice_PidGroupOfAndroid14(t *testing.T) {
 func TestDevice_KillPids(t *testing.T) {
 	assert.NotNil(t, adbclient)
 	d := adbclient.Device(AnyDevice())
-	list, err := d.PidOf("com.android.settings", true)
+	list, err := d.PidOf(context.TODO(), "com.android.settings", true)
 	assert.Nil(t, err)
 	assert.Equal(t, len(list), 1)
-	err = d.KillPids([]int{list[0].Pid}, 9)
+	err = d.KillPids(context.TODO(), []int{list[0].Pid}, 9)
 	assert.ErrorIs(t, err, ErrNotPermitted)
 
-	err = d.KillPids([]int{100000}, 9)
+	err = d.KillPids(context.TODO(), []int{100000}, 9)
 	assert.ErrorIs(t, err, ErrNoSuchProcess)
 }
 
 func TestDevice_KillPidGroupOf(t *testing.T) {
 	assert.NotNil(t, adbclient)
 	d := adbclient.Device(AnyDevice())
-	list, err := d.KillPidGroupOf("com.android.settings", true)
+	list, err := d.KillPidGroupOf(context.TODO(), "com.android.settings", true)
 	assert.Equal(t, len(list), 1)
 	assert.ErrorIs(t, err, ErrNotPermitted)
 }
@@ -0,0 +1,216 @@
+package adb
+
+import (
+	"bytes"
+	"context"
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"image"
+	"io"
+	"regexp"
+	"strconv"
+	"time"
+
+	"DomaphoneS-Next/backend/goadb/wire"
+)
+
+// UINode is a view of the UI hierarchy dumped by DumpUI.
+type UINode struct {
+	// Index is the position of the node among its siblings.
+	Index       int
+	Text        string
+	ResourceID  string
+	Class       string
+	Package     string
+	ContentDesc string
+	// Bounds are the screen coordinates of the view, tap its Center.
+	Bounds image.Rectangle
+
+	Checkable     bool
+	Checked       bool
+	Clickable     bool
+	Enabled       bool
+	Focusable     bool
+	Focused       bool
+	Scrollable    bool
+	LongClickable bool
+	Password      bool
+	Selected      bool
+
+	Parent   *UINode
+	Children []*UINode
+}
+
+// Center returns the center of the bounds of the node.
+func (n *UINode) Center() image.Point {
+	return image.Pt((n.Bounds.Min.X+n.Bounds.Max.X)/2, (n.Bounds.Min.Y+n.Bounds.Max.Y)/2)
+}
+
+// Find returns the first node of the tree of n, n included, matching sel in document
+// order, nil if none does.
+func (n *UINode) Find(sel UISelector) *UINode {
+	if sel.Match(n) {
+		return n
+	}
+	for _, child := range n.Children {
+		if found := child.Find(sel); found != nil {
+			return found
+		}
+	}
+	return nil
+}
+
+// FindAll returns the nodes of the tree of n, n included, matching sel in document order.
+func (n *UINode) FindAll(sel UISelector) []*UINode {
+	var nodes []*UINode
+	n.walk(func(n *UINode) {
+		if sel.Match(n) {
+			nodes = append(nodes, n)
+		}
+	})
+	return nodes
+}
+
+func (n *UINode) walk(fn func(n *UINode)) {
+	fn(n)
+	for _, child := range n.Children {
+		child.walk(fn)
+	}
+}
+
+// uiDumpRegex matches the output of a successful uiautomator dump.
+var uiDumpRegex = regexp.MustCompile(`UI hier\w* dumped to`)
+
+// DumpUI dumps the UI hierarchy of the screen with `uiautomator dump` and parses it. The root
+// node is the hierarchy itself, without attributes, its children are the windows.
+// uiautomator fails while the screen is animating, WaitFor retries.
+func (d *Device) DumpUI(ctx context.Context) (*UINode, error) {
+	path := fmt.Sprintf("/data/local/tmp/goadb-ui-%d.xml", time.Now().UnixNano())
+	out, err := d.runCommandTimeout(ctx, d.CmdTimeoutLong, "uiautomator", "dump", path)
+	if err != nil {
+		return nil, err
+	}
+	defer d.Rm(context.Background(), []string{path})
+	if !uiDumpRegex.Match(out) {
+		return nil, fmt.Errorf("uiautomator dump: %s", bytes.TrimSpace(out))
+	}
+
+	conn, reader, err := d.OpenFileReader(ctx, path)
+	if err != nil {
+		return nil, err
+	}
+	defer conn.Close()
+	data, err := io.ReadAll(reader)
+	if err != nil {
+		return nil, wrapClientError(contextError(ctx, err), d, "DumpUI")
+	}
+	return ParseUIHierarchy(data)
+}
+
+// ParseUIHierarchy parses the XML written by `uiautomator dump`, see DumpUI.
+func ParseUIHierarchy(data []byte) (*UINode, error) {
+	root := &UINode{Index: -1}
+	stack := []*UINode{root}
+	dec := xml.NewDecoder(bytes.NewReader(data))
+	for {
+		tok, err := dec.Token()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, fmt.Errorf("%w: UI hierarchy: %w", wire.ErrParse, err)
+		}
+		switch t := tok.(type) {
+		case xml.StartElement:
+			if t.Name.Local != "node" {
+				continue
+			}
+			parent := stack[len(stack)-1]
+			n, err := parseUINode(t.Attr)
+			if err != nil {
+				return nil, err
+			}
+			n.Parent = parent
+			parent.Children = append(parent.Children, n)
+			stack = append(stack, n)
+		case xml.EndElement:
+			if t.Name.Local == "node" && len(stack) > 1 {
+				stack = stack[:len(stack)-1]
+			}
+		}
+	}
+	if len(root.Children) == 0 {
+		return nil, fmt.Errorf("%w: UI hierarchy without nodes", wire.ErrParse)
+	}
+	return root, nil
+}
+
+var uiBoundsRegex = regexp.MustCompile(`^\[(-?\d+),(-?\d+)\]\[(-?\d+),(-?\d+)\]$`)
+
+func parseUINode(attrs []xml.Attr) (*UINode, error) {
+	n := &UINode{}
+	flags := map[string]*bool{
+		"checkable": &n.Checkable, "checked": &n.Checked, "clickable": &n.Clickable,
+		"enabled": &n.Enabled, "focusable": &n.Focusable, "focused": &n.Focused,
+		"scrollable": &n.Scrollable, "long-clickable": &n.LongClickable,
+		"password": &n.Password, "selected": &n.Selected,
+	}
+	for _, attr := range attrs {
+		switch attr.Name.Local {
+		case "index":
+			n.Index, _ = strconv.Atoi(attr.Value)
+		case "text":
+			n.Text = attr.Value
+		case "resource-id":
+			n.ResourceID = attr.Value
+		case "class":
+			n.Class = attr.Value
+		case "package":
+			n.Package = attr.Value
+		case "content-desc":
+			n.ContentDesc = attr.Value
+		case "bounds":
+			m := uiBoundsRegex.FindStringSubmatch(attr.Value)
+			if m == nil {
+				return nil, fmt.Errorf("%w: UI node bounds %q", wire.ErrParse, attr.Value)
+			}
+			var v [4]int
+			for i := range v {
+				v[i], _ = strconv.Atoi(m[i+1])
+			}
+			n.Bounds = image.Rect(v[0], v[1], v[2], v[3])
+		default:
+			if flag, ok := flags[attr.Name.Local]; ok {
+				*flag = attr.Value == "true"
+			}
+		}
+	}
+	return n, nil
+}
+
+// uiPollInterval is the pause of WaitFor between dumps, a dump takes a second or two.
+const uiPollInterval = 250 * time.Millisecond
+
+// WaitFor dumps the UI until a node matches sel and returns it. Failed dumps are retried,
+// the last failure is reported with the error of ctx once it's done.
+func (d *Device) WaitFor(ctx context.Context, sel UISelector) (*UINode, error) {
+	var lastErr error
+	for {
+		root, err := d.DumpUI(ctx)
+		if err == nil {
+			if n := root.Find(sel); n != nil {
+				return n, nil
+			}
+			lastErr = fmt.Errorf("no node matches %s", sel)
+		} else {
+			lastErr = err
+		}
+
+		select {
+		case <-ctx.Done():
+			return nil, errors.Join(ctx.Err(), lastErr)
+		case <-time.After(uiPollInterval):
+		}
+	}
+}
@@ -0,0 +1,153 @@
+package adb_test
+
+import (
+	"context"
+	"fmt"
+	"image"
+	"io"
+	"regexp"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	adb "DomaphoneS-Next/backend/goadb"
+	"DomaphoneS-Next/backend/goadb/adbtest"
+	"DomaphoneS-Next/backend/goadb/wire"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+const uiDump = `<?xml version='1.0' encoding='UTF-8' standalone='yes' ?>` +
+	`<hierarchy rotation="0">` +
+	`<node index="0" text="" resource-id="" class="android.widget.FrameLayout" package="com.android.settings" content-desc="" checkable="false" checked="false" clickable="false" enabled="true" focusable="false" focused="false" scrollable="false" long-clickable="false" password="false" selected="false" bounds="[0,0][1080,2340]">` +
+	`<node index="0" text="" resource-id="com.android.settings:id/list" class="android.widget.ListView" package="com.android.settings" content-desc="" checkable="false" checked="false" clickable="false" enabled="true" focusable="true" focused="false" scrollable="true" long-clickable="false" password="false" selected="false" bounds="[0,200][1080,2340]">` +
+	`<node index="0" text="" resource-id="" class="android.widget.LinearLayout" package="com.android.settings" content-desc="" checkable="false" checked="false" clickable="true" enabled="true" focusable="true" focused="false" scrollable="false" long-clickable="false" password="false" selected="false" bounds="[0,200][1080,400]">` +
+	`<node index="0" text="Network &amp; internet" resource-id="android:id/title" class="android.widget.TextView" package="com.android.settings" content-desc="" checkable="false" checked="false" clickable="false" enabled="true" focusable="false" focused="false" scrollable="false" long-clickable="false" password="false" selected="false" bounds="[40,220][600,300]" />` +
+	`</node>` +
+	`<node index="1" text="" resource-id="" class="android.widget.LinearLayout" package="com.android.settings" content-desc="" checkable="false" checked="false" clickable="true" enabled="true" focusable="true" focused="false" scrollable="false" long-clickable="false" password="false" selected="false" bounds="[0,400][1080,600]">` +
+	`<node index="0" text="Wi-Fi" resource-id="android:id/title" class="android.widget.TextView" package="com.android.settings" content-desc="" checkable="false" checked="false" clickable="false" enabled="true" focusable="false" focused="false" scrollable="false" long-clickable="false" password="false" selected="false" bounds="[40,420][600,500]" />` +
+	`<node index="1" text="" resource-id="android:id/switch_widget" class="android.widget.Switch" package="com.android.settings" content-desc="Wi-Fi toggle" checkable="true" checked="true" clickable="true" enabled="true" focusable="true" focused="false" scrollable="false" long-clickable="false" password="false" selected="false" bounds="[900,440][1040,560]" />` +
+	`</node>` +
+	`</node>` +
+	`</node>` +
+	`</hierarchy>`
+
+func TestParseUIHierarchy(t *testing.T) {
+	root, err := adb.ParseUIHierarchy([]byte(uiDump))
+	require.NoError(t, err)
+	require.Len(t, root.Children, 1)
+
+	toggle := root.Find(adb.ByID("switch_widget"))
+	require.NotNil(t, toggle)
+	assert.Equal(t, "android.widget.Switch", toggle.Class)
+	assert.Equal(t, "com.android.settings", toggle.Package)
+	assert.Equal(t, "Wi-Fi toggle", toggle.ContentDesc)
+	assert.Equal(t, 1, toggle.Index)
+	assert.True(t, toggle.Checkable)
+	assert.True(t, toggle.Checked)
+	assert.True(t, toggle.Clickable)
+	assert.False(t, toggle.Focused)
+	assert.Equal(t, image.Rect(900, 440, 1040, 560), toggle.Bounds)
+	assert.Equal(t, image.Pt(970, 500), toggle.Center())
+
+	assert.Len(t, root.FindAll(adb.ByClass("TextView")), 2)
+	assert.Len(t, root.FindAll(adb.ByClass("android.widget.LinearLayout")), 2)
+	assert.Empty(t, root.FindAll(adb.ByClass("widget.TextView")))
+	assert.Equal(t, "Network & internet", root.Find(adb.ByText(regexp.MustCompile(`^Network`))).Text)
+	assert.Equal(t, toggle, root.Find(adb.ByContentDesc(regexp.MustCompile(`toggle`))))
+	assert.Equal(t, toggle, root.Find(adb.MatchAll(adb.ByClass("Switch"), adb.ByID("android:id/switch_widget"))))
+	assert.Nil(t, root.Find(adb.ByID("com.android.settings:id/switch_widget")))
+
+	_, err = adb.ParseUIHierarchy([]byte(`<hierarchy rotation="0"></hierarchy>`))
+	assert.ErrorIs(t, err, wire.ErrParse)
+	_, err = adb.ParseUIHierarchy([]byte(`<hierarchy><node bounds="[0,0]"/></hierarchy>`))
+	assert.ErrorIs(t, err, wire.ErrParse)
+}
+
+func TestByPath(t *testing.T) {
+	root, err := adb.ParseUIHierarchy([]byte(uiDump))
+	require.NoError(t, err)
+
+	tests := []struct {
+		path string
+		want []string
+	}{
+		{"//TextView", []string{"Network & internet", "Wi-Fi"}},
+		{"TextView[@text='Wi-Fi']", []string{"Wi-Fi"}},
+		{"//ListView/LinearLayout[2]/TextView", []string{"Wi-Fi"}},
+		{"/FrameLayout/ListView/*/TextView", []string{"Network & internet", "Wi-Fi"}},
+		{"/FrameLayout//TextView[1]", []string{"Network & internet", "Wi-Fi"}},
+		{"/ListView//TextView", nil},
+		{"//android.widget.ListView[@resource-id='com.android.settings:id/list']//Switch", []string{""}},
+	}
+	for _, tt := range tests {
+		sel, err := adb.ByPath(tt.path)
+		require.NoError(t, err, tt.path)
+		var got []string
+		for _, n := range root.FindAll(sel) {
+			got = append(got, n.Text)
+		}
+		assert.Equal(t, tt.want, got, tt.path)
+	}
+
+	for _, path := range []string{"", "//", "a///b", "a/", "TextView[@bogus='x']", "TextView[text]"} {
+		_, err := adb.ByPath(path)
+		assert.ErrorIs(t, err, wire.ErrParse, path)
+	}
+}
+
+// newUIDevice serves uiautomator dump, failing the first failures dumps like while the
+// screen is animating.
+func newUIDevice(t *testing.T, failures int32) *adb.Device {
+	dev := adbtest.NewDevice("emulator-5554")
+	var dumps int32
+	dev.HandleShellFunc(func(cmd string, stdin io.Reader, stdout, stderr io.Writer) int {
+		if strings.HasPrefix(cmd, "rm -rf ") {
+			dev.FS.Remove(strings.TrimPrefix(cmd, "rm -rf "))
+			return 0
+		}
+		path := strings.TrimPrefix(cmd, "uiautomator dump ")
+		if path == cmd {
+			return 127
+		}
+		if atomic.AddInt32(&dumps, 1) <= failures {
+			fmt.Fprintln(stderr, "ERROR: null root node returned by UiTestAutomationBridge.")
+			return 0
+		}
+		dev.FS.WriteFile(path, []byte(uiDump), 0644)
+		fmt.Fprintf(stderr, "UI hierchary dumped to: %s\n", path)
+		return 0
+	})
+	_, client := newTestClient(t, dev)
+	return client.Device(adb.AnyDevice())
+}
+
+func TestDumpUI(t *testing.T) {
+	ctx := context.Background()
+	d := newUIDevice(t, 1)
+
+	_, err := d.DumpUI(ctx)
+	assert.ErrorContains(t, err, "null root node")
+
+	root, err := d.DumpUI(ctx)
+	require.NoError(t, err)
+	assert.NotNil(t, root.Find(adb.ByText(regexp.MustCompile(`^Wi-Fi$`))))
+}
+
+func TestWaitFor(t *testing.T) {
+	d := newUIDevice(t, 2)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+	n, err := d.WaitFor(ctx, adb.ByID("switch_widget"))
+	require.NoError(t, err)
+	assert.Equal(t, "Wi-Fi toggle", n.ContentDesc)
+
+	ctx, cancel = context.WithTimeout(context.Background(), 300*time.Millisecond)
+	defer cancel()
+	_, err = d.WaitFor(ctx, adb.ByID("missing"))
+	assert.ErrorIs(t, err, context.DeadlineExceeded)
+	assert.ErrorContains(t, err, "no node matches id missing")
+}
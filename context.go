@@ -0,0 +1,139 @@
+package adb
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"os"
+	"sync"
+	"time"
+
+	"DomaphoneS-Next/backend/goadb/wire"
+)
+
+// withDefaultTimeout applies timeout to ctx unless ctx already has a deadline,
+// so the deadline of the caller always wins over CmdTimeoutShort and CmdTimeoutLong.
+// A zero timeout leaves ctx unchanged.
+func withDefaultTimeout(ctx context.Context, timeout time.Duration) (context.Context, context.CancelFunc) {
+	if _, ok := ctx.Deadline(); ok || timeout <= 0 {
+		return context.WithCancel(ctx)
+	}
+	return context.WithTimeout(ctx, timeout)
+}
+
+// contextError returns err annotated with the error of ctx, if ctx is the reason of err:
+// closing the connection on cancellation makes reads fail with net.ErrClosed, and the
+// deadline of ctx makes them fail with os.ErrDeadlineExceeded.
+// io.EOF is returned as is, callers compare it directly.
+func contextError(ctx context.Context, err error) error {
+	if err == nil || err == io.EOF {
+		return err
+	}
+	ctxErr := ctx.Err()
+	if ctxErr == nil && errors.Is(err, os.ErrDeadlineExceeded) {
+		if deadline, ok := ctx.Deadline(); ok && !time.Now().Before(deadline) {
+			ctxErr = context.DeadlineExceeded
+		}
+	}
+	if ctxErr == nil || errors.Is(err, ctxErr) {
+		return err
+	}
+	return fmt.Errorf("%w: %w", ctxErr, err)
+}
+
+// dialServer dials s and binds the connection to ctx, see bindConn.
+func dialServer(ctx context.Context, s server) (wire.IConn, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	conn, err := s.Dial(ctx)
+	if err != nil {
+		return nil, contextError(ctx, err)
+	}
+	return bindConn(ctx, conn), nil
+}
+
+// bindConn ties conn to ctx: the deadline of ctx becomes the deadline of conn, and
+// cancelling ctx closes conn, so blocked reads and writes return immediately and
+// the socket to the adb server is released.
+// Connections returned to the caller, like shell streams, stay bound to ctx until closed.
+func bindConn(ctx context.Context, conn wire.IConn) wire.IConn {
+	if c, ok := conn.(*wire.Conn); ok {
+		return wire.NewConn(newCtxConn(ctx, c.Conn))
+	}
+
+	// Other implementations, like the mock server, only get the deadline.
+	if deadline, ok := ctx.Deadline(); ok {
+		conn.SetDeadline(deadline)
+	}
+	return conn
+}
+
+// ctxConn is a net.Conn bound to a context, see bindConn.
+type ctxConn struct {
+	net.Conn
+	ctx  context.Context
+	stop chan struct{}
+	once sync.Once
+}
+
+func newCtxConn(ctx context.Context, conn net.Conn) *ctxConn {
+	c := &ctxConn{Conn: conn, ctx: ctx, stop: make(chan struct{})}
+	if deadline, ok := ctx.Deadline(); ok {
+		conn.SetDeadline(deadline)
+	}
+	// Background contexts are never done, there is nothing to watch.
+	if ctx.Done() != nil {
+		go func() {
+			select {
+			case <-ctx.Done():
+				conn.Close()
+			case <-c.stop:
+			}
+		}()
+	}
+	return c
+}
+
+func (c *ctxConn) Read(b []byte) (int, error) {
+	n, err := c.Conn.Read(b)
+	return n, contextError(c.ctx, err)
+}
+
+func (c *ctxConn) Write(b []byte) (int, error) {
+	n, err := c.Conn.Write(b)
+	return n, contextError(c.ctx, err)
+}
+
+func (c *ctxConn) Close() error {
+	c.release()
+	return c.Conn.Close()
+}
+
+// release stops watching the context, without closing the connection.
+func (c *ctxConn) release() {
+	c.once.Do(func() { close(c.stop) })
+}
+
+// SetReadDeadline keeps the deadline of the context when t is later or zero.
+func (c *ctxConn) SetReadDeadline(t time.Time) error {
+	return c.Conn.SetReadDeadline(c.earliest(t))
+}
+
+func (c *ctxConn) SetWriteDeadline(t time.Time) error {
+	return c.Conn.SetWriteDeadline(c.earliest(t))
+}
+
+func (c *ctxConn) SetDeadline(t time.Time) error {
+	return c.Conn.SetDeadline(c.earliest(t))
+}
+
+func (c *ctxConn) earliest(t time.Time) time.Time {
+	deadline, ok := c.ctx.Deadline()
+	if !ok || (!t.IsZero() && t.Before(deadline)) {
+		return t
+	}
+	return deadline
+}
@@ -0,0 +1,94 @@
+package adb_test
+
+import (
+	"context"
+	"io"
+	"strings"
+	"testing"
+	"time"
+
+	adb "DomaphoneS-Next/backend/goadb"
+	"DomaphoneS-Next/backend/goadb/adbtest"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// newBlockingDevice returns a client of a device whose "block" command runs until its connection is closed.
+func newBlockingDevice(t *testing.T) *adb.Device {
+	srv, err := adbtest.NewServer()
+	require.NoError(t, err)
+	t.Cleanup(func() { srv.Close() })
+	dev := adbtest.NewDevice("emulator-5554")
+	dev.HandleShell("block", func(cmd string, stdin io.Reader, stdout, stderr io.Writer) int {
+		io.WriteString(stdout, "started\n")
+		io.Copy(io.Discard, stdin)
+		return 0
+	})
+	srv.AddDevice(dev)
+
+	client, err := adb.NewWithConfig(srv.Config())
+	require.NoError(t, err)
+	return client.Device(adb.AnyDevice())
+}
+
+func TestContext_Cancel(t *testing.T) {
+	d := newBlockingDevice(t)
+	ctx, cancel := context.WithCancel(context.Background())
+	time.AfterFunc(100*time.Millisecond, cancel)
+
+	start := time.Now()
+	var out strings.Builder
+	err := d.RunCommandTo(ctx, &out, "block")
+	assert.ErrorIs(t, err, context.Canceled)
+	assert.Less(t, time.Since(start), time.Second)
+	assert.Equal(t, "started\n", out.String())
+}
+
+func TestContext_Deadline(t *testing.T) {
+	d := newBlockingDevice(t)
+	d.CmdTimeoutShort = time.Minute
+	ctx, cancel := context.WithTimeout(context.Background(), 100*time.Millisecond)
+	defer cancel()
+
+	// The deadline of ctx wins over CmdTimeoutShort.
+	start := time.Now()
+	_, err := d.RunCommand(ctx, "block")
+	assert.ErrorIs(t, err, context.DeadlineExceeded)
+	assert.Less(t, time.Since(start), time.Second)
+
+	// Without a deadline, CmdTimeoutShort applies.
+	d.CmdTimeoutShort = 100 * time.Millisecond
+	_, err = d.RunCommand(context.Background(), "block")
+	assert.ErrorIs(t, err, context.DeadlineExceeded)
+}
+
+func TestContext_CanceledBeforeDial(t *testing.T) {
+	d := newBlockingDevice(t)
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	_, err := d.Serial(ctx)
+	assert.ErrorIs(t, err, context.Canceled)
+}
+
+func TestContext_DeviceWatcherShutdown(t *testing.T) {
+	srv, err := adbtest.NewServer()
+	require.NoError(t, err)
+	defer srv.Close()
+	client, err := adb.NewWithConfig(srv.Config())
+	require.NoError(t, err)
+
+	watcher := client.NewDeviceWatcher(context.Background())
+	srv.AddDevice(adbtest.NewDevice("emulator-5554"))
+	<-watcher.C()
+	watcher.Shutdown()
+
+	select {
+	case _, ok := <-watcher.C():
+		assert.False(t, ok)
+	case <-time.After(5 * time.Second):
+		t.Fatal("watcher not shut down")
+	}
+	assert.NoError(t, watcher.Err())
+}
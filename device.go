@@ -1,11 +1,14 @@
 package adb
 
 import (
+	"context"
+	"errors"
 	"fmt"
 	"net"
 	"os"
 	"strconv"
 	"strings"
+	"sync"
 	"time"
 
 	"DomaphoneS-Next/backend/goadb/wire"
@@ -28,12 +31,12 @@ const (
 	FeatureFixedPushSymlinkTimestamp = "fixed_push_symlink_timestamp"
 	FeatureAbbExec                   = "abb_exec"
 	FeatureRemountShell              = "remount_shell"
-	//track_app
-	//sendrecv_v2
-	//sendrecv_v2_brotli
-	//sendrecv_v2_lz4
-	//sendrecv_v2_zstd
-	//sendrecv_v2_dry_run_send
+	FeatureSendRecv2                 = "sendrecv_v2"
+	FeatureSendRecv2Brotli           = "sendrecv_v2_brotli"
+	FeatureSendRecv2LZ4              = "sendrecv_v2_lz4"
+	FeatureSendRecv2Zstd             = "sendrecv_v2_zstd"
+	FeatureSendRecv2DryRunSend       = "sendrecv_v2_dry_run_send"
+	FeatureTrackApp                  = "track_app"
 	//openscreen_mdns
 	//push_sync
 )
@@ -45,11 +48,21 @@ type Device struct {
 	descriptor DeviceDescriptor
 
 	// Used to get device info.
-	deviceListFunc func() ([]*DeviceInfo, error)
+	deviceListFunc func(context.Context) ([]*DeviceInfo, error)
 	deviceFeatures map[string]bool
+	featuresMu     sync.Mutex
 
+	// CmdTimeoutShort and CmdTimeoutLong are the timeouts of quick and slow commands
+	// when the context passed to a method has no deadline.
 	CmdTimeoutShort time.Duration
 	CmdTimeoutLong  time.Duration
+
+	// SyncCompression is the compression used for push and pull when the device
+	// supports FeatureSendRecv2. The zero value picks the best supported algorithm.
+	SyncCompression wire.CompressionType
+	// SyncDryRun makes push transfer the data without writing it on the device,
+	// to measure throughput. Requires FeatureSendRecv2DryRunSend.
+	SyncDryRun bool
 }
 
 func (c *Device) String() string {
@@ -58,18 +71,18 @@ func (c *Device) String() string {
 
 // Serial return the serial in adb-server, not the serial of the connected device
 // for adb connect 106.52.95.27:42370, return the "106.52.95.27:42370"
-func (c *Device) Serial() (string, error) {
-	attr, err := c.getAttribute("get-serialno")
+func (c *Device) Serial(ctx context.Context) (string, error) {
+	attr, err := c.getAttribute(ctx, "get-serialno")
 	return attr, wrapClientError(err, c, "Serial")
 }
 
-func (c *Device) DevicePath() (string, error) {
-	attr, err := c.getAttribute("get-devpath")
+func (c *Device) DevicePath(ctx context.Context) (string, error) {
+	attr, err := c.getAttribute(ctx, "get-devpath")
 	return attr, wrapClientError(err, c, "DevicePath")
 }
 
-func (c *Device) DeviceFeatures() (features map[string]bool, err error) {
-	attr, err := c.getAttribute("features")
+func (c *Device) DeviceFeatures(ctx context.Context) (features map[string]bool, err error) {
+	attr, err := c.getAttribute(ctx, "features")
 	if err != nil {
 		return nil, wrapClientError(err, c, "features")
 	}
@@ -77,11 +90,33 @@ func (c *Device) DeviceFeatures() (features map[string]bool, err error) {
 	return
 }
 
-func (c *Device) State() (DeviceState, error) {
-	attr, err := c.getAttribute("get-state")
+// cachedFeatures returns the device features, querying the server only once.
+// Errors are not cached, so a later call retries.
+func (c *Device) cachedFeatures(ctx context.Context) (map[string]bool, error) {
+	c.featuresMu.Lock()
+	defer c.featuresMu.Unlock()
+	if c.deviceFeatures != nil {
+		return c.deviceFeatures, nil
+	}
+	features, err := c.DeviceFeatures(ctx)
+	if err != nil {
+		return nil, err
+	}
+	c.deviceFeatures = features
+	return features, nil
+}
+
+func (c *Device) State(ctx context.Context) (DeviceState, error) {
+	attr, err := c.getAttribute(ctx, "get-state")
 	if err != nil {
-		if strings.Contains(err.Error(), "unauthorized") {
+		// The server fails get-state for devices it can't talk to yet.
+		switch {
+		case errors.Is(err, wire.ErrDeviceUnauthorized):
 			return StateUnauthorized, nil
+		case errors.Is(err, wire.ErrDeviceAuthorizing):
+			return StateAuthorizing, nil
+		case errors.Is(err, wire.ErrDeviceOffline):
+			return StateOffline, nil
 		}
 		return StateInvalid, wrapClientError(err, c, "State")
 	}
@@ -89,16 +124,16 @@ func (c *Device) State() (DeviceState, error) {
 	return state, wrapClientError(err, c, "State")
 }
 
-func (c *Device) DeviceInfo() (*DeviceInfo, error) {
+func (c *Device) DeviceInfo(ctx context.Context) (*DeviceInfo, error) {
 	// Adb doesn't actually provide a way to get this for an individual device,
 	// so we have to just list devices and find ourselves.
 
-	serial, err := c.Serial()
+	serial, err := c.Serial(ctx)
 	if err != nil {
 		return nil, wrapClientError(err, c, "GetDeviceInfo(GetSerial)")
 	}
 
-	devices, err := c.deviceListFunc()
+	devices, err := c.deviceListFunc(ctx)
 	if err != nil {
 		return nil, wrapClientError(err, c, "DeviceInfo(ListDevices)")
 	}
@@ -125,16 +160,17 @@ func (c *Device) DeviceInfo() (*DeviceInfo, error) {
 //	jdwp:<process pid> (remote only)
 //	vsock:<CID>:<port> (remote only)
 //	acceptfd:<fd> (listen only)
-func (c *Device) ForwardPort(port int) (net.Conn, error) {
-	return c.Forward("tcp:" + strconv.Itoa(port))
+func (c *Device) ForwardPort(ctx context.Context, port int) (net.Conn, error) {
+	return c.Forward(ctx, "tcp:"+strconv.Itoa(port))
 }
 
-func (c *Device) ForwardAbstract(name string) (net.Conn, error) {
-	return c.Forward("localabstract:" + name)
+func (c *Device) ForwardAbstract(ctx context.Context, name string) (net.Conn, error) {
+	return c.Forward(ctx, "localabstract:"+name)
 }
 
-func (c *Device) Forward(addr string) (net.Conn, error) {
-	conn, err := c.dialDevice(c.CmdTimeoutShort)
+// The connection stays bound to ctx: cancelling it closes the connection.
+func (c *Device) Forward(ctx context.Context, addr string) (net.Conn, error) {
+	conn, err := c.dialDevice(ctx)
 	if err != nil {
 		return nil, wrapClientError(err, c, "forward")
 	}
@@ -142,7 +178,7 @@ func (c *Device) Forward(addr string) (net.Conn, error) {
 		conn.Close()
 		return nil, wrapClientError(err, c, "forward")
 	}
-	if _, err = readStatusWithTimeout(conn, addr, c.CmdTimeoutShort); err != nil {
+	if _, err = readStatusWithTimeout(ctx, conn, addr, c.CmdTimeoutShort); err != nil {
 		conn.Close()
 		return nil, wrapClientError(err, c, "forward")
 	}
@@ -150,10 +186,31 @@ func (c *Device) Forward(addr string) (net.Conn, error) {
 	return conn.(*wire.Conn), wrapClientError(err, c, "forward")
 }
 
-func (c *Device) DoForward(local, remote string, noRebind bool) (err error) {
-	conn, err := c.dialDevice(c.CmdTimeoutShort)
+// openService opens a stream to the device service, for services that send messages
+// until the stream is closed, like track-jdwp.
+func (c *Device) openService(ctx context.Context, service string) (wire.IConn, error) {
+	conn, err := c.dialDevice(ctx)
+	if err != nil {
+		return nil, err
+	}
+	if err = conn.SendMessage([]byte(service)); err != nil {
+		conn.Close()
+		return nil, err
+	}
+	if _, err = readStatusWithTimeout(ctx, conn, service, c.CmdTimeoutShort); err != nil {
+		conn.Close()
+		return nil, err
+	}
+	return conn, nil
+}
+
+// DoForward forwards connections to local on the host to remote on the device, like
+// `adb forward [--no-rebind] LOCAL REMOTE`.
+// If local is tcp:0, the server picks the port and it's returned, otherwise the port is 0.
+func (c *Device) DoForward(ctx context.Context, local, remote string, noRebind bool) (port int, err error) {
+	conn, err := c.dialDevice(ctx)
 	if err != nil {
-		return wrapClientError(err, c, "forward")
+		return 0, wrapClientError(err, c, "forward")
 	}
 	defer conn.Close()
 
@@ -165,23 +222,37 @@ func (c *Device) DoForward(local, remote string, noRebind bool) (err error) {
 	}
 
 	if err = conn.SendMessage([]byte(command)); err != nil {
-		return wrapClientError(err, c, "forward")
+		return 0, wrapClientError(err, c, "forward")
 	}
-	if _, err := readStatusWithTimeout(conn, command, c.CmdTimeoutShort); err != nil {
-		return wrapClientError(err, c, "forward")
-	} else {
-		return nil
+	if _, err = readStatusWithTimeout(ctx, conn, command, c.CmdTimeoutShort); err != nil {
+		return 0, wrapClientError(err, c, "forward")
+	}
+	if local != "tcp:0" {
+		return 0, nil
 	}
+
+	// The result status is followed by the allocated port.
+	if _, err = readStatusWithTimeout(ctx, conn, command, c.CmdTimeoutShort); err != nil {
+		return 0, wrapClientError(err, c, "forward")
+	}
+	resp, err := conn.ReadMessage()
+	if err != nil {
+		return 0, wrapClientError(contextError(ctx, err), c, "forward")
+	}
+	if port, err = strconv.Atoi(string(resp)); err != nil {
+		return 0, wrapClientError(fmt.Errorf("%w: invalid forward port %q", wire.ErrParse, resp), c, "forward")
+	}
+	return port, nil
 }
 
-func (c *Device) DoListForward() (deviceForwardList []ForwardEntry, err error) {
+func (c *Device) DoListForward(ctx context.Context) (deviceForwardList []ForwardEntry, err error) {
 	// c.descriptor.serial 可能为空，因此从这里获取
-	serial, err := c.Serial()
+	serial, err := c.Serial(ctx)
 	if err != nil {
 		return nil, fmt.Errorf("forward-list get serial failed:%w", err)
 	}
 
-	resp, err := roundTripSingleResponse(c.server, "host:list-forward")
+	resp, err := roundTripSingleResponse(ctx, c.server, "host:list-forward")
 	if err != nil {
 		return nil, err
 	}
@@ -195,16 +266,111 @@ func (c *Device) DoListForward() (deviceForwardList []ForwardEntry, err error) {
 	return
 }
 
-func (c *Device) DoRemoveForward(local string) (err error) {
-	conn, err := c.dialDevice(c.CmdTimeoutShort)
+func (c *Device) DoRemoveForward(ctx context.Context, local string) (err error) {
+	ctx, cancel := withDefaultTimeout(ctx, c.CmdTimeoutShort)
+	defer cancel()
+	conn, err := c.dialDevice(ctx)
 	if err != nil {
 		return wrapClientError(err, c, "forward-remove")
 	}
 	defer conn.Close()
 
+	// Like killforward-all, the OKAY is followed by another OKAY, not by a message.
 	command := fmt.Sprintf("host:killforward:%s", local)
-	_, err = conn.RoundTripSingleResponse([]byte(command))
-	return wrapClientError(err, c, "forward-remove")
+	if err = conn.SendMessage([]byte(command)); err != nil {
+		return wrapClientError(err, c, "forward-remove")
+	}
+	_, err = conn.ReadStatus(command)
+	return wrapClientError(contextError(ctx, err), c, "forward-remove")
+}
+
+// DoReverse sets up a reverse forward: connections to remote on the device are forwarded to local
+// on the host, like `adb reverse [--no-rebind] REMOTE LOCAL`.
+// If remote is tcp:0, the device picks the port and it's returned, otherwise the port is 0.
+func (c *Device) DoReverse(ctx context.Context, remote, local string, noRebind bool) (port int, err error) {
+	command := fmt.Sprintf("reverse:forward:%s;%s", remote, local)
+	if noRebind {
+		command = fmt.Sprintf("reverse:forward:norebind:%s;%s", remote, local)
+	}
+	resp, err := c.reverseService(ctx, command)
+	if err != nil {
+		return 0, wrapClientError(err, c, "reverse")
+	}
+	if len(resp) > 0 {
+		if port, err = strconv.Atoi(string(resp)); err != nil {
+			return 0, wrapClientError(fmt.Errorf("%w: invalid reverse port %q", wire.ErrParse, resp), c, "reverse")
+		}
+	}
+	return port, nil
+}
+
+// DoListReverse lists the reverse forwards of the device. Local is the socket listening on the device,
+// Remote the one on the host, and Serial the name adbd gives to the connection to the host, eg. UsbFfs.
+func (c *Device) DoListReverse(ctx context.Context) ([]ForwardEntry, error) {
+	resp, err := c.reverseService(ctx, "reverse:list-forward")
+	if err != nil {
+		return nil, wrapClientError(err, c, "reverse-list")
+	}
+	return parseForwardList(resp), nil
+}
+
+// DoRemoveReverse removes the reverse forward listening on remote on the device.
+func (c *Device) DoRemoveReverse(ctx context.Context, remote string) error {
+	_, err := c.reverseService(ctx, "reverse:killforward:"+remote)
+	return wrapClientError(err, c, "reverse-remove")
+}
+
+// DoRemoveAllReverse removes all the reverse forwards of the device.
+func (c *Device) DoRemoveAllReverse(ctx context.Context) error {
+	_, err := c.reverseService(ctx, "reverse:killforward-all")
+	return wrapClientError(err, c, "reverse-remove-all")
+}
+
+// reverseService runs a reverse: service of adbd. For forward and killforward, adbd answers
+// with its own status after the one of the server, followed by a message for tcp:0 forwards.
+// For list-forward, it only sends the message after the status of the server.
+func (c *Device) reverseService(ctx context.Context, command string) ([]byte, error) {
+	ctx, cancel := withDefaultTimeout(ctx, c.CmdTimeoutShort)
+	defer cancel()
+	conn, err := c.dialDevice(ctx)
+	if err != nil {
+		return nil, err
+	}
+	defer conn.Close()
+
+	if err = conn.SendMessage([]byte(command)); err != nil {
+		return nil, err
+	}
+	if _, err = conn.ReadStatus(command); err != nil {
+		return nil, contextError(ctx, err)
+	}
+	if command == "reverse:list-forward" {
+		resp, err := conn.ReadMessage()
+		if err != nil {
+			return nil, contextError(ctx, err)
+		}
+		return resp, nil
+	}
+	if _, err = conn.ReadStatus(command); err != nil {
+		return nil, contextError(ctx, err)
+	}
+
+	// adbd closes the stream after the message.
+	resp, err := conn.ReadUntilEof()
+	if err != nil {
+		return nil, contextError(ctx, err)
+	}
+	if len(resp) == 0 {
+		return nil, nil
+	}
+	if len(resp) < 4 {
+		return nil, fmt.Errorf("%w: truncated response to %s: %q", wire.ErrParse, command, resp)
+	}
+	length, err := strconv.ParseUint(string(resp[:4]), 16, 16)
+	if err != nil || int(length) != len(resp)-4 {
+		return nil, fmt.Errorf("%w: invalid response to %s: %q", wire.ErrParse, command, resp)
+	}
+	return resp[4:], nil
 }
 
 // Remount, from the official adb command’s docs:
@@ -216,8 +382,10 @@ func (c *Device) DoRemoveForward(local string) (err error) {
 //	that.
 //
 // Source: https://android.googlesource.com/platform/system/core/+/master/adb/SERVICES.TXT
-func (c *Device) Remount() (string, error) {
-	conn, err := c.dialDevice(c.CmdTimeoutShort)
+func (c *Device) Remount(ctx context.Context) (string, error) {
+	ctx, cancel := withDefaultTimeout(ctx, c.CmdTimeoutLong)
+	defer cancel()
+	conn, err := c.dialDevice(ctx)
 	if err != nil {
 		return "", wrapClientError(err, c, "Remount")
 	}
@@ -227,8 +395,10 @@ func (c *Device) Remount() (string, error) {
 	return string(resp), wrapClientError(err, c, "Remount")
 }
 
-func (c *Device) Stat(path string) (*wire.DirEntry, error) {
-	conn, err := c.NewSyncConn()
+func (c *Device) Stat(ctx context.Context, path string) (*wire.DirEntry, error) {
+	ctx, cancel := withDefaultTimeout(ctx, c.CmdTimeoutShort)
+	defer cancel()
+	conn, err := c.NewSyncConn(ctx)
 	if err != nil {
 		return nil, wrapClientError(err, c, "Stat(%s)", path)
 	}
@@ -238,8 +408,8 @@ func (c *Device) Stat(path string) (*wire.DirEntry, error) {
 	return entry, wrapClientError(err, c, "Stat(%s)", path)
 }
 
-func (c *Device) OpenDirReader(path string) (*wire.SyncConn, *wire.SyncDirReader, error) {
-	conn, err := c.NewSyncConn()
+func (c *Device) OpenDirReader(ctx context.Context, path string) (*wire.SyncConn, *wire.SyncDirReader, error) {
+	conn, err := c.NewSyncConn(ctx)
 	if err != nil {
 		return nil, nil, wrapClientError(err, c, "OpenDirReader(%s)", path)
 	}
@@ -252,8 +422,8 @@ func (c *Device) OpenDirReader(path string) (*wire.SyncConn, *wire.SyncDirReader
 	return conn, dr, nil
 }
 
-func (c *Device) OpenFileReader(path string) (*wire.SyncConn, *wire.SyncFileReader, error) {
-	conn, err := c.NewSyncConn()
+func (c *Device) OpenFileReader(ctx context.Context, path string) (*wire.SyncConn, *wire.SyncFileReader, error) {
+	conn, err := c.NewSyncConn(ctx)
 	if err != nil {
 		return nil, nil, wrapClientError(err, c, "OpenRead(%s)", path)
 	}
@@ -271,8 +441,8 @@ func (c *Device) OpenFileReader(path string) (*wire.SyncConn, *wire.SyncFileRead
 // by perms if necessary, and returns a writer that writes to the file.
 // The files modification time will be set to mtime when the WriterCloser is closed. The zero value
 // is TimeOfClose, which will use the time the Close method is called as the modification time.
-func (c *Device) OpenFileWriter(path string, perms os.FileMode, mtime time.Time) (*wire.SyncConn, *wire.SyncFileWriter, error) {
-	conn, err := c.NewSyncConn()
+func (c *Device) OpenFileWriter(ctx context.Context, path string, perms os.FileMode, mtime time.Time) (*wire.SyncConn, *wire.SyncFileWriter, error) {
+	conn, err := c.NewSyncConn(ctx)
 	if err != nil {
 		return nil, nil, wrapClientError(err, c, "OpenWrite(%s)", path)
 	}
@@ -288,8 +458,8 @@ func (c *Device) OpenFileWriter(path string, perms os.FileMode, mtime time.Time)
 
 // getAttribute returns the first message returned by the server by running
 // <host-prefix>:<attr>, where host-prefix is determined from the DeviceDescriptor.
-func (c *Device) getAttribute(attr string) (string, error) {
-	resp, err := roundTripSingleResponse(c.server,
+func (c *Device) getAttribute(ctx context.Context, attr string) (string, error) {
+	resp, err := roundTripSingleResponse(ctx, c.server,
 		fmt.Sprintf("%s:%s", c.descriptor.getHostPrefix(), attr))
 	if err != nil {
 		return "", err
@@ -297,28 +467,44 @@ func (c *Device) getAttribute(attr string) (string, error) {
 	return string(resp), nil
 }
 
-func (c *Device) NewSyncConn() (*wire.SyncConn, error) {
-	conn, err := c.dialDevice(c.CmdTimeoutShort)
+// NewSyncConn opens a connection in sync mode. The v2 stat and list requests are
+// used when the device advertises FeatureStat2 and FeatureLs2, and compressed
+// SND2/RCV2 transfers when it advertises FeatureSendRecv2.
+// The connection stays bound to ctx: cancelling it aborts the transfer in progress.
+func (c *Device) NewSyncConn(ctx context.Context) (*wire.SyncConn, error) {
+	// Old servers may not know the features request, fall back to the v1 protocol.
+	features, _ := c.cachedFeatures(ctx)
+
+	conn, err := c.dialDevice(ctx)
 	if err != nil {
 		return nil, err
 	}
 
 	// Switch the connection to sync mode.
 	if err := conn.SendMessage([]byte("sync:")); err != nil {
+		conn.Close()
 		return nil, err
 	}
-	if _, err = readStatusWithTimeout(conn, "sync", c.CmdTimeoutShort); err != nil {
+	if _, err = readStatusWithTimeout(ctx, conn, "sync", c.CmdTimeoutShort); err != nil {
+		conn.Close()
 		return nil, err
 	}
 
 	// FIXME: refactor in soon
-	return wire.NewSyncConn(conn.(*wire.Conn)), nil
+	sconn := wire.NewSyncConnWithFeatures(conn.(*wire.Conn), features)
+	sconn.SetCompression(c.SyncCompression)
+	if err = sconn.SetDryRun(c.SyncDryRun); err != nil {
+		sconn.Close()
+		return nil, err
+	}
+	return sconn, nil
 }
 
 // dialDevice switches the connection to communicate directly with the device
 // by requesting the transport defined by the DeviceDescriptor.
-func (c *Device) dialDevice(timeout time.Duration) (wire.IConn, error) {
-	conn, err := c.server.Dial()
+// The connection is bound to ctx, see bindConn.
+func (c *Device) dialDevice(ctx context.Context) (wire.IConn, error) {
+	conn, err := dialServer(ctx, c.server)
 	if err != nil {
 		return nil, err
 	}
@@ -329,7 +515,7 @@ func (c *Device) dialDevice(timeout time.Duration) (wire.IConn, error) {
 		return nil, fmt.Errorf("error connecting to device '%s': %w", c.descriptor, err)
 	}
 
-	if _, err = readStatusWithTimeout(conn, req, timeout); err != nil {
+	if _, err = readStatusWithTimeout(ctx, conn, req, c.CmdTimeoutShort); err != nil {
 		conn.Close()
 		return nil, err
 	}
@@ -337,12 +523,16 @@ func (c *Device) dialDevice(timeout time.Duration) (wire.IConn, error) {
 	return conn, nil
 }
 
-func readStatusWithTimeout(conn wire.IConn, req string, timeout time.Duration) (resp string, err error) {
-	if err = conn.SetReadDeadline(time.Now().Add(timeout)); err != nil {
-		return
+// readStatusWithTimeout reads the status of req. timeout applies only if ctx has no deadline;
+// a deadline of ctx is kept on conn by bindConn.
+func readStatusWithTimeout(ctx context.Context, conn wire.IConn, req string, timeout time.Duration) (resp string, err error) {
+	if _, ok := ctx.Deadline(); !ok && timeout > 0 {
+		if err = conn.SetReadDeadline(time.Now().Add(timeout)); err != nil {
+			return
+		}
 	}
 	if resp, err = conn.ReadStatus(req); err != nil {
-		return
+		return resp, contextError(ctx, err)
 	}
 	if err = conn.SetReadDeadline(time.Time{}); err != nil {
 		return
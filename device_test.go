@@ -2,8 +2,10 @@ package adb
 
 import (
 	"bytes"
+	"context"
 	"errors"
 	"fmt"
+	"strings"
 	"testing"
 
 	"DomaphoneS-Next/backend/goadb/wire"
@@ -18,14 +20,14 @@ func TestGetAttribute(t *testing.T) {
 	}
 	client := (&Adb{s}).Device(DeviceWithSerial("serial"))
 
-	v, err := client.getAttribute("attr")
+	v, err := client.getAttribute(context.TODO(), "attr")
 	assert.Equal(t, "host-serial:serial:attr", s.Requests[0])
 	assert.NoError(t, err)
 	assert.Equal(t, "value", v)
 }
 
 func TestGetDeviceInfo(t *testing.T) {
-	deviceLister := func() ([]*DeviceInfo, error) {
+	deviceLister := func(context.Context) ([]*DeviceInfo, error) {
 		return []*DeviceInfo{
 			&DeviceInfo{
 				Serial:  "abc",
@@ -39,24 +41,24 @@ func TestGetDeviceInfo(t *testing.T) {
 	}
 
 	client := newDeviceClientWithDeviceLister("abc", deviceLister)
-	device, err := client.DeviceInfo()
+	device, err := client.DeviceInfo(context.TODO())
 	assert.NoError(t, err)
 	assert.Equal(t, "Foo", device.Product)
 
 	client = newDeviceClientWithDeviceLister("def", deviceLister)
-	device, err = client.DeviceInfo()
+	device, err = client.DeviceInfo(context.TODO())
 	assert.NoError(t, err)
 	assert.Equal(t, "Bar", device.Product)
 
 	client = newDeviceClientWithDeviceLister("serial", deviceLister)
-	device, err = client.DeviceInfo()
+	device, err = client.DeviceInfo(context.TODO())
 	assert.True(t, errors.Is(err, wire.ErrDeviceNotFound))
 	assert.EqualError(t, errors.Unwrap(err),
 		"DeviceNotFound: device list doesn't contain serial serial")
 	assert.Nil(t, device)
 }
 
-func newDeviceClientWithDeviceLister(serial string, deviceLister func() ([]*DeviceInfo, error)) *Device {
+func newDeviceClientWithDeviceLister(serial string, deviceLister func(context.Context) ([]*DeviceInfo, error)) *Device {
 	client := (&Adb{&MockServer{
 		Status:   wire.StatusSuccess,
 		Messages: []string{serial},
@@ -76,7 +78,7 @@ func TestRunCommandNoArgs(t *testing.T) {
 	}
 	client := (&Adb{s}).Device(AnyDevice())
 
-	v, err := client.RunCommand("cmd")
+	v, err := client.RunCommand(context.TODO(), "cmd")
 	assert.Equal(t, "host:transport-any", s.Requests[0])
 	assert.Equal(t, "shell:cmd", s.Requests[1])
 	assert.NoError(t, err)
@@ -131,13 +133,35 @@ func Test_featuresStrToMap(t *testing.T) {
 func TestDevice_State(t *testing.T) {
 	assert.NotNil(t, adbclient)
 	d := adbclient.Device(DeviceWithSerial("not-existed"))
-	state, err := d.State()
+	state, err := d.State(context.TODO())
 	assert.Equal(t, state, StateInvalid)
 	assert.ErrorIs(t, err, wire.ErrDeviceNotFound)
 
 	d2 := adbclient.Device(AnyDevice())
-	state, err = d2.State()
+	state, err = d2.State(context.TODO())
 	fmt.Printf("state:%v, err=%v", state, err)
 	assert.Equal(t, state, StateInvalid)
 	assert.Contains(t, err.Error(), "no devices/emulators found")
 }
+
+// TestDoListReverse_Replay replays adbd's reply to reverse:list-forward: the protocol string
+// follows the status of the server, adbd sends no status of its own.
+func TestDoListReverse_Replay(t *testing.T) {
+	capture := `{"conn":1,"time":"2024-01-01T00:00:00Z","dir":"dial","addr":"127.0.0.1:5037"}
+{"conn":1,"time":"2024-01-01T00:00:00Z","dir":"send","req":"host:transport-any","data":"MDAxMmhvc3Q6dHJhbnNwb3J0LWFueQ=="}
+{"conn":1,"time":"2024-01-01T00:00:00Z","dir":"recv","req":"host:transport-any","data":"T0tBWQ=="}
+{"conn":1,"time":"2024-01-01T00:00:00Z","dir":"send","req":"reverse:list-forward","data":"MDAxNHJldmVyc2U6bGlzdC1mb3J3YXJk"}
+{"conn":1,"time":"2024-01-01T00:00:00Z","dir":"recv","req":"reverse:list-forward","data":"T0tBWTAwMTlVc2JGZnMgdGNwOjgwODAgdGNwOjkwOTAK"}
+{"conn":1,"time":"2024-01-01T00:00:00Z","dir":"recv","req":"reverse:list-forward","err":"EOF"}
+`
+	replay, err := NewReplayDialer(strings.NewReader(capture))
+	assert.NoError(t, err)
+	server, err := newServer(ServerConfig{PathToAdb: "/bin/adb", Dialer: replay, fs: newTestFilesystem(nil)})
+	assert.NoError(t, err)
+	d := (&Adb{server}).Device(AnyDevice())
+
+	list, err := d.DoListReverse(context.Background())
+	assert.NoError(t, err)
+	assert.Equal(t, []ForwardEntry{{Serial: "UsbFfs", Local: "tcp:8080", Remote: "tcp:9090"}}, list)
+	assert.Zero(t, replay.Remaining())
+}
@@ -1,6 +1,7 @@
 package adb
 
 import (
+	"context"
 	"errors"
 	"fmt"
 	"log"
@@ -41,15 +42,22 @@ func (s DeviceStateChangedEvent) WentOffline() bool {
 type deviceWatcherImpl struct {
 	server server
 
+	// ctx ends the watcher, cancel is called by Shutdown.
+	ctx    context.Context
+	cancel context.CancelFunc
+
 	// If an error occurs, it is stored here and eventChan is close immediately after.
 	err atomic.Value
 
 	eventChan chan DeviceStateChangedEvent
 }
 
-func newDeviceWatcher(server server) *DeviceWatcher {
+func newDeviceWatcher(ctx context.Context, server server) *DeviceWatcher {
+	ctx, cancel := context.WithCancel(ctx)
 	watcher := &DeviceWatcher{&deviceWatcherImpl{
 		server:    server,
+		ctx:       ctx,
+		cancel:    cancel,
 		eventChan: make(chan DeviceStateChangedEvent),
 	}}
 
@@ -78,9 +86,9 @@ func (w *DeviceWatcher) Err() error {
 }
 
 // Shutdown stops the watcher from listening for events and closes the channel returned
-// from C.
+// from C. Err returns nil after a shutdown.
 func (w *DeviceWatcher) Shutdown() {
-	// TODO(z): Implement.
+	w.cancel()
 }
 
 func (w *deviceWatcherImpl) reportErr(err error) {
@@ -89,30 +97,34 @@ func (w *deviceWatcherImpl) reportErr(err error) {
 
 // publishDevices reads device lists from scanner, calculates diffs, and publishes events on
 // eventChan.
-// Returns when scanner returns an error.
+// Returns when scanner returns an error, or when the context of the watcher is done.
 // Doesn't refer directly to a *DeviceWatcher so it can be GCed (which will,
-// in turn, close Scanner and stop this goroutine).
-//
-// TODO: to support shutdown, spawn a new goroutine each time a server connection is established.
-// This goroutine should read messages and send them to a message channel. Can write errors directly
-// to errVal. publishDevicesUntilError should take the msg chan and the scanner and select on the msg chan and stop chan, and if the stop
-// chan sends, close the scanner and return true. If the msg chan closes, just return false.
-// publishDevices can look at ret val: if false and err == EOF, reconnect. If false and other error, report err
-// and abort. If true, report no error and stop.
+// in turn, cancel the context and stop this goroutine).
 func publishDevices(watcher *deviceWatcherImpl) {
 	defer close(watcher.eventChan)
 
+	ctx := watcher.ctx
+	if ctx == nil {
+		ctx = context.Background()
+	}
 	var lastKnownStates map[string]DeviceState
 	finished := false
 
 	for {
-		scanner, err := connectToTrackDevices(watcher.server)
+		scanner, err := connectToTrackDevices(ctx, watcher.server)
+		if ctx.Err() != nil {
+			// Shut down, not an error.
+			if err == nil {
+				scanner.Close()
+			}
+			return
+		}
 		if err != nil {
 			watcher.reportErr(err)
 			return
 		}
 
-		finished, err = publishDevicesUntilError(scanner, watcher.eventChan, &lastKnownStates)
+		finished, err = publishDevicesUntilError(ctx, scanner, watcher.eventChan, &lastKnownStates)
 
 		if finished {
 			scanner.Close()
@@ -130,7 +142,11 @@ func publishDevices(watcher *deviceWatcherImpl) {
 
 			// report all devices removed
 			for serial, deviceState := range lastKnownStates {
-				watcher.eventChan <- DeviceStateChangedEvent{serial, deviceState, StateDisconnected}
+				select {
+				case watcher.eventChan <- DeviceStateChangedEvent{serial, deviceState, StateDisconnected}:
+				case <-ctx.Done():
+					return
+				}
 			}
 			lastKnownStates = nil
 
@@ -139,8 +155,12 @@ func publishDevices(watcher *deviceWatcherImpl) {
 			delay := time.Duration(rand.Intn(500)) * time.Millisecond
 
 			log.Printf("[DeviceWatcher] server died, restarting in %s…", delay)
-			time.Sleep(delay)
-			if err := watcher.server.Start(); err != nil {
+			select {
+			case <-time.After(delay):
+			case <-ctx.Done():
+				return
+			}
+			if err := watcher.server.Start(ctx); err != nil {
 				log.Println("[DeviceWatcher] error restarting server, giving up")
 				watcher.reportErr(err)
 				return
@@ -153,8 +173,9 @@ func publishDevices(watcher *deviceWatcherImpl) {
 	}
 }
 
-func connectToTrackDevices(server server) (wire.Scanner, error) {
-	conn, err := server.Dial()
+// connectToTrackDevices opens a track-devices stream bound to ctx.
+func connectToTrackDevices(ctx context.Context, server server) (wire.Scanner, error) {
+	conn, err := dialServer(ctx, server)
 	if err != nil {
 		return nil, err
 	}
@@ -172,9 +193,13 @@ func connectToTrackDevices(server server) (wire.Scanner, error) {
 	return conn, nil
 }
 
-func publishDevicesUntilError(scanner wire.Scanner, eventChan chan<- DeviceStateChangedEvent, lastKnownStates *map[string]DeviceState) (finished bool, err error) {
+// publishDevicesUntilError returns finished if ctx is done, the stream is closed then.
+func publishDevicesUntilError(ctx context.Context, scanner wire.Scanner, eventChan chan<- DeviceStateChangedEvent, lastKnownStates *map[string]DeviceState) (finished bool, err error) {
 	for {
 		msg, err := scanner.ReadMessage()
+		if ctx.Err() != nil {
+			return true, nil
+		}
 		if err != nil {
 			return false, err
 		}
@@ -185,7 +210,11 @@ func publishDevicesUntilError(scanner wire.Scanner, eventChan chan<- DeviceState
 		}
 
 		for _, event := range calculateStateDiffs(*lastKnownStates, deviceStates) {
-			eventChan <- event
+			select {
+			case eventChan <- event:
+			case <-ctx.Done():
+				return true, nil
+			}
 		}
 		*lastKnownStates = deviceStates
 	}
@@ -1,27 +1,72 @@
 package adb
 
 import (
+	"context"
 	"fmt"
 	"net"
-	"time"
+	"strconv"
+	"strings"
 
 	"DomaphoneS-Next/backend/goadb/wire"
 )
 
 // Dialer knows how to create connections to an adb server.
+// The dial is bound by the deadline of ctx; the connection itself is bound to ctx
+// by the caller.
+// address is host:port for TCP servers, and the socket spec, eg. localfilesystem:/path,
+// for servers listening on a unix socket.
 type Dialer interface {
-	Dial(address string, timeout time.Duration) (*wire.Conn, error)
+	Dial(ctx context.Context, address string) (*wire.Conn, error)
 }
 
-type tcpDialer struct{}
+type netDialer struct{}
 
-// DialTimeout connects to the adb server on the host and port set on the netDialer.
-// The zero-value will connect to the default, localhost:5037.
-func (tcpDialer) Dial(address string, timeout time.Duration) (*wire.Conn, error) {
-	netConn, err := net.DialTimeout("tcp", address, timeout)
+// Dial connects to the adb server at address, over TCP or a unix socket.
+func (netDialer) Dial(ctx context.Context, address string) (*wire.Conn, error) {
+	network, addr := "tcp", address
+	if path, ok := unixSocketPath(address); ok {
+		network, addr = "unix", path
+	}
+
+	var d net.Dialer
+	netConn, err := d.DialContext(ctx, network, addr)
 	if err != nil {
-		return nil, fmt.Errorf("%w: error dialing %s", wire.ErrServerNotAvailable, address)
+		return nil, fmt.Errorf("%w: error dialing %s: %w", wire.ErrServerNotAvailable, address, err)
 	}
 
 	return wire.NewConn(netConn), nil
 }
+
+// Socket spec prefixes of adb's socket_spec.cpp supported for the server socket.
+const (
+	socketSpecTCP             = "tcp:"
+	socketSpecLocalFilesystem = "localfilesystem:"
+	socketSpecLocalAbstract   = "localabstract:"
+)
+
+// unixSocketPath returns the path to dial for a localfilesystem: or localabstract: spec.
+// Abstract sockets are named with a leading @ by the net package.
+func unixSocketPath(spec string) (string, bool) {
+	switch {
+	case strings.HasPrefix(spec, socketSpecLocalFilesystem):
+		return strings.TrimPrefix(spec, socketSpecLocalFilesystem), true
+	case strings.HasPrefix(spec, socketSpecLocalAbstract):
+		return "@" + strings.TrimPrefix(spec, socketSpecLocalAbstract), true
+	}
+	return "", false
+}
+
+// parseTCPSocketSpec parses tcp:port and tcp:host:port, the host is empty for tcp:port.
+func parseTCPSocketSpec(spec string) (host string, port int, err error) {
+	rest := strings.TrimPrefix(spec, socketSpecTCP)
+	portStr := rest
+	if strings.Contains(rest, ":") {
+		if host, portStr, err = net.SplitHostPort(rest); err != nil {
+			return "", 0, fmt.Errorf("%w: invalid socket spec %s: %w", wire.ErrParse, spec, err)
+		}
+	}
+	if port, err = strconv.Atoi(portStr); err != nil || port < 0 || port > 65535 {
+		return "", 0, fmt.Errorf("%w: invalid port in socket spec %s", wire.ErrParse, spec)
+	}
+	return host, port, nil
+}
@@ -0,0 +1,361 @@
+package adb
+
+import (
+	"context"
+	"crypto/rsa"
+	"fmt"
+	"io"
+	"net"
+	"strings"
+	"sync"
+	"time"
+
+	"DomaphoneS-Next/backend/goadb/wire"
+)
+
+const (
+	// Default port adbd listens on for TCP connections.
+	AdbdPort = 5555
+
+	AuthTimeoutDefault = time.Second * 60
+)
+
+// DirectConfig configures a server-less connection to adbd.
+type DirectConfig struct {
+	// Addr is host:port of adbd. The port defaults to AdbdPort.
+	Addr string
+	// Path to the private key, in the format of ~/.android/adbkey.
+	// If empty, DefaultAdbKeyPath is used. A new key is generated if the file doesn't exist.
+	KeyPath     string
+	DialTimeout time.Duration
+	// AuthTimeout bounds the CNXN/AUTH handshake, including the time the user
+	// needs to accept an unknown key on the device.
+	AuthTimeout time.Duration
+}
+
+// NewDirect creates an Adb client that talks to adbd over TCP without an adb server,
+// so the adb binary isn't needed. It speaks the adbd transport protocol
+// (CNXN/AUTH/OPEN/WRTE/OKAY/CLSE) and serves the host requests the adb package
+// sends to the server locally, so Device, SyncConn and Session work unchanged.
+// The single device is available as AnyDevice() or DeviceWithSerial(addr).
+//
+// Host services that need a real adb server, like forward or connect, are not supported.
+func NewDirect(config DirectConfig) (*Adb, error) {
+	server, err := newDirectServer(config)
+	if err != nil {
+		return nil, err
+	}
+	return &Adb{server}, nil
+}
+
+type directServer struct {
+	config DirectConfig
+	key    *rsa.PrivateKey
+	serial string
+
+	mu        sync.Mutex
+	transport *adbdTransport
+}
+
+func newDirectServer(config DirectConfig) (*directServer, error) {
+	if config.Addr == "" {
+		return nil, fmt.Errorf("%w: adbd address cannot be empty", wire.ErrAssertion)
+	}
+	if _, _, err := net.SplitHostPort(config.Addr); err != nil {
+		config.Addr = net.JoinHostPort(config.Addr, fmt.Sprint(AdbdPort))
+	}
+	if config.DialTimeout == 0 {
+		config.DialTimeout = DialTimeoutDefault
+	}
+	if config.AuthTimeout == 0 {
+		config.AuthTimeout = AuthTimeoutDefault
+	}
+	if config.KeyPath == "" {
+		path, err := DefaultAdbKeyPath()
+		if err != nil {
+			return nil, fmt.Errorf("locate adb key: %w", err)
+		}
+		config.KeyPath = path
+	}
+
+	key, err := LoadAdbKey(config.KeyPath)
+	if err != nil {
+		return nil, fmt.Errorf("load adb key %s: %w", config.KeyPath, err)
+	}
+
+	return &directServer{
+		config: config,
+		key:    key,
+		serial: config.Addr,
+	}, nil
+}
+
+// Start connects to adbd if not connected yet.
+func (s *directServer) Start(ctx context.Context) error {
+	_, err := s.getTransport(ctx)
+	return err
+}
+
+// Dial returns a connection that behaves like one to an adb server.
+// ctx only bounds the connection to adbd, which is shared by all the returned connections.
+func (s *directServer) Dial(ctx context.Context) (wire.IConn, error) {
+	t, err := s.getTransport(ctx)
+	if err != nil {
+		return nil, err
+	}
+	client, server := net.Pipe()
+	go s.serve(t, server)
+	return wire.NewConn(client), nil
+}
+
+func (s *directServer) getTransport(ctx context.Context) (*adbdTransport, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.transport != nil && s.transport.Err() == nil {
+		return s.transport, nil
+	}
+
+	dialCtx, cancel := context.WithTimeout(ctx, s.config.DialTimeout)
+	defer cancel()
+	var d net.Dialer
+	conn, err := d.DialContext(dialCtx, "tcp", s.config.Addr)
+	if err != nil {
+		return nil, fmt.Errorf("%w: error dialing %s: %w", wire.ErrServerNotAvailable, s.config.Addr, err)
+	}
+
+	// The handshake is bound by ctx too, without binding the transport to it.
+	authCtx, cancel := context.WithTimeout(ctx, s.config.AuthTimeout)
+	defer cancel()
+	handshakeConn := newCtxConn(authCtx, conn)
+	banner, maxPayload, err := handshake(handshakeConn, s.key)
+	handshakeConn.release()
+	if err != nil {
+		conn.Close()
+		return nil, fmt.Errorf("connect to %s: %w", s.config.Addr, err)
+	}
+	conn.SetDeadline(time.Time{})
+
+	s.transport = newAdbdTransport(conn, banner, maxPayload)
+	return s.transport, nil
+}
+
+// handshake runs the CNXN/AUTH exchange. If adbd rejects the signature of key,
+// the public key is sent, and the user has to accept it on the device.
+func handshake(conn net.Conn, key *rsa.PrivateKey) (banner deviceBanner, maxPayload int, err error) {
+	hostBanner := "host::features=" + strings.Join(hostFeatures, ",")
+	if err = writePacket(conn, packet{command: aCNXN, arg0: aVersion, arg1: adbdMaxPayload, data: []byte(hostBanner)}); err != nil {
+		return
+	}
+
+	signed := false
+	sentPublicKey := false
+	for {
+		var p packet
+		if p, err = readPacket(conn); err != nil {
+			if sentPublicKey {
+				err = fmt.Errorf("%w: device unauthorized, accept the key on the device: %w", wire.ErrDeviceUnauthorized, err)
+			}
+			return
+		}
+
+		switch p.command {
+		case aCNXN:
+			maxPayload = int(p.arg1)
+			if maxPayload > adbdMaxPayload || maxPayload <= 0 {
+				maxPayload = adbdMaxPayload
+			}
+			return parseDeviceBanner(string(p.data)), maxPayload, nil
+
+		case aAUTH:
+			if p.arg0 != authToken {
+				err = fmt.Errorf("%w: unexpected AUTH type %d", wire.ErrAssertion, p.arg0)
+				return
+			}
+			if !signed {
+				signed = true
+				var sig []byte
+				if sig, err = signAuthToken(key, p.data); err != nil {
+					return
+				}
+				err = writePacket(conn, packet{command: aAUTH, arg0: authSignature, data: sig})
+			} else if !sentPublicKey {
+				sentPublicKey = true
+				var pub []byte
+				if pub, err = androidPublicKey(&key.PublicKey); err != nil {
+					return
+				}
+				err = writePacket(conn, packet{command: aAUTH, arg0: authRSAPublicKey, data: pub})
+			} else {
+				err = fmt.Errorf("%w: device unauthorized", wire.ErrDeviceUnauthorized)
+			}
+			if err != nil {
+				return
+			}
+
+		case aSTLS:
+			err = fmt.Errorf("%w: adbd requires TLS, which is not supported", wire.ErrAdb)
+			return
+
+		default:
+			err = fmt.Errorf("%w: unexpected packet during handshake: %s", wire.ErrAssertion, p)
+			return
+		}
+	}
+}
+
+// serve answers the requests the adb package sends to an adb server on conn:
+// host requests are handled locally, device services are opened as adbd streams.
+func (s *directServer) serve(t *adbdTransport, conn net.Conn) {
+	defer conn.Close()
+	c := wire.NewConn(conn)
+
+	for {
+		msg, err := c.ReadMessage()
+		if err != nil {
+			return
+		}
+		req := string(msg)
+
+		switch {
+		case strings.HasPrefix(req, "host:transport") || strings.HasPrefix(req, "host:tport"):
+			if err = s.checkTransport(req); err != nil {
+				writeFail(c, err.Error())
+				return
+			}
+			if _, err = c.Write([]byte(wire.StatusSuccess)); err != nil {
+				return
+			}
+			// The next request is the device service.
+
+		case strings.HasPrefix(req, "host"):
+			s.serveHost(t, c, req)
+			return
+
+		default:
+			stream, err := t.Open(req)
+			if err != nil {
+				writeFail(c, "closed")
+				return
+			}
+			defer stream.Close()
+			if _, err = c.Write([]byte(wire.StatusSuccess)); err != nil {
+				return
+			}
+			go func() {
+				io.Copy(stream, conn)
+				stream.Close()
+			}()
+			io.Copy(conn, stream)
+			return
+		}
+	}
+}
+
+func (s *directServer) checkTransport(req string) error {
+	switch {
+	case req == "host:transport-any" || req == "host:transport-local":
+		return nil
+	case strings.HasPrefix(req, "host:transport:"):
+		if serial := strings.TrimPrefix(req, "host:transport:"); serial != s.serial {
+			return fmt.Errorf("device '%s' not found", serial)
+		}
+		return nil
+	case req == "host:transport-usb":
+		return fmt.Errorf("no devices/emulators found")
+	default:
+		return fmt.Errorf("unsupported request %s", req)
+	}
+}
+
+func (s *directServer) serveHost(t *adbdTransport, c *wire.Conn, req string) {
+	var serial, cmd string
+	switch {
+	case strings.HasPrefix(req, "host:"):
+		cmd = strings.TrimPrefix(req, "host:")
+	case strings.HasPrefix(req, "host-local:"):
+		cmd = strings.TrimPrefix(req, "host-local:")
+	case strings.HasPrefix(req, "host-serial:"):
+		// The serial itself may contain colons, eg. 192.168.1.2:5555.
+		rest := strings.TrimPrefix(req, "host-serial:")
+		pos := strings.LastIndex(rest, ":")
+		if pos < 0 {
+			writeFail(c, "unsupported request "+req)
+			return
+		}
+		serial, cmd = rest[:pos], rest[pos+1:]
+		if serial != s.serial {
+			writeFail(c, fmt.Sprintf("device '%s' not found", serial))
+			return
+		}
+	case strings.HasPrefix(req, "host-usb:"):
+		writeFail(c, "no devices/emulators found")
+		return
+	default:
+		writeFail(c, "unsupported request "+req)
+		return
+	}
+
+	var resp string
+	switch cmd {
+	case "version":
+		resp = fmt.Sprintf("%04x", 41)
+	case "host-features":
+		resp = strings.Join(hostFeatures, ",")
+	case "features":
+		var features []string
+		for _, f := range hostFeatures {
+			if t.banner.Features[f] {
+				features = append(features, f)
+			}
+		}
+		resp = strings.Join(features, ",")
+	case "devices":
+		resp = s.serial + "\tdevice\n"
+	case "devices-l":
+		resp = fmt.Sprintf("%-22s device product:%s model:%s device:%s transport_id:1\n",
+			s.serial, t.banner.Product, t.banner.Model, t.banner.Device)
+	case "get-state":
+		resp = "device"
+	case "get-serialno":
+		resp = s.serial
+	case "get-devpath":
+		resp = "unknown"
+	case "track-devices":
+		if _, err := c.Write([]byte(wire.StatusSuccess)); err != nil {
+			return
+		}
+		if err := c.SendMessage([]byte(s.serial + "\tdevice\n")); err != nil {
+			return
+		}
+		// Keep the stream open until either side goes away.
+		closed := make(chan struct{})
+		go func() {
+			io.Copy(io.Discard, c)
+			close(closed)
+		}()
+		select {
+		case <-t.done:
+		case <-closed:
+		}
+		return
+	case "kill":
+		c.Write([]byte(wire.StatusSuccess))
+		t.Close()
+		return
+	default:
+		writeFail(c, "unsupported request "+req)
+		return
+	}
+
+	if _, err := c.Write([]byte(wire.StatusSuccess)); err != nil {
+		return
+	}
+	c.SendMessage([]byte(resp))
+}
+
+func writeFail(c *wire.Conn, msg string) {
+	if _, err := c.Write([]byte(wire.StatusFailure)); err != nil {
+		return
+	}
+	c.SendMessage([]byte(msg))
+}
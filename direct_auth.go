@@ -0,0 +1,166 @@
+package adb
+
+import (
+	"crypto"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/binary"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"math/big"
+	"os"
+	"os/user"
+	"path/filepath"
+
+	"DomaphoneS-Next/backend/goadb/wire"
+)
+
+const (
+	// adbd only accepts 2048 bit keys.
+	adbKeyBits = 2048
+	// Size of the token adbd sends in AUTH(TOKEN).
+	authTokenSize = 20
+)
+
+// DefaultAdbKeyPath returns ~/.android/adbkey, or $ANDROID_USER_HOME/adbkey when set,
+// where the official adb stores its private key.
+func DefaultAdbKeyPath() (string, error) {
+	if dir := os.Getenv("ANDROID_USER_HOME"); dir != "" {
+		return filepath.Join(dir, "adbkey"), nil
+	}
+	home, err := os.UserHomeDir()
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(home, ".android", "adbkey"), nil
+}
+
+// LoadAdbKey reads a private key in the format of ~/.android/adbkey (PEM, PKCS#8 or PKCS#1).
+// If the file doesn't exist, a new key is generated and saved to path, together with
+// the public key in path + ".pub", the same way adb does on first start.
+func LoadAdbKey(path string) (*rsa.PrivateKey, error) {
+	data, err := os.ReadFile(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return generateAdbKey(path)
+	} else if err != nil {
+		return nil, err
+	}
+	return parseAdbKey(data)
+}
+
+func parseAdbKey(data []byte) (*rsa.PrivateKey, error) {
+	block, _ := pem.Decode(data)
+	if block == nil {
+		return nil, fmt.Errorf("%w: adb key is not PEM encoded", wire.ErrParse)
+	}
+
+	switch block.Type {
+	case "RSA PRIVATE KEY":
+		return x509.ParsePKCS1PrivateKey(block.Bytes)
+	case "PRIVATE KEY":
+		key, err := x509.ParsePKCS8PrivateKey(block.Bytes)
+		if err != nil {
+			return nil, err
+		}
+		rsaKey, ok := key.(*rsa.PrivateKey)
+		if !ok {
+			return nil, fmt.Errorf("%w: adb key is not an RSA key", wire.ErrParse)
+		}
+		return rsaKey, nil
+	default:
+		return nil, fmt.Errorf("%w: unexpected PEM block type %s", wire.ErrParse, block.Type)
+	}
+}
+
+func generateAdbKey(path string) (*rsa.PrivateKey, error) {
+	key, err := rsa.GenerateKey(rand.Reader, adbKeyBits)
+	if err != nil {
+		return nil, err
+	}
+	der, err := x509.MarshalPKCS8PrivateKey(key)
+	if err != nil {
+		return nil, err
+	}
+	pub, err := androidPublicKey(&key.PublicKey)
+	if err != nil {
+		return nil, err
+	}
+
+	if err = os.MkdirAll(filepath.Dir(path), 0750); err != nil {
+		return nil, err
+	}
+	if err = os.WriteFile(path, pem.EncodeToMemory(&pem.Block{Type: "PRIVATE KEY", Bytes: der}), 0600); err != nil {
+		return nil, err
+	}
+	if err = os.WriteFile(path+".pub", pub[:len(pub)-1], 0644); err != nil {
+		return nil, err
+	}
+	return key, nil
+}
+
+// signAuthToken signs the AUTH(TOKEN) payload. adbd verifies it with RSA_verify(NID_sha1),
+// treating the token as an already computed SHA-1 digest.
+func signAuthToken(key *rsa.PrivateKey, token []byte) ([]byte, error) {
+	if len(token) != authTokenSize {
+		return nil, fmt.Errorf("%w: auth token must be %d bytes, got %d", wire.ErrAssertion, authTokenSize, len(token))
+	}
+	return rsa.SignPKCS1v15(nil, key, crypto.SHA1, token)
+}
+
+// androidPublicKey encodes pub the way adbd expects in AUTH(RSAPUBLICKEY) and adb_keys:
+// the base64 of the binary key below, a space, a user@host comment and a NUL terminator.
+//
+//	typedef struct RSAPublicKey {
+//		uint32_t modulus_size_words; // 64
+//		uint32_t n0inv;              // -1 / n[0] mod 2^32
+//		uint8_t modulus[256];        // little endian
+//		uint8_t rr[256];             // 2^4096 mod n, little endian
+//		uint32_t exponent;
+//	} RSAPublicKey;
+func androidPublicKey(pub *rsa.PublicKey) ([]byte, error) {
+	const modulusSize = adbKeyBits / 8
+	if pub.N.BitLen() != adbKeyBits {
+		return nil, fmt.Errorf("%w: adb key must be %d bits, got %d", wire.ErrAssertion, adbKeyBits, pub.N.BitLen())
+	}
+
+	buf := make([]byte, 4+4+modulusSize+modulusSize+4)
+	binary.LittleEndian.PutUint32(buf[0:], modulusSize/4)
+
+	r32 := new(big.Int).Lsh(big.NewInt(1), 32)
+	n0 := new(big.Int).Mod(pub.N, r32)
+	n0inv := new(big.Int).ModInverse(n0, r32)
+	n0inv.Sub(r32, n0inv)
+	binary.LittleEndian.PutUint32(buf[4:], uint32(n0inv.Uint64()))
+
+	putLittleEndian(buf[8:8+modulusSize], pub.N)
+	rr := new(big.Int).Lsh(big.NewInt(1), 2*adbKeyBits)
+	rr.Mod(rr, pub.N)
+	putLittleEndian(buf[8+modulusSize:8+2*modulusSize], rr)
+	binary.LittleEndian.PutUint32(buf[8+2*modulusSize:], uint32(pub.E))
+
+	encoded := base64.StdEncoding.EncodeToString(buf)
+	return []byte(encoded + " " + adbKeyComment() + "\x00"), nil
+}
+
+// putLittleEndian writes n to buf in little endian, zero padded.
+func putLittleEndian(buf []byte, n *big.Int) {
+	be := n.FillBytes(make([]byte, len(buf)))
+	for i := range be {
+		buf[i] = be[len(be)-1-i]
+	}
+}
+
+func adbKeyComment() string {
+	name := "unknown"
+	if u, err := user.Current(); err == nil {
+		name = u.Username
+	}
+	host, err := os.Hostname()
+	if err != nil {
+		host = "unknown"
+	}
+	return name + "@" + host
+}
@@ -0,0 +1,209 @@
+package adb
+
+import (
+	"bytes"
+	"context"
+	"crypto"
+	"crypto/rand"
+	"crypto/rsa"
+	"encoding/base64"
+	"encoding/binary"
+	"io"
+	"math/big"
+	"net"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// fakeAdbd is a loopback adbd speaking the transport protocol.
+// "shell:" services reply with canned output and close, "tcp:" services echo.
+type fakeAdbd struct {
+	ln net.Listener
+	// trusted is the key whose signatures are accepted. If nil, every
+	// signature is rejected and the key sent with AUTH(RSAPUBLICKEY) is accepted.
+	trusted   *rsa.PublicKey
+	shell     map[string]string
+	publicKey chan []byte
+}
+
+func newFakeAdbd(t *testing.T, trusted *rsa.PublicKey) *fakeAdbd {
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+	d := &fakeAdbd{ln: ln, trusted: trusted, shell: map[string]string{}, publicKey: make(chan []byte, 1)}
+	t.Cleanup(func() { ln.Close() })
+	go func() {
+		for {
+			conn, err := ln.Accept()
+			if err != nil {
+				return
+			}
+			go d.serve(conn)
+		}
+	}()
+	return d
+}
+
+func (d *fakeAdbd) serve(conn net.Conn) {
+	defer conn.Close()
+	p, err := readPacket(conn)
+	if err != nil || p.command != aCNXN {
+		return
+	}
+
+	token := make([]byte, authTokenSize)
+	rand.Read(token)
+	writePacket(conn, packet{command: aAUTH, arg0: authToken, data: token})
+	for authorized := false; !authorized; {
+		if p, err = readPacket(conn); err != nil {
+			return
+		}
+		switch p.arg0 {
+		case authSignature:
+			if d.trusted != nil && rsa.VerifyPKCS1v15(d.trusted, crypto.SHA1, token, p.data) == nil {
+				authorized = true
+			} else {
+				writePacket(conn, packet{command: aAUTH, arg0: authToken, data: token})
+			}
+		case authRSAPublicKey:
+			d.publicKey <- p.data
+			authorized = true
+		}
+	}
+	writePacket(conn, packet{command: aCNXN, arg0: aVersion, arg1: 4096,
+		data: []byte("device::ro.product.name=fake;ro.product.model=Fake_Model;ro.product.device=fakedev;features=shell_v2,cmd,stat_v2,track_app")})
+
+	var nextID uint32 = 100
+	closing := map[uint32]bool{}
+	for {
+		if p, err = readPacket(conn); err != nil {
+			return
+		}
+		switch p.command {
+		case aOPEN:
+			service := strings.TrimRight(string(p.data), "\x00")
+			nextID++
+			switch {
+			case strings.HasPrefix(service, "shell:"):
+				out, ok := d.shell[strings.TrimPrefix(service, "shell:")]
+				if !ok {
+					writePacket(conn, packet{command: aCLSE, arg1: p.arg0})
+					continue
+				}
+				writePacket(conn, packet{command: aOKAY, arg0: nextID, arg1: p.arg0})
+				writePacket(conn, packet{command: aWRTE, arg0: nextID, arg1: p.arg0, data: []byte(out)})
+				closing[nextID] = true
+			case strings.HasPrefix(service, "tcp:"):
+				writePacket(conn, packet{command: aOKAY, arg0: nextID, arg1: p.arg0})
+			default:
+				writePacket(conn, packet{command: aCLSE, arg1: p.arg0})
+			}
+		case aOKAY:
+			if closing[p.arg1] {
+				delete(closing, p.arg1)
+				writePacket(conn, packet{command: aCLSE, arg0: p.arg1, arg1: p.arg0})
+			}
+		case aWRTE:
+			writePacket(conn, packet{command: aOKAY, arg0: p.arg1, arg1: p.arg0})
+			writePacket(conn, packet{command: aWRTE, arg0: p.arg1, arg1: p.arg0, data: p.data})
+		}
+	}
+}
+
+func newDirectClient(t *testing.T, d *fakeAdbd, keyPath string) *Adb {
+	client, err := NewDirect(DirectConfig{Addr: d.ln.Addr().String(), KeyPath: keyPath, AuthTimeout: 5 * time.Second})
+	require.NoError(t, err)
+	return client
+}
+
+func TestDirect_RunCommand(t *testing.T) {
+	keyPath := filepath.Join(t.TempDir(), "adbkey")
+	key, err := LoadAdbKey(keyPath)
+	require.NoError(t, err)
+
+	d := newFakeAdbd(t, &key.PublicKey)
+	d.shell["echo hello"] = "hello\n"
+	client := newDirectClient(t, d, keyPath)
+
+	dev := client.Device(AnyDevice())
+	out, err := dev.RunCommand(context.TODO(), "echo", "hello")
+	assert.NoError(t, err)
+	assert.Equal(t, "hello\n", string(out))
+
+	features, err := dev.DeviceFeatures(context.TODO())
+	assert.NoError(t, err)
+	assert.Equal(t, map[string]bool{FeatureShell2: true, FeatureCmd: true, FeatureStat2: true}, features)
+
+	devices, err := client.ListDevices(context.TODO())
+	assert.NoError(t, err)
+	require.Len(t, devices, 1)
+	assert.Equal(t, d.ln.Addr().String(), devices[0].Serial)
+	assert.Equal(t, "Fake_Model", devices[0].Model)
+
+	_, err = client.Device(DeviceWithSerial("other")).RunCommand(context.TODO(), "echo", "hello")
+	assert.Error(t, err)
+}
+
+func TestDirect_PublicKeyAuth(t *testing.T) {
+	keyPath := filepath.Join(t.TempDir(), "adbkey")
+	d := newFakeAdbd(t, nil)
+	d.shell["id"] = "uid=2000(shell)\n"
+	client := newDirectClient(t, d, keyPath)
+
+	out, err := client.Device(AnyDevice()).RunCommand(context.TODO(), "id")
+	assert.NoError(t, err)
+	assert.Equal(t, "uid=2000(shell)\n", string(out))
+
+	key, err := LoadAdbKey(keyPath)
+	require.NoError(t, err)
+	pub := <-d.publicKey
+	assert.True(t, bytes.HasSuffix(pub, []byte("\x00")))
+	raw, err := base64.StdEncoding.DecodeString(strings.Fields(string(pub))[0])
+	require.NoError(t, err)
+	require.Len(t, raw, 524)
+	assert.Equal(t, uint32(64), binary.LittleEndian.Uint32(raw[0:]))
+
+	// n0inv * n[0] == -1 mod 2^32
+	n0inv := binary.LittleEndian.Uint32(raw[4:])
+	assert.Equal(t, uint32(0xffffffff), n0inv*uint32(key.N.Uint64()))
+
+	modulus := make([]byte, 256)
+	for i := range modulus {
+		modulus[i] = raw[8+255-i]
+	}
+	assert.Equal(t, 0, new(big.Int).SetBytes(modulus).Cmp(key.N))
+	assert.Equal(t, uint32(key.E), binary.LittleEndian.Uint32(raw[520:]))
+}
+
+func TestDirect_Forward(t *testing.T) {
+	keyPath := filepath.Join(t.TempDir(), "adbkey")
+	key, err := LoadAdbKey(keyPath)
+	require.NoError(t, err)
+	client := newDirectClient(t, newFakeAdbd(t, &key.PublicKey), keyPath)
+
+	conn, err := client.Device(AnyDevice()).ForwardPort(context.TODO(), 8080)
+	require.NoError(t, err)
+	defer conn.Close()
+
+	// Larger than the 4096 bytes max payload the fake device announces.
+	data := bytes.Repeat([]byte("0123456789"), 1000)
+	go conn.Write(data)
+	got := make([]byte, len(data))
+	_, err = io.ReadFull(conn, got)
+	assert.NoError(t, err)
+	assert.Equal(t, data, got)
+}
+
+func TestDirect_UnknownService(t *testing.T) {
+	keyPath := filepath.Join(t.TempDir(), "adbkey")
+	key, err := LoadAdbKey(keyPath)
+	require.NoError(t, err)
+	client := newDirectClient(t, newFakeAdbd(t, &key.PublicKey), keyPath)
+
+	_, err = client.Device(AnyDevice()).RunCommand(context.TODO(), "missing")
+	assert.ErrorContains(t, err, "closed")
+}
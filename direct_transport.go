@@ -0,0 +1,416 @@
+package adb
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"strings"
+	"sync"
+
+	"DomaphoneS-Next/backend/goadb/wire"
+)
+
+// Commands of the adbd transport protocol, see
+// https://android.googlesource.com/platform/packages/modules/adb/+/refs/heads/main/protocol.txt
+const (
+	aSYNC = 0x434e5953
+	aCNXN = 0x4e584e43
+	aAUTH = 0x48545541
+	aOPEN = 0x4e45504f
+	aOKAY = 0x59414b4f
+	aCLSE = 0x45534c43
+	aWRTE = 0x45545257
+	aSTLS = 0x534c5453
+
+	aVersion = 0x01000001
+
+	// Arguments of AUTH packets.
+	authToken        = 1
+	authSignature    = 2
+	authRSAPublicKey = 3
+
+	adbdMaxPayload  = 1024 * 1024
+	packetHeaderLen = 24
+)
+
+// hostFeatures are announced in our CNXN banner. adbd only enables the
+// optional protocols both sides announce.
+var hostFeatures = []string{
+	FeatureShell2, FeatureCmd, FeatureStat2, FeatureLs2, FeatureFixedPushMkdir,
+	FeatureApex, FeatureAbb, FeatureFixedPushSymlinkTimestamp, FeatureAbbExec,
+	FeatureRemountShell, FeatureSendRecv2, FeatureSendRecv2Brotli, FeatureSendRecv2LZ4,
+	FeatureSendRecv2Zstd, FeatureSendRecv2DryRunSend,
+}
+
+// packet is a message of the adbd transport protocol.
+//
+//	struct amessage {
+//		uint32_t command;     // command identifier constant
+//		uint32_t arg0;        // first argument
+//		uint32_t arg1;        // second argument
+//		uint32_t data_length; // length of payload (0 is allowed)
+//		uint32_t data_check;  // checksum of data payload
+//		uint32_t magic;       // command ^ 0xffffffff
+//	};
+type packet struct {
+	command uint32
+	arg0    uint32
+	arg1    uint32
+	data    []byte
+}
+
+func (p packet) String() string {
+	var cmd [4]byte
+	binary.LittleEndian.PutUint32(cmd[:], p.command)
+	return fmt.Sprintf("%s(%08x, %08x, %d bytes)", cmd[:], p.arg0, p.arg1, len(p.data))
+}
+
+func writePacket(w io.Writer, p packet) error {
+	buf := make([]byte, packetHeaderLen+len(p.data))
+	var check uint32
+	for _, b := range p.data {
+		check += uint32(b)
+	}
+	binary.LittleEndian.PutUint32(buf[0:], p.command)
+	binary.LittleEndian.PutUint32(buf[4:], p.arg0)
+	binary.LittleEndian.PutUint32(buf[8:], p.arg1)
+	binary.LittleEndian.PutUint32(buf[12:], uint32(len(p.data)))
+	binary.LittleEndian.PutUint32(buf[16:], check)
+	binary.LittleEndian.PutUint32(buf[20:], p.command^0xffffffff)
+	copy(buf[packetHeaderLen:], p.data)
+	_, err := w.Write(buf)
+	return err
+}
+
+func readPacket(r io.Reader) (p packet, err error) {
+	var header [packetHeaderLen]byte
+	if _, err = io.ReadFull(r, header[:]); err != nil {
+		return p, fmt.Errorf("%w: read packet header: %w", wire.ErrConnectionReset, err)
+	}
+	p.command = binary.LittleEndian.Uint32(header[0:])
+	p.arg0 = binary.LittleEndian.Uint32(header[4:])
+	p.arg1 = binary.LittleEndian.Uint32(header[8:])
+	length := binary.LittleEndian.Uint32(header[12:])
+	if magic := binary.LittleEndian.Uint32(header[20:]); magic != p.command^0xffffffff {
+		return p, fmt.Errorf("%w: bad packet magic %08x for command %08x", wire.ErrAssertion, magic, p.command)
+	}
+	if length > adbdMaxPayload {
+		return p, fmt.Errorf("%w: packet payload too large: %d", wire.ErrAssertion, length)
+	}
+	if length > 0 {
+		p.data = make([]byte, length)
+		if _, err = io.ReadFull(r, p.data); err != nil {
+			return p, fmt.Errorf("%w: read packet payload: %w", wire.ErrConnectionReset, err)
+		}
+	}
+	return p, nil
+}
+
+// deviceBanner is the identity adbd sends in its CNXN packet, eg.
+//
+//	device::ro.product.name=sdk_gphone64_x86_64;ro.product.model=sdk_gphone64_x86_64;ro.product.device=emu64x;features=shell_v2,cmd,...
+type deviceBanner struct {
+	Product  string
+	Model    string
+	Device   string
+	Features map[string]bool
+}
+
+func parseDeviceBanner(banner string) deviceBanner {
+	var b deviceBanner
+	banner = strings.TrimRight(banner, "\x00")
+	if pos := strings.Index(banner, "::"); pos >= 0 {
+		banner = banner[pos+2:]
+	}
+	for _, prop := range strings.Split(banner, ";") {
+		key, value, ok := strings.Cut(prop, "=")
+		if !ok {
+			continue
+		}
+		switch key {
+		case "ro.product.name":
+			b.Product = value
+		case "ro.product.model":
+			b.Model = value
+		case "ro.product.device":
+			b.Device = value
+		case "features":
+			b.Features = featuresStrToMap(value)
+		}
+	}
+	if b.Features == nil {
+		b.Features = map[string]bool{}
+	}
+	return b
+}
+
+// adbdTransport multiplexes streams over a single connection to adbd.
+type adbdTransport struct {
+	conn       net.Conn
+	banner     deviceBanner
+	maxPayload int
+
+	wmu sync.Mutex // serializes packet writes
+
+	mu      sync.Mutex
+	streams map[uint32]*adbdStream
+	nextID  uint32
+	err     error
+	done    chan struct{}
+}
+
+func newAdbdTransport(conn net.Conn, banner deviceBanner, maxPayload int) *adbdTransport {
+	t := &adbdTransport{
+		conn:       conn,
+		banner:     banner,
+		maxPayload: maxPayload,
+		streams:    make(map[uint32]*adbdStream),
+		done:       make(chan struct{}),
+	}
+	go t.readLoop()
+	return t
+}
+
+func (t *adbdTransport) send(p packet) error {
+	t.wmu.Lock()
+	defer t.wmu.Unlock()
+	debugLog(fmt.Sprintf("adbd --> %s", p))
+	return writePacket(t.conn, p)
+}
+
+// Err returns the error that closed the transport, or nil while it's alive.
+func (t *adbdTransport) Err() error {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	return t.err
+}
+
+func (t *adbdTransport) Close() error {
+	return t.closeWithError(fmt.Errorf("%w: transport closed", wire.ErrConnectionReset))
+}
+
+func (t *adbdTransport) closeWithError(err error) error {
+	t.mu.Lock()
+	if t.err != nil {
+		t.mu.Unlock()
+		return nil
+	}
+	t.err = err
+	streams := t.streams
+	t.streams = nil
+	close(t.done)
+	t.mu.Unlock()
+
+	for _, s := range streams {
+		s.remoteClosed(err)
+	}
+	return t.conn.Close()
+}
+
+func (t *adbdTransport) readLoop() {
+	for {
+		p, err := readPacket(t.conn)
+		if err != nil {
+			t.closeWithError(err)
+			return
+		}
+		debugLog(fmt.Sprintf("adbd <-- %s", p))
+
+		switch p.command {
+		case aOKAY:
+			if s := t.stream(p.arg1); s != nil {
+				s.okay(p.arg0)
+			}
+		case aWRTE:
+			if s := t.stream(p.arg1); s != nil {
+				s.write(p.data)
+			} else {
+				t.send(packet{command: aCLSE, arg1: p.arg0})
+			}
+		case aCLSE:
+			if s := t.stream(p.arg1); s != nil {
+				t.removeStream(s.localID)
+				s.remoteClosed(io.EOF)
+			}
+		}
+	}
+}
+
+func (t *adbdTransport) stream(localID uint32) *adbdStream {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	return t.streams[localID]
+}
+
+func (t *adbdTransport) removeStream(localID uint32) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	delete(t.streams, localID)
+}
+
+// Open opens a stream to service on the device, eg. "shell:ls" or "sync:".
+func (t *adbdTransport) Open(service string) (*adbdStream, error) {
+	t.mu.Lock()
+	if t.err != nil {
+		t.mu.Unlock()
+		return nil, t.err
+	}
+	t.nextID++
+	s := newAdbdStream(t, t.nextID)
+	t.streams[s.localID] = s
+	t.mu.Unlock()
+
+	if err := t.send(packet{command: aOPEN, arg0: s.localID, data: append([]byte(service), 0)}); err != nil {
+		t.removeStream(s.localID)
+		return nil, err
+	}
+	if err := s.waitOpen(service); err != nil {
+		t.removeStream(s.localID)
+		return nil, err
+	}
+	return s, nil
+}
+
+// adbdStream is one OPEN'd stream of an adbdTransport.
+// The device acknowledges every WRTE with an OKAY before the next one may be sent,
+// and we acknowledge its WRTE once the data has been read.
+type adbdStream struct {
+	t        *adbdTransport
+	localID  uint32
+	remoteID uint32
+
+	mu       sync.Mutex
+	cond     *sync.Cond
+	opened   bool
+	canWrite bool
+	pending  []byte
+	err      error // set once the stream is closed, io.EOF if closed by the device
+	closed   bool  // closed by us
+}
+
+var _ io.ReadWriteCloser = &adbdStream{}
+
+func newAdbdStream(t *adbdTransport, localID uint32) *adbdStream {
+	s := &adbdStream{t: t, localID: localID}
+	s.cond = sync.NewCond(&s.mu)
+	return s
+}
+
+func (s *adbdStream) waitOpen(service string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for !s.opened && s.err == nil {
+		s.cond.Wait()
+	}
+	if !s.opened {
+		if errors.Is(s.err, io.EOF) {
+			// adbd rejects unknown services by closing the stream, the adb server reports it as "closed".
+			return wire.NewServerError(service, "closed")
+		}
+		return s.err
+	}
+	return nil
+}
+
+func (s *adbdStream) okay(remoteID uint32) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if !s.opened {
+		s.opened = true
+		s.remoteID = remoteID
+	}
+	s.canWrite = true
+	s.cond.Broadcast()
+}
+
+func (s *adbdStream) write(data []byte) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.pending = append(s.pending, data...)
+	s.cond.Broadcast()
+}
+
+func (s *adbdStream) remoteClosed(err error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.err == nil {
+		s.err = err
+	}
+	s.cond.Broadcast()
+}
+
+func (s *adbdStream) Read(buf []byte) (n int, err error) {
+	s.mu.Lock()
+	for len(s.pending) == 0 && s.err == nil {
+		s.cond.Wait()
+	}
+	if len(s.pending) == 0 {
+		err = s.err
+		s.mu.Unlock()
+		return 0, err
+	}
+	n = copy(buf, s.pending)
+	s.pending = s.pending[n:]
+	drained := len(s.pending) == 0 && s.err == nil
+	s.mu.Unlock()
+
+	if drained {
+		// Ready for the next WRTE.
+		s.t.send(packet{command: aOKAY, arg0: s.localID, arg1: s.remoteID})
+	}
+	return n, nil
+}
+
+func (s *adbdStream) Write(buf []byte) (n int, err error) {
+	for len(buf) > 0 {
+		chunk := buf
+		if len(chunk) > s.t.maxPayload {
+			chunk = chunk[:s.t.maxPayload]
+		}
+
+		s.mu.Lock()
+		for !s.canWrite && s.err == nil {
+			s.cond.Wait()
+		}
+		if s.err != nil {
+			err = s.err
+			if errors.Is(err, io.EOF) {
+				err = io.ErrClosedPipe
+			}
+			s.mu.Unlock()
+			return n, err
+		}
+		s.canWrite = false
+		s.mu.Unlock()
+
+		if err = s.t.send(packet{command: aWRTE, arg0: s.localID, arg1: s.remoteID, data: chunk}); err != nil {
+			return n, err
+		}
+		n += len(chunk)
+		buf = buf[len(chunk):]
+	}
+	return n, nil
+}
+
+func (s *adbdStream) Close() error {
+	s.mu.Lock()
+	if s.closed {
+		s.mu.Unlock()
+		return nil
+	}
+	s.closed = true
+	notify := s.err == nil
+	if s.err == nil {
+		s.err = io.ErrClosedPipe
+	}
+	s.cond.Broadcast()
+	s.mu.Unlock()
+
+	s.t.removeStream(s.localID)
+	if notify {
+		return s.t.send(packet{command: aCLSE, arg0: s.localID, arg1: s.remoteID})
+	}
+	return nil
+}
@@ -0,0 +1,43 @@
+package adb
+
+import (
+	"context"
+	"io"
+
+	"DomaphoneS-Next/backend/goadb/wire"
+)
+
+// ExecOut runs cmd on the device with the exec: service, like `adb exec-out`, and returns its
+// output, stderr included. Unlike shell:, exec: has neither a pty, which turns \n into \r\n on
+// older devices, nor the framing of shell v2: binary output like `screencap -p`, a tar stream
+// or a database read with cat arrives byte-exact. The command gets no stdin, see ExecIn.
+// The arguments are quoted like RunShellCommand does. The output ends when the command exits.
+// The returned reader stays bound to ctx: cancelling it closes the connection.
+func (c *Device) ExecOut(ctx context.Context, cmd string, args ...string) (io.ReadCloser, error) {
+	conn, err := c.openExec(ctx, cmd, args...)
+	if err != nil {
+		return nil, wrapClientError(err, c, "ExecOut")
+	}
+	return conn, nil
+}
+
+// ExecIn runs cmd on the device with the exec: service, like `adb exec-in`, and returns its
+// stdin: what's written arrives byte-exact, eg. `cat > /data/local/tmp/db` or `tar -x`.
+// Closing the writer closes the stdin of the command, its output is dropped.
+// The returned writer stays bound to ctx: cancelling it closes the connection.
+func (c *Device) ExecIn(ctx context.Context, cmd string, args ...string) (io.WriteCloser, error) {
+	conn, err := c.openExec(ctx, cmd, args...)
+	if err != nil {
+		return nil, wrapClientError(err, c, "ExecIn")
+	}
+	return conn, nil
+}
+
+// openExec opens the exec: service for cmd, the connection is both its stdin and output.
+func (c *Device) openExec(ctx context.Context, cmd string, args ...string) (wire.IConn, error) {
+	cmd, err := prepareCommandLine(cmd, args...)
+	if err != nil {
+		return nil, err
+	}
+	return c.openService(ctx, "exec:"+cmd)
+}
@@ -0,0 +1,50 @@
+package adb_test
+
+import (
+	"context"
+	"io"
+	"testing"
+
+	adb "DomaphoneS-Next/backend/goadb"
+	"DomaphoneS-Next/backend/goadb/adbtest"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestExecOut(t *testing.T) {
+	payload := []byte("\x89PNG\r\n\x1a\n\x00\x01\n\xff")
+	dev := adbtest.NewDevice("emulator-5554")
+	dev.HandleShell("screencap -p", func(cmd string, stdin io.Reader, stdout, stderr io.Writer) int {
+		stdout.Write(payload)
+		return 0
+	})
+	_, client := newTestClient(t, dev)
+
+	out, err := client.Device(adb.AnyDevice()).ExecOut(context.Background(), "screencap", "-p")
+	require.NoError(t, err)
+	defer out.Close()
+	got, err := io.ReadAll(out)
+	require.NoError(t, err)
+	assert.Equal(t, payload, got)
+}
+
+func TestExecIn(t *testing.T) {
+	received := make(chan []byte, 1)
+	dev := adbtest.NewDevice("emulator-5554")
+	dev.HandleShell("cat > /data/local/tmp/db", func(cmd string, stdin io.Reader, stdout, stderr io.Writer) int {
+		data, _ := io.ReadAll(stdin)
+		received <- data
+		return 0
+	})
+	_, client := newTestClient(t, dev)
+
+	// Only the arguments are quoted, so the redirection goes in cmd.
+	in, err := client.Device(adb.AnyDevice()).ExecIn(context.Background(), "cat > /data/local/tmp/db")
+	require.NoError(t, err)
+	payload := []byte("SQLite format 3\x00\r\n\x00")
+	_, err = in.Write(payload)
+	require.NoError(t, err)
+	require.NoError(t, in.Close())
+	assert.Equal(t, payload, <-received)
+}
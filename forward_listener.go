@@ -0,0 +1,232 @@
+package adb
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"strconv"
+	"strings"
+	"sync"
+
+	"DomaphoneS-Next/backend/goadb/wire"
+)
+
+// ForwardListener accepts local connections and tunnels each one to a socket of the device
+// with its own Device.Forward stream. Unlike DoForward, the adb server doesn't know about it:
+// the forward ends with Close, or with the process.
+type ForwardListener struct {
+	device *Device
+	remote string
+	ln     net.Listener
+
+	ctx    context.Context
+	cancel context.CancelFunc
+	wg     sync.WaitGroup
+	done   chan struct{}
+
+	mu    sync.Mutex
+	conns map[net.Conn]struct{}
+	stats ForwardStats
+	err   error
+}
+
+// ForwardStats counts the connections of a ForwardListener.
+type ForwardStats struct {
+	// Accepted is the number of local connections accepted.
+	Accepted int
+	// Active is the number of connections being forwarded.
+	Active int
+	// Failed is the number of connections that couldn't be forwarded to the device.
+	Failed int
+}
+
+// ListenAndForward listens on localAddr and forwards every connection to remote on the device,
+// like `adb forward`. localAddr is tcp:port, tcp:host:port, host:port or localfilesystem:/path,
+// the host defaults to localhost and port 0 picks a free port, see Port.
+// remote takes the forms of Forward, eg. tcp:8080 or localabstract:name.
+// The listener stops when ctx is done or Close is called.
+func (c *Device) ListenAndForward(ctx context.Context, localAddr, remote string) (*ForwardListener, error) {
+	network, address, err := listenAddress(localAddr)
+	if err != nil {
+		return nil, wrapClientError(err, c, "ListenAndForward")
+	}
+	ln, err := net.Listen(network, address)
+	if err != nil {
+		return nil, wrapClientError(fmt.Errorf("%w: %w", wire.ErrCannotBind, err), c, "ListenAndForward")
+	}
+
+	l := &ForwardListener{
+		device: c,
+		remote: remote,
+		ln:     ln,
+		done:   make(chan struct{}),
+		conns:  map[net.Conn]struct{}{},
+	}
+	l.ctx, l.cancel = context.WithCancel(ctx)
+	l.wg.Add(2)
+	go l.serve()
+	go func() {
+		defer l.wg.Done()
+		<-l.ctx.Done()
+		l.ln.Close()
+	}()
+	return l, nil
+}
+
+// listenAddress converts a local socket spec of adb forward to a network and address for net.Listen.
+func listenAddress(localAddr string) (network, address string, err error) {
+	if path, ok := unixSocketPath(localAddr); ok {
+		return "unix", path, nil
+	}
+	if !strings.HasPrefix(localAddr, socketSpecTCP) {
+		if _, _, err = net.SplitHostPort(localAddr); err != nil {
+			return "", "", fmt.Errorf("%w: invalid local address %s: %w", wire.ErrParse, localAddr, err)
+		}
+		return "tcp", localAddr, nil
+	}
+
+	host, port, err := parseTCPSocketSpec(localAddr)
+	if err != nil {
+		return "", "", err
+	}
+	if host == "" {
+		host = "127.0.0.1"
+	}
+	return "tcp", net.JoinHostPort(host, strconv.Itoa(port)), nil
+}
+
+// Addr returns the address the listener is bound to.
+func (l *ForwardListener) Addr() net.Addr {
+	return l.ln.Addr()
+}
+
+// Port returns the bound TCP port, the picked one for port 0. It's 0 for unix sockets.
+func (l *ForwardListener) Port() int {
+	if addr, ok := l.ln.Addr().(*net.TCPAddr); ok {
+		return addr.Port
+	}
+	return 0
+}
+
+// Stats returns the connection counts.
+func (l *ForwardListener) Stats() ForwardStats {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	return l.stats
+}
+
+// Err returns the last error, of a failed forward or of the listener once it stopped.
+func (l *ForwardListener) Err() error {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	return l.err
+}
+
+// Done is closed once the listener stopped and all its connections are closed.
+func (l *ForwardListener) Done() <-chan struct{} {
+	return l.done
+}
+
+// Close stops listening and closes the forwarded connections.
+func (l *ForwardListener) Close() error {
+	l.cancel()
+	<-l.done
+	return nil
+}
+
+func (l *ForwardListener) serve() {
+	defer l.wg.Done()
+	// Everything is torn down once serve returns, whatever the reason.
+	defer func() {
+		go func() {
+			l.wg.Wait()
+			close(l.done)
+		}()
+	}()
+	defer l.closeConns()
+	defer l.cancel()
+
+	for {
+		conn, err := l.ln.Accept()
+		if err != nil {
+			if l.ctx.Err() == nil {
+				l.setErr(fmt.Errorf("forward listener stopped: %w", err))
+			}
+			return
+		}
+
+		l.mu.Lock()
+		l.stats.Accepted++
+		l.stats.Active++
+		l.conns[conn] = struct{}{}
+		l.mu.Unlock()
+
+		l.wg.Add(1)
+		go l.forward(conn)
+	}
+}
+
+// forward tunnels conn through a new Forward stream until either side closes.
+func (l *ForwardListener) forward(conn net.Conn) {
+	defer l.wg.Done()
+	defer func() {
+		l.mu.Lock()
+		delete(l.conns, conn)
+		l.stats.Active--
+		l.mu.Unlock()
+		conn.Close()
+	}()
+
+	remote, err := l.device.Forward(l.ctx, l.remote)
+	if err != nil {
+		l.mu.Lock()
+		l.stats.Failed++
+		l.mu.Unlock()
+		if l.ctx.Err() == nil {
+			l.setErr(err)
+		}
+		return
+	}
+	defer remote.Close()
+
+	// Closing both ends once one of them is done unblocks the other copy.
+	var once sync.Once
+	closeBoth := func() {
+		once.Do(func() {
+			conn.Close()
+			remote.Close()
+		})
+	}
+	copied := make(chan struct{})
+	go func() {
+		defer close(copied)
+		copyConn(remote, conn)
+		closeBoth()
+	}()
+	copyConn(conn, remote)
+	closeBoth()
+	<-copied
+}
+
+// copyConn copies src to dst, errors of closed connections are expected when tearing down.
+func copyConn(dst io.Writer, src io.Reader) {
+	if _, err := io.Copy(dst, src); err != nil && !errors.Is(err, net.ErrClosed) {
+		debugLog(fmt.Sprintf("forward copy: %v", err))
+	}
+}
+
+func (l *ForwardListener) setErr(err error) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.err = err
+}
+
+func (l *ForwardListener) closeConns() {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	for conn := range l.conns {
+		conn.Close()
+	}
+}
@@ -0,0 +1,102 @@
+package adb_test
+
+import (
+	"context"
+	"io"
+	"net"
+	"strconv"
+	"testing"
+	"time"
+
+	adb "DomaphoneS-Next/backend/goadb"
+	"DomaphoneS-Next/backend/goadb/adbtest"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func newEchoDevice(t *testing.T) (*adbtest.Server, *adb.Device) {
+	srv, err := adbtest.NewServer()
+	require.NoError(t, err)
+	t.Cleanup(func() { srv.Close() })
+	dev := adbtest.NewDevice("emulator-5554")
+	dev.HandleService("tcp:8080", func(service string, rw io.ReadWriter) {
+		io.Copy(rw, rw)
+	})
+	srv.AddDevice(dev)
+
+	client, err := adb.NewWithConfig(srv.Config())
+	require.NoError(t, err)
+	return srv, client.Device(adb.AnyDevice())
+}
+
+func echo(t *testing.T, conn net.Conn, msg string) {
+	_, err := conn.Write([]byte(msg))
+	require.NoError(t, err)
+	buf := make([]byte, len(msg))
+	_, err = io.ReadFull(conn, buf)
+	require.NoError(t, err)
+	assert.Equal(t, msg, string(buf))
+}
+
+func TestListenAndForward(t *testing.T) {
+	srv, d := newEchoDevice(t)
+	l, err := d.ListenAndForward(context.Background(), "tcp:0", "tcp:8080")
+	require.NoError(t, err)
+	defer l.Close()
+	require.NotZero(t, l.Port())
+	addr := net.JoinHostPort("127.0.0.1", strconv.Itoa(l.Port()))
+
+	conn1, err := net.Dial("tcp", addr)
+	require.NoError(t, err)
+	defer conn1.Close()
+	conn2, err := net.Dial("tcp", addr)
+	require.NoError(t, err)
+	defer conn2.Close()
+	echo(t, conn1, "ping")
+	echo(t, conn2, "pong")
+	assert.Equal(t, adb.ForwardStats{Accepted: 2, Active: 2}, l.Stats())
+
+	// The server doesn't know about the forward.
+	assert.Empty(t, srv.Forwards())
+
+	require.NoError(t, l.Close())
+	buf := make([]byte, 1)
+	_, err = conn1.Read(buf)
+	assert.Error(t, err)
+	_, err = net.Dial("tcp", addr)
+	assert.Error(t, err)
+	assert.Equal(t, adb.ForwardStats{Accepted: 2}, l.Stats())
+	assert.NoError(t, l.Err())
+}
+
+func TestListenAndForward_RemoteError(t *testing.T) {
+	_, d := newEchoDevice(t)
+	l, err := d.ListenAndForward(context.Background(), "127.0.0.1:0", "tcp:9090")
+	require.NoError(t, err)
+	defer l.Close()
+
+	conn, err := net.Dial("tcp", l.Addr().String())
+	require.NoError(t, err)
+	defer conn.Close()
+	// The local connection is closed when the device refuses the forward.
+	conn.SetReadDeadline(time.Now().Add(5 * time.Second))
+	_, err = conn.Read(make([]byte, 1))
+	assert.ErrorIs(t, err, io.EOF)
+	assert.Equal(t, adb.ForwardStats{Accepted: 1, Failed: 1}, l.Stats())
+	assert.Error(t, l.Err())
+}
+
+func TestListenAndForward_Context(t *testing.T) {
+	_, d := newEchoDevice(t)
+	ctx, cancel := context.WithCancel(context.Background())
+	l, err := d.ListenAndForward(ctx, "tcp:0", "tcp:8080")
+	require.NoError(t, err)
+
+	cancel()
+	select {
+	case <-l.Done():
+	case <-time.After(5 * time.Second):
+		t.Fatal("listener not stopped")
+	}
+}
@@ -0,0 +1,277 @@
+package adb
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strconv"
+	"sync"
+
+	"DomaphoneS-Next/backend/goadb/wire"
+)
+
+// ForwardRule is a forward or reverse forward kept by a ForwardManager.
+type ForwardRule struct {
+	Serial string
+	// Reverse is true for reverse forwards, from the device to the host.
+	Reverse bool
+	// Local is the socket on the host and Remote the one on the device, in both directions,
+	// as they were requested.
+	Local  string
+	Remote string
+	// Port is the port allocated for a tcp:0 socket: the local one of a forward, the remote
+	// one of a reverse. The same port is asked for again when the rule is reapplied.
+	Port int
+	// Err is the error of the last attempt to apply the rule, nil once it's set up.
+	Err error
+}
+
+// listener returns the socket the rule listens on, with the allocated port for tcp:0.
+func (r *ForwardRule) listener() string {
+	spec := r.Local
+	if r.Reverse {
+		spec = r.Remote
+	}
+	if spec == "tcp:0" && r.Port != 0 {
+		return "tcp:" + strconv.Itoa(r.Port)
+	}
+	return spec
+}
+
+// ForwardManager keeps forwards and reverse forwards set up across reboots and replugs.
+// It records the rules per serial, reapplies them when the DeviceWatcher reports the device
+// back online, and removes only its own rules on Close.
+type ForwardManager struct {
+	client  *Adb
+	watcher *DeviceWatcher
+	done    chan struct{}
+
+	mu     sync.Mutex
+	rules  []*ForwardRule
+	closed bool
+}
+
+// NewForwardManager returns a ForwardManager watching devices until ctx is done or Close is called.
+func (c *Adb) NewForwardManager(ctx context.Context) *ForwardManager {
+	m := &ForwardManager{
+		client:  c,
+		watcher: c.NewDeviceWatcher(ctx),
+		done:    make(chan struct{}),
+	}
+	go m.watch(ctx)
+	return m
+}
+
+func (m *ForwardManager) watch(ctx context.Context) {
+	defer close(m.done)
+	for event := range m.watcher.C() {
+		if event.CameOnline() {
+			m.restore(ctx, event.Serial)
+		}
+	}
+}
+
+// Forward forwards local on the host to remote on the device with serial, like DoForward,
+// and returns the port allocated for tcp:0.
+// The rule is kept even if it can't be applied now, eg. while the device is offline: it's
+// applied once the device comes online.
+func (m *ForwardManager) Forward(ctx context.Context, serial, local, remote string) (int, error) {
+	return m.add(ctx, &ForwardRule{Serial: serial, Local: local, Remote: remote})
+}
+
+// Reverse forwards remote on the device with serial to local on the host, like DoReverse,
+// and returns the port allocated for tcp:0. The rule is kept like for Forward.
+func (m *ForwardManager) Reverse(ctx context.Context, serial, remote, local string) (int, error) {
+	return m.add(ctx, &ForwardRule{Serial: serial, Reverse: true, Local: local, Remote: remote})
+}
+
+func (m *ForwardManager) add(ctx context.Context, rule *ForwardRule) (int, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if m.closed {
+		return 0, fmt.Errorf("%w: forward manager is closed", wire.ErrAssertion)
+	}
+
+	// Applying a rule listening on the same socket replaces it, like adb does.
+	if i := m.find(rule.Serial, rule.Reverse, rule.listener()); i >= 0 {
+		m.rules = append(m.rules[:i], m.rules[i+1:]...)
+	}
+	err := m.apply(ctx, rule, false)
+	m.rules = append(m.rules, rule)
+	return rule.Port, err
+}
+
+// Remove removes the forward listening on local, either as requested or with its allocated port.
+func (m *ForwardManager) Remove(ctx context.Context, serial, local string) error {
+	return m.remove(ctx, serial, false, local)
+}
+
+// RemoveReverse removes the reverse forward listening on remote on the device.
+func (m *ForwardManager) RemoveReverse(ctx context.Context, serial, remote string) error {
+	return m.remove(ctx, serial, true, remote)
+}
+
+func (m *ForwardManager) remove(ctx context.Context, serial string, reverse bool, spec string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	i := m.find(serial, reverse, spec)
+	if i < 0 {
+		return fmt.Errorf("%w: no forward of %s listening on %s", wire.ErrAssertion, serial, spec)
+	}
+	rule := m.rules[i]
+	m.rules = append(m.rules[:i], m.rules[i+1:]...)
+	if rule.Err != nil {
+		return nil
+	}
+	return m.unapply(ctx, rule)
+}
+
+// find returns the index of the rule listening on spec, or -1. Every tcp:0 rule is a new socket.
+func (m *ForwardManager) find(serial string, reverse bool, spec string) int {
+	if spec == "tcp:0" {
+		return -1
+	}
+	for i, r := range m.rules {
+		if r.Serial != serial || r.Reverse != reverse {
+			continue
+		}
+		requested := r.Local
+		if r.Reverse {
+			requested = r.Remote
+		}
+		if r.listener() == spec || requested == spec {
+			return i
+		}
+	}
+	return -1
+}
+
+// Rules returns a copy of the rules, with their allocated ports and errors.
+func (m *ForwardManager) Rules() []ForwardRule {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	rules := make([]ForwardRule, len(m.rules))
+	for i, r := range m.rules {
+		rules[i] = *r
+	}
+	return rules
+}
+
+// Close stops watching devices and removes the rules of the manager, leaving the other
+// forwards of the server alone. Rules of devices that are gone are skipped.
+func (m *ForwardManager) Close(ctx context.Context) error {
+	m.watcher.Shutdown()
+	<-m.done
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if m.closed {
+		return nil
+	}
+	m.closed = true
+
+	var errs []error
+	for _, rule := range m.rules {
+		if rule.Err != nil {
+			continue
+		}
+		err := m.unapply(ctx, rule)
+		if err != nil && !errors.Is(err, wire.ErrDeviceNotFound) && !errors.Is(err, wire.ErrDeviceOffline) {
+			errs = append(errs, err)
+		}
+	}
+	m.rules = nil
+	return errors.Join(errs...)
+}
+
+// restore reapplies the rules of serial that are missing, after the device came back online.
+func (m *ForwardManager) restore(ctx context.Context, serial string) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if m.closed {
+		return
+	}
+
+	device := m.client.Device(DeviceWithSerial(serial))
+	var forwards, reverses []ForwardEntry
+	var listed, listedReverses bool
+	for _, rule := range m.rules {
+		if rule.Serial != serial {
+			continue
+		}
+
+		// Rules the device still has, eg. when the watcher reports it at start, are left alone.
+		var existing []ForwardEntry
+		if rule.Reverse {
+			if !listedReverses {
+				reverses, _ = device.DoListReverse(ctx)
+				listedReverses = true
+			}
+			existing = reverses
+		} else {
+			if !listed {
+				forwards, _ = device.DoListForward(ctx)
+				listed = true
+			}
+			existing = forwards
+		}
+		if rule.Err == nil && hasForward(existing, rule) {
+			continue
+		}
+
+		if err := m.apply(ctx, rule, true); err != nil {
+			debugLog(fmt.Sprintf("restore forward %s %s: %v", serial, rule.listener(), err))
+		}
+	}
+}
+
+func hasForward(list []ForwardEntry, rule *ForwardRule) bool {
+	target := rule.Remote
+	if rule.Reverse {
+		target = rule.Local
+	}
+	for _, e := range list {
+		if e.Local == rule.listener() && e.Remote == target {
+			return true
+		}
+	}
+	return false
+}
+
+// apply sets up rule on its device. When restoring, the port allocated before is asked for
+// again, without rebinding it in case something else took it meanwhile.
+func (m *ForwardManager) apply(ctx context.Context, rule *ForwardRule, restoring bool) error {
+	device := m.client.Device(DeviceWithSerial(rule.Serial))
+	set := func(spec string, noRebind bool) (int, error) {
+		if rule.Reverse {
+			return device.DoReverse(ctx, spec, rule.Local, noRebind)
+		}
+		return device.DoForward(ctx, spec, rule.Remote, noRebind)
+	}
+
+	requested := rule.Local
+	if rule.Reverse {
+		requested = rule.Remote
+	}
+	if restoring && requested == "tcp:0" && rule.Port != 0 {
+		if _, err := set(rule.listener(), true); err == nil {
+			rule.Err = nil
+			return nil
+		}
+	}
+
+	port, err := set(requested, false)
+	rule.Err = err
+	if err == nil && port != 0 {
+		rule.Port = port
+	}
+	return err
+}
+
+func (m *ForwardManager) unapply(ctx context.Context, rule *ForwardRule) error {
+	device := m.client.Device(DeviceWithSerial(rule.Serial))
+	if rule.Reverse {
+		return device.DoRemoveReverse(ctx, rule.listener())
+	}
+	return device.DoRemoveForward(ctx, rule.listener())
+}
@@ -0,0 +1,109 @@
+package adb_test
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	adb "DomaphoneS-Next/backend/goadb"
+	"DomaphoneS-Next/backend/goadb/adbtest"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// replug detaches the device with serial and attaches dev in its place, once a watcher
+// saw it go away.
+func replug(t *testing.T, srv *adbtest.Server, client *adb.Adb, serial string, dev *adbtest.Device) {
+	watcher := client.NewDeviceWatcher(context.Background())
+	defer watcher.Shutdown()
+	wait := func(state adb.DeviceState) {
+		for event := range watcher.C() {
+			if event.Serial == serial && event.NewState == state {
+				return
+			}
+		}
+		t.Fatalf("watcher stopped: %v", watcher.Err())
+	}
+	wait(adb.StateOnline)
+	srv.RemoveDevice(serial)
+	wait(adb.StateDisconnected)
+	srv.AddDevice(dev)
+}
+
+func TestForwardManager(t *testing.T) {
+	ctx := context.Background()
+	srv, err := adbtest.NewServer()
+	require.NoError(t, err)
+	defer srv.Close()
+	dev := adbtest.NewDevice("emulator-5554")
+	srv.AddDevice(dev)
+	client, err := adb.NewWithConfig(srv.Config())
+	require.NoError(t, err)
+
+	// A forward made by someone else.
+	_, err = client.Device(adb.AnyDevice()).DoForward(ctx, "tcp:6100", "tcp:8080", false)
+	require.NoError(t, err)
+
+	m := client.NewForwardManager(ctx)
+	port, err := m.Forward(ctx, "emulator-5554", "tcp:0", "tcp:8080")
+	require.NoError(t, err)
+	assert.Equal(t, 40000, port)
+	_, err = m.Forward(ctx, "emulator-5554", "tcp:6200", "localabstract:app")
+	require.NoError(t, err)
+	port, err = m.Reverse(ctx, "emulator-5554", "tcp:0", "tcp:9090")
+	require.NoError(t, err)
+	assert.Equal(t, 40000, port)
+	assert.Len(t, srv.Forwards(), 3)
+
+	// The forwards and reverses vanish with the device and come back with it.
+	dev2 := adbtest.NewDevice("emulator-5554")
+	replug(t, srv, client, "emulator-5554", dev2)
+	require.Eventually(t, func() bool {
+		return len(srv.Forwards()) == 2 && len(dev2.Reverses()) == 1
+	}, 5*time.Second, 10*time.Millisecond)
+	assert.ElementsMatch(t, []adbtest.Forward{
+		{Serial: "emulator-5554", Local: "tcp:40000", Remote: "tcp:8080"},
+		{Serial: "emulator-5554", Local: "tcp:6200", Remote: "localabstract:app"},
+	}, srv.Forwards())
+	assert.Equal(t, []adbtest.Forward{{Serial: "UsbFfs", Local: "tcp:40000", Remote: "tcp:9090"}}, dev2.Reverses())
+	for _, rule := range m.Rules() {
+		assert.NoError(t, rule.Err)
+	}
+
+	require.NoError(t, m.Remove(ctx, "emulator-5554", "tcp:6200"))
+	assert.Len(t, m.Rules(), 2)
+
+	_, err = client.Device(adb.AnyDevice()).DoForward(ctx, "tcp:6100", "tcp:8080", false)
+	require.NoError(t, err)
+	require.NoError(t, m.Close(ctx))
+	assert.Equal(t, []adbtest.Forward{{Serial: "emulator-5554", Local: "tcp:6100", Remote: "tcp:8080"}}, srv.Forwards())
+	assert.Empty(t, dev2.Reverses())
+
+	_, err = m.Forward(ctx, "emulator-5554", "tcp:0", "tcp:8080")
+	assert.Error(t, err)
+}
+
+func TestForwardManager_Offline(t *testing.T) {
+	ctx := context.Background()
+	srv, err := adbtest.NewServer()
+	require.NoError(t, err)
+	defer srv.Close()
+	client, err := adb.NewWithConfig(srv.Config())
+	require.NoError(t, err)
+
+	m := client.NewForwardManager(ctx)
+	defer m.Close(ctx)
+	_, err = m.Forward(ctx, "emulator-5554", "tcp:6200", "tcp:8080")
+	assert.Error(t, err)
+	rules := m.Rules()
+	require.Len(t, rules, 1)
+	assert.Error(t, rules[0].Err)
+
+	// The rule is applied once the device shows up.
+	srv.AddDevice(adbtest.NewDevice("emulator-5554"))
+	require.Eventually(t, func() bool {
+		return len(srv.Forwards()) == 1
+	}, 5*time.Second, 10*time.Millisecond)
+	assert.NoError(t, m.Rules()[0].Err)
+}
@@ -4,7 +4,10 @@ go 1.18
 
 require (
 	github.com/alecthomas/kingpin/v2 v2.3.2
+	github.com/andybalholm/brotli v1.0.5
 	github.com/cheggaaa/pb v1.0.29
+	github.com/klauspost/compress v1.16.7
+	github.com/pierrec/lz4/v4 v4.1.18
 	github.com/prife/gomlib v0.0.4
 	github.com/sirupsen/logrus v1.9.3
 	github.com/stretchr/testify v1.8.4
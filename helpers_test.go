@@ -0,0 +1,24 @@
+package adb_test
+
+import (
+	"testing"
+
+	adb "DomaphoneS-Next/backend/goadb"
+	"DomaphoneS-Next/backend/goadb/adbtest"
+
+	"github.com/stretchr/testify/require"
+)
+
+// newTestClient starts an adbtest server with devices and returns a client of it.
+func newTestClient(t *testing.T, devices ...*adbtest.Device) (*adbtest.Server, *adb.Adb) {
+	srv, err := adbtest.NewServer()
+	require.NoError(t, err)
+	t.Cleanup(func() { srv.Close() })
+	for _, d := range devices {
+		srv.AddDevice(d)
+	}
+
+	client, err := adb.NewWithConfig(srv.Config())
+	require.NoError(t, err)
+	return srv, client
+}
@@ -0,0 +1,191 @@
+package adb
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strconv"
+
+	"DomaphoneS-Next/backend/goadb/wire"
+)
+
+// InstallLocation is where an app is installed, see InstallOptions.
+type InstallLocation int
+
+const (
+	// InstallLocationDefault leaves the choice to the app manifest and the system.
+	InstallLocationDefault InstallLocation = iota
+	InstallLocationAuto
+	InstallLocationInternal
+	InstallLocationExternal
+)
+
+// InstallOptions are the options of Install, like the ones of `adb install`.
+type InstallOptions struct {
+	// Reinstall replaces an installed app, keeping its data (-r).
+	Reinstall bool
+	// GrantPermissions grants all the runtime permissions of the manifest (-g).
+	GrantPermissions bool
+	// AllowDowngrade allows a lower version code than the installed one (-d).
+	AllowDowngrade bool
+	// AllowTest allows apps marked testOnly (-t).
+	AllowTest bool
+	// User installs for a user id, or "all" or "current". Empty installs for the default user.
+	User string
+	// Location overrides the install location of the app.
+	Location InstallLocation
+	// Progress is called as the APK is sent, every percent.
+	Progress wire.SyncFileHandler
+	// SplitProgress is called by InstallMultiple and InstallMultiPackage as each APK is sent,
+	// every percent, with the number of APKs, the 1-based index and the path of the APK.
+	// It's called with the error of an APK that couldn't be sent.
+	SplitProgress wire.SyncHandler
+}
+
+// args returns the pm install options.
+func (o InstallOptions) args() []string {
+	var args []string
+	if o.Reinstall {
+		args = append(args, "-r")
+	}
+	if o.GrantPermissions {
+		args = append(args, "-g")
+	}
+	if o.AllowDowngrade {
+		args = append(args, "-d")
+	}
+	if o.AllowTest {
+		args = append(args, "-t")
+	}
+	if o.User != "" {
+		args = append(args, "--user", o.User)
+	}
+	if o.Location != InstallLocationDefault {
+		// pm numbers the locations from 0: auto, internal, external.
+		args = append(args, "--install-location", strconv.Itoa(int(o.Location)-1))
+	}
+	return args
+}
+
+// Install installs the APK localAPK of the host on the device, like `adb install`.
+// The APK is streamed to the package manager, with abb_exec or `cmd package install -S`, so
+// it's never stored on the device where system_server may not be able to read it. Devices
+// older than Android 7 have no streaming install, the APK is pushed to /data/local/tmp,
+// installed with PmInstall and removed.
+// Installing takes as long as it takes, only ctx limits it.
+func (c *Device) Install(ctx context.Context, localAPK string, opts InstallOptions) error {
+	f, err := os.Open(localAPK)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	info, err := f.Stat()
+	if err != nil {
+		return err
+	}
+	if !info.Mode().IsRegular() {
+		return fmt.Errorf("not regular file: %s", localAPK)
+	}
+
+	features, err := c.cachedFeatures(ctx)
+	if err != nil {
+		return wrapClientError(err, c, "Install")
+	}
+	if !features[FeatureCmd] && !features[FeatureAbbExec] {
+		return c.installPushed(ctx, localAPK, opts)
+	}
+
+	args := append([]string{"install", "-S", strconv.FormatInt(info.Size(), 10)}, opts.args()...)
+	out, err := c.streamInstall(ctx, features, f, uint64(info.Size()), opts.Progress, args)
+	if err != nil {
+		return wrapClientError(err, c, "Install")
+	}
+	return installResult(out)
+}
+
+// streamInstall runs the package command args, which reads size bytes of stdin like
+// `install -S <size>`, with apk as its stdin and returns its output.
+func (c *Device) streamInstall(ctx context.Context, features map[string]bool, apk io.Reader, size uint64,
+	progress wire.SyncFileHandler, args []string) ([]byte, error) {
+	var conn io.ReadWriteCloser
+	var err error
+	if features[FeatureAbbExec] {
+		conn, err = c.AbbExec(ctx, "package", args...)
+	} else {
+		// Without cmd, pm is the only way to the package manager.
+		cmd := "pm"
+		if features[FeatureCmd] {
+			cmd, args = "cmd", append([]string{"package"}, args...)
+		}
+		conn, err = c.openExec(ctx, cmd, args...)
+	}
+	if err != nil {
+		return nil, err
+	}
+	defer conn.Close()
+
+	// pm reads exactly size bytes, then prints the result and exits.
+	w := io.Writer(conn)
+	if fn := progressFunc(size, progress); fn != nil {
+		w = &progressWriter{w: conn, fn: fn}
+	}
+	buf := make([]byte, wire.SyncMaxChunkSize)
+	if _, err = io.CopyBuffer(w, io.LimitReader(apk, int64(size)), buf); err != nil {
+		// The output may tell why pm stopped reading.
+		out, _ := io.ReadAll(conn)
+		if len(out) > 0 {
+			return out, nil
+		}
+		return nil, contextError(ctx, err)
+	}
+	out, err := io.ReadAll(conn)
+	return out, contextError(ctx, err)
+}
+
+// installPushed installs like adb does for devices without streaming install.
+func (c *Device) installPushed(ctx context.Context, localAPK string, opts InstallOptions) error {
+	remote := "/data/local/tmp/" + filepath.Base(localAPK)
+	if err := c.PushFile(ctx, localAPK, remote, opts.Progress); err != nil {
+		return err
+	}
+	defer c.Rm(context.Background(), []string{remote})
+
+	args := append([]string{"install"}, opts.args()...)
+	args = append(args, remote)
+	out, err := c.pm(ctx, args...)
+	if err != nil {
+		return wrapClientError(err, c, "Install")
+	}
+	return installResult(out)
+}
+
+// installResult returns the error reported by the output of pm install, nil on Success.
+// Failures are an *InstallError.
+func installResult(out []byte) error {
+	out = bytes.TrimSpace(out)
+	for _, line := range bytes.Split(out, []byte("\n")) {
+		if bytes.HasPrefix(bytes.TrimSpace(line), []byte("Success")) {
+			return nil
+		}
+	}
+	if len(out) == 0 {
+		return errors.New("install: no output from pm")
+	}
+	return parseInstallError(string(out))
+}
+
+// progressWriter calls fn with the size of each write.
+type progressWriter struct {
+	w  io.Writer
+	fn func(n uint64)
+}
+
+func (p *progressWriter) Write(b []byte) (int, error) {
+	n, err := p.w.Write(b)
+	p.fn(uint64(n))
+	return n, err
+}
@@ -0,0 +1,190 @@
+package adb
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+)
+
+// Failure codes of the package manager, see PackageManager.INSTALL_FAILED_*. Codes
+// missing here are still reported in InstallError.Code.
+const (
+	InstallFailedAlreadyExists            = "INSTALL_FAILED_ALREADY_EXISTS"
+	InstallFailedInvalidAPK               = "INSTALL_FAILED_INVALID_APK"
+	InstallFailedInsufficientStorage      = "INSTALL_FAILED_INSUFFICIENT_STORAGE"
+	InstallFailedDuplicatePackage         = "INSTALL_FAILED_DUPLICATE_PACKAGE"
+	InstallFailedUpdateIncompatible       = "INSTALL_FAILED_UPDATE_INCOMPATIBLE"
+	InstallFailedSharedUserIncompatible   = "INSTALL_FAILED_SHARED_USER_INCOMPATIBLE"
+	InstallFailedDexopt                   = "INSTALL_FAILED_DEXOPT"
+	InstallFailedOlderSdk                 = "INSTALL_FAILED_OLDER_SDK"
+	InstallFailedContainerError           = "INSTALL_FAILED_CONTAINER_ERROR"
+	InstallFailedMediaUnavailable         = "INSTALL_FAILED_MEDIA_UNAVAILABLE"
+	InstallFailedVerificationTimeout      = "INSTALL_FAILED_VERIFICATION_TIMEOUT"
+	InstallFailedPackageChanged           = "INSTALL_FAILED_PACKAGE_CHANGED"
+	InstallFailedUidChanged               = "INSTALL_FAILED_UID_CHANGED"
+	InstallFailedVersionDowngrade         = "INSTALL_FAILED_VERSION_DOWNGRADE"
+	InstallFailedNoMatchingAbis           = "INSTALL_FAILED_NO_MATCHING_ABIS"
+	InstallFailedTestOnly                 = "INSTALL_FAILED_TEST_ONLY"
+	InstallFailedDuplicatePermission      = "INSTALL_FAILED_DUPLICATE_PERMISSION"
+	InstallFailedInternalError            = "INSTALL_FAILED_INTERNAL_ERROR"
+	InstallFailedUserRestricted           = "INSTALL_FAILED_USER_RESTRICTED"
+	InstallFailedAborted                  = "INSTALL_FAILED_ABORTED"
+	InstallParseFailedNoCertificates      = "INSTALL_PARSE_FAILED_NO_CERTIFICATES"
+	InstallParseFailedInconsistentCerts   = "INSTALL_PARSE_FAILED_INCONSISTENT_CERTIFICATES"
+	InstallParseFailedUnexpectedException = "INSTALL_PARSE_FAILED_UNEXPECTED_EXCEPTION"
+)
+
+// InstallErrorKind tells what may fix a failed install, see InstallError.
+type InstallErrorKind int
+
+const (
+	// InstallErrorOther won't be fixed by retrying, eg. an invalid APK.
+	InstallErrorOther InstallErrorKind = iota
+	// InstallErrorRetryable is a transient failure of the device, the same install may succeed.
+	InstallErrorRetryable
+	// InstallErrorNeedsUninstall means the installed app must be uninstalled first, eg. it's
+	// signed with another key.
+	InstallErrorNeedsUninstall
+	// InstallErrorNeedsDowngrade means the installed version is newer, see
+	// InstallOptions.AllowDowngrade.
+	InstallErrorNeedsDowngrade
+	// InstallErrorStorage means the device is out of space.
+	InstallErrorStorage
+)
+
+func (k InstallErrorKind) String() string {
+	switch k {
+	case InstallErrorOther:
+		return "other"
+	case InstallErrorRetryable:
+		return "retryable"
+	case InstallErrorNeedsUninstall:
+		return "needs uninstall"
+	case InstallErrorNeedsDowngrade:
+		return "needs downgrade"
+	case InstallErrorStorage:
+		return "storage"
+	}
+	return fmt.Sprintf("InstallErrorKind(%d)", int(k))
+}
+
+// installErrorKinds classifies the failure codes.
+var installErrorKinds = map[string]InstallErrorKind{
+	InstallFailedInsufficientStorage:    InstallErrorStorage,
+	InstallFailedMediaUnavailable:       InstallErrorRetryable,
+	InstallFailedContainerError:         InstallErrorRetryable,
+	InstallFailedDexopt:                 InstallErrorRetryable,
+	InstallFailedVerificationTimeout:    InstallErrorRetryable,
+	InstallFailedPackageChanged:         InstallErrorRetryable,
+	InstallFailedInternalError:          InstallErrorRetryable,
+	InstallFailedAborted:                InstallErrorRetryable,
+	InstallFailedUpdateIncompatible:     InstallErrorNeedsUninstall,
+	InstallFailedSharedUserIncompatible: InstallErrorNeedsUninstall,
+	InstallFailedUidChanged:             InstallErrorNeedsUninstall,
+	InstallFailedDuplicatePermission:    InstallErrorNeedsUninstall,
+	InstallParseFailedInconsistentCerts: InstallErrorNeedsUninstall,
+	InstallFailedVersionDowngrade:       InstallErrorNeedsDowngrade,
+}
+
+// InstallError is a failure reported by the package manager, from either form of its output:
+//
+//	Failure [INSTALL_FAILED_UPDATE_INCOMPATIBLE: Package com.example signatures do not match previously installed version; ignoring!]
+//
+// or an exception, followed by its stack trace:
+//
+//	Exception occurred while executing 'install':
+//	java.lang.IllegalArgumentException: Error: Can't open file: app.apk
+//		at com.android.server.pm.PackageManagerShellCommand.setParamsSize(PackageManagerShellCommand.java:604)
+type InstallError struct {
+	// Code is the failure code, eg. INSTALL_FAILED_INSUFFICIENT_STORAGE. It may be empty
+	// for exceptions.
+	Code string
+	// Message is the explanation of the failure, without the stack trace.
+	Message string
+	// Exception is the Java exception class for the exception form, eg.
+	// java.lang.IllegalArgumentException.
+	Exception string
+	Kind      InstallErrorKind
+	// Output is the whole output of pm.
+	Output string
+}
+
+func (e *InstallError) Error() string {
+	switch {
+	case e.Code != "" && e.Message != "":
+		return fmt.Sprintf("install failed: %s: %s", e.Code, e.Message)
+	case e.Code != "":
+		return "install failed: " + e.Code
+	case e.Exception != "":
+		return fmt.Sprintf("install failed: %s: %s", e.Exception, e.Message)
+	}
+	return "install failed: " + e.Message
+}
+
+// Retryable tells whether the same install may succeed if tried again.
+func (e *InstallError) Retryable() bool {
+	return e.Kind == InstallErrorRetryable
+}
+
+var (
+	installCodeRegex = regexp.MustCompile(`\bINSTALL_(?:PARSE_)?FAILED_[A-Z0-9_]+`)
+	// installExceptionRegex matches `java.io.IOException: message`, possibly after `Error: `.
+	installExceptionRegex = regexp.MustCompile(`^(?:Error: )?((?:[a-zA-Z_$][\w$]*\.)+[\w$]*(?:Exception|Error)): ?(.*)$`)
+)
+
+// parseInstallError parses the failure in the output of pm install and the session commands.
+func parseInstallError(out string) *InstallError {
+	out = strings.TrimSpace(out)
+	e := &InstallError{Output: out}
+	lines := strings.Split(out, "\n")
+	for i := range lines {
+		lines[i] = strings.TrimSpace(lines[i])
+	}
+
+	for _, line := range lines {
+		i := strings.Index(line, "Failure [")
+		if i < 0 {
+			continue
+		}
+		// The message may contain brackets, the failure ends at the last one.
+		failure := strings.TrimSuffix(line[i+len("Failure ["):], "]")
+		code, msg, _ := strings.Cut(failure, ":")
+		e.Code, e.Message = strings.TrimSpace(code), strings.TrimSpace(msg)
+		break
+	}
+
+	if e.Code == "" {
+		for _, line := range lines {
+			if m := installExceptionRegex.FindStringSubmatch(line); m != nil {
+				e.Exception, e.Message = m[1], strings.TrimPrefix(m[2], "Error: ")
+				break
+			}
+		}
+		if e.Message == "" {
+			// `Error: ...` lines without an exception, or unknown output.
+			for _, line := range lines {
+				if strings.HasPrefix(line, "Error: ") {
+					e.Message = strings.TrimPrefix(line, "Error: ")
+					break
+				}
+			}
+		}
+		if e.Message == "" && e.Exception == "" {
+			e.Message = out
+		}
+		// Exceptions may carry the code in their message.
+		e.Code = installCodeRegex.FindString(out)
+	}
+
+	e.Kind = installErrorKinds[e.Code]
+	if e.Kind == InstallErrorOther {
+		switch {
+		case strings.Contains(out, "No space left on device") || strings.Contains(out, "ENOSPC"):
+			e.Kind = InstallErrorStorage
+		case strings.Contains(out, "DeadObjectException"):
+			// system_server died while installing.
+			e.Kind = InstallErrorRetryable
+		}
+	}
+	return e
+}
@@ -0,0 +1,79 @@
+package adb
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func Test_parseInstallError(t *testing.T) {
+	tests := []struct {
+		out  string
+		want InstallError
+	}{
+		{
+			out: "Failure [INSTALL_FAILED_UPDATE_INCOMPATIBLE: Package com.example signatures do not match previously installed version; ignoring!]",
+			want: InstallError{
+				Code:    InstallFailedUpdateIncompatible,
+				Message: "Package com.example signatures do not match previously installed version; ignoring!",
+				Kind:    InstallErrorNeedsUninstall,
+			},
+		},
+		{
+			// Android 4 prints the path first.
+			out:  "\tpkg: /data/local/tmp/app.apk\r\nFailure [INSTALL_FAILED_VERSION_DOWNGRADE]\r\n",
+			want: InstallError{Code: InstallFailedVersionDowngrade, Kind: InstallErrorNeedsDowngrade},
+		},
+		{
+			out: "Failure [INSTALL_FAILED_INSUFFICIENT_STORAGE: Failed to override installation location [internal]]",
+			want: InstallError{
+				Code:    InstallFailedInsufficientStorage,
+				Message: "Failed to override installation location [internal]",
+				Kind:    InstallErrorStorage,
+			},
+		},
+		{
+			out: "avc:  denied  { read } for  scontext=u:r:system_server:s0\n" +
+				"Error: Unable to open file: app.apk\n" +
+				"Consider using a file under /data/local/tmp/\n" +
+				"Exception occurred while executing 'install':\n" +
+				"java.lang.IllegalArgumentException: Error: Can't open file: app.apk\n" +
+				"\tat com.android.server.pm.PackageManagerShellCommand.setParamsSize(PackageManagerShellCommand.java:604)\n",
+			want: InstallError{
+				Message:   "Can't open file: app.apk",
+				Exception: "java.lang.IllegalArgumentException",
+			},
+		},
+		{
+			out: "Error: java.io.IOException: No space left on device",
+			want: InstallError{
+				Message:   "No space left on device",
+				Exception: "java.io.IOException",
+				Kind:      InstallErrorStorage,
+			},
+		},
+		{
+			out: "Exception occurred while executing 'install-commit':\n" +
+				"java.lang.SecurityException: INSTALL_FAILED_INTERNAL_ERROR: Session relinquished\n",
+			want: InstallError{
+				Code:      InstallFailedInternalError,
+				Message:   "INSTALL_FAILED_INTERNAL_ERROR: Session relinquished",
+				Exception: "java.lang.SecurityException",
+				Kind:      InstallErrorRetryable,
+			},
+		},
+		{
+			out:  "Error: Failed to parse APK file: /data/local/tmp/app.apk",
+			want: InstallError{Message: "Failed to parse APK file: /data/local/tmp/app.apk"},
+		},
+		{
+			out:  "something unexpected",
+			want: InstallError{Message: "something unexpected"},
+		},
+	}
+	for _, tt := range tests {
+		got := parseInstallError(tt.out)
+		got.Output = ""
+		assert.Equal(t, tt.want, *got, tt.out)
+	}
+}
@@ -0,0 +1,214 @@
+package adb
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strconv"
+
+	"DomaphoneS-Next/backend/goadb/wire"
+)
+
+// installSessionRegex matches the output of pm install-create.
+var installSessionRegex = regexp.MustCompile(`Success: created install session \[(\d+)\]`)
+
+// installSessions writes APKs to pm install sessions, see InstallMultiple.
+type installSessions struct {
+	device   *Device
+	features map[string]bool
+	opts     InstallOptions
+
+	// created are the sessions to abandon if the install fails.
+	created []int
+	// totalAPKs and sentAPKs count the APKs for SplitProgress.
+	totalAPKs int
+	sentAPKs  int
+}
+
+// InstallMultiple installs an app delivered as several APKs, a base APK and its splits, like
+// `adb install-multiple`. The APKs are written to a pm install session which is committed
+// once they are all on the device: either every APK is installed or none.
+// The session is abandoned if anything fails or ctx is done.
+func (c *Device) InstallMultiple(ctx context.Context, apks []string, opts InstallOptions) (err error) {
+	s, err := c.newInstallSessions(ctx, opts, apks)
+	if err != nil {
+		return err
+	}
+	defer func() {
+		if err != nil {
+			s.abandon()
+		}
+	}()
+
+	session, err := s.createWith(ctx, apks)
+	if err != nil {
+		return err
+	}
+	return s.commit(ctx, session)
+}
+
+// InstallMultiPackage installs several apps at once, like `adb install-multi-package`: each
+// package is the APKs of an app, written to its own session, and the sessions are committed
+// together through a parent session. Either all the apps are installed or none.
+// The sessions are abandoned if anything fails or ctx is done.
+func (c *Device) InstallMultiPackage(ctx context.Context, packages [][]string, opts InstallOptions) (err error) {
+	var all []string
+	for _, apks := range packages {
+		all = append(all, apks...)
+	}
+	s, err := c.newInstallSessions(ctx, opts, all)
+	if err != nil {
+		return err
+	}
+	defer func() {
+		if err != nil {
+			s.abandon()
+		}
+	}()
+
+	parent, err := s.create(ctx, "--multi-package")
+	if err != nil {
+		return err
+	}
+	args := []string{"install-add-session", strconv.Itoa(parent)}
+	for _, apks := range packages {
+		child, err := s.createWith(ctx, apks)
+		if err != nil {
+			return err
+		}
+		args = append(args, strconv.Itoa(child))
+	}
+	if err = s.run(ctx, args...); err != nil {
+		return err
+	}
+	return s.commit(ctx, parent)
+}
+
+func (c *Device) newInstallSessions(ctx context.Context, opts InstallOptions, apks []string) (*installSessions, error) {
+	if len(apks) == 0 {
+		return nil, fmt.Errorf("%w: no APK to install", wire.ErrAssertion)
+	}
+	for _, apk := range apks {
+		info, err := os.Stat(apk)
+		if err != nil {
+			return nil, err
+		}
+		if !info.Mode().IsRegular() {
+			return nil, fmt.Errorf("not regular file: %s", apk)
+		}
+	}
+	features, err := c.cachedFeatures(ctx)
+	if err != nil {
+		return nil, wrapClientError(err, c, "Install")
+	}
+	return &installSessions{device: c, features: features, opts: opts, totalAPKs: len(apks)}, nil
+}
+
+// create runs pm install-create with the install options and extra, and returns the session id.
+func (s *installSessions) create(ctx context.Context, extra ...string) (int, error) {
+	args := append([]string{"install-create"}, s.opts.args()...)
+	args = append(args, extra...)
+	out, err := s.device.pm(ctx, args...)
+	if err != nil {
+		return 0, wrapClientError(err, s.device, "Install")
+	}
+	m := installSessionRegex.FindSubmatch(out)
+	if m == nil {
+		return 0, installResult(out)
+	}
+	session, _ := strconv.Atoi(string(m[1]))
+	s.created = append(s.created, session)
+	return session, nil
+}
+
+// createWith creates a session and writes apks to it.
+func (s *installSessions) createWith(ctx context.Context, apks []string) (int, error) {
+	var total int64
+	for _, apk := range apks {
+		info, err := os.Stat(apk)
+		if err != nil {
+			return 0, err
+		}
+		total += info.Size()
+	}
+	session, err := s.create(ctx, "-S", strconv.FormatInt(total, 10))
+	if err != nil {
+		return 0, err
+	}
+	for i, apk := range apks {
+		if err = s.write(ctx, session, i, apk); err != nil {
+			return 0, err
+		}
+	}
+	return session, nil
+}
+
+// write streams apk to session with pm install-write. The name of the split in the session
+// is prefixed with its index, like adb does, so APKs with the same name don't collide.
+func (s *installSessions) write(ctx context.Context, session, index int, apk string) error {
+	s.sentAPKs++
+	err := s.writeAPK(ctx, session, index, apk)
+	if err != nil && s.opts.SplitProgress != nil {
+		s.opts.SplitProgress(uint64(s.totalAPKs), uint64(s.sentAPKs), apk, 0, 0, err)
+	}
+	return err
+}
+
+func (s *installSessions) writeAPK(ctx context.Context, session, index int, apk string) error {
+	f, err := os.Open(apk)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	info, err := f.Stat()
+	if err != nil {
+		return err
+	}
+
+	var progress wire.SyncFileHandler
+	if s.opts.SplitProgress != nil {
+		total, sent := uint64(s.totalAPKs), uint64(s.sentAPKs)
+		progress = func(_, _ uint64, percent, speed float64) {
+			s.opts.SplitProgress(total, sent, apk, percent, speed, nil)
+		}
+	}
+	name := fmt.Sprintf("%d_%s", index, filepath.Base(apk))
+	size := strconv.FormatInt(info.Size(), 10)
+	out, err := s.device.streamInstall(ctx, s.features, f, uint64(info.Size()), progress,
+		[]string{"install-write", "-S", size, strconv.Itoa(session), name, "-"})
+	if err != nil {
+		return wrapClientError(err, s.device, "Install")
+	}
+	return installResult(out)
+}
+
+// run runs a pm session command and checks it succeeded.
+func (s *installSessions) run(ctx context.Context, args ...string) error {
+	out, err := s.device.pm(ctx, args...)
+	if err != nil {
+		return wrapClientError(err, s.device, "Install")
+	}
+	return installResult(out)
+}
+
+func (s *installSessions) commit(ctx context.Context, session int) error {
+	if err := s.run(ctx, "install-commit", strconv.Itoa(session)); err != nil {
+		return err
+	}
+	s.created = nil
+	return nil
+}
+
+// abandon abandons the created sessions. ctx may be done already, so it has its own timeout.
+func (s *installSessions) abandon() {
+	ctx, cancel := context.WithTimeout(context.Background(), s.device.CmdTimeoutLong)
+	defer cancel()
+	for i := len(s.created) - 1; i >= 0; i-- {
+		if err := s.run(ctx, "install-abandon", strconv.Itoa(s.created[i])); err != nil {
+			debugLog(fmt.Sprintf("install-abandon %d: %v", s.created[i], err))
+		}
+	}
+	s.created = nil
+}
@@ -0,0 +1,142 @@
+package adb_test
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+
+	adb "DomaphoneS-Next/backend/goadb"
+	"DomaphoneS-Next/backend/goadb/adbtest"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// fakeSessions emulates the install session commands of the package manager.
+type fakeSessions struct {
+	mu        sync.Mutex
+	next      int
+	splits    map[int]map[string][]byte
+	committed []int
+	abandoned []int
+	commands  []string
+	// failWrite fails install-write of the split with this name.
+	failWrite string
+}
+
+func (f *fakeSessions) handle(cmd string, stdin io.Reader, stdout, stderr io.Writer) int {
+	args := strings.Fields(strings.TrimPrefix(cmd, "cmd package "))
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.commands = append(f.commands, args[0])
+	switch args[0] {
+	case "install-create":
+		f.next++
+		fmt.Fprintf(stdout, "Success: created install session [%d]\n", f.next)
+	case "install-write":
+		// install-write -S size session name -
+		size, _ := strconv.Atoi(args[2])
+		session, _ := strconv.Atoi(args[3])
+		data, _ := io.ReadAll(io.LimitReader(stdin, int64(size)))
+		if args[4] == f.failWrite {
+			fmt.Fprintln(stdout, "Error: java.io.IOException: No space left on device")
+			return 1
+		}
+		if f.splits[session] == nil {
+			f.splits[session] = map[string][]byte{}
+		}
+		f.splits[session][args[4]] = data
+		fmt.Fprintf(stdout, "Success: streamed %d bytes\n", len(data))
+	case "install-add-session":
+		fmt.Fprintln(stdout, "Success")
+	case "install-commit":
+		session, _ := strconv.Atoi(args[1])
+		f.committed = append(f.committed, session)
+		fmt.Fprintln(stdout, "Success")
+	case "install-abandon":
+		session, _ := strconv.Atoi(args[1])
+		f.abandoned = append(f.abandoned, session)
+		fmt.Fprintln(stdout, "Success")
+	default:
+		return 127
+	}
+	return 0
+}
+
+func newSessionsDevice(t *testing.T) (*fakeSessions, *adb.Device) {
+	f := &fakeSessions{splits: map[int]map[string][]byte{}}
+	dev := adbtest.NewDevice("emulator-5554")
+	dev.Features = append(dev.Features, adb.FeatureAbb, adb.FeatureAbbExec)
+	dev.HandleShellFunc(f.handle)
+	_, client := newTestClient(t, dev)
+	return f, client.Device(adb.AnyDevice())
+}
+
+func TestInstallMultiple(t *testing.T) {
+	f, d := newSessionsDevice(t)
+	base := writeAPK(t, 3000)
+	split := writeAPK(t, 1000)
+
+	progress := map[string]float64{}
+	opts := adb.InstallOptions{
+		SplitProgress: func(total, sent uint64, apk string, percent, speed float64, err error) {
+			assert.Equal(t, uint64(2), total)
+			assert.NoError(t, err)
+			progress[apk] = percent
+		},
+	}
+	require.NoError(t, d.InstallMultiple(context.Background(), []string{base, split}, opts))
+
+	baseData, _ := os.ReadFile(base)
+	splitData, _ := os.ReadFile(split)
+	assert.Equal(t, map[string][]byte{"0_app.apk": baseData, "1_app.apk": splitData}, f.splits[1])
+	assert.Equal(t, []int{1}, f.committed)
+	assert.Empty(t, f.abandoned)
+	assert.Equal(t, map[string]float64{base: 100, split: 100}, progress)
+}
+
+func TestInstallMultiple_Abandon(t *testing.T) {
+	f, d := newSessionsDevice(t)
+	f.failWrite = "1_app.apk"
+
+	err := d.InstallMultiple(context.Background(), []string{writeAPK(t, 10), writeAPK(t, 10)}, adb.InstallOptions{})
+	assert.ErrorContains(t, err, "No space left on device")
+	assert.Empty(t, f.committed)
+	assert.Equal(t, []int{1}, f.abandoned)
+
+	// A canceled context abandons the session too, with a context of its own.
+	ctx, cancel := context.WithCancel(context.Background())
+	f.failWrite = ""
+	opts := adb.InstallOptions{
+		SplitProgress: func(total, sent uint64, apk string, percent, speed float64, err error) {
+			cancel()
+		},
+	}
+	err = d.InstallMultiple(ctx, []string{writeAPK(t, 10), writeAPK(t, 10)}, opts)
+	assert.ErrorIs(t, err, context.Canceled)
+	assert.Empty(t, f.committed)
+	assert.Equal(t, []int{1, 2}, f.abandoned)
+}
+
+func TestInstallMultiPackage(t *testing.T) {
+	f, d := newSessionsDevice(t)
+	packages := [][]string{
+		{writeAPK(t, 100), writeAPK(t, 10)},
+		{writeAPK(t, 200)},
+	}
+	require.NoError(t, d.InstallMultiPackage(context.Background(), packages, adb.InstallOptions{Reinstall: true}))
+
+	// Session 1 is the parent, 2 and 3 the apps.
+	assert.Len(t, f.splits[2], 2)
+	assert.Len(t, f.splits[3], 1)
+	assert.Equal(t, []int{1}, f.committed)
+	assert.Equal(t, []string{
+		"install-create", "install-create", "install-write", "install-write",
+		"install-create", "install-write", "install-add-session", "install-commit",
+	}, f.commands)
+}
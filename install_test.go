@@ -0,0 +1,105 @@
+package adb_test
+
+import (
+	"context"
+	"io"
+	"os"
+	"path/filepath"
+	"testing"
+
+	adb "DomaphoneS-Next/backend/goadb"
+	"DomaphoneS-Next/backend/goadb/adbtest"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func writeAPK(t *testing.T, size int) string {
+	path := filepath.Join(t.TempDir(), "app.apk")
+	data := make([]byte, size)
+	for i := range data {
+		data[i] = byte(i)
+	}
+	require.NoError(t, os.WriteFile(path, data, 0644))
+	return path
+}
+
+// installHandler is pm install -S: it reads the APK from stdin and reports its size.
+func installHandler(got *[]byte) adbtest.ShellFunc {
+	return func(cmd string, stdin io.Reader, stdout, stderr io.Writer) int {
+		*got, _ = io.ReadAll(io.LimitReader(stdin, 100000))
+		io.WriteString(stdout, "Success\n")
+		return 0
+	}
+}
+
+func TestInstall(t *testing.T) {
+	ctx := context.Background()
+	apk := writeAPK(t, 100000)
+	opts := adb.InstallOptions{
+		Reinstall:        true,
+		GrantPermissions: true,
+		AllowDowngrade:   true,
+		AllowTest:        true,
+		User:             "10",
+		Location:         adb.InstallLocationInternal,
+	}
+
+	for name, features := range map[string][]string{
+		"abb_exec": {adb.FeatureAbbExec},
+		"exec":     {adb.FeatureCmd},
+	} {
+		t.Run(name, func(t *testing.T) {
+			dev := adbtest.NewDevice("emulator-5554")
+			dev.Features = features
+			var got []byte
+			dev.HandleShell("cmd package install -S 100000 -r -g -d -t --user 10 --install-location 1", installHandler(&got))
+			_, client := newTestClient(t, dev)
+
+			var percent float64
+			opts.Progress = func(total, sent uint64, p, speed float64) {
+				assert.Equal(t, uint64(100000), total)
+				percent = p
+			}
+			require.NoError(t, client.Device(adb.AnyDevice()).Install(ctx, apk, opts))
+			want, _ := os.ReadFile(apk)
+			assert.Equal(t, want, got)
+			assert.Equal(t, float64(100), percent)
+		})
+	}
+}
+
+func TestInstall_Failure(t *testing.T) {
+	dev := adbtest.NewDevice("emulator-5554")
+	dev.HandleShell("cmd package install -S 10", func(cmd string, stdin io.Reader, stdout, stderr io.Writer) int {
+		io.ReadAll(io.LimitReader(stdin, 10))
+		io.WriteString(stdout, "Failure [INSTALL_FAILED_INVALID_APK: Failed to parse]\n")
+		return 1
+	})
+	_, client := newTestClient(t, dev)
+
+	err := client.Device(adb.AnyDevice()).Install(context.Background(), writeAPK(t, 10), adb.InstallOptions{})
+	assert.EqualError(t, err, "install failed: INSTALL_FAILED_INVALID_APK: Failed to parse")
+	var installErr *adb.InstallError
+	require.ErrorAs(t, err, &installErr)
+	assert.Equal(t, adb.InstallFailedInvalidAPK, installErr.Code)
+	assert.Equal(t, adb.InstallErrorOther, installErr.Kind)
+}
+
+func TestInstall_Pushed(t *testing.T) {
+	dev := adbtest.NewDevice("emulator-5554")
+	// Before Android 7 there is neither cmd nor abb.
+	dev.Features = []string{"shell_v2"}
+	var got []byte
+	dev.HandleShell("pm install -r /data/local/tmp/app.apk", func(cmd string, stdin io.Reader, stdout, stderr io.Writer) int {
+		got, _ = dev.FS.ReadFile("/data/local/tmp/app.apk")
+		io.WriteString(stdout, "Success\n")
+		return 0
+	})
+	_, client := newTestClient(t, dev)
+
+	apk := writeAPK(t, 1000)
+	require.NoError(t, client.Device(adb.AnyDevice()).Install(context.Background(), apk, adb.InstallOptions{Reinstall: true}))
+	want, _ := os.ReadFile(apk)
+	assert.Equal(t, want, got)
+}
@@ -0,0 +1,196 @@
+package adb
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"net"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"DomaphoneS-Next/backend/goadb/wire"
+)
+
+// jdwpHandshake is sent by the debugger and echoed by the VM before any JDWP packet.
+const jdwpHandshake = "JDWP-Handshake"
+
+// JdwpEvent reports a debuggable process that started or exited.
+type JdwpEvent struct {
+	Pid int
+	// Added is true for a new process, false for one that exited.
+	Added bool
+}
+
+// JdwpTracker publishes the debuggable processes of a device, see Device.TrackJdwp.
+type JdwpTracker struct {
+	conn   wire.IConn
+	cancel context.CancelFunc
+	events chan JdwpEvent
+
+	mu   sync.Mutex
+	pids map[int]bool
+	err  error
+}
+
+// TrackJdwp tracks the processes of the device that accept a debugger, with the track-jdwp
+// service. The processes running at start are reported as added.
+// The tracker stops when ctx is done or Close is called.
+func (c *Device) TrackJdwp(ctx context.Context) (*JdwpTracker, error) {
+	ctx, cancel := context.WithCancel(ctx)
+	conn, err := c.openService(ctx, "track-jdwp")
+	if err != nil {
+		cancel()
+		return nil, wrapClientError(err, c, "TrackJdwp")
+	}
+
+	t := &JdwpTracker{
+		conn:   conn,
+		cancel: cancel,
+		events: make(chan JdwpEvent),
+		pids:   map[int]bool{},
+	}
+	go t.run(ctx)
+	return t, nil
+}
+
+// C returns the channel of events. It's closed when the tracker stops, see Err.
+func (t *JdwpTracker) C() <-chan JdwpEvent {
+	return t.events
+}
+
+// Pids returns the debuggable processes, sorted.
+func (t *JdwpTracker) Pids() []int {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	pids := make([]int, 0, len(t.pids))
+	for pid := range t.pids {
+		pids = append(pids, pid)
+	}
+	sort.Ints(pids)
+	return pids
+}
+
+// Err returns the error that stopped the tracker once C is closed, nil after Close.
+func (t *JdwpTracker) Err() error {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	return t.err
+}
+
+// Close stops the tracker.
+func (t *JdwpTracker) Close() error {
+	t.cancel()
+	return nil
+}
+
+func (t *JdwpTracker) run(ctx context.Context) {
+	defer close(t.events)
+	defer t.conn.Close()
+	defer t.cancel()
+
+	for {
+		msg, err := t.conn.ReadMessage()
+		if err != nil {
+			if ctx.Err() == nil {
+				t.mu.Lock()
+				t.err = fmt.Errorf("track-jdwp: %w", err)
+				t.mu.Unlock()
+			}
+			return
+		}
+		pids, err := parseJdwpPids(msg)
+		if err != nil {
+			t.mu.Lock()
+			t.err = err
+			t.mu.Unlock()
+			return
+		}
+
+		for _, event := range t.update(pids) {
+			select {
+			case t.events <- event:
+			case <-ctx.Done():
+				return
+			}
+		}
+	}
+}
+
+// update replaces the pid set and returns the differences, added pids first.
+func (t *JdwpTracker) update(pids map[int]bool) []JdwpEvent {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	var added, removed []int
+	for pid := range pids {
+		if !t.pids[pid] {
+			added = append(added, pid)
+		}
+	}
+	for pid := range t.pids {
+		if !pids[pid] {
+			removed = append(removed, pid)
+		}
+	}
+	t.pids = pids
+
+	sort.Ints(added)
+	sort.Ints(removed)
+	events := make([]JdwpEvent, 0, len(added)+len(removed))
+	for _, pid := range added {
+		events = append(events, JdwpEvent{Pid: pid, Added: true})
+	}
+	for _, pid := range removed {
+		events = append(events, JdwpEvent{Pid: pid})
+	}
+	return events
+}
+
+// parseJdwpPids parses a track-jdwp message, one pid per line.
+func parseJdwpPids(msg []byte) (map[int]bool, error) {
+	pids := map[int]bool{}
+	for _, line := range strings.Split(string(msg), "\n") {
+		line = strings.TrimSpace(line)
+		if line == "" {
+			continue
+		}
+		pid, err := strconv.Atoi(line)
+		if err != nil {
+			return nil, fmt.Errorf("%w: invalid jdwp pid %q", wire.ErrParse, line)
+		}
+		pids[pid] = true
+	}
+	return pids, nil
+}
+
+// ForwardJdwp connects to the JDWP agent of the process pid and performs the JDWP handshake,
+// the returned connection is ready for JDWP packets.
+// The connection stays bound to ctx: cancelling it closes the connection.
+func (c *Device) ForwardJdwp(ctx context.Context, pid int) (net.Conn, error) {
+	conn, err := c.Forward(ctx, "jdwp:"+strconv.Itoa(pid))
+	if err != nil {
+		return nil, err
+	}
+
+	if _, ok := ctx.Deadline(); !ok {
+		conn.SetDeadline(time.Now().Add(c.CmdTimeoutShort))
+	}
+	if _, err = conn.Write([]byte(jdwpHandshake)); err != nil {
+		conn.Close()
+		return nil, wrapClientError(contextError(ctx, err), c, "ForwardJdwp")
+	}
+	reply := make([]byte, len(jdwpHandshake))
+	if _, err = io.ReadFull(conn, reply); err != nil {
+		conn.Close()
+		return nil, wrapClientError(contextError(ctx, err), c, "ForwardJdwp")
+	}
+	if !bytes.Equal(reply, []byte(jdwpHandshake)) {
+		conn.Close()
+		return nil, wrapClientError(fmt.Errorf("%w: invalid JDWP handshake %q", wire.ErrAssertion, reply), c, "ForwardJdwp")
+	}
+	conn.SetDeadline(time.Time{})
+	return conn, nil
+}
@@ -0,0 +1,86 @@
+package adb_test
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"testing"
+
+	adb "DomaphoneS-Next/backend/goadb"
+	"DomaphoneS-Next/backend/goadb/adbtest"
+	"DomaphoneS-Next/backend/goadb/wire"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestTrackJdwp(t *testing.T) {
+	ctx := context.Background()
+	lists := make(chan string)
+	dev := adbtest.NewDevice("emulator-5554")
+	dev.HandleService("track-jdwp", func(service string, rw io.ReadWriter) {
+		for list := range lists {
+			fmt.Fprintf(rw, "%04x%s", len(list), list)
+		}
+	})
+	_, client := newTestClient(t, dev)
+	d := client.Device(adb.AnyDevice())
+
+	tracker, err := d.TrackJdwp(ctx)
+	require.NoError(t, err)
+	defer tracker.Close()
+
+	lists <- "1234\n567\n"
+	assert.Equal(t, adb.JdwpEvent{Pid: 567, Added: true}, <-tracker.C())
+	assert.Equal(t, adb.JdwpEvent{Pid: 1234, Added: true}, <-tracker.C())
+	lists <- "1234\n890\n"
+	assert.Equal(t, adb.JdwpEvent{Pid: 890, Added: true}, <-tracker.C())
+	assert.Equal(t, adb.JdwpEvent{Pid: 567}, <-tracker.C())
+	assert.Equal(t, []int{890, 1234}, tracker.Pids())
+
+	// The device ends the stream.
+	close(lists)
+	_, ok := <-tracker.C()
+	assert.False(t, ok)
+	assert.Error(t, tracker.Err())
+}
+
+func TestTrackJdwp_Close(t *testing.T) {
+	dev := adbtest.NewDevice("emulator-5554")
+	dev.HandleService("track-jdwp", func(service string, rw io.ReadWriter) {
+		io.WriteString(rw, "0004123\n")
+		io.Copy(io.Discard, rw)
+	})
+	_, client := newTestClient(t, dev)
+
+	tracker, err := client.Device(adb.AnyDevice()).TrackJdwp(context.Background())
+	require.NoError(t, err)
+	assert.Equal(t, adb.JdwpEvent{Pid: 123, Added: true}, <-tracker.C())
+	tracker.Close()
+	_, ok := <-tracker.C()
+	assert.False(t, ok)
+	assert.NoError(t, tracker.Err())
+}
+
+func TestForwardJdwp(t *testing.T) {
+	ctx := context.Background()
+	dev := adbtest.NewDevice("emulator-5554")
+	dev.HandleService("jdwp:1234", func(service string, rw io.ReadWriter) {
+		io.Copy(rw, rw)
+	})
+	dev.HandleService("jdwp:567", func(service string, rw io.ReadWriter) {
+		io.WriteString(rw, "Not-A-Handshake")
+	})
+	_, client := newTestClient(t, dev)
+	d := client.Device(adb.AnyDevice())
+
+	conn, err := d.ForwardJdwp(ctx, 1234)
+	require.NoError(t, err)
+	defer conn.Close()
+	echo(t, conn, "packet")
+
+	_, err = d.ForwardJdwp(ctx, 567)
+	assert.ErrorIs(t, err, wire.ErrAssertion)
+	_, err = d.ForwardJdwp(ctx, 890)
+	assert.Error(t, err)
+}
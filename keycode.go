@@ -0,0 +1,137 @@
+package adb
+
+import "strconv"
+
+// Keycode is an Android key code, see KeyEvent.KEYCODE_* and Device.KeyEvent.
+type Keycode int
+
+const (
+	KeycodeUnknown            Keycode = 0
+	KeycodeSoftLeft           Keycode = 1
+	KeycodeSoftRight          Keycode = 2
+	KeycodeHome               Keycode = 3
+	KeycodeBack               Keycode = 4
+	KeycodeCall               Keycode = 5
+	KeycodeEndCall            Keycode = 6
+	Keycode0                  Keycode = 7
+	Keycode1                  Keycode = 8
+	Keycode2                  Keycode = 9
+	Keycode3                  Keycode = 10
+	Keycode4                  Keycode = 11
+	Keycode5                  Keycode = 12
+	Keycode6                  Keycode = 13
+	Keycode7                  Keycode = 14
+	Keycode8                  Keycode = 15
+	Keycode9                  Keycode = 16
+	KeycodeStar               Keycode = 17
+	KeycodePound              Keycode = 18
+	KeycodeDpadUp             Keycode = 19
+	KeycodeDpadDown           Keycode = 20
+	KeycodeDpadLeft           Keycode = 21
+	KeycodeDpadRight          Keycode = 22
+	KeycodeDpadCenter         Keycode = 23
+	KeycodeVolumeUp           Keycode = 24
+	KeycodeVolumeDown         Keycode = 25
+	KeycodePower              Keycode = 26
+	KeycodeCamera             Keycode = 27
+	KeycodeClear              Keycode = 28
+	KeycodeA                  Keycode = 29
+	KeycodeB                  Keycode = 30
+	KeycodeC                  Keycode = 31
+	KeycodeD                  Keycode = 32
+	KeycodeE                  Keycode = 33
+	KeycodeF                  Keycode = 34
+	KeycodeG                  Keycode = 35
+	KeycodeH                  Keycode = 36
+	KeycodeI                  Keycode = 37
+	KeycodeJ                  Keycode = 38
+	KeycodeK                  Keycode = 39
+	KeycodeL                  Keycode = 40
+	KeycodeM                  Keycode = 41
+	KeycodeN                  Keycode = 42
+	KeycodeO                  Keycode = 43
+	KeycodeP                  Keycode = 44
+	KeycodeQ                  Keycode = 45
+	KeycodeR                  Keycode = 46
+	KeycodeS                  Keycode = 47
+	KeycodeT                  Keycode = 48
+	KeycodeU                  Keycode = 49
+	KeycodeV                  Keycode = 50
+	KeycodeW                  Keycode = 51
+	KeycodeX                  Keycode = 52
+	KeycodeY                  Keycode = 53
+	KeycodeZ                  Keycode = 54
+	KeycodeComma              Keycode = 55
+	KeycodePeriod             Keycode = 56
+	KeycodeAltLeft            Keycode = 57
+	KeycodeAltRight           Keycode = 58
+	KeycodeShiftLeft          Keycode = 59
+	KeycodeShiftRight         Keycode = 60
+	KeycodeTab                Keycode = 61
+	KeycodeSpace              Keycode = 62
+	KeycodeEnter              Keycode = 66
+	KeycodeDel                Keycode = 67
+	KeycodeMenu               Keycode = 82
+	KeycodeNotification       Keycode = 83
+	KeycodeSearch             Keycode = 84
+	KeycodeMediaPlayPause     Keycode = 85
+	KeycodeMediaStop          Keycode = 86
+	KeycodeMediaNext          Keycode = 87
+	KeycodeMediaPrevious      Keycode = 88
+	KeycodeMute               Keycode = 91
+	KeycodePageUp             Keycode = 92
+	KeycodePageDown           Keycode = 93
+	KeycodeEscape             Keycode = 111
+	KeycodeForwardDel         Keycode = 112
+	KeycodeCtrlLeft           Keycode = 113
+	KeycodeCtrlRight          Keycode = 114
+	KeycodeMoveHome           Keycode = 122
+	KeycodeMoveEnd            Keycode = 123
+	KeycodeMediaPlay          Keycode = 126
+	KeycodeMediaPause         Keycode = 127
+	KeycodeVolumeMute         Keycode = 164
+	KeycodeAppSwitch          Keycode = 187
+	KeycodeBrightnessDown     Keycode = 220
+	KeycodeBrightnessUp       Keycode = 221
+	KeycodeSleep              Keycode = 223
+	KeycodeWakeup             Keycode = 224
+	KeycodeSystemNavigationUp Keycode = 280
+	KeycodeAllApps            Keycode = 284
+)
+
+var keycodeNames = map[Keycode]string{
+	KeycodeUnknown: "UNKNOWN", KeycodeSoftLeft: "SOFT_LEFT", KeycodeSoftRight: "SOFT_RIGHT",
+	KeycodeHome: "HOME", KeycodeBack: "BACK", KeycodeCall: "CALL", KeycodeEndCall: "ENDCALL",
+	Keycode0: "0", Keycode1: "1", Keycode2: "2", Keycode3: "3", Keycode4: "4",
+	Keycode5: "5", Keycode6: "6", Keycode7: "7", Keycode8: "8", Keycode9: "9",
+	KeycodeStar: "STAR", KeycodePound: "POUND",
+	KeycodeDpadUp: "DPAD_UP", KeycodeDpadDown: "DPAD_DOWN", KeycodeDpadLeft: "DPAD_LEFT",
+	KeycodeDpadRight: "DPAD_RIGHT", KeycodeDpadCenter: "DPAD_CENTER",
+	KeycodeVolumeUp: "VOLUME_UP", KeycodeVolumeDown: "VOLUME_DOWN", KeycodePower: "POWER",
+	KeycodeCamera: "CAMERA", KeycodeClear: "CLEAR",
+	KeycodeA: "A", KeycodeB: "B", KeycodeC: "C", KeycodeD: "D", KeycodeE: "E", KeycodeF: "F",
+	KeycodeG: "G", KeycodeH: "H", KeycodeI: "I", KeycodeJ: "J", KeycodeK: "K", KeycodeL: "L",
+	KeycodeM: "M", KeycodeN: "N", KeycodeO: "O", KeycodeP: "P", KeycodeQ: "Q", KeycodeR: "R",
+	KeycodeS: "S", KeycodeT: "T", KeycodeU: "U", KeycodeV: "V", KeycodeW: "W", KeycodeX: "X",
+	KeycodeY: "Y", KeycodeZ: "Z",
+	KeycodeComma: "COMMA", KeycodePeriod: "PERIOD", KeycodeAltLeft: "ALT_LEFT", KeycodeAltRight: "ALT_RIGHT",
+	KeycodeShiftLeft: "SHIFT_LEFT", KeycodeShiftRight: "SHIFT_RIGHT", KeycodeTab: "TAB", KeycodeSpace: "SPACE",
+	KeycodeEnter: "ENTER", KeycodeDel: "DEL", KeycodeMenu: "MENU", KeycodeNotification: "NOTIFICATION",
+	KeycodeSearch: "SEARCH", KeycodeMediaPlayPause: "MEDIA_PLAY_PAUSE", KeycodeMediaStop: "MEDIA_STOP",
+	KeycodeMediaNext: "MEDIA_NEXT", KeycodeMediaPrevious: "MEDIA_PREVIOUS", KeycodeMute: "MUTE",
+	KeycodePageUp: "PAGE_UP", KeycodePageDown: "PAGE_DOWN", KeycodeEscape: "ESCAPE",
+	KeycodeForwardDel: "FORWARD_DEL", KeycodeCtrlLeft: "CTRL_LEFT", KeycodeCtrlRight: "CTRL_RIGHT",
+	KeycodeMoveHome: "MOVE_HOME", KeycodeMoveEnd: "MOVE_END", KeycodeMediaPlay: "MEDIA_PLAY",
+	KeycodeMediaPause: "MEDIA_PAUSE", KeycodeVolumeMute: "VOLUME_MUTE", KeycodeAppSwitch: "APP_SWITCH",
+	KeycodeBrightnessDown: "BRIGHTNESS_DOWN", KeycodeBrightnessUp: "BRIGHTNESS_UP",
+	KeycodeSleep: "SLEEP", KeycodeWakeup: "WAKEUP", KeycodeSystemNavigationUp: "SYSTEM_NAVIGATION_UP",
+	KeycodeAllApps: "ALL_APPS",
+}
+
+// String returns the name of the key code like Android, eg. KEYCODE_HOME.
+func (k Keycode) String() string {
+	if name, ok := keycodeNames[k]; ok {
+		return "KEYCODE_" + name
+	}
+	return strconv.Itoa(int(k))
+}
@@ -2,10 +2,12 @@ package adb
 
 import (
 	"bytes"
+	"context"
 	"errors"
 	"fmt"
 	"regexp"
 	"strconv"
+	"strings"
 
 	"github.com/Masterminds/semver"
 )
@@ -18,6 +20,10 @@ const (
 	PropProductModel           = "ro.product.model"
 	PropProductManu            = "ro.product.manufacturer"
 	PropProductCpuAbi          = "ro.product.cpu.abi"
+	PropProductCpuAbiList      = "ro.product.cpu.abilist"
+	PropLcdDensity             = "ro.sf.lcd_density"
+	PropSysLocale              = "persist.sys.locale"
+	PropProductLocale          = "ro.product.locale"
 	PropBuildVersionSdk        = "ro.build.version.sdk"         // api level
 	PropProductBuildVersionSdk = "ro.product.build.version.sdk" // api level
 	PropBuildVersionRelease    = "ro.build.version.release"     // android os version
@@ -55,8 +61,8 @@ func parseDeviceProperties(resp []byte, filter PropertiesFilter) map[string]stri
 }
 
 // GetProperties adb shell getprop
-func (d *Device) GetProperties(filter PropertiesFilter) (properties AndroidProperties, err error) {
-	resp, err := d.RunCommand("getprop")
+func (d *Device) GetProperties(ctx context.Context, filter PropertiesFilter) (properties AndroidProperties, err error) {
+	resp, err := d.RunCommand(ctx, "getprop")
 	if err != nil {
 		return
 	}
@@ -68,8 +74,8 @@ func (d *Device) GetProperties(filter PropertiesFilter) (properties AndroidPrope
 	return
 }
 
-func (d *Device) GetProperty(name string) (value string, err error) {
-	resp, err := d.RunCommand("getprop", name)
+func (d *Device) GetProperty(ctx context.Context, name string) (value string, err error) {
+	resp, err := d.RunCommand(ctx, "getprop", name)
 	if err != nil {
 		return
 	}
@@ -77,8 +83,8 @@ func (d *Device) GetProperty(name string) (value string, err error) {
 	return
 }
 
-func (d *Device) BootCompleted() (bool, error) {
-	booted, err := d.GetProperty(PropSysBootCompleted)
+func (d *Device) BootCompleted(ctx context.Context) (bool, error) {
+	booted, err := d.GetProperty(ctx, PropSysBootCompleted)
 	if err != nil {
 		return false, err
 	}
@@ -86,8 +92,8 @@ func (d *Device) BootCompleted() (bool, error) {
 }
 
 // SetProperty adb shell setprop
-func (d *Device) SetProperty(key, value string) (err error) {
-	resp, err := d.RunCommand("setprop", key, value)
+func (d *Device) SetProperty(ctx context.Context, key, value string) (err error) {
+	resp, err := d.RunCommand(ctx, "setprop", key, value)
 	if err != nil {
 		return fmt.Errorf("'setprop %s %s' failed: %w", key, value, err)
 	}
@@ -131,6 +137,43 @@ func (a AndroidProperties) CpuAbi() (string, error) {
 	return a.GetMapValue(PropProductCpuAbi)
 }
 
+// CpuAbiList returns the ABIs supported by the device, preferred first.
+// Devices older than Android 5 only have the primary ABI.
+func (a AndroidProperties) CpuAbiList() ([]string, error) {
+	if list, err := a.GetMapValue(PropProductCpuAbiList); err == nil && list != "" {
+		return strings.Split(list, ","), nil
+	}
+	abi, err := a.CpuAbi()
+	if err != nil {
+		return nil, err
+	}
+	return []string{abi}, nil
+}
+
+// Density returns the screen density in dpi.
+func (a AndroidProperties) Density() (int, error) {
+	v, err := a.GetMapValue(PropLcdDensity)
+	if err != nil {
+		return 0, err
+	}
+	density, err := strconv.Atoi(v)
+	if err != nil {
+		return 0, fmt.Errorf("parse 'getprop %s': %w", PropLcdDensity, err)
+	}
+	return density, nil
+}
+
+// Locale returns the locale of the system as a BCP 47 tag, eg. en-US. Before Android 7
+// the locale may only be in the product properties.
+func (a AndroidProperties) Locale() (string, error) {
+	for _, key := range []string{PropSysLocale, PropProductLocale} {
+		if v, err := a.GetMapValue(key); err == nil && v != "" {
+			return v, nil
+		}
+	}
+	return "", fmt.Errorf("getprop %s: %w", PropSysLocale, ErrNotFound)
+}
+
 func (a AndroidProperties) SdkLevel() (int, error) {
 	sdkstr, err := a.GetMapValue(PropBuildVersionSdk)
 	if err != nil {
@@ -1,6 +1,7 @@
 package adb
 
 import (
+	"context"
 	"fmt"
 	"strings"
 	"testing"
@@ -26,7 +27,7 @@ func Test_parseDeviceProperties(t *testing.T) {
 func TestDevice_GetProperites(t *testing.T) {
 	assert.NotNil(t, adbclient)
 	d := adbclient.Device(AnyDevice())
-	m, err := d.GetProperties(func(k, v string) bool {
+	m, err := d.GetProperties(context.TODO(), func(k, v string) bool {
 		return strings.HasPrefix(k, "ro.")
 	})
 	assert.Nil(t, err)
@@ -62,7 +63,7 @@ func TestDevice_GetProperites(t *testing.T) {
 	assert.Nil(t, err)
 	fmt.Println("serial:", serial)
 
-	booted, err := d.BootCompleted()
+	booted, err := d.BootCompleted(context.TODO())
 	assert.Nil(t, err)
 	fmt.Println("booted:", booted)
 }
@@ -70,7 +71,7 @@ func TestDevice_GetProperites(t *testing.T) {
 func TestDevice_SetProperty(t *testing.T) {
 	assert.NotNil(t, adbclient)
 	d := adbclient.Device(AnyDevice())
-	err := d.SetProperty(PropProductName, "hello")
+	err := d.SetProperty(context.TODO(), PropProductName, "hello")
 	assert.Contains(t, err.Error(), "Failed to set property")
 
 	// err = d.SetProperty("hello.test", "hello")
@@ -0,0 +1,62 @@
+package adb
+
+import (
+	"encoding/binary"
+	"fmt"
+)
+
+// Protobuf wire types, see https://protobuf.dev/programming-guides/encoding/.
+const (
+	protoVarint  = 0
+	protoFixed64 = 1
+	protoBytes   = 2
+	protoFixed32 = 5
+)
+
+// walkProto calls fn for each field of the protobuf message msg, with the value of varint
+// fields or the content of length-delimited ones. Fixed-size fields are skipped.
+func walkProto(msg []byte, fn func(num int, v uint64, data []byte) error) error {
+	for len(msg) > 0 {
+		key, n := binary.Uvarint(msg)
+		if n <= 0 {
+			return fmt.Errorf("bad field key")
+		}
+		msg = msg[n:]
+		num := int(key >> 3)
+
+		switch key & 7 {
+		case protoVarint:
+			v, n := binary.Uvarint(msg)
+			if n <= 0 {
+				return fmt.Errorf("bad varint of field %d", num)
+			}
+			msg = msg[n:]
+			if err := fn(num, v, nil); err != nil {
+				return err
+			}
+		case protoBytes:
+			length, n := binary.Uvarint(msg)
+			if n <= 0 || length > uint64(len(msg)-n) {
+				return fmt.Errorf("bad length of field %d", num)
+			}
+			data := msg[n : n+int(length)]
+			msg = msg[n+int(length):]
+			if err := fn(num, 0, data); err != nil {
+				return err
+			}
+		case protoFixed64:
+			if len(msg) < 8 {
+				return fmt.Errorf("truncated field %d", num)
+			}
+			msg = msg[8:]
+		case protoFixed32:
+			if len(msg) < 4 {
+				return fmt.Errorf("truncated field %d", num)
+			}
+			msg = msg[4:]
+		default:
+			return fmt.Errorf("unsupported wire type %d of field %d", key&7, num)
+		}
+	}
+	return nil
+}
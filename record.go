@@ -0,0 +1,138 @@
+package adb
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+	"time"
+
+	"DomaphoneS-Next/backend/goadb/wire"
+)
+
+// ErrRecordingTruncated is returned by RecordScreen when screenrecord didn't end the stream
+// once interrupted, the recording misses its end.
+var ErrRecordingTruncated = errors.New("recording truncated")
+
+// RecordOptions are the options of RecordScreen, like the ones of screenrecord.
+type RecordOptions struct {
+	// BitRate is the video bit rate in bits per second, 0 is the default of screenrecord, 20 Mbps.
+	BitRate int
+	// Size is the video size, eg. 1280x720. Empty is the size of the display when the
+	// encoder supports it.
+	Size string
+	// DisplayID is the physical display to record, as listed by
+	// `dumpsys SurfaceFlinger --display-id`. Empty records the default display.
+	DisplayID string
+	// Bugreport overlays the time and frame number on the video.
+	Bugreport bool
+	// TimeLimit stops the recording, screenrecord allows up to 3 minutes on older devices.
+	// 0 is the default of screenrecord.
+	TimeLimit time.Duration
+}
+
+// args returns the screenrecord options writing H.264 to stdout.
+func (o RecordOptions) args() []string {
+	args := []string{"--output-format=h264"}
+	if o.BitRate > 0 {
+		args = append(args, "--bit-rate", strconv.Itoa(o.BitRate))
+	}
+	if o.Size != "" {
+		args = append(args, "--size", o.Size)
+	}
+	if o.DisplayID != "" {
+		args = append(args, "--display-id", o.DisplayID)
+	}
+	if o.Bugreport {
+		args = append(args, "--bugreport")
+	}
+	if o.TimeLimit > 0 {
+		// screenrecord takes whole seconds.
+		seconds := int((o.TimeLimit + time.Second - 1) / time.Second)
+		args = append(args, "--time-limit", strconv.Itoa(seconds))
+	}
+	return append(args, "-")
+}
+
+// RecordScreen records the screen with screenrecord and writes the raw H.264 stream to w,
+// until the time limit of opts or ctx is done. The stream is read with the exec: service,
+// so it's byte-exact.
+// When ctx is done, screenrecord is interrupted like with Ctrl-C and the end of the stream
+// is still written: the recording then ends cleanly and nil is returned. If screenrecord
+// doesn't exit within CmdTimeoutShort, the stream is cut and ErrRecordingTruncated returned.
+func (c *Device) RecordScreen(ctx context.Context, w io.Writer, opts RecordOptions) error {
+	// The connection outlives ctx, to read the end of the stream once screenrecord is interrupted.
+	streamCtx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	// The shell prints its pid, screenrecord then replaces it, so it can be interrupted.
+	conn, err := c.openExec(streamCtx, "echo $$; exec screenrecord", opts.args()...)
+	if err != nil {
+		return wrapClientError(err, c, "RecordScreen")
+	}
+	defer conn.Close()
+
+	pids := make(chan int, 1)
+	done := make(chan error, 1)
+	go func() {
+		done <- copyRecording(conn, w, pids)
+	}()
+
+	var pid int
+	select {
+	case pid = <-pids:
+	case err = <-done:
+		return wrapClientError(err, c, "RecordScreen")
+	case <-ctx.Done():
+		return wrapClientError(ctx.Err(), c, "RecordScreen")
+	}
+
+	select {
+	case err = <-done:
+		return wrapClientError(err, c, "RecordScreen")
+	case <-ctx.Done():
+	}
+	if _, err = c.RunCommand(context.Background(), "kill", "-INT", strconv.Itoa(pid)); err != nil {
+		debugLog(fmt.Sprintf("interrupt screenrecord %d: %v", pid, err))
+	}
+	timer := time.NewTimer(c.CmdTimeoutShort)
+	defer timer.Stop()
+	select {
+	case err = <-done:
+		return wrapClientError(err, c, "RecordScreen")
+	case <-timer.C:
+		err = fmt.Errorf("%w: screenrecord %d didn't exit within %s: %w", ErrRecordingTruncated, pid, c.CmdTimeoutShort, ctx.Err())
+		return wrapClientError(err, c, "RecordScreen")
+	}
+}
+
+// copyRecording reads the pid printed before screenrecord starts, sends it to pids and copies
+// the stream to w.
+func copyRecording(conn io.Reader, w io.Writer, pids chan<- int) error {
+	r := bufio.NewReaderSize(conn, wire.SyncMaxChunkSize)
+	line, err := r.ReadString('\n')
+	if err != nil {
+		return fmt.Errorf("screenrecord: %w", err)
+	}
+	pid, err := strconv.Atoi(strings.TrimSpace(line))
+	if err != nil {
+		return fmt.Errorf("%w: screenrecord pid %q", wire.ErrParse, strings.TrimSpace(line))
+	}
+	pids <- pid
+
+	// The stream starts with the start code of a NAL unit, anything else is an error message,
+	// eg. for an invalid option or a device without H.264 output.
+	start, err := r.Peek(3)
+	if err != nil && err != io.EOF {
+		return err
+	}
+	if len(start) < 3 || start[0] != 0 || start[1] != 0 {
+		msg, _ := io.ReadAll(r)
+		return fmt.Errorf("screenrecord: %s", bytes.TrimSpace(msg))
+	}
+	_, err = r.WriteTo(w)
+	return err
+}
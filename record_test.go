@@ -0,0 +1,149 @@
+package adb_test
+
+import (
+	"bytes"
+	"context"
+	"io"
+	"testing"
+	"time"
+
+	adb "DomaphoneS-Next/backend/goadb"
+	"DomaphoneS-Next/backend/goadb/adbtest"
+	"DomaphoneS-Next/backend/goadb/wire"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+var (
+	h264Frame = []byte{0x00, 0x00, 0x00, 0x01, 0x65, 0x88, 0x84}
+	h264End   = []byte{0x00, 0x00, 0x00, 0x01, 0x0b}
+)
+
+// newRecordingDevice serves screenrecord with cmd, which streams frames until it's
+// interrupted with kill -INT and then ends the stream.
+func newRecordingDevice(t *testing.T, cmd string) (*adb.Device, chan struct{}) {
+	interrupted := make(chan struct{})
+	dev := adbtest.NewDevice("emulator-5554")
+	dev.HandleShell(cmd, func(cmd string, stdin io.Reader, stdout, stderr io.Writer) int {
+		io.WriteString(stdout, "4242\n")
+		for {
+			stdout.Write(h264Frame)
+			select {
+			case <-interrupted:
+				stdout.Write(h264End)
+				return 0
+			case <-time.After(5 * time.Millisecond):
+			}
+		}
+	})
+	dev.HandleShell("kill -INT 4242", func(cmd string, stdin io.Reader, stdout, stderr io.Writer) int {
+		close(interrupted)
+		return 0
+	})
+	_, client := newTestClient(t, dev)
+	return client.Device(adb.AnyDevice()), interrupted
+}
+
+func TestRecordScreen(t *testing.T) {
+	d, interrupted := newRecordingDevice(t, "echo $$; exec screenrecord --output-format=h264 "+
+		"--bit-rate 4000000 --size 1280x720 --display-id 1 --bugreport --time-limit 2 -")
+
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	var video bytes.Buffer
+	opts := adb.RecordOptions{
+		BitRate:   4000000,
+		Size:      "1280x720",
+		DisplayID: "1",
+		Bugreport: true,
+		TimeLimit: 1500 * time.Millisecond,
+	}
+	require.NoError(t, d.RecordScreen(ctx, &video, opts))
+
+	select {
+	case <-interrupted:
+	default:
+		t.Fatal("screenrecord wasn't interrupted")
+	}
+	assert.True(t, bytes.HasPrefix(video.Bytes(), h264Frame))
+	assert.True(t, bytes.HasSuffix(video.Bytes(), h264End), "the end of the stream is written")
+}
+
+func TestRecordScreen_TimeLimit(t *testing.T) {
+	dev := adbtest.NewDevice("emulator-5554")
+	dev.HandleShell("echo $$; exec screenrecord --output-format=h264 --time-limit 1 -",
+		func(cmd string, stdin io.Reader, stdout, stderr io.Writer) int {
+			io.WriteString(stdout, "4242\n")
+			stdout.Write(h264Frame)
+			stdout.Write(h264End)
+			return 0
+		})
+	_, client := newTestClient(t, dev)
+
+	var video bytes.Buffer
+	err := client.Device(adb.AnyDevice()).RecordScreen(context.Background(), &video, adb.RecordOptions{TimeLimit: time.Second})
+	require.NoError(t, err)
+	assert.Equal(t, append(append([]byte(nil), h264Frame...), h264End...), video.Bytes())
+}
+
+func TestRecordScreen_Error(t *testing.T) {
+	dev := adbtest.NewDevice("emulator-5554")
+	dev.HandleShell("echo $$; exec screenrecord --output-format=h264 --display-id 7 -",
+		func(cmd string, stdin io.Reader, stdout, stderr io.Writer) int {
+			io.WriteString(stdout, "4242\n")
+			io.WriteString(stderr, "ERROR: no display with id 7\n")
+			return 1
+		})
+	_, client := newTestClient(t, dev)
+
+	var video bytes.Buffer
+	err := client.Device(adb.AnyDevice()).RecordScreen(context.Background(), &video, adb.RecordOptions{DisplayID: "7"})
+	assert.ErrorContains(t, err, "screenrecord: ERROR: no display with id 7")
+	assert.Zero(t, video.Len())
+}
+
+func TestRecordScreen_Truncated(t *testing.T) {
+	dev := adbtest.NewDevice("emulator-5554")
+	dev.HandleShell("echo $$; exec screenrecord --output-format=h264 -",
+		func(cmd string, stdin io.Reader, stdout, stderr io.Writer) int {
+			io.WriteString(stdout, "4242\n")
+			// Ignores SIGINT, until the client is gone.
+			for i := 0; i < 1000; i++ {
+				if _, err := stdout.Write(h264Frame); err != nil {
+					break
+				}
+				time.Sleep(5 * time.Millisecond)
+			}
+			return 0
+		})
+	dev.HandleShell("kill -INT 4242", func(cmd string, stdin io.Reader, stdout, stderr io.Writer) int {
+		return 0
+	})
+	_, client := newTestClient(t, dev)
+	d := client.Device(adb.AnyDevice())
+	d.CmdTimeoutShort = 50 * time.Millisecond
+
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	var video bytes.Buffer
+	err := d.RecordScreen(ctx, &video, adb.RecordOptions{})
+	assert.ErrorIs(t, err, adb.ErrRecordingTruncated)
+	assert.ErrorIs(t, err, context.DeadlineExceeded)
+}
+
+func TestRecordScreen_BadPid(t *testing.T) {
+	dev := adbtest.NewDevice("emulator-5554")
+	dev.HandleShell("echo $$; exec screenrecord --output-format=h264 -",
+		func(cmd string, stdin io.Reader, stdout, stderr io.Writer) int {
+			io.WriteString(stdout, "WARNING: linker: unused DT entry\n")
+			stdout.Write(h264Frame)
+			return 0
+		})
+	_, client := newTestClient(t, dev)
+
+	var video bytes.Buffer
+	err := client.Device(adb.AnyDevice()).RecordScreen(context.Background(), &video, adb.RecordOptions{})
+	assert.ErrorIs(t, err, wire.ErrParse)
+	assert.Zero(t, video.Len())
+}
@@ -0,0 +1,203 @@
+package adb
+
+import (
+	"bytes"
+	"context"
+	"encoding/binary"
+	"fmt"
+	"image"
+	"image/png"
+	"io"
+
+	"DomaphoneS-Next/backend/goadb/wire"
+)
+
+// ScreenshotOptions are the options of Screenshot.
+type ScreenshotOptions struct {
+	// DisplayID is the physical display to capture on multi-display devices, as listed by
+	// `dumpsys SurfaceFlinger --display-id`. Empty captures the default display.
+	// Only screencap can capture another display, the framebuffer service is skipped.
+	DisplayID string
+	// Screencap skips the framebuffer service and always runs screencap.
+	Screencap bool
+}
+
+// Screenshot captures the screen and returns it decoded and as PNG.
+// The framebuffer: service sends the raw pixels, which is faster than screencap encoding a
+// PNG on the device. Devices whose framebuffer can't be read, or with a pixel format not
+// known here, fall back to `screencap -p`, read with ExecOut so it isn't mangled.
+func (c *Device) Screenshot(ctx context.Context, opts ScreenshotOptions) (image.Image, []byte, error) {
+	if opts.DisplayID == "" && !opts.Screencap {
+		img, err := c.readFramebuffer(ctx)
+		if err == nil {
+			var buf bytes.Buffer
+			if err = png.Encode(&buf, img); err != nil {
+				return nil, nil, err
+			}
+			return img, buf.Bytes(), nil
+		}
+		if ctx.Err() != nil {
+			return nil, nil, wrapClientError(contextError(ctx, err), c, "Screenshot")
+		}
+		debugLog(fmt.Sprintf("framebuffer: %v, falling back to screencap", err))
+	}
+
+	args := []string{"-p"}
+	if opts.DisplayID != "" {
+		args = []string{"-d", opts.DisplayID, "-p"}
+	}
+	out, err := c.ExecOut(ctx, "screencap", args...)
+	if err != nil {
+		return nil, nil, err
+	}
+	defer out.Close()
+	data, err := io.ReadAll(out)
+	if err != nil {
+		return nil, nil, wrapClientError(contextError(ctx, err), c, "Screenshot")
+	}
+	img, err := png.Decode(bytes.NewReader(data))
+	if err != nil {
+		// screencap prints its errors instead of the PNG, eg. for an unknown display.
+		return nil, nil, wrapClientError(fmt.Errorf("%w: screencap: %s", wire.ErrParse, bytes.TrimSpace(data)), c, "Screenshot")
+	}
+	return img, data, nil
+}
+
+// framebufferHeader is the header sent by the framebuffer: service, see adbd's
+// framebuffer_service.cpp. Version 1 has no ColorSpace, the legacy version 16 is RGB 565
+// with only Size, Width and Height.
+type framebufferHeader struct {
+	Version    uint32
+	Bpp        uint32
+	ColorSpace uint32
+	Size       uint32
+	Width      uint32
+	Height     uint32
+	// The channels, in this order on the wire.
+	RedOffset, RedLength     uint32
+	BlueOffset, BlueLength   uint32
+	GreenOffset, GreenLength uint32
+	AlphaOffset, AlphaLength uint32
+}
+
+// readFramebuffer reads the screen with the framebuffer: service.
+func (c *Device) readFramebuffer(ctx context.Context) (image.Image, error) {
+	conn, err := c.openService(ctx, "framebuffer:")
+	if err != nil {
+		return nil, err
+	}
+	defer conn.Close()
+
+	h, err := readFramebufferHeader(conn)
+	if err != nil {
+		return nil, err
+	}
+	// Old adbd waits for a byte before sending the pixels, like ddmlib's nudge.
+	if _, err = conn.Write([]byte{0}); err != nil {
+		return nil, err
+	}
+	if err = h.check(); err != nil {
+		return nil, err
+	}
+	pixels := make([]byte, h.Size)
+	if _, err = io.ReadFull(conn, pixels); err != nil {
+		return nil, err
+	}
+	return decodeFramebuffer(h, pixels)
+}
+
+// maxFramebufferSide bounds the width and height of a framebuffer, well above 8K screens,
+// so that a corrupt header doesn't allocate gigabytes.
+const maxFramebufferSide = 16384
+
+// check tells whether the header describes pixels that can be allocated and decoded.
+func (h framebufferHeader) check() error {
+	if h.Bpp != 16 && h.Bpp != 24 && h.Bpp != 32 {
+		return fmt.Errorf("%w: framebuffer of %d bpp", wire.ErrNotSupported, h.Bpp)
+	}
+	if h.Width == 0 || h.Height == 0 || h.Width > maxFramebufferSide || h.Height > maxFramebufferSide {
+		return fmt.Errorf("%w: framebuffer of %dx%d", wire.ErrParse, h.Width, h.Height)
+	}
+	if uint64(h.Size) != uint64(h.Width)*uint64(h.Height)*uint64(h.Bpp/8) {
+		return fmt.Errorf("%w: framebuffer of %d bytes for %dx%d at %d bpp", wire.ErrParse, h.Size, h.Width, h.Height, h.Bpp)
+	}
+	return nil
+}
+
+func readFramebufferHeader(r io.Reader) (h framebufferHeader, err error) {
+	if err = binary.Read(r, binary.LittleEndian, &h.Version); err != nil {
+		return
+	}
+	var fields []*uint32
+	switch h.Version {
+	case 16:
+		h.Bpp = 16
+		h.RedOffset, h.RedLength = 11, 5
+		h.GreenOffset, h.GreenLength = 5, 6
+		h.BlueOffset, h.BlueLength = 0, 5
+		fields = []*uint32{&h.Size, &h.Width, &h.Height}
+	case 1, 2:
+		fields = []*uint32{&h.Bpp}
+		if h.Version == 2 {
+			fields = append(fields, &h.ColorSpace)
+		}
+		fields = append(fields, &h.Size, &h.Width, &h.Height,
+			&h.RedOffset, &h.RedLength, &h.BlueOffset, &h.BlueLength,
+			&h.GreenOffset, &h.GreenLength, &h.AlphaOffset, &h.AlphaLength)
+	default:
+		return h, fmt.Errorf("%w: framebuffer version %d", wire.ErrNotSupported, h.Version)
+	}
+	for _, f := range fields {
+		if err = binary.Read(r, binary.LittleEndian, f); err != nil {
+			return
+		}
+	}
+	return
+}
+
+// decodeFramebuffer converts the little-endian pixels described by h, eg. RGBA_8888,
+// RGBX_8888, RGB_888, RGB_565 or BGRA_8888.
+// h is checked already.
+func decodeFramebuffer(h framebufferHeader, pixels []byte) (image.Image, error) {
+	for _, length := range []uint32{h.RedLength, h.GreenLength, h.BlueLength, h.AlphaLength} {
+		if length > 8 {
+			return nil, fmt.Errorf("%w: framebuffer channel of %d bits", wire.ErrNotSupported, length)
+		}
+	}
+	img := image.NewNRGBA(image.Rect(0, 0, int(h.Width), int(h.Height)))
+	n := int(h.Width * h.Height)
+
+	// RGBA_8888 is the memory layout of NRGBA.
+	if h.Bpp == 32 && h.RedOffset == 0 && h.GreenOffset == 8 && h.BlueOffset == 16 &&
+		h.AlphaOffset == 24 && h.AlphaLength == 8 {
+		copy(img.Pix, pixels[:n*4])
+		return img, nil
+	}
+
+	step := int(h.Bpp / 8)
+	for i := 0; i < n; i++ {
+		var v uint32
+		for b := 0; b < step; b++ {
+			v |= uint32(pixels[i*step+b]) << (8 * b)
+		}
+		p := img.Pix[i*4 : i*4+4]
+		p[0] = channel(v, h.RedOffset, h.RedLength)
+		p[1] = channel(v, h.GreenOffset, h.GreenLength)
+		p[2] = channel(v, h.BlueOffset, h.BlueLength)
+		// RGBX and formats without alpha are opaque.
+		p[3] = 0xff
+		if h.AlphaLength > 0 {
+			p[3] = channel(v, h.AlphaOffset, h.AlphaLength)
+		}
+	}
+	return img, nil
+}
+
+// channel extracts the channel of length bits at offset from v, scaled to 8 bits.
+func channel(v, offset, length uint32) uint8 {
+	if length == 0 {
+		return 0
+	}
+	max := uint32(1)<<length - 1
+	return uint8((v >> offset & max) * 0xff / max)
+}
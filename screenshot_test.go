@@ -0,0 +1,153 @@
+package adb_test
+
+import (
+	"bytes"
+	"context"
+	"encoding/binary"
+	"image"
+	"image/color"
+	"image/png"
+	"io"
+	"testing"
+
+	adb "DomaphoneS-Next/backend/goadb"
+	"DomaphoneS-Next/backend/goadb/adbtest"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// framebufferService serves framebuffer: with header, then pixels once the nudge byte is read.
+func framebufferService(header []uint32, pixels []byte) adbtest.ServiceFunc {
+	return func(service string, rw io.ReadWriter) {
+		binary.Write(rw, binary.LittleEndian, header)
+		io.ReadFull(rw, make([]byte, 1))
+		rw.Write(pixels)
+	}
+}
+
+func TestScreenshot_Framebuffer(t *testing.T) {
+	// A 2x1 screen: an orange pixel and a half transparent blue one.
+	want := []color.NRGBA{{0xff, 0x80, 0x00, 0xff}, {0x00, 0x00, 0xff, 0x80}}
+	tests := []struct {
+		name   string
+		header []uint32
+		pixels []byte
+		want   []color.NRGBA
+	}{
+		{
+			name:   "RGBA_8888",
+			header: []uint32{2, 32, 0, 8, 2, 1, 0, 8, 16, 8, 8, 8, 24, 8},
+			pixels: []byte{0xff, 0x80, 0x00, 0xff, 0x00, 0x00, 0xff, 0x80},
+			want:   want,
+		},
+		{
+			name:   "BGRA_8888",
+			header: []uint32{1, 32, 8, 2, 1, 16, 8, 0, 8, 8, 8, 24, 8},
+			pixels: []byte{0x00, 0x80, 0xff, 0xff, 0xff, 0x00, 0x00, 0x80},
+			want:   want,
+		},
+		{
+			name:   "RGBX_8888",
+			header: []uint32{2, 32, 0, 8, 2, 1, 0, 8, 16, 8, 8, 8, 24, 0},
+			pixels: []byte{0xff, 0x80, 0x00, 0x00, 0x00, 0x00, 0xff, 0x00},
+			want:   []color.NRGBA{{0xff, 0x80, 0x00, 0xff}, {0x00, 0x00, 0xff, 0xff}},
+		},
+		{
+			name:   "RGB_565",
+			header: []uint32{1, 16, 4, 2, 1, 11, 5, 0, 5, 5, 6, 0, 0},
+			pixels: []byte{0x00, 0xf8, 0x1f, 0x00},
+			want:   []color.NRGBA{{0xff, 0x00, 0x00, 0xff}, {0x00, 0x00, 0xff, 0xff}},
+		},
+		{
+			name:   "legacy",
+			header: []uint32{16, 4, 2, 1},
+			pixels: []byte{0xe0, 0x07, 0xff, 0xff},
+			want:   []color.NRGBA{{0x00, 0xff, 0x00, 0xff}, {0xff, 0xff, 0xff, 0xff}},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			dev := adbtest.NewDevice("emulator-5554")
+			dev.HandleService("framebuffer:", framebufferService(tt.header, tt.pixels))
+			_, client := newTestClient(t, dev)
+
+			img, data, err := client.Device(adb.AnyDevice()).Screenshot(context.Background(), adb.ScreenshotOptions{})
+			require.NoError(t, err)
+			assert.Equal(t, image.Rect(0, 0, 2, 1), img.Bounds())
+			for x, c := range tt.want {
+				assert.Equal(t, c, color.NRGBAModel.Convert(img.At(x, 0)), "pixel %d", x)
+			}
+			decoded, err := png.Decode(bytes.NewReader(data))
+			require.NoError(t, err)
+			assert.Equal(t, img.Bounds(), decoded.Bounds())
+		})
+	}
+}
+
+func encodePNG(t *testing.T) []byte {
+	img := image.NewNRGBA(image.Rect(0, 0, 3, 2))
+	img.Set(1, 1, color.NRGBA{0x10, 0x20, 0x30, 0xff})
+	var buf bytes.Buffer
+	require.NoError(t, png.Encode(&buf, img))
+	return buf.Bytes()
+}
+
+func TestScreenshot_Screencap(t *testing.T) {
+	ctx := context.Background()
+	screen := encodePNG(t)
+	dev := adbtest.NewDevice("emulator-5554")
+	// No framebuffer: service, screencap is the fallback.
+	dev.HandleShell("screencap -p", func(cmd string, stdin io.Reader, stdout, stderr io.Writer) int {
+		stdout.Write(screen)
+		return 0
+	})
+	dev.HandleShell("screencap -d 4619827259835644672 -p", func(cmd string, stdin io.Reader, stdout, stderr io.Writer) int {
+		stdout.Write(screen)
+		return 0
+	})
+	dev.HandleShell("screencap -d 42 -p", func(cmd string, stdin io.Reader, stdout, stderr io.Writer) int {
+		io.WriteString(stderr, "Display Id '42' is not valid.\n")
+		return 1
+	})
+	_, client := newTestClient(t, dev)
+	d := client.Device(adb.AnyDevice())
+
+	img, data, err := d.Screenshot(ctx, adb.ScreenshotOptions{})
+	require.NoError(t, err)
+	assert.Equal(t, screen, data)
+	assert.Equal(t, color.NRGBA{0x10, 0x20, 0x30, 0xff}, color.NRGBAModel.Convert(img.At(1, 1)))
+
+	_, data, err = d.Screenshot(ctx, adb.ScreenshotOptions{DisplayID: "4619827259835644672"})
+	require.NoError(t, err)
+	assert.Equal(t, screen, data)
+
+	_, _, err = d.Screenshot(ctx, adb.ScreenshotOptions{DisplayID: "42"})
+	assert.ErrorContains(t, err, "Display Id '42' is not valid.")
+}
+
+func TestScreenshot_CorruptFramebuffer(t *testing.T) {
+	screen := encodePNG(t)
+	for name, header := range map[string][]uint32{
+		// 65536*65536*4 is 0 in 32 bits.
+		"overflow": {1, 32, 16, 65536, 65536, 0, 8, 16, 8, 8, 8, 24, 8},
+		"huge":     {1, 32, 1 << 31, 1 << 15, 1 << 14, 0, 8, 16, 8, 8, 8, 24, 8},
+		"size":     {1, 32, 12, 2, 1, 0, 8, 16, 8, 8, 8, 24, 8},
+		"bpp":      {1, 8, 2, 2, 1, 0, 2, 2, 2, 4, 2, 6, 2},
+	} {
+		t.Run(name, func(t *testing.T) {
+			dev := adbtest.NewDevice("emulator-5554")
+			dev.HandleService("framebuffer:", framebufferService(header, make([]byte, 16)))
+			dev.HandleShell("screencap -p", func(cmd string, stdin io.Reader, stdout, stderr io.Writer) int {
+				stdout.Write(screen)
+				return 0
+			})
+			_, client := newTestClient(t, dev)
+
+			// screencap is the fallback.
+			_, data, err := client.Device(adb.AnyDevice()).Screenshot(context.Background(), adb.ScreenshotOptions{})
+			require.NoError(t, err)
+			assert.Equal(t, screen, data)
+		})
+	}
+}
@@ -1,10 +1,13 @@
 package adb
 
 import (
+	"context"
 	"errors"
 	"fmt"
+	"net"
 	"os"
 	"os/exec"
+	"strconv"
 	"strings"
 	"time"
 
@@ -17,6 +20,10 @@ const (
 	// Default port the adb server listens on.
 	AdbPort            = 5037
 	DialTimeoutDefault = time.Second * 3
+
+	// startServerTimeout bounds adb start-server when Dial starts the server, a cold start
+	// takes seconds.
+	startServerTimeout = time.Minute
 )
 
 type ServerConfig struct {
@@ -29,61 +36,63 @@ type ServerConfig struct {
 	// Host and port the adb server is listening on. If not specified, will use the default port on localhost.
 	Host string
 	Port int
-	fs   *filesystem
+	// Socket is the socket spec of the server, like the -L option of adb: tcp:port, tcp:host:port,
+	// localfilesystem:/path or localabstract:name. It overrides Host and Port.
+	// If Socket, Host and Port are all empty, the ADB_SERVER_SOCKET and ANDROID_ADB_SERVER_PORT
+	// environment variables are honored like adb does.
+	Socket string
+	fs     *filesystem
 }
 
 // Server knows how to start the adb server and connect to it.
 type server interface {
-	Start() error
-	Dial() (wire.IConn, error)
+	Start(ctx context.Context) error
+	Dial(ctx context.Context) (wire.IConn, error)
 }
 
-func roundTripSingleResponse(s server, req string) (resp []byte, err error) {
-	return roundTripSingleResponseTimeout(s, req, time.Second)
+// roundTripSingleResponse sends req to the server and reads a single response.
+// If ctx has no deadline, CommandTimeoutShortDefault is used.
+func roundTripSingleResponse(ctx context.Context, s server, req string) (resp []byte, err error) {
+	return roundTripSingleResponseTimeout(ctx, s, req, CommandTimeoutShortDefault)
 }
 
-func roundTripSingleResponseTimeout(s server, req string, timeout time.Duration) (resp []byte, err error) {
-	conn, err := s.Dial()
+// roundTripSingleResponseTimeout is roundTripSingleResponse with timeout
+// as the default for requests that take longer, like host:connect.
+func roundTripSingleResponseTimeout(ctx context.Context, s server, req string, timeout time.Duration) (resp []byte, err error) {
+	ctx, cancel := withDefaultTimeout(ctx, timeout)
+	defer cancel()
+
+	conn, err := dialServer(ctx, s)
 	if err != nil {
 		return
 	}
 	defer conn.Close()
 
-	if err = conn.SetReadDeadline(time.Now().Add(timeout)); err != nil {
-		return
-	}
-	if resp, err = conn.RoundTripSingleResponse([]byte(req)); err != nil {
-		return
-	}
-	if err = conn.SetReadDeadline(time.Time{}); err != nil {
-		return
-	}
-	return
+	return conn.RoundTripSingleResponse([]byte(req))
 }
 
 type realServer struct {
 	config ServerConfig
 
-	// Caches Host:Port so they don't have to be concatenated for every dial.
+	// Caches Host:Port so they don't have to be concatenated for every dial,
+	// or the socket spec of unix socket servers.
 	address string
 }
 
 func newServer(config ServerConfig) (server, error) {
 	if config.Dialer == nil {
-		config.Dialer = tcpDialer{}
-	}
-
-	if config.Host == "" {
-		config.Host = "127.0.0.1"
-	}
-	if config.Port == 0 {
-		config.Port = AdbPort
+		config.Dialer = netDialer{}
 	}
 
 	if config.fs == nil {
 		config.fs = localFilesystem
 	}
 
+	address, err := resolveServerAddress(&config)
+	if err != nil {
+		return nil, err
+	}
+
 	if config.DialTimeout == 0 {
 		config.DialTimeout = DialTimeoutDefault
 	}
@@ -101,24 +110,79 @@ func newServer(config ServerConfig) (server, error) {
 
 	return &realServer{
 		config:  config,
-		address: fmt.Sprintf("%s:%d", config.Host, config.Port),
+		address: address,
 	}, nil
 }
 
+// resolveServerAddress fills Host and Port of config from its Socket, or from the environment,
+// and returns the address to dial.
+func resolveServerAddress(config *ServerConfig) (string, error) {
+	if config.Socket == "" && config.Host == "" && config.Port == 0 {
+		config.Socket = config.fs.getenv("ADB_SERVER_SOCKET")
+	}
+
+	switch {
+	case config.Socket == "":
+	case strings.HasPrefix(config.Socket, socketSpecTCP):
+		host, port, err := parseTCPSocketSpec(config.Socket)
+		if err != nil {
+			return "", err
+		}
+		if port == 0 {
+			return "", fmt.Errorf("%w: no port in adb server socket %s", wire.ErrParse, config.Socket)
+		}
+		config.Host, config.Port = host, port
+	default:
+		if _, ok := unixSocketPath(config.Socket); !ok {
+			return "", fmt.Errorf("%w: unsupported adb server socket %s", wire.ErrServerNotAvailable, config.Socket)
+		}
+		return config.Socket, nil
+	}
+
+	if config.Host == "" {
+		config.Host = "127.0.0.1"
+	}
+	if config.Port == 0 {
+		config.Port = AdbPort
+		if env := config.fs.getenv("ANDROID_ADB_SERVER_PORT"); env != "" {
+			port, err := strconv.Atoi(env)
+			if err != nil || port <= 0 || port > 65535 {
+				return "", fmt.Errorf("%w: invalid ANDROID_ADB_SERVER_PORT %q", wire.ErrParse, env)
+			}
+			config.Port = port
+		}
+	}
+	return net.JoinHostPort(config.Host, strconv.Itoa(config.Port)), nil
+}
+
 // Dial tries to connect to the server. If the first attempt fails, tries starting the server before
 // retrying. If the second attempt fails, returns the error.
-func (s *realServer) Dial() (wire.IConn, error) {
-	conn, err := s.config.Dial(s.address, s.config.DialTimeout)
+// Each attempt is bound by DialTimeout and the deadline of ctx. The server start isn't, ctx
+// usually has the deadline of a command, killing adb mid-start would leave no server: Dial
+// returns when ctx is done and lets adb finish starting it for the next call.
+func (s *realServer) Dial(ctx context.Context) (wire.IConn, error) {
+	conn, err := s.dial(ctx)
 	if err != nil {
 		if !s.config.AutoStart {
 			return nil, err
 		}
 		// Attempt to start the server and try again.
-		if err = s.Start(); err != nil {
+		started := make(chan error, 1)
+		go func() {
+			startCtx, cancel := context.WithTimeout(context.Background(), startServerTimeout)
+			defer cancel()
+			started <- s.Start(startCtx)
+		}()
+		select {
+		case err = <-started:
+		case <-ctx.Done():
+			return nil, fmt.Errorf("%w: starting server for dial: %w", wire.ErrServerNotAvailable, ctx.Err())
+		}
+		if err != nil {
 			return nil, fmt.Errorf("%w: error starting server for dial, err:%w", wire.ErrServerNotAvailable, err)
 		}
 
-		conn, err = s.config.Dial(s.address, s.config.DialTimeout)
+		conn, err = s.dial(ctx)
 		if err != nil {
 			return nil, err
 		}
@@ -126,9 +190,15 @@ func (s *realServer) Dial() (wire.IConn, error) {
 	return conn, nil
 }
 
-// StartServer ensures there is a server running.
-func (s *realServer) Start() error {
-	output, err := s.config.fs.CmdCombinedOutput(s.config.PathToAdb /*"-L", fmt.Sprintf("tcp:%s", s.address),*/, "start-server")
+func (s *realServer) dial(ctx context.Context) (*wire.Conn, error) {
+	ctx, cancel := context.WithTimeout(ctx, s.config.DialTimeout)
+	defer cancel()
+	return s.config.Dial(ctx, s.address)
+}
+
+// StartServer ensures there is a server running on the configured socket.
+func (s *realServer) Start(ctx context.Context) error {
+	output, err := s.config.fs.CmdCombinedOutput(ctx, s.config.PathToAdb, "-L", s.socketSpec(), "start-server")
 	outputStr := strings.TrimSpace(string(output))
 	if err != nil {
 		return fmt.Errorf("%w: error starting server: %w\noutput:\n%s", wire.ErrServerNotAvailable, err, outputStr)
@@ -136,6 +206,14 @@ func (s *realServer) Start() error {
 	return nil
 }
 
+// socketSpec returns the socket spec of the server for the -L option of adb.
+func (s *realServer) socketSpec() string {
+	if _, ok := unixSocketPath(s.address); ok {
+		return s.address
+	}
+	return socketSpecTCP + s.address
+}
+
 // filesystem abstracts interactions with the local filesystem for testability.
 type filesystem struct {
 	// Wraps exec.LookPath.
@@ -144,8 +222,18 @@ type filesystem struct {
 	// Returns nil if path is a regular file and executable by the current user.
 	IsExecutableFile func(path string) error
 
-	// Wraps exec.Command().CombinedOutput()
-	CmdCombinedOutput func(name string, arg ...string) ([]byte, error)
+	// Wraps exec.CommandContext().CombinedOutput()
+	CmdCombinedOutput func(ctx context.Context, name string, arg ...string) ([]byte, error)
+
+	// Wraps os.Getenv, the environment is empty if nil.
+	Getenv func(key string) string
+}
+
+func (fs *filesystem) getenv(key string) string {
+	if fs.Getenv == nil {
+		return ""
+	}
+	return fs.Getenv(key)
 }
 
 var localFilesystem = &filesystem{
@@ -160,7 +248,8 @@ var localFilesystem = &filesystem{
 		}
 		return isExecutable(path)
 	},
-	CmdCombinedOutput: func(name string, arg ...string) ([]byte, error) {
-		return exec.Command(name, arg...).CombinedOutput()
+	CmdCombinedOutput: func(ctx context.Context, name string, arg ...string) ([]byte, error) {
+		return exec.CommandContext(ctx, name, arg...).CombinedOutput()
 	},
+	Getenv: os.Getenv,
 }
@@ -2,6 +2,7 @@ package adb
 
 import (
 	"bytes"
+	"context"
 	"io"
 	"net"
 	"strings"
@@ -38,7 +39,7 @@ var _ server = &MockServer{
 	},
 }
 
-func (s *MockServer) Dial() (wire.IConn, error) {
+func (s *MockServer) Dial(ctx context.Context) (wire.IConn, error) {
 	s.logMethod("Dial")
 	if err := s.getNextErrToReturn(); err != nil {
 		return nil, err
@@ -46,7 +47,7 @@ func (s *MockServer) Dial() (wire.IConn, error) {
 	return s, nil
 }
 
-func (s *MockServer) Start() error {
+func (s *MockServer) Start(ctx context.Context) error {
 	s.logMethod("Start")
 	return nil
 }
@@ -1,7 +1,10 @@
 package adb
 
 import (
+	"context"
 	"fmt"
+	"net"
+	"path/filepath"
 	"testing"
 	"time"
 
@@ -29,7 +32,7 @@ func TestNewServer_ZeroConfig(t *testing.T) {
 	serverIf, err := newServer(config)
 	server := serverIf.(*realServer)
 	assert.NoError(t, err)
-	assert.IsType(t, tcpDialer{}, server.config.Dialer)
+	assert.IsType(t, netDialer{}, server.config.Dialer)
 	assert.Equal(t, "127.0.0.1", server.config.Host)
 	assert.Equal(t, AdbPort, server.config.Port)
 	assert.Equal(t, fmt.Sprintf("127.0.0.1:%d", AdbPort), server.address)
@@ -38,7 +41,7 @@ func TestNewServer_ZeroConfig(t *testing.T) {
 
 type MockDialer struct{}
 
-func (d MockDialer) Dial(address string, timeout time.Duration) (*wire.Conn, error) {
+func (d MockDialer) Dial(ctx context.Context, address string) (*wire.Conn, error) {
 	return nil, nil
 }
 
@@ -78,3 +81,150 @@ func TestNewServer_AdbNotFound(t *testing.T) {
 	_, err := newServer(config)
 	assert.EqualError(t, err, "ServerNotAvailable: could not find adb in PATH")
 }
+
+func newTestFilesystem(env map[string]string) *filesystem {
+	return &filesystem{
+		IsExecutableFile: func(path string) error { return nil },
+		Getenv:           func(key string) string { return env[key] },
+	}
+}
+
+func TestNewServer_Socket(t *testing.T) {
+	for socket, address := range map[string]string{
+		"tcp:5038":                      "127.0.0.1:5038",
+		"tcp:192.168.1.2:5038":          "192.168.1.2:5038",
+		"tcp:[::1]:5038":                "[::1]:5038",
+		"localfilesystem:/tmp/adb.sock": "localfilesystem:/tmp/adb.sock",
+		"localabstract:adb-test-server": "localabstract:adb-test-server",
+	} {
+		serverIf, err := newServer(ServerConfig{PathToAdb: "/bin/adb", Socket: socket, fs: newTestFilesystem(nil)})
+		if assert.NoError(t, err, socket) {
+			assert.Equal(t, address, serverIf.(*realServer).address, socket)
+		}
+	}
+
+	for _, socket := range []string{"tcp:", "tcp:0", "tcp:host:port", "tcp:70000", "vsock:1:5037"} {
+		_, err := newServer(ServerConfig{PathToAdb: "/bin/adb", Socket: socket, fs: newTestFilesystem(nil)})
+		assert.Error(t, err, socket)
+	}
+}
+
+func TestNewServer_Env(t *testing.T) {
+	fs := newTestFilesystem(map[string]string{"ADB_SERVER_SOCKET": "tcp:localhost:5040", "ANDROID_ADB_SERVER_PORT": "5041"})
+	serverIf, err := newServer(ServerConfig{PathToAdb: "/bin/adb", fs: fs})
+	assert.NoError(t, err)
+	assert.Equal(t, "localhost:5040", serverIf.(*realServer).address)
+
+	// The configuration wins over the environment.
+	serverIf, err = newServer(ServerConfig{PathToAdb: "/bin/adb", Port: 5042, fs: fs})
+	assert.NoError(t, err)
+	assert.Equal(t, "127.0.0.1:5042", serverIf.(*realServer).address)
+
+	fs = newTestFilesystem(map[string]string{"ANDROID_ADB_SERVER_PORT": "5041"})
+	serverIf, err = newServer(ServerConfig{PathToAdb: "/bin/adb", fs: fs})
+	assert.NoError(t, err)
+	assert.Equal(t, "127.0.0.1:5041", serverIf.(*realServer).address)
+
+	fs = newTestFilesystem(map[string]string{"ANDROID_ADB_SERVER_PORT": "adb"})
+	_, err = newServer(ServerConfig{PathToAdb: "/bin/adb", fs: fs})
+	assert.ErrorIs(t, err, wire.ErrParse)
+}
+
+func TestRealServer_Start(t *testing.T) {
+	for socket, spec := range map[string]string{
+		"":                              "tcp:127.0.0.1:5037",
+		"tcp:5038":                      "tcp:127.0.0.1:5038",
+		"localfilesystem:/tmp/adb.sock": "localfilesystem:/tmp/adb.sock",
+	} {
+		var args []string
+		fs := newTestFilesystem(nil)
+		fs.CmdCombinedOutput = func(ctx context.Context, name string, arg ...string) ([]byte, error) {
+			args = append([]string{name}, arg...)
+			return nil, nil
+		}
+		serverIf, err := newServer(ServerConfig{PathToAdb: "/bin/adb", Socket: socket, fs: fs})
+		assert.NoError(t, err)
+		assert.NoError(t, serverIf.Start(context.Background()))
+		assert.Equal(t, []string{"/bin/adb", "-L", spec, "start-server"}, args)
+	}
+}
+
+type failingDialer struct{ dials int }
+
+func (d *failingDialer) Dial(ctx context.Context, address string) (*wire.Conn, error) {
+	d.dials++
+	return nil, fmt.Errorf("%w: connection refused", wire.ErrServerNotAvailable)
+}
+
+func TestRealServer_DialAutoStart(t *testing.T) {
+	var startDeadline time.Time
+	fs := newTestFilesystem(nil)
+	fs.CmdCombinedOutput = func(ctx context.Context, name string, arg ...string) ([]byte, error) {
+		startDeadline, _ = ctx.Deadline()
+		return nil, nil
+	}
+	dialer := &failingDialer{}
+	serverIf, err := newServer(ServerConfig{PathToAdb: "/bin/adb", AutoStart: true, Dialer: dialer, fs: fs})
+	assert.NoError(t, err)
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+	deadline, _ := ctx.Deadline()
+	_, err = serverIf.Dial(ctx)
+	assert.ErrorIs(t, err, wire.ErrServerNotAvailable)
+	assert.Equal(t, 2, dialer.dials)
+	// adb start-server isn't bound by the deadline of the command.
+	assert.True(t, startDeadline.After(deadline), "start deadline %v", startDeadline)
+}
+
+func TestRealServer_DialCanceledDuringStart(t *testing.T) {
+	starting := make(chan struct{})
+	release := make(chan struct{})
+	startErr := make(chan error, 1)
+	fs := newTestFilesystem(nil)
+	fs.CmdCombinedOutput = func(ctx context.Context, name string, arg ...string) ([]byte, error) {
+		close(starting)
+		<-release
+		startErr <- ctx.Err()
+		return nil, nil
+	}
+	dialer := &failingDialer{}
+	serverIf, err := newServer(ServerConfig{PathToAdb: "/bin/adb", AutoStart: true, Dialer: dialer, fs: fs})
+	assert.NoError(t, err)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	go func() {
+		<-starting
+		cancel()
+	}()
+	_, err = serverIf.Dial(ctx)
+	assert.ErrorIs(t, err, context.Canceled)
+	assert.ErrorIs(t, err, wire.ErrServerNotAvailable)
+	assert.Equal(t, 1, dialer.dials)
+
+	// The server keeps starting.
+	close(release)
+	assert.NoError(t, <-startErr)
+}
+
+func TestNetDialer_Unix(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "adb.sock")
+	listener, err := net.Listen("unix", path)
+	if err != nil {
+		t.Skip("unix sockets not supported:", err)
+	}
+	defer listener.Close()
+	go func() {
+		conn, err := listener.Accept()
+		if err == nil {
+			conn.Write([]byte("OKAY"))
+			conn.Close()
+		}
+	}()
+
+	conn, err := netDialer{}.Dial(context.Background(), "localfilesystem:"+path)
+	assert.NoError(t, err)
+	defer conn.Close()
+	_, err = conn.ReadStatus("host:version")
+	assert.NoError(t, err)
+}
@@ -9,7 +9,7 @@ import (
 	log "github.com/sirupsen/logrus"
 )
 
-func InitAdb() (cli *adb.Adb, err error) {
+func InitAdb(ctx context.Context) (cli *adb.Adb, err error) {
 	serverConfig := adb.ServerConfig{
 		AutoStart: true,
 		Host:      "127.0.0.1",
@@ -29,7 +29,7 @@ func InitAdb() (cli *adb.Adb, err error) {
 		return
 	}
 
-	err = cli.StartServer()
+	err = cli.StartServer(ctx)
 	if err != nil {
 		log.Errorln(err)
 		return
@@ -38,12 +38,12 @@ func InitAdb() (cli *adb.Adb, err error) {
 }
 
 func Monitor(ctx context.Context, r *gomlib.Registry) (err error) {
-	client, err := InitAdb()
+	client, err := InitAdb(ctx)
 	if err != nil {
 		return
 	}
 
-	watcher := client.NewDeviceWatcher()
+	watcher := client.NewDeviceWatcher(ctx)
 	for event := range watcher.C() {
 		log.Infof("adb-monitor: %+v", event)
 		switch event.NewState {
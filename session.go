@@ -6,6 +6,7 @@ package adb
 
 import (
 	"bytes"
+	"context"
 	"errors"
 	"fmt"
 	"io"
@@ -32,6 +33,7 @@ type Session struct {
 	Stdout io.Writer
 	Stderr io.Writer
 
+	ctx            context.Context
 	transport      *wire.Conn
 	errorChan      chan error
 	abort          bool
@@ -66,12 +68,13 @@ func (w Waitmsg) ExitStatus() int {
 }
 
 // NewSession opens a new Session for this client. (A session is a remote execution of a program.)
-func (d *Device) NewSession() (*Session, error) {
-	conn, err := d.dialDevice(d.CmdTimeoutShort)
+// The session is bound to ctx: cancelling it aborts the running command.
+func (d *Device) NewSession(ctx context.Context) (*Session, error) {
+	conn, err := d.dialDevice(ctx)
 	if err != nil {
 		return nil, fmt.Errorf("failed to create transport: %w", err)
 	}
-	return &Session{transport: conn.(*wire.Conn)}, nil
+	return &Session{ctx: ctx, transport: conn.(*wire.Conn)}, nil
 }
 
 // Close frees resources associated with this Session, and aborts any running command.
@@ -148,7 +151,7 @@ func (s *Session) Start(cmd string) error {
 		return fmt.Errorf("failed to send shell cmd: %w", err)
 	}
 
-	if _, err := readStatusWithTimeout(s.transport, req, CommandTimeoutShortDefault); err != nil {
+	if _, err := readStatusWithTimeout(s.ctx, s.transport, req, CommandTimeoutShortDefault); err != nil {
 		s.transport.Close()
 		return fmt.Errorf("failed to verify shell cmd: %w", err)
 	}
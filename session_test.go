@@ -5,6 +5,7 @@
 package adb_test
 
 import (
+	"context"
 	"fmt"
 	"os"
 	"testing"
@@ -16,7 +17,7 @@ import (
 
 func TestDevice_Session(t *testing.T) {
 	d := adbclient.Device(adb.AnyDevice())
-	session, err := d.NewSession()
+	session, err := d.NewSession(context.TODO())
 	if err != nil {
 		t.Fatal(err)
 	}
@@ -31,7 +32,7 @@ func TestDevice_Session(t *testing.T) {
 
 func TestDevice_SessionNonExistedCommand(t *testing.T) {
 	d := adbclient.Device(adb.AnyDevice())
-	session, err := d.NewSession()
+	session, err := d.NewSession(context.TODO())
 	if err != nil {
 		t.Fatal(err)
 	}
@@ -45,7 +46,7 @@ func TestDevice_SessionNonExistedCommand(t *testing.T) {
 
 func TestDevice_SessionLogcat(t *testing.T) {
 	d := adbclient.Device(adb.AnyDevice())
-	session, err := d.NewSession()
+	session, err := d.NewSession(context.TODO())
 	if err != nil {
 		t.Fatal(err)
 	}
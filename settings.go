@@ -1,6 +1,7 @@
 package adb
 
 import (
+	"context"
 	"strings"
 )
 
@@ -9,9 +10,9 @@ func checkNameValid(name string) bool {
 }
 
 // see: https://stackoverflow.com/questions/16704597/how-do-you-get-the-user-defined-device-name-in-android
-func (d *Device) GetDeviceName() (name string, err error) {
+func (d *Device) GetDeviceName(ctx context.Context) (name string, err error) {
 	// fist try
-	resp, err := d.RunCommand("settings get global device_name")
+	resp, err := d.RunCommand(ctx, "settings get global device_name")
 	if err != nil {
 		return
 	}
@@ -21,7 +22,7 @@ func (d *Device) GetDeviceName() (name string, err error) {
 	}
 
 	// try again
-	resp, err = d.RunCommand("settings get secure bluetooth_name")
+	resp, err = d.RunCommand(ctx, "settings get secure bluetooth_name")
 	if err != nil {
 		return
 	}
@@ -31,17 +32,17 @@ func (d *Device) GetDeviceName() (name string, err error) {
 	}
 
 	// final try
-	name, err = d.GetProperty(PropProductName)
+	name, err = d.GetProperty(ctx, PropProductName)
 	return
 }
 
-func (d *Device) SetAccelerometerRotation(enable bool) error {
+func (d *Device) SetAccelerometerRotation(ctx context.Context, enable bool) error {
 	var value string
 	if enable {
 		value = "1"
 	} else {
 		value = "0"
 	}
-	_, err := d.RunCommand("settings put system accelerometer_rotation " + value)
+	_, err := d.RunCommand(ctx, "settings put system accelerometer_rotation "+value)
 	return err
 }
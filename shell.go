@@ -45,16 +45,18 @@ import (
 // ........
 // 000004a0  39 39 29 0a 03 01 00 00  00 ff                    |99).......|
 //
+// The returned connection stays bound to ctx: cancelling it closes the connection.
+//
 // v2协议，在应用输出的开头包裹了5个字符，其中的第2~5个字符似乎是小端表示的4字节长度
 // 在应用输出的结尾包裹了6个字符，似乎总是 03 01 00 00 00 [00 or ff]
 // 参考：https://stackoverflow.com/questions/13578416/read-binary-stdout-data-like-screencap-data-from-adb-shell
-func (c *Device) RunShellCommand(v2 bool, cmd string, args ...string) (fn net.Conn, err error) {
+func (c *Device) RunShellCommand(ctx context.Context, v2 bool, cmd string, args ...string) (fn net.Conn, err error) {
 	cmd, err = prepareCommandLine(cmd, args...)
 	if err != nil {
 		return nil, wrapClientError(err, c, "RunCommand")
 	}
 
-	conn, err := c.dialDevice(c.CmdTimeoutShort)
+	conn, err := c.dialDevice(ctx)
 	if err != nil {
 		return nil, wrapClientError(err, c, "RunCommand")
 	}
@@ -77,7 +79,7 @@ func (c *Device) RunShellCommand(v2 bool, cmd string, args ...string) (fn net.Co
 		return nil, wrapClientError(err, c, "RunCommand")
 	}
 
-	if _, err = readStatusWithTimeout(conn, req, c.CmdTimeoutShort); err != nil {
+	if _, err = readStatusWithTimeout(ctx, conn, req, c.CmdTimeoutShort); err != nil {
 		conn.Close()
 		return nil, wrapClientError(err, c, "RunCommand")
 	}
@@ -85,76 +87,44 @@ func (c *Device) RunShellCommand(v2 bool, cmd string, args ...string) (fn net.Co
 	return conn, wrapClientError(err, c, "RunCommand")
 }
 
-func (c *Device) RunCommandTimeout(timeout time.Duration, cmd string, args ...string) (resp []byte, err error) {
-	conn, err := c.RunShellCommand(false, cmd, args...)
-	if err != nil {
-		return nil, err
-	}
-	defer conn.Close()
-
-	// set read timeout
-	if timeout > 0 {
-		if err = conn.SetReadDeadline(time.Now().Add(timeout)); err != nil {
-			return nil, wrapClientError(err, c, "RunCommand")
-		}
-	}
-	resp, err = io.ReadAll(conn)
-	if err != nil {
-		return
-	}
-	// fmt.Println(hex.Dump(resp))
-	// fmt.Println("----------------")
-	// fmt.Printf("%s", resp)
-	return
+// RunCommand runs cmd and returns its output. If ctx has no deadline, the command
+// is given CmdTimeoutShort, which is 2 seconds by default, be careful.
+func (c *Device) RunCommand(ctx context.Context, cmd string, args ...string) ([]byte, error) {
+	ctx, cancel := withDefaultTimeout(ctx, c.CmdTimeoutShort)
+	defer cancel()
+	buf := &bytes.Buffer{}
+	err := c.RunCommandTo(ctx, buf, cmd, args...)
+	return buf.Bytes(), err
 }
 
-// RunCommand default timeout is CommandTimeoutShortDefault which is 2 seconds, be careful
-func (c *Device) RunCommand(cmd string, args ...string) ([]byte, error) {
-	return c.RunCommandTimeout(c.CmdTimeoutShort, cmd, args...)
+// runCommandTimeout runs cmd like RunCommand, with timeout instead of CmdTimeoutShort.
+func (c *Device) runCommandTimeout(ctx context.Context, timeout time.Duration, cmd string, args ...string) ([]byte, error) {
+	ctx, cancel := withDefaultTimeout(ctx, timeout)
+	defer cancel()
+	return c.RunCommand(ctx, cmd, args...)
 }
 
-// RunCommandCtx wrap RunShellCommand with context
-func (c *Device) RunCommandCtx(ctx context.Context, writer io.Writer, cmd string, args ...string) error {
-	conn, err := c.RunShellCommand(false, cmd, args...)
+// RunCommandTo runs cmd and copies its output to writer until the command exits
+// or ctx is done. Cancelling ctx closes the connection, the command keeps running
+// on the device if it doesn't stop on SIGHUP.
+func (c *Device) RunCommandTo(ctx context.Context, writer io.Writer, cmd string, args ...string) error {
+	conn, err := c.RunShellCommand(ctx, false, cmd, args...)
 	if err != nil {
 		return err
 	}
 	defer conn.Close()
-	buf := make([]byte, wire.SyncMaxChunkSize)
-	ch := make(chan error, 2)
-	go func() {
-		for {
-			n, err := conn.Read(buf)
-			if writer != nil && n > 0 {
-				writer.Write(buf[:n])
-			}
-
-			// shell v1 协议无法确认 connection 结束的真正原因，实际测试效果如下：
-			// 1. 手机 adb 连接正常，程序正常结束，err返回 EOF
-			// 2. 手机 adb 连接正常，kill 掉正在执行的程序，err 也会返回 EOF
-			// 3. 如果进程执行中，断开 USB 线，err 还会返回 EOF
-			// 综上: 需要支持 v2 协议，才有可能区分上述三种情况。
-			if err != nil {
-				// fmt.Println("err:", err)
-				ch <- io.EOF
-				return
-			}
-		}
-	}()
-
-	select {
-	case <-ctx.Done():
-		return ctx.Err()
-	case err := <-ch:
-		if err == io.EOF {
-			return nil
-		}
-		return err
+	if writer == nil {
+		writer = io.Discard
 	}
-}
 
-func (c *Device) RunCommandOutputCtx(ctx context.Context, cmd string, args ...string) ([]byte, error) {
-	buf := &bytes.Buffer{}
-	err := c.RunCommandCtx(ctx, buf, cmd, args...)
-	return buf.Bytes(), err
+	// shell v1 协议无法确认 connection 结束的真正原因，实际测试效果如下：
+	// 1. 手机 adb 连接正常，程序正常结束，err返回 EOF
+	// 2. 手机 adb 连接正常，kill 掉正在执行的程序，err 也会返回 EOF
+	// 3. 如果进程执行中，断开 USB 线，err 还会返回 EOF
+	// 综上: 需要支持 v2 协议，才有可能区分上述三种情况。
+	buf := make([]byte, wire.SyncMaxChunkSize)
+	if _, err = io.CopyBuffer(writer, conn, buf); err != nil {
+		return wrapClientError(err, c, "RunCommand")
+	}
+	return nil
 }
@@ -10,10 +10,10 @@ import (
 	"github.com/stretchr/testify/assert"
 )
 
-func TestDevice_RunCommandCtx(t *testing.T) {
+func TestDevice_RunCommand(t *testing.T) {
 	assert.NotNil(t, adbclient)
 	d := adbclient.Device(adb.AnyDevice())
-	out, err := d.RunCommandOutputCtx(context.TODO(), "/data/local/tmp/test")
+	out, err := d.RunCommand(context.TODO(), "/data/local/tmp/test")
 	assert.Nil(t, err)
 	fmt.Printf("out:[%s]\n", out)
 }
@@ -87,12 +87,12 @@ func filterFileExistedError(resp []byte) (errs []error) {
 	return
 }
 
-func (c *Device) Mkdirs(list []string) error {
-	return c.MkdirsWithParent(list, false)
+func (c *Device) Mkdirs(ctx context.Context, list []string) error {
+	return c.MkdirsWithParent(ctx, list, false)
 }
 
 // adb shell mkdir [-p] <dir1> <dir2> ...
-func (c *Device) MkdirsWithParent(list []string, withParent bool) error {
+func (c *Device) MkdirsWithParent(ctx context.Context, list []string, withParent bool) error {
 	var commands []string
 	var commandsLen int
 
@@ -104,7 +104,7 @@ func (c *Device) MkdirsWithParent(list []string, withParent bool) error {
 		// adb 这里的长度是32768，但是由于wire/conn.go 中判断最大长度为 MaxPayloadV1Length 4096
 		// 因此这里使用 4000
 		if commandsLen+len(l) > 4000 {
-			resp, err := c.RunCommandTimeout(time.Second*15, "mkdir", commands...)
+			resp, err := c.runCommandTimeout(ctx, 15*time.Second, "mkdir", commands...)
 			if err != nil {
 				return err
 			}
@@ -125,7 +125,7 @@ func (c *Device) MkdirsWithParent(list []string, withParent bool) error {
 	}
 
 	if commandsLen > 0 {
-		resp, err := c.RunCommandTimeout(time.Second*15, "mkdir", commands...)
+		resp, err := c.runCommandTimeout(ctx, 15*time.Second, "mkdir", commands...)
 		if err != nil {
 			return err
 		}
@@ -142,7 +142,7 @@ func (c *Device) MkdirsWithParent(list []string, withParent bool) error {
 
 // Rm run `adb shell rm -rf xx xx`
 // it returns is meaning less in most cases, so just ignore error is ok
-func (c *Device) Rm(list []string) error {
+func (c *Device) Rm(ctx context.Context, list []string) error {
 	var commands []string
 	var commandsLen int
 
@@ -151,7 +151,7 @@ func (c *Device) Rm(list []string) error {
 	commands = append(commands, "-rf")
 	for _, l := range list {
 		if commandsLen+len(l) > (32768 - 7) { // len('rm -rf ') == 6
-			resp, err := c.RunCommandTimeout(time.Second*15, "rm", commands...)
+			resp, err := c.runCommandTimeout(ctx, 15*time.Second, "rm", commands...)
 			if err != nil {
 				return err
 			}
@@ -171,7 +171,7 @@ func (c *Device) Rm(list []string) error {
 	}
 
 	if commandsLen > 0 {
-		resp, err := c.RunCommandTimeout(time.Second*15, "rm", commands...)
+		resp, err := c.runCommandTimeout(ctx, 15*time.Second, "rm", commands...)
 		if err != nil {
 			return err
 		}
@@ -182,11 +182,9 @@ func (c *Device) Rm(list []string) error {
 	return errors.Join(errs...)
 }
 
-func (c *Device) PushFile(localPath, remotePath string, handler wire.SyncFileHandler) error {
-	return c.PushFileCtx(context.Background(), localPath, remotePath, handler)
-}
-
-func (c *Device) PushFileCtx(ctx context.Context, localPath, remotePath string, handler wire.SyncFileHandler) error {
+// PushFile pushes a regular file, into remotePath if it's a directory.
+// Cancelling ctx aborts the transfer.
+func (c *Device) PushFile(ctx context.Context, localPath, remotePath string, handler wire.SyncFileHandler) error {
 	linfo, err := os.Lstat(localPath)
 	if err != nil {
 		return err
@@ -200,7 +198,7 @@ func (c *Device) PushFileCtx(ctx context.Context, localPath, remotePath string,
 	// 	return fmt.Errorf("get device features: %w", err)
 	// }
 
-	fconn, err := c.NewSyncConn()
+	fconn, err := c.NewSyncConn(ctx)
 	if err != nil {
 		return err
 	}
@@ -212,38 +210,30 @@ func (c *Device) PushFileCtx(ctx context.Context, localPath, remotePath string,
 		remotePath = remotePath + "/" + linfo.Name()
 	}
 
-	var syncHandler func(n uint64)
-	if handler != nil {
-		total := uint64(linfo.Size())
-		sent := uint64(0)
-		startTime := time.Now()
-		percent := 0
-		syncHandler = func(n uint64) {
-			sent += n
-			curPercent := float64(sent) / float64(total) * 100
-			if int(curPercent) > percent {
-				speedMBPerSecond := float64(sent) * float64(time.Second) / 1024.0 / 1024.0 / (float64(time.Since(startTime)))
-				handler(total, sent, curPercent, speedMBPerSecond)
-			}
-			percent = int(curPercent)
-		}
+	if err := fconn.PushFile(localPath, remotePath, progressFunc(uint64(linfo.Size()), handler)); err != nil {
+		return fmt.Errorf("push failed: %w", err)
 	}
+	return nil
+}
 
-	ch := make(chan error, 2)
-	go func() {
-		err := fconn.PushFile(localPath, remotePath, syncHandler)
-		ch <- err
-	}()
-
-	select {
-	case <-ctx.Done():
-		return fmt.Errorf("push failed by ctx done: %w", ctx.Err())
-	case err := <-ch:
-		if err != nil {
-			return fmt.Errorf("push failed: %w", err)
-		}
+// progressFunc returns a function to call with the size of each chunk sent, which calls
+// handler every time another percent of total is sent. It returns nil for a nil handler.
+func progressFunc(total uint64, handler wire.SyncFileHandler) func(n uint64) {
+	if handler == nil {
 		return nil
 	}
+	sent := uint64(0)
+	startTime := time.Now()
+	percent := 0
+	return func(n uint64) {
+		sent += n
+		curPercent := float64(sent) / float64(total) * 100
+		if int(curPercent) > percent {
+			speedMBPerSecond := float64(sent) * float64(time.Second) / 1024.0 / 1024.0 / (float64(time.Since(startTime)))
+			handler(total, sent, curPercent, speedMBPerSecond)
+		}
+		percent = int(curPercent)
+	}
 }
 
 // PushDir support push dir
@@ -255,43 +245,29 @@ func (c *Device) PushFileCtx(ctx context.Context, localPath, remotePath string,
 // 本函数行为如下
 // 当 withSrcDir 为 true，永远会在手机上创建src-dir
 // 当 withSrcDir 为 false，则仅会 src-dir 的子文件/目录推送到目标文件夹下
-func (c *Device) PushDir(local, remote string, withSrcDir bool, handler wire.SyncHandler) (err error) {
-	return c.PushDirCtx(context.Background(), local, remote, withSrcDir, handler)
-}
-
-func (c *Device) PushDirCtx(ctx context.Context, local, remote string, withSrcDir bool, handler wire.SyncHandler) (err error) {
+// 取消 ctx 会中断推送
+func (c *Device) PushDir(ctx context.Context, local, remote string, withSrcDir bool, handler wire.SyncHandler) (err error) {
 	// Android 12 之后，push 可能遇到文件夹权限问题，解决办法
 	// 1. 先在手机上创建所有文件夹，如果失败则直接返回错误
 	// 2. 再推送文件
-	if err := MakeDirs(c, local, remote, withSrcDir); err != nil {
+	if err := MakeDirs(ctx, c, local, remote, withSrcDir); err != nil {
 		return err
 	}
 
 	// push files
-	fconn, err := c.NewSyncConn()
+	fconn, err := c.NewSyncConn(ctx)
 	if err != nil {
 		return err
 	}
 	defer fconn.Close()
 
-	ch := make(chan error, 2)
-	go func() {
-		err := fconn.PushDir(withSrcDir, local, remote, handler)
-		ch <- err
-	}()
-
-	select {
-	case <-ctx.Done():
-		return fmt.Errorf("push failed by ctx done: %w", ctx.Err())
-	case err := <-ch:
-		if err != nil {
-			return fmt.Errorf("push failed: %w", err)
-		}
-		return nil
+	if err := fconn.PushDir(withSrcDir, local, remote, handler); err != nil {
+		return fmt.Errorf("push failed: %w", err)
 	}
+	return nil
 }
 
-func MakeDirs(c *Device, local string, remote string, withSrcDir bool) (err error) {
+func MakeDirs(ctx context.Context, c *Device, local string, remote string, withSrcDir bool) (err error) {
 	local, err = filepath.Abs(local)
 	if err != nil {
 		return fmt.Errorf("pushd: get abs path of %s failed: %w", local, err)
@@ -329,7 +305,7 @@ func MakeDirs(c *Device, local string, remote string, withSrcDir bool) (err erro
 			remoteSubDirs[i+1] = remote + "/" + d
 		}
 	}
-	err = c.MkdirsWithParent(remoteSubDirs, true)
+	err = c.MkdirsWithParent(ctx, remoteSubDirs, true)
 	if err != nil {
 		// 当创建很多文件夹时(比如推送游戏资源包到手机中)，可能会返回一个超长的错误，截断处理
 		errStr := err.Error()
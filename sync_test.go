@@ -1,6 +1,7 @@
 package adb_test
 
 import (
+	"context"
 	"fmt"
 	"io"
 	"os"
@@ -27,13 +28,13 @@ func init() {
 }
 
 func TestDeviceFeatures(t *testing.T) {
-	features, err := adbclient.HostFeatures()
+	features, err := adbclient.HostFeatures(context.TODO())
 	if err != nil {
 		t.Fatal(err)
 	}
 	fmt.Println("host features: ", features)
 	d := adbclient.Device(adb.AnyDevice())
-	fmt.Println(d.DeviceFeatures())
+	fmt.Println(d.DeviceFeatures(context.TODO()))
 }
 
 func TestPath(t *testing.T) {
@@ -49,7 +50,7 @@ func TestPath(t *testing.T) {
 
 func TestForwardPort(t *testing.T) {
 	d := adbclient.Device(adb.AnyDevice())
-	conn, err := d.ForwardPort(50000)
+	conn, err := d.ForwardPort(context.TODO(), 50000)
 	if err != nil {
 		t.Fatal(err)
 	}
@@ -87,12 +88,12 @@ func Test_listAllSubDirs(t *testing.T) {
 // mkdir: '/sdcard/a/b/c': File exists
 func TestDevice_Mkdirs(t *testing.T) {
 	d := adbclient.Device(adb.AnyDevice())
-	_, err := d.RunCommand("rm", "-rf", "/sdcard/a")
+	_, err := d.RunCommand(context.TODO(), "rm", "-rf", "/sdcard/a")
 	assert.Nil(t, err)
 
-	err = d.Mkdirs([]string{"/sdcard/a/", "/sdcard/a/b", "/sdcard/a/b/c"})
+	err = d.Mkdirs(context.TODO(), []string{"/sdcard/a/", "/sdcard/a/b", "/sdcard/a/b/c"})
 	assert.Nil(t, err)
-	err = d.Mkdirs([]string{"/sdcard/a/", "/sdcard/a/b", "/sdcard/a/b/c"})
+	err = d.Mkdirs(context.TODO(), []string{"/sdcard/a/", "/sdcard/a/b", "/sdcard/a/b/c"})
 	assert.Nil(t, err)
 }
 
@@ -102,7 +103,7 @@ func TestDevice_Mkdirs(t *testing.T) {
 // mkdir: '/sd/a/b/c': No such file or directory
 func TestDevice_Mkdirs_NonExsit(t *testing.T) {
 	d := adbclient.Device(adb.AnyDevice())
-	err := d.Mkdirs([]string{"/sd/a/", "/sd/a/b", "/sd/a/b/c"})
+	err := d.Mkdirs(context.TODO(), []string{"/sd/a/", "/sd/a/b", "/sd/a/b/c"})
 	fmt.Println(err)
 	assert.NotNil(t, err)
 	lines := strings.Split(err.Error(), "\n")
@@ -117,7 +118,7 @@ func TestDevice_Mkdirs_NonExsit(t *testing.T) {
 
 func TestDevice_Mkdirs_ReadOnly(t *testing.T) {
 	d := adbclient.Device(adb.AnyDevice())
-	err := d.Mkdirs([]string{"/a", "/b", "/c"})
+	err := d.Mkdirs(context.TODO(), []string{"/a", "/b", "/c"})
 	fmt.Println(err)
 	assert.NotNil(t, err)
 	lines := strings.Split(err.Error(), "\n")
@@ -132,7 +133,7 @@ func TestDevice_Mkdirs_ReadOnly(t *testing.T) {
 
 func TestDevice_Mkdirs_PermissionDeny(t *testing.T) {
 	d := adbclient.Device(adb.AnyDevice())
-	err := d.Mkdirs([]string{"/data/a", "/data/b", "/data/c"})
+	err := d.Mkdirs(context.TODO(), []string{"/data/a", "/data/b", "/data/c"})
 	fmt.Println(err)
 	assert.NotNil(t, err)
 	lines := strings.Split(err.Error(), "\n")
@@ -147,13 +148,13 @@ func TestDevice_Mkdirs_PermissionDeny(t *testing.T) {
 
 func TestDevice_Rm_NonExistAndPermissionDeny(t *testing.T) {
 	d := adbclient.Device(adb.AnyDevice())
-	err := d.Rm([]string{"/data/a", "/data/b", "/data/c"})
+	err := d.Rm(context.TODO(), []string{"/data/a", "/data/b", "/data/c"})
 	if err != nil {
 		fmt.Println(err)
 	}
 	assert.Nil(t, err)
 
-	err = d.Rm([]string{"/a", "/b", "/c"})
+	err = d.Rm(context.TODO(), []string{"/a", "/b", "/c"})
 	if err != nil {
 		fmt.Println(err)
 	}
@@ -161,7 +162,7 @@ func TestDevice_Rm_NonExistAndPermissionDeny(t *testing.T) {
 }
 
 func listDir(d *adb.Device, path string) error {
-	sc, dr, err := d.OpenDirReader(path)
+	sc, dr, err := d.OpenDirReader(context.TODO(), path)
 	if err != nil {
 		fmt.Println("list dir: ", err)
 		return err
@@ -181,7 +182,7 @@ func listDir(d *adb.Device, path string) error {
 
 func TestDeviceOpenDirReader(t *testing.T) {
 	d := adbclient.Device(adb.AnyDevice())
-	sc, dr, err := d.OpenDirReader("/sdcard")
+	sc, dr, err := d.OpenDirReader(context.TODO(), "/sdcard")
 	if err != nil {
 		t.Fatal(err)
 	}
@@ -196,14 +197,14 @@ func TestDeviceOpenDirReader(t *testing.T) {
 
 func TestDeviceOpenDirReader_NonExisted(t *testing.T) {
 	d := adbclient.Device(adb.AnyDevice())
-	_, dr, err := d.OpenDirReader("/non-exsited")
+	_, dr, err := d.OpenDirReader(context.TODO(), "/non-exsited")
 	assert.ErrorIs(t, err, wire.ErrFileNoExist)
 	fmt.Println(dr, err)
 }
 
 func TestFileService_PushFileSimple_LargeFile(t *testing.T) {
 	d := adbclient.Device(adb.AnyDevice())
-	fs, err := d.NewSyncConn()
+	fs, err := d.NewSyncConn(context.TODO())
 	if err != nil {
 		t.Fatal(err)
 	}
@@ -231,7 +232,7 @@ func TestFileService_PushFileSimple_LargeFile(t *testing.T) {
 
 func TestFileService_PushFile_ToDir(t *testing.T) {
 	d := adbclient.Device(adb.AnyDevice())
-	fs, err := d.NewSyncConn()
+	fs, err := d.NewSyncConn(context.TODO())
 	if err != nil {
 		t.Fatal(err)
 	}
@@ -253,7 +254,7 @@ func TestDevice_PushFile(t *testing.T) {
 	pwd, _ := os.Getwd()
 
 	// push to dir
-	err := d.PushFile(path.Join(pwd, "sync.go"), "/sdcard/",
+	err := d.PushFile(context.TODO(), path.Join(pwd, "sync.go"), "/sdcard/",
 		func(totalSize, sentSize uint64, percent, speedMBPerSecond float64) {
 			fmt.Printf("%d/%d bytes, %.02f%%, %.02f MB/s\n", sentSize, totalSize, percent, speedMBPerSecond)
 		})
@@ -262,7 +263,7 @@ func TestDevice_PushFile(t *testing.T) {
 	}
 
 	// push to file
-	err = d.PushFile(testZip, "/sdcard/test.zip",
+	err = d.PushFile(context.TODO(), testZip, "/sdcard/test.zip",
 		func(totalSize, sentSize uint64, percent, speedMBPerSecond float64) {
 			fmt.Printf("%d/%d bytes, %.02f%%, %.02f MB/s\n", sentSize, totalSize, percent, speedMBPerSecond)
 		})
@@ -277,11 +278,11 @@ func TestFileService_PushDir(t *testing.T) {
 
 	// clear remote dir
 	d := adbclient.Device(adb.AnyDevice())
-	_ = d.Rm([]string{"/sdcard/wire"})
+	_ = d.Rm(context.TODO(), []string{"/sdcard/wire"})
 	// listDir(d, "/sdcard/")
 
 	// create connection
-	fs, err := d.NewSyncConn()
+	fs, err := d.NewSyncConn(context.TODO())
 	if err != nil {
 		t.Fatal(err)
 	}
@@ -307,14 +308,14 @@ func TestDevice_PushDir(t *testing.T) {
 
 	// clear remote dir
 	d := adbclient.Device(adb.AnyDevice())
-	err := d.Mkdirs([]string{"/sdcard/test"})
+	err := d.Mkdirs(context.TODO(), []string{"/sdcard/test"})
 	if err != nil {
 		t.Fatal(err)
 	}
 	// listDir(d, "/sdcard/")
 
 	// push all files and subdirs under wire/ to /sdcard/test
-	err = d.PushDir(path.Join(pwd, "wire/"), "/sdcard/test", false,
+	err = d.PushDir(context.TODO(), path.Join(pwd, "wire/"), "/sdcard/test", false,
 		func(totalFiles, sentFiles uint64, current string, percent, speed float64, err error) {
 			if err != nil {
 				fmt.Printf("[%d/%d] pushing %s, %.2f%%, err:%s\n", sentFiles, totalFiles, current, percent, err.Error())
@@ -327,7 +328,7 @@ func TestDevice_PushDir(t *testing.T) {
 	}
 
 	// push all files and subdirs under wire/ to /sdcard/test
-	err = d.PushDir(path.Join(pwd, "wire/"), "/sdcard/test", true,
+	err = d.PushDir(context.TODO(), path.Join(pwd, "wire/"), "/sdcard/test", true,
 		func(totalFiles, sentFiles uint64, current string, percent, speed float64, err error) {
 			if err != nil {
 				fmt.Printf("[%d/%d] pushing %s, %.2f%%, err:%s\n", sentFiles, totalFiles, current, percent, err.Error())
@@ -342,7 +343,7 @@ func TestDevice_PushDir(t *testing.T) {
 
 func TestFileService_PullFile(t *testing.T) {
 	d := adbclient.Device(adb.AnyDevice())
-	fs, err := d.NewSyncConn()
+	fs, err := d.NewSyncConn(context.TODO())
 	if err != nil {
 		t.Fatal(err)
 	}
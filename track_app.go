@@ -0,0 +1,254 @@
+package adb
+
+import (
+	"context"
+	"fmt"
+	"reflect"
+	"sort"
+	"sync"
+
+	"DomaphoneS-Next/backend/goadb/wire"
+)
+
+// AppProcess is a process of an app, as reported by adbd's track-app service.
+type AppProcess struct {
+	Pid         int
+	Debuggable  bool
+	Profileable bool
+	// Architecture is the ABI of the process, eg. arm64.
+	Architecture       string
+	WaitingForDebugger bool
+	Uid                int
+	ProcessName        string
+	// PackageNames are the packages running in the process, usually one. They are filled in
+	// once the app is bound, an AppChanged event follows its start.
+	PackageNames []string
+	UserID       int
+}
+
+// AppEventType is the kind of an AppEvent.
+type AppEventType int
+
+const (
+	// AppStarted is sent when a process shows up, including the ones running at start.
+	AppStarted AppEventType = iota
+	// AppChanged is sent when the details of a process change, eg. its package names.
+	AppChanged
+	// AppStopped is sent when a process exits.
+	AppStopped
+)
+
+func (t AppEventType) String() string {
+	switch t {
+	case AppStarted:
+		return "started"
+	case AppChanged:
+		return "changed"
+	case AppStopped:
+		return "stopped"
+	}
+	return fmt.Sprintf("AppEventType(%d)", int(t))
+}
+
+// AppEvent reports a change of the app processes. Process is the last known state of the
+// process, for AppStopped too.
+type AppEvent struct {
+	Type    AppEventType
+	Process AppProcess
+}
+
+// AppTracker publishes the app processes of a device, see Device.TrackApp.
+type AppTracker struct {
+	conn   wire.IConn
+	cancel context.CancelFunc
+	events chan AppEvent
+
+	mu        sync.Mutex
+	processes map[int]AppProcess
+	err       error
+}
+
+// TrackApp tracks the app processes of the device with the track-app service, which needs
+// the track_app feature (Android 12 and later). Unlike TrackJdwp, it reports processes that
+// are only profileable too.
+// The tracker stops when ctx is done or Close is called.
+func (c *Device) TrackApp(ctx context.Context) (*AppTracker, error) {
+	features, err := c.cachedFeatures(ctx)
+	if err != nil {
+		return nil, wrapClientError(err, c, "TrackApp")
+	}
+	if !features[FeatureTrackApp] {
+		return nil, wrapClientError(fmt.Errorf("%w: %s", wire.ErrNotSupported, FeatureTrackApp), c, "TrackApp")
+	}
+
+	ctx, cancel := context.WithCancel(ctx)
+	conn, err := c.openService(ctx, "track-app")
+	if err != nil {
+		cancel()
+		return nil, wrapClientError(err, c, "TrackApp")
+	}
+
+	t := &AppTracker{
+		conn:      conn,
+		cancel:    cancel,
+		events:    make(chan AppEvent),
+		processes: map[int]AppProcess{},
+	}
+	go t.run(ctx)
+	return t, nil
+}
+
+// C returns the channel of events. It's closed when the tracker stops, see Err.
+func (t *AppTracker) C() <-chan AppEvent {
+	return t.events
+}
+
+// Processes returns the app processes, sorted by pid.
+func (t *AppTracker) Processes() []AppProcess {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	processes := make([]AppProcess, 0, len(t.processes))
+	for _, p := range t.processes {
+		processes = append(processes, p)
+	}
+	sort.Slice(processes, func(i, j int) bool { return processes[i].Pid < processes[j].Pid })
+	return processes
+}
+
+// Err returns the error that stopped the tracker once C is closed, nil after Close.
+func (t *AppTracker) Err() error {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	return t.err
+}
+
+// Close stops the tracker.
+func (t *AppTracker) Close() error {
+	t.cancel()
+	return nil
+}
+
+func (t *AppTracker) run(ctx context.Context) {
+	defer close(t.events)
+	defer t.conn.Close()
+	defer t.cancel()
+
+	for {
+		msg, err := t.conn.ReadMessage()
+		if err != nil {
+			if ctx.Err() == nil {
+				t.mu.Lock()
+				t.err = fmt.Errorf("track-app: %w", err)
+				t.mu.Unlock()
+			}
+			return
+		}
+		processes, err := parseAppProcesses(msg)
+		if err != nil {
+			t.mu.Lock()
+			t.err = err
+			t.mu.Unlock()
+			return
+		}
+
+		for _, event := range t.update(processes) {
+			select {
+			case t.events <- event:
+			case <-ctx.Done():
+				return
+			}
+		}
+	}
+}
+
+// update replaces the processes and returns the differences ordered by pid.
+func (t *AppTracker) update(processes []AppProcess) []AppEvent {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	var events []AppEvent
+	current := make(map[int]AppProcess, len(processes))
+	for _, p := range processes {
+		current[p.Pid] = p
+		old, ok := t.processes[p.Pid]
+		switch {
+		case !ok:
+			events = append(events, AppEvent{Type: AppStarted, Process: p})
+		case !reflect.DeepEqual(old, p):
+			events = append(events, AppEvent{Type: AppChanged, Process: p})
+		}
+	}
+	for pid, p := range t.processes {
+		if _, ok := current[pid]; !ok {
+			events = append(events, AppEvent{Type: AppStopped, Process: p})
+		}
+	}
+	t.processes = current
+
+	sort.SliceStable(events, func(i, j int) bool { return events[i].Process.Pid < events[j].Process.Pid })
+	return events
+}
+
+// parseAppProcesses decodes the AppProcesses protobuf message sent by track-app, see
+// adb's proto/app_processes.proto:
+//
+//	message ProcessEntry {
+//	    int64 pid = 1;
+//	    bool debuggable = 2;
+//	    bool profileable = 3;
+//	    string architecture = 4;
+//	    bool waiting_for_debugger = 5;
+//	    int64 uid = 6;
+//	    string process_name = 7;
+//	    repeated string package_names = 8;
+//	    int64 user_id = 9;
+//	}
+//	message AppProcesses {
+//	    repeated ProcessEntry process = 1;
+//	}
+//
+// Unknown fields are skipped, so older and newer adbd versions decode alike.
+func parseAppProcesses(msg []byte) ([]AppProcess, error) {
+	var processes []AppProcess
+	err := walkProto(msg, func(num int, v uint64, data []byte) error {
+		if num != 1 || data == nil {
+			return nil
+		}
+		p, err := parseProcessEntry(data)
+		if err != nil {
+			return err
+		}
+		processes = append(processes, p)
+		return nil
+	})
+	if err != nil {
+		return nil, fmt.Errorf("%w: invalid track-app message: %w", wire.ErrParse, err)
+	}
+	return processes, nil
+}
+
+func parseProcessEntry(msg []byte) (p AppProcess, err error) {
+	err = walkProto(msg, func(num int, v uint64, data []byte) error {
+		switch num {
+		case 1:
+			p.Pid = int(v)
+		case 2:
+			p.Debuggable = v != 0
+		case 3:
+			p.Profileable = v != 0
+		case 4:
+			p.Architecture = string(data)
+		case 5:
+			p.WaitingForDebugger = v != 0
+		case 6:
+			p.Uid = int(v)
+		case 7:
+			p.ProcessName = string(data)
+		case 8:
+			p.PackageNames = append(p.PackageNames, string(data))
+		case 9:
+			p.UserID = int(v)
+		}
+		return nil
+	})
+	return
+}
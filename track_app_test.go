@@ -0,0 +1,100 @@
+package adb_test
+
+import (
+	"context"
+	"encoding/binary"
+	"fmt"
+	"io"
+	"testing"
+
+	adb "DomaphoneS-Next/backend/goadb"
+	"DomaphoneS-Next/backend/goadb/adbtest"
+	"DomaphoneS-Next/backend/goadb/wire"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func appendUvarint(b []byte, v uint64) []byte {
+	var buf [binary.MaxVarintLen64]byte
+	return append(b, buf[:binary.PutUvarint(buf[:], v)]...)
+}
+
+func protoVarint(b []byte, num int, v uint64) []byte {
+	b = appendUvarint(b, uint64(num)<<3)
+	return appendUvarint(b, v)
+}
+
+func protoBytes(b []byte, num int, data []byte) []byte {
+	b = appendUvarint(b, uint64(num)<<3|2)
+	b = appendUvarint(b, uint64(len(data)))
+	return append(b, data...)
+}
+
+// encodeAppProcesses encodes processes like adbd's track-app.
+func encodeAppProcesses(processes ...adb.AppProcess) []byte {
+	var msg []byte
+	for _, p := range processes {
+		var entry []byte
+		entry = protoVarint(entry, 1, uint64(p.Pid))
+		if p.Debuggable {
+			entry = protoVarint(entry, 2, 1)
+		}
+		if p.Profileable {
+			entry = protoVarint(entry, 3, 1)
+		}
+		entry = protoBytes(entry, 4, []byte(p.Architecture))
+		entry = protoVarint(entry, 6, uint64(p.Uid))
+		// A field this client doesn't know about.
+		entry = protoBytes(entry, 42, []byte("ignored"))
+		for _, name := range p.PackageNames {
+			entry = protoBytes(entry, 8, []byte(name))
+		}
+		msg = protoBytes(msg, 1, entry)
+	}
+	return msg
+}
+
+func TestTrackApp(t *testing.T) {
+	ctx := context.Background()
+	lists := make(chan []byte)
+	dev := adbtest.NewDevice("emulator-5554")
+	dev.Features = append(dev.Features, adb.FeatureTrackApp)
+	dev.HandleService("track-app", func(service string, rw io.ReadWriter) {
+		for list := range lists {
+			fmt.Fprintf(rw, "%04x%s", len(list), list)
+		}
+	})
+	_, client := newTestClient(t, dev)
+
+	tracker, err := client.Device(adb.AnyDevice()).TrackApp(ctx)
+	require.NoError(t, err)
+	defer tracker.Close()
+
+	system := adb.AppProcess{Pid: 321, Profileable: true, Architecture: "arm64", Uid: 1000, PackageNames: []string{"android"}}
+	app := adb.AppProcess{Pid: 4567, Debuggable: true, Architecture: "arm64", Uid: 10123}
+	lists <- encodeAppProcesses(system, app)
+	assert.Equal(t, adb.AppEvent{Type: adb.AppStarted, Process: system}, <-tracker.C())
+	assert.Equal(t, adb.AppEvent{Type: adb.AppStarted, Process: app}, <-tracker.C())
+
+	// The package name comes once the app is bound.
+	app.PackageNames = []string{"com.example.app"}
+	lists <- encodeAppProcesses(system, app)
+	assert.Equal(t, adb.AppEvent{Type: adb.AppChanged, Process: app}, <-tracker.C())
+	assert.Equal(t, []adb.AppProcess{system, app}, tracker.Processes())
+
+	lists <- encodeAppProcesses(system)
+	assert.Equal(t, adb.AppEvent{Type: adb.AppStopped, Process: app}, <-tracker.C())
+
+	lists <- []byte{0x0a, 0x05, 0x08}
+	_, ok := <-tracker.C()
+	assert.False(t, ok)
+	assert.ErrorIs(t, tracker.Err(), wire.ErrParse)
+	close(lists)
+}
+
+func TestTrackApp_NotSupported(t *testing.T) {
+	_, client := newTestClient(t, adbtest.NewDevice("emulator-5554"))
+	_, err := client.Device(adb.AnyDevice()).TrackApp(context.Background())
+	assert.ErrorIs(t, err, wire.ErrNotSupported)
+}
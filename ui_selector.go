@@ -0,0 +1,238 @@
+package adb
+
+import (
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+
+	"DomaphoneS-Next/backend/goadb/wire"
+)
+
+// UISelector matches nodes of a UI hierarchy, see UINode.Find and Device.WaitFor.
+type UISelector interface {
+	Match(n *UINode) bool
+	String() string
+}
+
+// uiSelector is a UISelector made of a function.
+type uiSelector struct {
+	desc  string
+	match func(n *UINode) bool
+}
+
+func (s uiSelector) Match(n *UINode) bool { return s.match(n) }
+func (s uiSelector) String() string       { return s.desc }
+
+// ByID matches the resource id, either whole like com.example:id/ok or without the
+// package like ok.
+func ByID(id string) UISelector {
+	return uiSelector{"id " + id, func(n *UINode) bool {
+		if strings.Contains(id, ":") {
+			return n.ResourceID == id
+		}
+		return n.ResourceID == id || strings.HasSuffix(n.ResourceID, ":id/"+id)
+	}}
+}
+
+// ByText matches the text with re, anchor it to match the whole text.
+func ByText(re *regexp.Regexp) UISelector {
+	return uiSelector{"text " + re.String(), func(n *UINode) bool { return re.MatchString(n.Text) }}
+}
+
+// ByContentDesc matches the content description with re.
+func ByContentDesc(re *regexp.Regexp) UISelector {
+	return uiSelector{"content-desc " + re.String(), func(n *UINode) bool { return re.MatchString(n.ContentDesc) }}
+}
+
+// ByClass matches the class, either whole like android.widget.Button or its simple name
+// like Button.
+func ByClass(class string) UISelector {
+	return uiSelector{"class " + class, func(n *UINode) bool { return matchClass(n.Class, class) }}
+}
+
+// MatchAll matches nodes matched by all the selectors.
+func MatchAll(selectors ...UISelector) UISelector {
+	desc := make([]string, len(selectors))
+	for i, s := range selectors {
+		desc[i] = s.String()
+	}
+	return uiSelector{strings.Join(desc, " and "), func(n *UINode) bool {
+		for _, s := range selectors {
+			if !s.Match(n) {
+				return false
+			}
+		}
+		return true
+	}}
+}
+
+func matchClass(class, name string) bool {
+	if name == "*" || class == name {
+		return true
+	}
+	return !strings.Contains(name, ".") && strings.HasSuffix(class, "."+name)
+}
+
+// uiStep is a step of a ByPath path.
+type uiStep struct {
+	// descendant is set for //, the step is anywhere below the previous one.
+	descendant bool
+	class      string
+	attrs      map[string]string
+	// position is the 1-based position among the siblings matching the step, 0 for any.
+	position int
+}
+
+var (
+	uiStepRegex      = regexp.MustCompile(`^([\w.$*]+)((?:\[[^\]]*\])*)$`)
+	uiPredicateRegex = regexp.MustCompile(`\[(?:(\d+)|@([\w-]+)='([^']*)')\]`)
+)
+
+// ByPath matches the nodes at path, a subset of XPath over the classes: steps separated
+// by / for a child or // for a descendant, each a class like in ByClass or *, with
+// predicates [@attribute='value'] on resource-id, text, content-desc, class and package,
+// and [n] for the n-th sibling matching the step, from 1. A path starting with a single
+// / starts at the windows.
+//
+//	//android.widget.ListView/LinearLayout[2]//TextView[@text='Wi-Fi']
+func ByPath(path string) (UISelector, error) {
+	anchored := strings.HasPrefix(path, "/") && !strings.HasPrefix(path, "//")
+	var steps []uiStep
+	descendant := !anchored
+	rest := strings.TrimPrefix(strings.TrimPrefix(path, "/"), "/")
+	for _, part := range splitUIPath(rest) {
+		if part == "" {
+			// An empty part comes from //.
+			if descendant {
+				return nil, fmt.Errorf("%w: UI path %q", wire.ErrParse, path)
+			}
+			descendant = true
+			continue
+		}
+		step, err := parseUIStep(part)
+		if err != nil {
+			return nil, fmt.Errorf("%w: UI path %q: %w", wire.ErrParse, path, err)
+		}
+		step.descendant = descendant
+		steps = append(steps, step)
+		descendant = false
+	}
+	if len(steps) == 0 || descendant {
+		return nil, fmt.Errorf("%w: UI path %q", wire.ErrParse, path)
+	}
+	return uiSelector{"path " + path, func(n *UINode) bool {
+		return matchUIPath(n, steps, len(steps)-1)
+	}}, nil
+}
+
+// splitUIPath splits path at the slashes that aren't quoted, resource ids have some.
+func splitUIPath(path string) []string {
+	var parts []string
+	quoted := false
+	start := 0
+	for i, r := range path {
+		switch {
+		case r == '\'':
+			quoted = !quoted
+		case r == '/' && !quoted:
+			parts = append(parts, path[start:i])
+			start = i + 1
+		}
+	}
+	return append(parts, path[start:])
+}
+
+func parseUIStep(s string) (step uiStep, err error) {
+	m := uiStepRegex.FindStringSubmatch(s)
+	if m == nil {
+		return step, fmt.Errorf("bad step %q", s)
+	}
+	step.class = m[1]
+	predicates := m[2]
+	for _, p := range uiPredicateRegex.FindAllStringSubmatch(predicates, -1) {
+		predicates = strings.Replace(predicates, p[0], "", 1)
+		if p[1] != "" {
+			step.position, _ = strconv.Atoi(p[1])
+			continue
+		}
+		switch p[2] {
+		case "resource-id", "text", "content-desc", "class", "package":
+		default:
+			return step, fmt.Errorf("unknown attribute %q", p[2])
+		}
+		if step.attrs == nil {
+			step.attrs = map[string]string{}
+		}
+		step.attrs[p[2]] = p[3]
+	}
+	if predicates != "" {
+		return step, fmt.Errorf("bad predicate %q", predicates)
+	}
+	return step, nil
+}
+
+// matchUIPath tells whether n matches steps[i] and its ancestors the previous steps.
+func matchUIPath(n *UINode, steps []uiStep, i int) bool {
+	step := steps[i]
+	// The root is the hierarchy, not a node of the path.
+	if n == nil || n.Parent == nil || !step.match(n) {
+		return false
+	}
+	if i == 0 {
+		return step.descendant || n.Parent.Parent == nil
+	}
+	if !step.descendant {
+		return matchUIPath(n.Parent, steps, i-1)
+	}
+	for a := n.Parent; a != nil; a = a.Parent {
+		if matchUIPath(a, steps, i-1) {
+			return true
+		}
+	}
+	return false
+}
+
+func (s uiStep) match(n *UINode) bool {
+	if !s.matchNode(n) {
+		return false
+	}
+	if s.position == 0 {
+		return true
+	}
+	position := 0
+	for _, sibling := range n.Parent.Children {
+		if s.matchNode(sibling) {
+			position++
+		}
+		if sibling == n {
+			return position == s.position
+		}
+	}
+	return false
+}
+
+func (s uiStep) matchNode(n *UINode) bool {
+	if !matchClass(n.Class, s.class) {
+		return false
+	}
+	for name, value := range s.attrs {
+		var v string
+		switch name {
+		case "resource-id":
+			v = n.ResourceID
+		case "text":
+			v = n.Text
+		case "content-desc":
+			v = n.ContentDesc
+		case "class":
+			v = n.Class
+		case "package":
+			v = n.Package
+		}
+		if v != value {
+			return false
+		}
+	}
+	return true
+}
@@ -2,6 +2,8 @@ package wire
 
 import (
 	"errors"
+	"fmt"
+	"io/fs"
 )
 
 var (
@@ -13,10 +15,99 @@ var (
 	ErrNetwork = errors.New("Network")
 	// ErrConnectionReset the connection to the server was reset in the middle of an operation. Server probably died.
 	ErrConnectionReset = errors.New("ConnectionReset")
-	// ErrAdb The server returned an error message, but we couldn't parse it.
+	// ErrAdb The server returned an error message. Every ServerError matches it,
+	// the ones we couldn't classify match only it.
 	ErrAdb = errors.New("AdbError")
 	// ErrDeviceNotFound the server returned a "device not found" error.
 	ErrDeviceNotFound = errors.New("DeviceNotFound")
+	// ErrDeviceUnauthorized the device hasn't accepted the key of the host.
+	ErrDeviceUnauthorized = errors.New("DeviceUnauthorized")
+	// ErrDeviceAuthorizing the device is still checking the key of the host.
+	ErrDeviceAuthorizing = errors.New("DeviceAuthorizing")
+	// ErrDeviceOffline the device is connected but not responding.
+	ErrDeviceOffline = errors.New("DeviceOffline")
+	// ErrMoreThanOneDevice the request didn't select a device and more than one is connected.
+	ErrMoreThanOneDevice = errors.New("MoreThanOneDevice")
+	// ErrClosed the device closed the service, usually because it doesn't know it.
+	ErrClosed = errors.New("Closed")
+	// ErrProtocolFault the server couldn't talk to the device.
+	ErrProtocolFault = errors.New("ProtocolFault")
+	// ErrCannotBind the server couldn't bind the local socket of a forward or reverse.
+	ErrCannotBind = errors.New("CannotBind")
+	// ErrNotSupported the device lacks the feature the request needs.
+	ErrNotSupported = errors.New("NotSupported")
 	// ErrFileNoExist tried to perform an operation on a path that doesn't exist on the device.
 	ErrFileNoExist = errors.New("FileNoExist")
 )
+
+// Errno is an errno value reported by adbd in the sync v2 protocol.
+// adbd translates the device errno into the Linux numbering before sending it,
+// so the values are the same regardless of the host platform.
+type Errno uint32
+
+// Errno values used on the wire, see adb's sysdeps/errno.cpp.
+const (
+	EPERM        Errno = 1
+	ENOENT       Errno = 2
+	EINTR        Errno = 4
+	EIO          Errno = 5
+	ENOMEM       Errno = 12
+	EACCES       Errno = 13
+	EFAULT       Errno = 14
+	EEXIST       Errno = 17
+	ENOTDIR      Errno = 20
+	EISDIR       Errno = 21
+	EINVAL       Errno = 22
+	ENFILE       Errno = 23
+	EMFILE       Errno = 24
+	ETXTBSY      Errno = 26
+	EFBIG        Errno = 27
+	ENOSPC       Errno = 28
+	EROFS        Errno = 30
+	ENAMETOOLONG Errno = 36
+	ELOOP        Errno = 40
+	EOVERFLOW    Errno = 75
+)
+
+var errnoStrings = map[Errno]string{
+	EPERM:        "operation not permitted",
+	ENOENT:       "no such file or directory",
+	EINTR:        "interrupted system call",
+	EIO:          "input/output error",
+	ENOMEM:       "cannot allocate memory",
+	EACCES:       "permission denied",
+	EFAULT:       "bad address",
+	EEXIST:       "file exists",
+	ENOTDIR:      "not a directory",
+	EISDIR:       "is a directory",
+	EINVAL:       "invalid argument",
+	ENFILE:       "too many open files in system",
+	EMFILE:       "too many open files",
+	ETXTBSY:      "text file busy",
+	EFBIG:        "file too large",
+	ENOSPC:       "no space left on device",
+	EROFS:        "read-only file system",
+	ENAMETOOLONG: "file name too long",
+	ELOOP:        "too many levels of symbolic links",
+	EOVERFLOW:    "value too large for defined data type",
+}
+
+func (e Errno) Error() string {
+	if s, ok := errnoStrings[e]; ok {
+		return s
+	}
+	return fmt.Sprintf("errno %d", uint32(e))
+}
+
+// Is makes Errno work with errors.Is for ErrFileNoExist and the io/fs sentinel errors.
+func (e Errno) Is(target error) bool {
+	switch target {
+	case ErrFileNoExist, fs.ErrNotExist:
+		return e == ENOENT
+	case fs.ErrExist:
+		return e == EEXIST
+	case fs.ErrPermission:
+		return e == EACCES || e == EPERM
+	}
+	return false
+}
@@ -0,0 +1,125 @@
+package wire
+
+import (
+	"fmt"
+	"io"
+
+	"github.com/andybalholm/brotli"
+	"github.com/klauspost/compress/zstd"
+	"github.com/pierrec/lz4/v4"
+)
+
+// SyncFlag is the flags field of send_v2_setup and recv_v2_setup.
+type SyncFlag uint32
+
+const (
+	SyncFlagNone   SyncFlag = 0
+	SyncFlagBrotli SyncFlag = 1
+	SyncFlagLZ4    SyncFlag = 2
+	SyncFlagZstd   SyncFlag = 4
+	SyncFlagDryRun SyncFlag = 0x80000000
+)
+
+// CompressionType selects the compression used by SND2/RCV2 transfers.
+type CompressionType int
+
+const (
+	// CompressionAny picks the best algorithm the device supports.
+	CompressionAny CompressionType = iota
+	CompressionNone
+	CompressionBrotli
+	CompressionLZ4
+	CompressionZstd
+)
+
+func (c CompressionType) String() string {
+	switch c {
+	case CompressionAny:
+		return "any"
+	case CompressionNone:
+		return "none"
+	case CompressionBrotli:
+		return "brotli"
+	case CompressionLZ4:
+		return "lz4"
+	case CompressionZstd:
+		return "zstd"
+	default:
+		return fmt.Sprintf("CompressionType(%d)", int(c))
+	}
+}
+
+func (c CompressionType) flag() SyncFlag {
+	switch c {
+	case CompressionBrotli:
+		return SyncFlagBrotli
+	case CompressionLZ4:
+		return SyncFlagLZ4
+	case CompressionZstd:
+		return SyncFlagZstd
+	default:
+		return SyncFlagNone
+	}
+}
+
+// resolveCompression returns c if supported holds its flag, and the preferred supported
+// algorithm for CompressionAny. Anything the device can't handle falls back to CompressionNone.
+func resolveCompression(c CompressionType, supported SyncFlag) CompressionType {
+	if c == CompressionAny {
+		// Same order as the official client: zstd is fast and compresses well,
+		// lz4 is the cheapest, brotli compresses best but is slow.
+		for _, candidate := range []CompressionType{CompressionZstd, CompressionLZ4, CompressionBrotli} {
+			if supported&candidate.flag() != 0 {
+				return candidate
+			}
+		}
+		return CompressionNone
+	}
+	if f := c.flag(); f == SyncFlagNone || supported&f == 0 {
+		return CompressionNone
+	}
+	return c
+}
+
+// newSyncEncoder wraps w with an encoder for c, or returns nil if c is CompressionNone.
+// Closing the encoder flushes the end of the compressed stream but doesn't close w.
+func newSyncEncoder(c CompressionType, w io.Writer) (io.WriteCloser, error) {
+	switch c {
+	case CompressionBrotli:
+		return brotli.NewWriterLevel(w, brotli.DefaultCompression), nil
+	case CompressionLZ4:
+		return lz4.NewWriter(w), nil
+	case CompressionZstd:
+		return zstd.NewWriter(w)
+	default:
+		return nil, nil
+	}
+}
+
+// newSyncDecoder wraps r with a decoder for c, or returns nil if c is CompressionNone.
+func newSyncDecoder(c CompressionType, r io.Reader) (io.Reader, error) {
+	switch c {
+	case CompressionBrotli:
+		return brotli.NewReader(r), nil
+	case CompressionLZ4:
+		return lz4.NewReader(r), nil
+	case CompressionZstd:
+		d, err := zstd.NewReader(r, zstd.WithDecoderConcurrency(1))
+		if err != nil {
+			return nil, err
+		}
+		return zstdReadCloser{d}, nil
+	default:
+		return nil, nil
+	}
+}
+
+// zstdReadCloser adapts zstd.Decoder, whose Close has no return value.
+type zstdReadCloser struct {
+	*zstd.Decoder
+}
+
+func (z zstdReadCloser) Close() error {
+	z.Decoder.Close()
+	return nil
+}
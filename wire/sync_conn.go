@@ -24,13 +24,27 @@ const (
 	ID_DENT_V1 = "DENT"
 	ID_DENT_V2 = "DNT2"
 
-	ID_SEND = "SEND"
-	ID_RECV = "RECV"
-	ID_DONE = "DONE"
-	ID_DATA = "DATA"
-	ID_OKAY = "OKAY"
-	ID_FAIL = "FAIL"
-	ID_QUIT = "QUIT"
+	ID_SEND    = "SEND"
+	ID_RECV    = "RECV"
+	ID_SEND_V2 = "SND2"
+	ID_RECV_V2 = "RCV2"
+	ID_DONE    = "DONE"
+	ID_DATA    = "DATA"
+	ID_OKAY    = "OKAY"
+	ID_FAIL    = "FAIL"
+	ID_QUIT    = "QUIT"
+)
+
+// Names of the device features that enable optional parts of the sync protocol.
+// They mirror the Feature* constants of the adb package.
+const (
+	featureStat2           = "stat_v2"
+	featureLs2             = "ls_v2"
+	featureSendRecv2       = "sendrecv_v2"
+	featureSendRecv2Brotli = "sendrecv_v2_brotli"
+	featureSendRecv2LZ4    = "sendrecv_v2_lz4"
+	featureSendRecv2Zstd   = "sendrecv_v2_zstd"
+	featureSendRecv2DryRun = "sendrecv_v2_dry_run_send"
 )
 
 var (
@@ -50,10 +64,67 @@ type SyncConn struct {
 	net.Conn
 	rbuf []byte
 	wbuf []byte
+
+	// stat2 and ls2 select STA2/LST2 and LIS2/DNT2 instead of the v1 requests.
+	stat2 bool
+	ls2   bool
+
+	// sendrecv2 selects SND2/RCV2 instead of SEND/RECV, supported holds the
+	// SyncFlags the device accepts with them.
+	sendrecv2   bool
+	supported   SyncFlag
+	compression CompressionType
+	dryRun      bool
 }
 
 func NewSyncConn(r net.Conn) *SyncConn {
-	return &SyncConn{r, make([]byte, 8), make([]byte, 8)}
+	return &SyncConn{Conn: r, rbuf: make([]byte, 8), wbuf: make([]byte, 8)}
+}
+
+// NewSyncConnWithFeatures returns a SyncConn that uses the v2 variants of the sync
+// requests advertised in features, as returned by `host-serial:<serial>:features`.
+func NewSyncConnWithFeatures(r net.Conn, features map[string]bool) *SyncConn {
+	s := NewSyncConn(r)
+	s.stat2 = features[featureStat2]
+	s.ls2 = features[featureLs2]
+	s.sendrecv2 = features[featureSendRecv2]
+	if s.sendrecv2 {
+		if features[featureSendRecv2Brotli] {
+			s.supported |= SyncFlagBrotli
+		}
+		if features[featureSendRecv2LZ4] {
+			s.supported |= SyncFlagLZ4
+		}
+		if features[featureSendRecv2Zstd] {
+			s.supported |= SyncFlagZstd
+		}
+		if features[featureSendRecv2DryRun] {
+			s.supported |= SyncFlagDryRun
+		}
+	}
+	s.compression = resolveCompression(CompressionAny, s.supported)
+	return s
+}
+
+// SetCompression selects the compression of following Send and Recv calls.
+// Algorithms the device doesn't support fall back to CompressionNone.
+func (s *SyncConn) SetCompression(c CompressionType) {
+	s.compression = resolveCompression(c, s.supported)
+}
+
+// Compression returns the compression used by Send and Recv.
+func (s *SyncConn) Compression() CompressionType {
+	return s.compression
+}
+
+// SetDryRun makes following Send calls transfer the data without writing it on the device,
+// which is useful to measure throughput. Requires the sendrecv_v2_dry_run_send feature.
+func (s *SyncConn) SetDryRun(dryRun bool) error {
+	if dryRun && s.supported&SyncFlagDryRun == 0 {
+		return fmt.Errorf("%w: device doesn't support %s", ErrAssertion, featureSendRecv2DryRun)
+	}
+	s.dryRun = dryRun
+	return nil
 }
 
 // ReadStatus reads a 4-byte status string and returns it.
@@ -101,10 +172,10 @@ func unpackLstatV1(rbuf []byte) (d *DirEntry, err error) {
 	}
 	mode_ := binary.LittleEndian.Uint32(rbuf[4:8])
 	mode := ParseFileModeFromAdb(mode_)
-	size := int32(binary.LittleEndian.Uint32(rbuf[8:12]))
+	size := int64(binary.LittleEndian.Uint32(rbuf[8:12]))
 	mtime_ := int32(binary.LittleEndian.Uint32(rbuf[12:16]))
 	mtime := time.Unix(int64(mtime_), 0).UTC()
-	// adb doesn't indicate when a file doesn't exist, but will return all zeros.
+	// stat v1 doesn't indicate when a file doesn't exist, but will return all zeros.
 	// Theoretically this could be an actual file, but that's very unlikely.
 	if mode == os.FileMode(0) && size == 0 && mtime == zeroTime {
 		err = fmt.Errorf("%w: file doesn't exist", ErrFileNoExist)
@@ -124,6 +195,57 @@ func (conn *SyncConn) finishLstatV1() (d *DirEntry, err error) {
 	return unpackLstatV1(rbuf[:])
 }
 
+//	struct __attribute__((packed)) {
+//		uint32_t id;
+//		uint32_t error;
+//		uint64_t dev;
+//		uint64_t ino;
+//		uint32_t mode;
+//		uint32_t nlink;
+//		uint32_t uid;
+//		uint32_t gid;
+//		uint64_t size;
+//		int64_t atime;
+//		int64_t mtime;
+//		int64_t ctime;
+//	} stat_v2;
+const statV2Size = 72
+
+// unpackStatV2 decodes the fields shared by stat_v2 and dent_v2, which start with the same layout.
+func unpackStatV2(rbuf []byte) (d *DirEntry, errno Errno) {
+	errno = Errno(binary.LittleEndian.Uint32(rbuf[4:8]))
+	d = &DirEntry{
+		Dev:        binary.LittleEndian.Uint64(rbuf[8:16]),
+		Inode:      binary.LittleEndian.Uint64(rbuf[16:24]),
+		Mode:       ParseFileModeFromAdb(binary.LittleEndian.Uint32(rbuf[24:28])),
+		Nlink:      binary.LittleEndian.Uint32(rbuf[28:32]),
+		Uid:        binary.LittleEndian.Uint32(rbuf[32:36]),
+		Gid:        binary.LittleEndian.Uint32(rbuf[36:40]),
+		Size:       int64(binary.LittleEndian.Uint64(rbuf[40:48])),
+		AccessedAt: time.Unix(int64(binary.LittleEndian.Uint64(rbuf[48:56])), 0).UTC(),
+		ModifiedAt: time.Unix(int64(binary.LittleEndian.Uint64(rbuf[56:64])), 0).UTC(),
+		ChangedAt:  time.Unix(int64(binary.LittleEndian.Uint64(rbuf[64:72])), 0).UTC(),
+	}
+	return
+}
+
+func (conn *SyncConn) finishStatV2(id string) (d *DirEntry, err error) {
+	var rbuf [statV2Size]byte
+	_, err = io.ReadFull(conn, rbuf[:])
+	if err != nil {
+		return nil, err
+	}
+	if string(rbuf[:4]) != id {
+		return nil, fmt.Errorf("%w: expected stat ID '%s', but got '%s'", ErrAssertion, id, rbuf[:4])
+	}
+
+	d, errno := unpackStatV2(rbuf[:])
+	if errno != 0 {
+		return nil, fmt.Errorf("stat failed: %w", errno)
+	}
+	return d, nil
+}
+
 //	struct __attribute__((packed)) {
 //		uint32_t id;
 //		uint32_t mode;
@@ -142,7 +264,7 @@ func (s *SyncConn) readDentV1() (entry *DirEntry, done bool, err error) {
 	id := string(buf[:4])
 	mode_ := binary.LittleEndian.Uint32(buf[4:8])
 	mode := ParseFileModeFromAdb(mode_)
-	size := int32(binary.LittleEndian.Uint32(buf[8:12]))
+	size := int64(binary.LittleEndian.Uint32(buf[8:12]))
 	mtime_ := int32(binary.LittleEndian.Uint32(buf[12:16]))
 	mtime := time.Unix(int64(mtime_), 0).UTC()
 	namelen := binary.LittleEndian.Uint32(buf[16:20])
@@ -173,7 +295,73 @@ func (s *SyncConn) readDentV1() (entry *DirEntry, done bool, err error) {
 	return
 }
 
+//	struct __attribute__((packed)) {
+//		uint32_t id;
+//		uint32_t error;
+//		uint64_t dev;
+//		uint64_t ino;
+//		uint32_t mode;
+//		uint32_t nlink;
+//		uint32_t uid;
+//		uint32_t gid;
+//		uint64_t size;
+//		int64_t atime;
+//		int64_t mtime;
+//		int64_t ctime;
+//		uint32_t namelen;
+//	} dent_v2; // followed by `namelen` bytes of the name.
+func (s *SyncConn) readDentV2() (entry *DirEntry, done bool, err error) {
+	var buf [statV2Size + 4]byte
+	_, err = io.ReadFull(s.Conn, buf[:])
+	if err != nil {
+		err = fmt.Errorf("read dir entry header failed: %w", err)
+		return
+	}
+
+	id := string(buf[:4])
+	namelen := binary.LittleEndian.Uint32(buf[statV2Size:])
+
+	var name []byte
+	if namelen > 0 {
+		name = make([]byte, namelen)
+		if _, err = io.ReadFull(s, name); err != nil {
+			err = fmt.Errorf("read dir entry name failed: %w", err)
+			return
+		}
+	}
+
+	if id == ID_DONE {
+		done = true
+		return
+	} else if id != ID_DENT_V2 {
+		err = fmt.Errorf("error reading dir entries: expected dir entry ID 'DNT2', but got '%s'", id)
+		return
+	}
+
+	// A non-zero error means adbd couldn't lstat the entry; the name is still valid.
+	var errno Errno
+	entry, errno = unpackStatV2(buf[:])
+	entry.Name = string(name)
+	entry.Errno = errno
+	return
+}
+
+func (s *SyncConn) readDent() (entry *DirEntry, done bool, err error) {
+	if s.ls2 {
+		return s.readDentV2()
+	}
+	return s.readDentV1()
+}
+
+// Stat returns the lstat of path, using LST2 when the device supports stat_v2.
 func (s *SyncConn) Stat(path string) (*DirEntry, error) {
+	if s.stat2 {
+		if err := s.SendRequest([]byte(ID_LSTAT_V2), []byte(path)); err != nil {
+			return nil, err
+		}
+		return s.finishStatV2(ID_LSTAT_V2)
+	}
+
 	if err := s.SendRequest([]byte(ID_LSTAT_V1), []byte(path)); err != nil {
 		return nil, err
 	}
@@ -196,17 +384,45 @@ func (s *SyncConn) SendList(path string) (dr *SyncDirReader, err error) {
 		}
 	*/
 
-	if err = s.SendRequest([]byte(ID_LIST_V1), []byte(path)); err != nil {
+	id := ID_LIST_V1
+	if s.ls2 {
+		id = ID_LIST_V2
+	}
+	if err = s.SendRequest([]byte(id), []byte(path)); err != nil {
 		return
 	}
 	return &SyncDirReader{syncConn: s}, nil
 }
 
 func (s *SyncConn) Recv(path string) (*SyncFileReader, error) {
-	if err := s.SendRequest([]byte(ID_RECV), []byte(path)); err != nil {
+	if !s.sendrecv2 {
+		if err := s.SendRequest([]byte(ID_RECV), []byte(path)); err != nil {
+			return nil, err
+		}
+		return newSyncFileReader(s), nil
+	}
+
+	//	struct __attribute__((packed)) {
+	//		uint32_t id;
+	//		uint32_t flags;
+	//	} recv_v2_setup; // sent after the RCV2 request.
+	if err := s.SendRequest([]byte(ID_RECV_V2), []byte(path)); err != nil {
+		return nil, err
+	}
+	var setup [8]byte
+	copy(setup[:4], ID_RECV_V2)
+	binary.LittleEndian.PutUint32(setup[4:8], uint32(s.compression.flag()))
+	if _, err := s.Write(setup[:]); err != nil {
+		return nil, fmt.Errorf("error send bytes: %w", err)
+	}
+
+	r := newSyncFileReader(s)
+	dec, err := newSyncDecoder(s.compression, syncChunkReader{r})
+	if err != nil {
 		return nil, err
 	}
-	return newSyncFileReader(s), nil
+	r.dec = dec
+	return r, nil
 }
 
 // Send returns a WriteCloser than will write to the file at path on device.
@@ -214,6 +430,10 @@ func (s *SyncConn) Recv(path string) (*SyncFileReader, error) {
 // The file's modified time will be set to mtime, unless mtime is 0, in which case the time the writer is
 // closed will be used.
 func (s *SyncConn) Send(path string, mode os.FileMode, mtime time.Time) (*SyncFileWriter, error) {
+	if s.sendrecv2 {
+		return s.sendV2(path, mode, mtime)
+	}
+
 	// encodes a path and file mode as required for starting a send file stream.
 	// From https://android.googlesource.com/platform/system/core/+/master/adb/SYNC.TXT:
 	//	The remote file name is split into two parts separated by the last
@@ -227,6 +447,37 @@ func (s *SyncConn) Send(path string, mode os.FileMode, mtime time.Time) (*SyncFi
 	return newSyncFileWriter(s, mtime), nil
 }
 
+//	struct __attribute__((packed)) {
+//		uint32_t id;
+//		uint32_t mode;
+//		uint32_t flags;
+//	} send_v2_setup; // sent after the SND2 request, whose path has no ",mode" suffix.
+func (s *SyncConn) sendV2(path string, mode os.FileMode, mtime time.Time) (*SyncFileWriter, error) {
+	if err := s.SendRequest([]byte(ID_SEND_V2), []byte(path)); err != nil {
+		return nil, err
+	}
+
+	flags := s.compression.flag()
+	if s.dryRun {
+		flags |= SyncFlagDryRun
+	}
+	var setup [12]byte
+	copy(setup[:4], ID_SEND_V2)
+	binary.LittleEndian.PutUint32(setup[4:8], uint32(mode.Perm()))
+	binary.LittleEndian.PutUint32(setup[8:12], uint32(flags))
+	if _, err := s.Write(setup[:]); err != nil {
+		return nil, fmt.Errorf("error send bytes: %w", err)
+	}
+
+	w := newSyncFileWriter(s, mtime)
+	enc, err := newSyncEncoder(s.compression, syncChunkWriter{w})
+	if err != nil {
+		return nil, err
+	}
+	w.enc = enc
+	return w, nil
+}
+
 // ReadNextChunkSize read the 4-bytes length of next chunk of data,
 // returns io.EOF if the last chunk has been read.
 //
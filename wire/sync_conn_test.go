@@ -4,6 +4,7 @@ import (
 	"bytes"
 	"encoding/binary"
 	"errors"
+	"io"
 	"math"
 	"os"
 	"testing"
@@ -40,7 +41,7 @@ func TestStatValid(t *testing.T) {
 	assert.NoError(t, err)
 	require.NotNil(t, entry)
 	assert.Equal(t, mode, entry.Mode, "expected os.FileMode %s, got %s", mode, entry.Mode)
-	assert.Equal(t, int32(4), entry.Size)
+	assert.Equal(t, int64(4), entry.Size)
 	assert.Equal(t, someTime, entry.ModifiedAt)
 	assert.Equal(t, "", entry.Name)
 }
@@ -112,3 +113,102 @@ func TestMath(t *testing.T) {
 	a := int(math.Ceil(0))
 	assert.Equal(t, a, 0)
 }
+
+func packStatV2(id string, errno uint32, mode uint32, size uint64, mtime time.Time) []byte {
+	var b bytes.Buffer
+	b.Write([]byte(id))
+	binary.Write(&b, binary.LittleEndian, errno)
+	binary.Write(&b, binary.LittleEndian, uint64(66))   // dev
+	binary.Write(&b, binary.LittleEndian, uint64(1234)) // ino
+	binary.Write(&b, binary.LittleEndian, mode)
+	binary.Write(&b, binary.LittleEndian, uint32(1))    // nlink
+	binary.Write(&b, binary.LittleEndian, uint32(2000)) // uid
+	binary.Write(&b, binary.LittleEndian, uint32(1015)) // gid
+	binary.Write(&b, binary.LittleEndian, size)
+	binary.Write(&b, binary.LittleEndian, mtime.Unix()) // atime
+	binary.Write(&b, binary.LittleEndian, mtime.Unix())
+	binary.Write(&b, binary.LittleEndian, mtime.Unix()) // ctime
+	return b.Bytes()
+}
+
+func TestStatV2Valid(t *testing.T) {
+	var buf bytes.Buffer
+	conn := NewSyncConnWithFeatures(makeMockConn2(
+		string(packStatV2(ID_LSTAT_V2, 0, 0100644, 5<<30, someTime)), &buf),
+		map[string]bool{"stat_v2": true})
+
+	entry, err := conn.Stat("/sdcard/big.bin")
+	assert.NoError(t, err)
+	require.NotNil(t, entry)
+	assert.Equal(t, "LST2\x0f\x00\x00\x00/sdcard/big.bin", buf.String())
+	assert.Equal(t, os.FileMode(0644), entry.Mode)
+	assert.Equal(t, int64(5<<30), entry.Size)
+	assert.Equal(t, uint64(1234), entry.Inode)
+	assert.Equal(t, uint32(2000), entry.Uid)
+	assert.Equal(t, uint32(1015), entry.Gid)
+	assert.Equal(t, someTime, entry.ModifiedAt)
+	assert.Equal(t, someTime, entry.ChangedAt)
+}
+
+func TestStatV2NoExist(t *testing.T) {
+	var buf bytes.Buffer
+	conn := NewSyncConnWithFeatures(makeMockConn2(
+		string(packStatV2(ID_LSTAT_V2, uint32(ENOENT), 0, 0, time.Unix(0, 0))), &buf),
+		map[string]bool{"stat_v2": true})
+
+	entry, err := conn.Stat("/nonexistent")
+	assert.Nil(t, entry)
+	assert.ErrorIs(t, err, ErrFileNoExist)
+	assert.ErrorIs(t, err, ENOENT)
+}
+
+func TestStatV2PermissionDenied(t *testing.T) {
+	var buf bytes.Buffer
+	conn := NewSyncConnWithFeatures(makeMockConn2(
+		string(packStatV2(ID_LSTAT_V2, uint32(EACCES), 0, 0, time.Unix(0, 0))), &buf),
+		map[string]bool{"stat_v2": true})
+
+	_, err := conn.Stat("/data/data")
+	assert.ErrorIs(t, err, EACCES)
+	assert.False(t, errors.Is(err, ErrFileNoExist))
+}
+
+func TestReadDirV2(t *testing.T) {
+	var resp bytes.Buffer
+	resp.Write(packStatV2(ID_DENT_V2, 0, 0100644, 3<<31, someTime))
+	binary.Write(&resp, binary.LittleEndian, uint32(3))
+	resp.WriteString("foo")
+	resp.Write(packStatV2(ID_DONE, 0, 0, 0, time.Unix(0, 0)))
+	binary.Write(&resp, binary.LittleEndian, uint32(0))
+
+	conn := NewSyncConnWithFeatures(makeMockConnBytes(resp.Bytes()), map[string]bool{"ls_v2": true})
+	dr := &SyncDirReader{syncConn: conn}
+	entries, err := dr.ReadDir(-1)
+	assert.Equal(t, io.EOF, err)
+	require.Len(t, entries, 1)
+	assert.Equal(t, "foo", entries[0].Name)
+	assert.Equal(t, int64(3<<31), entries[0].Size)
+	assert.Equal(t, someTime, entries[0].ModifiedAt)
+}
+
+func TestReadDirV2_Errno(t *testing.T) {
+	var resp bytes.Buffer
+	resp.Write(packStatV2(ID_DENT_V2, uint32(EACCES), 0, 0, time.Unix(0, 0)))
+	binary.Write(&resp, binary.LittleEndian, uint32(6))
+	resp.WriteString("secret")
+	resp.Write(packStatV2(ID_DENT_V2, 0, 0100644, 3, someTime))
+	binary.Write(&resp, binary.LittleEndian, uint32(3))
+	resp.WriteString("foo")
+	resp.Write(packStatV2(ID_DONE, 0, 0, 0, time.Unix(0, 0)))
+	binary.Write(&resp, binary.LittleEndian, uint32(0))
+
+	conn := NewSyncConnWithFeatures(makeMockConnBytes(resp.Bytes()), map[string]bool{"ls_v2": true})
+	dr := &SyncDirReader{syncConn: conn}
+	entries, err := dr.ReadDir(-1)
+	assert.Equal(t, io.EOF, err)
+	require.Len(t, entries, 2)
+	assert.Equal(t, "secret", entries[0].Name)
+	assert.Equal(t, EACCES, entries[0].Errno)
+	assert.Equal(t, "foo", entries[1].Name)
+	assert.Zero(t, entries[1].Errno)
+}
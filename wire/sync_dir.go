@@ -8,11 +8,25 @@ import (
 )
 
 // DirEntry holds information about a directory entry on a device.
+// Fields other than Name, Mode, Size and ModifiedAt are only filled in when the
+// device speaks the v2 sync protocol (stat_v2/ls_v2 features).
 type DirEntry struct {
 	Name       string
 	Mode       os.FileMode
-	Size       int32
+	Size       int64
 	ModifiedAt time.Time
+
+	Dev        uint64
+	Inode      uint64
+	Nlink      uint32
+	Uid        uint32
+	Gid        uint32
+	AccessedAt time.Time
+	ChangedAt  time.Time
+
+	// Errno is set when adbd listed the entry but couldn't lstat it, with the v2 protocol
+	// only. The other fields but Name are zero then.
+	Errno Errno
 }
 
 func (entry DirEntry) String() string {
@@ -36,7 +50,7 @@ func (dr *SyncDirReader) ReadDir(n int) (entries []*DirEntry, err error) {
 
 	// to iterator when n = -1, just cast it to uint32 in loop
 	for i := uint32(0); i < uint32(n); i++ {
-		entry, done, err2 := dr.syncConn.readDentV1()
+		entry, done, err2 := dr.syncConn.readDent()
 		if err2 != nil {
 			err = err2
 			return
@@ -12,9 +12,14 @@ type SyncFileReader struct {
 	syncConn *SyncConn
 	toRead   int
 	eof      bool
+	// done is set once Read returned io.EOF or the reader is closed.
+	done bool
+
+	// dec decompresses the chunks of a RCV2 transfer, nil for uncompressed transfers.
+	dec io.Reader
 }
 
-var _ io.Reader = &SyncFileReader{}
+var _ io.ReadCloser = &SyncFileReader{}
 
 func newSyncFileReader(s *SyncConn) (r *SyncFileReader) {
 	r = &SyncFileReader{
@@ -24,6 +29,45 @@ func newSyncFileReader(s *SyncConn) (r *SyncFileReader) {
 }
 
 func (r *SyncFileReader) Read(buf []byte) (n int, err error) {
+	if r.done {
+		return 0, io.EOF
+	}
+	if r.dec == nil {
+		n, err = r.readChunk(buf)
+		r.done = err == io.EOF
+		return
+	}
+
+	n, err = r.dec.Read(buf)
+	if err == io.EOF {
+		r.done = true
+		// The decoder stops at the end of the compressed stream, the DONE chunk is still unread.
+		_, err2 := io.Copy(io.Discard, syncChunkReader{r})
+		r.closeDecoder()
+		if err2 != nil {
+			return n, err2
+		}
+	}
+	return
+}
+
+// Close releases the decoder of a compressed transfer, the connection stays open. Read
+// returns io.EOF afterwards.
+func (r *SyncFileReader) Close() error {
+	r.done = true
+	r.closeDecoder()
+	return nil
+}
+
+func (r *SyncFileReader) closeDecoder() {
+	if c, ok := r.dec.(io.Closer); ok {
+		c.Close()
+	}
+	r.dec = nil
+}
+
+// readChunk reads the raw content of DATA chunks until the DONE chunk.
+func (r *SyncFileReader) readChunk(buf []byte) (n int, err error) {
 	if r.eof {
 		return 0, io.EOF
 	}
@@ -52,6 +96,15 @@ func (r *SyncFileReader) Read(buf []byte) (n int, err error) {
 	return
 }
 
+// syncChunkReader reads the raw chunk content of a SyncFileReader, feeding its decoder.
+type syncChunkReader struct {
+	r *SyncFileReader
+}
+
+func (c syncChunkReader) Read(buf []byte) (int, error) {
+	return c.r.readChunk(buf)
+}
+
 // SyncFileWriter wraps a SyncConn that has requested to send a file.
 type SyncFileWriter struct {
 	// The modification time to write in the footer.
@@ -60,6 +113,9 @@ type SyncFileWriter struct {
 
 	// Reader used to read data from the adb connection.
 	syncConn *SyncConn
+
+	// enc compresses the data of a SND2 transfer, nil for uncompressed transfers.
+	enc io.WriteCloser
 }
 
 var _ io.Writer = &SyncFileWriter{}
@@ -71,8 +127,16 @@ func newSyncFileWriter(s *SyncConn, mtime time.Time) *SyncFileWriter {
 	}
 }
 
-// Write writes the min of (len(buf), 64k).
+// Write sends buf to the device, compressing it first if the transfer is compressed.
 func (w *SyncFileWriter) Write(buf []byte) (n int, err error) {
+	if w.enc != nil {
+		return w.enc.Write(buf)
+	}
+	return w.writeChunks(buf)
+}
+
+// writeChunks sends buf as DATA chunks of at most 64k.
+func (w *SyncFileWriter) writeChunks(buf []byte) (n int, err error) {
 	written := 0
 
 	// If buf > 64k we'll have to send multiple chunks.
@@ -96,7 +160,23 @@ func (w *SyncFileWriter) Write(buf []byte) (n int, err error) {
 	return written, nil
 }
 
+// syncChunkWriter sends the output of a SyncFileWriter's encoder as DATA chunks.
+type syncChunkWriter struct {
+	w *SyncFileWriter
+}
+
+func (c syncChunkWriter) Write(buf []byte) (int, error) {
+	return c.w.writeChunks(buf)
+}
+
 func (w *SyncFileWriter) CopyDone() error {
+	if w.enc != nil {
+		// Flush the end of the compressed stream before DONE.
+		if err := w.enc.Close(); err != nil {
+			return fmt.Errorf("error flushing compressed stream: %w", err)
+		}
+	}
+
 	if w.mtime.IsZero() {
 		w.mtime = time.Now()
 	}
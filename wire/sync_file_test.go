@@ -210,3 +210,101 @@ func TestFileWriterCloseAutoMtime(t *testing.T) {
 	// Delta has to be a whole second since adb only supports second granularity for mtimes.
 	assert.WithinDuration(t, time.Now(), mtimeActual, 1*time.Second)
 }
+
+////////////////////////////////////////////////////////////////////
+// sendrecv v2
+
+var sendRecv2Features = map[string]bool{
+	"sendrecv_v2":              true,
+	"sendrecv_v2_brotli":       true,
+	"sendrecv_v2_lz4":          true,
+	"sendrecv_v2_zstd":         true,
+	"sendrecv_v2_dry_run_send": true,
+}
+
+func TestSendV2Setup(t *testing.T) {
+	var buf bytes.Buffer
+	syncConn := NewSyncConnWithFeatures(makeMockConn2("OKAY\x00\x00\x00\x00", &buf),
+		map[string]bool{"sendrecv_v2": true})
+	assert.Equal(t, CompressionNone, syncConn.Compression())
+	assert.Error(t, syncConn.SetDryRun(true))
+
+	writer, err := syncConn.Send("/a", 0644, time.Unix(1, 0))
+	assert.NoError(t, err)
+	writer.Write([]byte("hello"))
+	assert.NoError(t, writer.CopyDone())
+	assert.Equal(t, "SND2\x02\x00\x00\x00/aSND2\xa4\x01\x00\x00\x00\x00\x00\x00"+
+		"DATA\005\000\000\000helloDONE\x01\x00\x00\x00", buf.String())
+}
+
+func TestSendV2DryRunFlag(t *testing.T) {
+	var buf bytes.Buffer
+	syncConn := NewSyncConnWithFeatures(makeMockConn2("OKAY\x00\x00\x00\x00", &buf), sendRecv2Features)
+	syncConn.SetCompression(CompressionNone)
+	assert.NoError(t, syncConn.SetDryRun(true))
+
+	_, err := syncConn.Send("/a", 0644, time.Unix(1, 0))
+	assert.NoError(t, err)
+	assert.Equal(t, "SND2\x02\x00\x00\x00/aSND2\xa4\x01\x00\x00\x00\x00\x00\x80", buf.String())
+}
+
+func TestResolveCompression(t *testing.T) {
+	assert.Equal(t, CompressionZstd, resolveCompression(CompressionAny, SyncFlagBrotli|SyncFlagLZ4|SyncFlagZstd))
+	assert.Equal(t, CompressionLZ4, resolveCompression(CompressionAny, SyncFlagBrotli|SyncFlagLZ4))
+	assert.Equal(t, CompressionNone, resolveCompression(CompressionAny, SyncFlagNone))
+	assert.Equal(t, CompressionBrotli, resolveCompression(CompressionBrotli, SyncFlagBrotli|SyncFlagZstd))
+	assert.Equal(t, CompressionNone, resolveCompression(CompressionLZ4, SyncFlagBrotli))
+}
+
+// TestSendRecvV2Compressed pushes a file with each algorithm and feeds the DATA chunks
+// that were sent back to Recv, which must restore the original content.
+func TestSendRecvV2Compressed(t *testing.T) {
+	data := bytes.Repeat([]byte("goadb sendrecv_v2 "), 10000)
+	for _, c := range []CompressionType{CompressionBrotli, CompressionLZ4, CompressionZstd} {
+		t.Run(c.String(), func(t *testing.T) {
+			var sent bytes.Buffer
+			sender := NewSyncConnWithFeatures(makeMockConn2("OKAY\x00\x00\x00\x00", &sent), sendRecv2Features)
+			sender.SetCompression(c)
+			writer, err := sender.Send("/a", 0644, time.Unix(1, 0))
+			assert.NoError(t, err)
+			_, err = writer.Write(data)
+			assert.NoError(t, err)
+			assert.NoError(t, writer.CopyDone())
+
+			// Strip the request and setup, keep the chunks and replace the DONE mtime.
+			chunks := sent.Bytes()[8+2+12:]
+			assert.Less(t, len(chunks), len(data)/10)
+			chunks = append(chunks[:len(chunks)-8], "DONE\x00\x00\x00\x00"...)
+
+			var req bytes.Buffer
+			receiver := NewSyncConnWithFeatures(makeMockConn2(string(chunks), &req), sendRecv2Features)
+			receiver.SetCompression(c)
+			reader, err := receiver.Recv("/a")
+			assert.NoError(t, err)
+			got, err := io.ReadAll(reader)
+			assert.NoError(t, err)
+			assert.Equal(t, data, got)
+			// The decoder is closed, reads keep returning EOF.
+			n, err := reader.Read(make([]byte, 16))
+			assert.Zero(t, n)
+			assert.Equal(t, io.EOF, err)
+			assert.NoError(t, reader.Close())
+
+			flag := make([]byte, 4)
+			binary.LittleEndian.PutUint32(flag, uint32(c.flag()))
+			assert.Equal(t, "RCV2\x02\x00\x00\x00/aRCV2"+string(flag), req.String())
+
+			// A reader closed before the end releases its decoder.
+			receiver = NewSyncConnWithFeatures(makeMockConn2(string(chunks), &req), sendRecv2Features)
+			receiver.SetCompression(c)
+			reader, err = receiver.Recv("/a")
+			assert.NoError(t, err)
+			_, err = io.ReadFull(reader, make([]byte, 100))
+			assert.NoError(t, err)
+			assert.NoError(t, reader.Close())
+			n, err = reader.Read(make([]byte, 16))
+			assert.Zero(t, n)
+			assert.Equal(t, io.EOF, err)
+		})
+	}
+}
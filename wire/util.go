@@ -14,6 +14,38 @@ type ErrorResponseDetails struct {
 	ServerMsg string
 }
 
+// ServerError is a FAIL message of the server, classified into one of the sentinel errors.
+// errors.Is matches it against its Kind and ErrAdb.
+type ServerError struct {
+	ErrorResponseDetails
+	// Kind is ErrDeviceNotFound, ErrDeviceUnauthorized, ... or ErrAdb if the message isn't known.
+	Kind error
+}
+
+// NewServerError classifies serverMsg, the FAIL message of the server for request.
+func NewServerError(request string, serverMsg string) *ServerError {
+	err := &ServerError{ErrorResponseDetails{request, serverMsg}, ErrAdb}
+	for _, p := range serverErrorPatterns {
+		if p.pattern.MatchString(serverMsg) {
+			err.Kind = p.kind
+			break
+		}
+	}
+	return err
+}
+
+func (e *ServerError) Error() string {
+	return fmt.Sprintf("%v: request %s, server error: %s", e.Kind, e.Request, e.ServerMsg)
+}
+
+func (e *ServerError) Unwrap() error {
+	return e.Kind
+}
+
+func (e *ServerError) Is(target error) bool {
+	return target == ErrAdb
+}
+
 // deviceNotFoundMessagePattern matches all possible error messages returned by adb servers to
 // report that a matching device was not found. Used to set the DeviceNotFound error code on
 // error values.
@@ -21,11 +53,30 @@ type ErrorResponseDetails struct {
 // Old servers send "device not found", and newer ones "device 'serial' not found".
 var deviceNotFoundMessagePattern = regexp.MustCompile(`device( '.*')? not found`)
 
+// serverErrorPatterns match the messages of adb's transport.cpp and adb_listeners.cpp,
+// across server versions. The first match wins.
+var serverErrorPatterns = []struct {
+	pattern *regexp.Regexp
+	kind    error
+}{
+	// "device unauthorized.\nThis adb server's $ADB_VENDOR_KEYS is not set..."
+	{regexp.MustCompile(`device unauthorized`), ErrDeviceUnauthorized},
+	{regexp.MustCompile(`device still authorizing`), ErrDeviceAuthorizing},
+	// "device offline", "device offline (no transport)", "device offline (transport disconnected)"
+	{regexp.MustCompile(`device offline`), ErrDeviceOffline},
+	// "more than one device/emulator", or "more than one device" with -d and "more than one emulator" with -e
+	{regexp.MustCompile(`more than one (device|emulator)`), ErrMoreThanOneDevice},
+	{deviceNotFoundMessagePattern, ErrDeviceNotFound},
+	{regexp.MustCompile(`no (devices|emulators|devices/emulators) found|no device with transport id`), ErrDeviceNotFound},
+	{regexp.MustCompile(`^closed$`), ErrClosed},
+	// "protocol fault (couldn't read status): ..."
+	{regexp.MustCompile(`^protocol fault`), ErrProtocolFault},
+	// "cannot bind listener: Address already in use", "cannot rebind existing socket"
+	{regexp.MustCompile(`^cannot (re)?bind`), ErrCannotBind},
+}
+
 func adbServerError(request string, serverMsg string) error {
-	if deviceNotFoundMessagePattern.MatchString(serverMsg) {
-		return fmt.Errorf("%w: request %s, server error: %s", ErrDeviceNotFound, request, serverMsg)
-	}
-	return fmt.Errorf("%w: request %s, server error: %s", ErrAdb, request, serverMsg)
+	return NewServerError(request, serverMsg)
 }
 
 func errIncompleteMessage(description string, actual int, expected int) error {
@@ -30,3 +30,33 @@ func TestAdbServerError_DeviceSerialNotFound(t *testing.T) {
 	assert.True(t, errors.Is(err, ErrDeviceNotFound))
 	assert.EqualError(t, err, "DeviceNotFound: request , server error: device 'LGV4801c74eccd' not found")
 }
+
+func TestAdbServerError_Classified(t *testing.T) {
+	for msg, kind := range map[string]error{
+		"device unauthorized.\nThis adb server's $ADB_VENDOR_KEYS is not set": ErrDeviceUnauthorized,
+		"device still authorizing":                       ErrDeviceAuthorizing,
+		"device offline (no transport)":                  ErrDeviceOffline,
+		"more than one device/emulator":                  ErrMoreThanOneDevice,
+		"more than one emulator":                         ErrMoreThanOneDevice,
+		"no devices/emulators found":                     ErrDeviceNotFound,
+		"closed":                                         ErrClosed,
+		"protocol fault (couldn't read status): Success": ErrProtocolFault,
+		"cannot bind listener: Address already in use":   ErrCannotBind,
+		"cannot rebind existing socket":                  ErrCannotBind,
+		"listener 'tcp:6100' not found":                  ErrAdb,
+	} {
+		err := adbServerError("host:transport-any", msg)
+		assert.ErrorIs(t, err, kind, msg)
+		assert.ErrorIs(t, err, ErrAdb, msg)
+
+		var serverErr *ServerError
+		if assert.True(t, errors.As(err, &serverErr), msg) {
+			assert.Equal(t, "host:transport-any", serverErr.Request)
+			assert.Equal(t, msg, serverErr.ServerMsg)
+		}
+	}
+
+	err := adbServerError("", "device offline")
+	assert.NotErrorIs(t, err, ErrDeviceNotFound)
+	assert.EqualError(t, err, "DeviceOffline: request , server error: device offline")
+}